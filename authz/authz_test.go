@@ -0,0 +1,118 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+	"github.com/google/uuid"
+)
+
+// newTestPolicy builds a viewer < editor < admin policy recording audited decisions.
+func newTestPolicy(t *testing.T, audited *[]Decision) *Policy {
+	policy, err := NewPolicy(PolicyOptions{
+		Roles: []RoleDefinition{
+			{Name: "admin", Inherits: []string{"editor"}, Permissions: []string{"users:*"}},
+			{Name: "editor", Inherits: []string{"viewer"}, Permissions: []string{"posts:write"}},
+			{Name: "viewer", Permissions: []string{"*:read"}},
+		},
+		Audit: func(ctx context.Context, decision Decision) { *audited = append(*audited, decision) },
+	})
+	if err != nil {
+		t.Fatalf("NewPolicy failed: %v", err)
+	}
+	return policy
+}
+
+// TestPolicy tests role hierarchies, wildcard permissions, audited denials and invalid definitions.
+func TestPolicy(t *testing.T) {
+	var (
+		audited []Decision
+		policy  *Policy
+		ctx     = context.Background()
+		editor  = &ft_supabase.User{UserID: uuid.New(), Role: "editor"}
+		admin   = &ft_supabase.User{UserID: uuid.New(), Role: "admin"}
+		err     error
+	)
+
+	// setup
+	policy = newTestPolicy(t, &audited)
+
+	// verify: inheritance and wildcards
+	if !policy.Can(ctx, editor, "read", "comments") || !policy.Can(ctx, editor, "write", "posts") || !policy.Can(ctx, admin, "delete", "users") {
+		t.Fatalf("Inherited and wildcard permissions should be granted")
+	}
+	if !policy.HasRole(ctx, admin, "viewer") || len(audited) != 0 {
+		t.Fatalf("Admin should include viewer, allowed decisions should not be audited (audited: %d)", len(audited))
+	}
+
+	// verify: denials carry a reason
+	for _, tc := range []struct {
+		decision Decision
+		reason   string
+	}{
+		{policy.Check(ctx, editor, "delete", "users"), ReasonMissingPerm},
+		{policy.CheckRole(ctx, editor, "admin"), ReasonMissingRole},
+		{policy.Check(ctx, nil, "read", "posts"), ReasonNoUser},
+		{policy.Check(ctx, &ft_supabase.User{}, "read", "posts"), ReasonNoRole},
+		{policy.Check(ctx, &ft_supabase.User{Role: "ghost"}, "read", "posts"), ReasonUndefinedRole},
+	} {
+		if tc.decision.Allowed || tc.decision.Reason != tc.reason {
+			t.Fatalf("Expected denial %q, got %+v", tc.reason, tc.decision)
+		}
+	}
+	if len(audited) != 5 || audited[0].UserID != editor.UserID || audited[0].Resource != "users" {
+		t.Fatalf("Every denial should be audited, got %d", len(audited))
+	}
+
+	// verify: invalid definitions
+	_, err = NewPolicy(PolicyOptions{Roles: []RoleDefinition{{Name: "a", Inherits: []string{"b"}}, {Name: "b", Inherits: []string{"a"}}}})
+	if !errors.Is(err, ErrRoleCycle) {
+		t.Fatalf("Expected ErrRoleCycle, got %v", err)
+	}
+	_, err = NewPolicy(PolicyOptions{Roles: []RoleDefinition{{Name: "a", Inherits: []string{"missing"}}}})
+	if !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("Expected ErrUnknownRole, got %v", err)
+	}
+}
+
+// TestRequireMiddleware tests RequireRole and RequirePermission responses.
+func TestRequireMiddleware(t *testing.T) {
+	var (
+		audited []Decision
+		policy  *Policy
+		ok      = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) })
+	)
+
+	// setup
+	policy = newTestPolicy(t, &audited)
+	serve := func(h http.Handler, user *ft_supabase.User) int {
+		req := httptest.NewRequest("POST", "/posts", nil)
+		if user != nil {
+			req = req.WithContext(ft_supabase.ContextWithUser(req.Context(), user, nil, "token"))
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	// verify
+	for _, tc := range []struct {
+		handler http.Handler
+		user    *ft_supabase.User
+		status  int
+	}{
+		{policy.RequirePermission("write", "posts")(ok), &ft_supabase.User{Role: "editor"}, http.StatusNoContent},
+		{policy.RequirePermission("write", "posts")(ok), &ft_supabase.User{Role: "viewer"}, http.StatusForbidden},
+		{policy.RequireRole("admin")(ok), &ft_supabase.User{Role: "admin"}, http.StatusNoContent},
+		{policy.RequireRole("admin")(ok), &ft_supabase.User{Role: "editor"}, http.StatusForbidden},
+		{policy.RequireRole("viewer")(ok), nil, http.StatusUnauthorized},
+	} {
+		if status := serve(tc.handler, tc.user); status != tc.status {
+			t.Errorf("Expected status %d for %+v, got %d", tc.status, tc.user, status)
+		}
+	}
+}
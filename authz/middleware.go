@@ -0,0 +1,67 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+)
+
+// RequireRole returns middleware letting through users having role, directly or through inheritance.
+// role is the required role.
+// Must run after Service.Middleware(), which stores the user in the request context.
+// Requests without a user get 401, denied requests get 403.
+func (p *Policy) RequireRole(role string) func(http.Handler) http.Handler {
+	return p.require(func(r *http.Request, user *ft_supabase.User) Decision {
+		return p.CheckRole(r.Context(), user, role)
+	})
+}
+
+// RequirePermission returns middleware letting through users allowed to perform action on resource.
+// action is the required action (e.g., "write").
+// resource is the required resource (e.g., "posts").
+// Must run after Service.Middleware(), which stores the user in the request context.
+// Requests without a user get 401, denied requests get 403.
+func (p *Policy) RequirePermission(action, resource string) func(http.Handler) http.Handler {
+	return p.require(func(r *http.Request, user *ft_supabase.User) Decision {
+		return p.Check(r.Context(), user, action, resource)
+	})
+}
+
+// require builds middleware running check on the request user.
+func (p *Policy) require(check func(r *http.Request, user *ft_supabase.User) Decision) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			user, _ := ft_supabase.UserFromContext(r.Context())
+
+			decision := check(r, user)
+			if decision.Allowed {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if p.opts.DeniedHandler != nil {
+				p.opts.DeniedHandler(w, r, decision)
+				return
+			}
+			writeDenied(w, decision)
+		})
+	}
+}
+
+// writeDenied writes a JSON 401 (no user) or 403 (denied) response.
+// The reason is kept in the audit trail and not sent to the client.
+func writeDenied(w http.ResponseWriter, decision Decision) {
+	var (
+		status = http.StatusForbidden
+		code   = "forbidden"
+	)
+
+	if decision.Reason == ReasonNoUser {
+		status, code = http.StatusUnauthorized, "unauthorized"
+	}
+
+	w.Header().Set(ft_supabase.HeaderContentType, ft_supabase.ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code})
+}
@@ -0,0 +1,325 @@
+// Package authz provides role- and permission-based authorization for ft_supabase users.
+//
+// A Policy declares roles, the roles they inherit, and the permissions they grant.
+// Permissions are written "resource:action" (e.g., "posts:write") and accept "*" for
+// either part ("posts:*", "*:read", "*"). A role inherits every permission of its
+// parent roles and satisfies RequireRole for each of them.
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for policy definitions.
+var (
+	ErrUnknownRole     = errors.New("unknown role")
+	ErrRoleCycle       = errors.New("role inheritance cycle")
+	ErrDuplicateRole   = errors.New("duplicate role")
+	ErrEmptyPermission = errors.New("empty permission")
+)
+
+// Denial reasons reported in Decision.Reason.
+const (
+	ReasonNoUser        = "no authenticated user"
+	ReasonNoRole        = "user has no role"
+	ReasonUndefinedRole = "role is not defined"
+	ReasonMissingRole   = "role does not include the required role"
+	ReasonMissingPerm   = "role lacks the permission"
+)
+
+// RoleDefinition declares a role of a policy.
+// Name is the role name, matched against User.Role.
+// Inherits are the roles whose permissions this role includes.
+// Permissions are the permissions granted by the role ("resource:action", "*" wildcards).
+//
+// Used in:
+// - PolicyOptions.Roles - declares the policy roles
+type RoleDefinition struct {
+	Name        string   `json:"name"`
+	Inherits    []string `json:"inherits,omitempty"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+// PolicyOptions configures a Policy.
+// Roles are the role definitions (parents may be declared after their children).
+// DefaultRole is used for users without a role (empty denies them).
+// Audit is called for every denied decision (nil logs denials).
+// AuditAllowed also sends allowed decisions to Audit.
+// DeniedHandler writes the response of requests denied by RequireRole/RequirePermission (default: JSON 401/403).
+//
+// Used in:
+// - NewPolicy() - configures the policy
+type PolicyOptions struct {
+	Roles         []RoleDefinition
+	DefaultRole   string
+	Audit         func(ctx context.Context, decision Decision)
+	AuditAllowed  bool
+	DeniedHandler func(w http.ResponseWriter, r *http.Request, decision Decision)
+}
+
+// Decision is the result of an authorization check.
+// Allowed is true if access is granted.
+// UserID is the checked user (zero without a user).
+// Role is the role the check used (DefaultRole for users without a role).
+// Action and Resource are the checked permission (empty for role checks).
+// RequiredRole is the checked role (empty for permission checks).
+// Reason explains a denial (empty when allowed).
+// Time is when the decision was made.
+//
+// Used in:
+// - Policy.Check(), Policy.CheckRole() - returned to callers
+// - PolicyOptions.Audit - audit trail of denials
+type Decision struct {
+	Allowed      bool
+	UserID       uuid.UUID
+	Role         string
+	Action       string
+	Resource     string
+	RequiredRole string
+	Reason       string
+	Time         time.Time
+}
+
+// Policy is an immutable set of roles and permissions, safe for concurrent use.
+// opts holds the policy configuration.
+// ancestors maps each role to itself and every role it inherits, directly or not.
+// permissions maps each role to its effective permissions (own and inherited).
+type Policy struct {
+	opts        PolicyOptions
+	ancestors   map[string]map[string]bool
+	permissions map[string][]permission
+}
+
+// permission is a parsed "resource:action" permission.
+type permission struct {
+	resource string
+	action   string
+}
+
+// NewPolicy builds a policy from role definitions.
+// opts declares the roles and configures auditing.
+// Returns the policy, or ErrDuplicateRole, ErrUnknownRole, ErrRoleCycle or ErrEmptyPermission if the definitions are invalid.
+func NewPolicy(opts PolicyOptions) (*Policy, error) {
+	var (
+		policy      *Policy
+		definitions map[string]RoleDefinition
+		state       map[string]int
+		visit       func(name string, path []string) error
+	)
+
+	definitions = make(map[string]RoleDefinition, len(opts.Roles))
+	for _, role := range opts.Roles {
+		if _, exists := definitions[role.Name]; exists {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateRole, role.Name)
+		}
+		definitions[role.Name] = role
+	}
+	if opts.DefaultRole != "" {
+		if _, exists := definitions[opts.DefaultRole]; !exists {
+			return nil, fmt.Errorf("%w: default role %s", ErrUnknownRole, opts.DefaultRole)
+		}
+	}
+
+	policy = &Policy{
+		opts:        opts,
+		ancestors:   make(map[string]map[string]bool, len(definitions)),
+		permissions: make(map[string][]permission, len(definitions)),
+	}
+
+	// depth-first resolution of inherited roles (0 = new, 1 = in progress, 2 = done)
+	state = make(map[string]int, len(definitions))
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("%w: %s", ErrRoleCycle, strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+
+		ancestors := map[string]bool{name: true}
+		var permissions []permission
+		for _, raw := range definitions[name].Permissions {
+			perm, err := parsePermission(raw)
+			if err != nil {
+				return fmt.Errorf("role %s: %w", name, err)
+			}
+			permissions = append(permissions, perm)
+		}
+
+		for _, parent := range definitions[name].Inherits {
+			if _, exists := definitions[parent]; !exists {
+				return fmt.Errorf("%w: %s inherits %s", ErrUnknownRole, name, parent)
+			}
+			if err := visit(parent, append(path, name)); err != nil {
+				return err
+			}
+			for ancestor := range policy.ancestors[parent] {
+				ancestors[ancestor] = true
+			}
+			permissions = append(permissions, policy.permissions[parent]...)
+		}
+
+		policy.ancestors[name] = ancestors
+		policy.permissions[name] = permissions
+		state[name] = 2
+		return nil
+	}
+
+	for _, role := range opts.Roles {
+		if err := visit(role.Name, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	ft_supabase.Logf("authz.NewPolicy", "Authorization policy created - Roles: %d", len(definitions))
+	return policy, nil
+}
+
+// Can reports whether user may perform action on resource.
+// ctx is passed to the audit hook.
+// user is the authenticated user (nil is denied).
+// action is the action (e.g., "write").
+// resource is the resource (e.g., "posts").
+// Denials are audited with their reason.
+func (p *Policy) Can(ctx context.Context, user *ft_supabase.User, action, resource string) bool {
+	return p.Check(ctx, user, action, resource).Allowed
+}
+
+// Check decides whether user may perform action on resource and audits the decision.
+// Returns the Decision with the denial reason, if any.
+func (p *Policy) Check(ctx context.Context, user *ft_supabase.User, action, resource string) Decision {
+	var (
+		decision Decision
+	)
+
+	decision = p.newDecision(user)
+	decision.Action = action
+	decision.Resource = resource
+
+	if decision.Reason == "" {
+		decision.Reason = ReasonMissingPerm
+		for _, perm := range p.permissions[decision.Role] {
+			if perm.matches(action, resource) {
+				decision.Allowed = true
+				decision.Reason = ""
+				break
+			}
+		}
+	}
+
+	p.audit(ctx, decision)
+	return decision
+}
+
+// HasRole reports whether user has role, directly or through inheritance.
+// ctx is passed to the audit hook.
+// user is the authenticated user (nil is denied).
+// role is the required role.
+func (p *Policy) HasRole(ctx context.Context, user *ft_supabase.User, role string) bool {
+	return p.CheckRole(ctx, user, role).Allowed
+}
+
+// CheckRole decides whether user has role, directly or through inheritance, and audits the decision.
+// Returns the Decision with the denial reason, if any.
+func (p *Policy) CheckRole(ctx context.Context, user *ft_supabase.User, role string) Decision {
+	var (
+		decision Decision
+	)
+
+	decision = p.newDecision(user)
+	decision.RequiredRole = role
+
+	if decision.Reason == "" {
+		decision.Allowed = p.ancestors[decision.Role][role]
+		if !decision.Allowed {
+			decision.Reason = ReasonMissingRole
+		}
+	}
+
+	p.audit(ctx, decision)
+	return decision
+}
+
+// newDecision starts a decision for user, resolving its role.
+// Returns a denied decision whose Reason is set if the user or its role cannot be checked.
+func (p *Policy) newDecision(user *ft_supabase.User) Decision {
+	var (
+		decision Decision
+	)
+
+	decision = Decision{Time: time.Now()}
+	if user == nil {
+		decision.Reason = ReasonNoUser
+		return decision
+	}
+
+	decision.UserID = user.UserID
+	decision.Role = user.Role
+	if decision.Role == "" {
+		decision.Role = p.opts.DefaultRole
+	}
+
+	switch {
+	case decision.Role == "":
+		decision.Reason = ReasonNoRole
+	case p.ancestors[decision.Role] == nil:
+		decision.Reason = ReasonUndefinedRole
+	}
+
+	return decision
+}
+
+// audit reports a decision to the audit hook, or logs it without one.
+func (p *Policy) audit(ctx context.Context, decision Decision) {
+	if decision.Allowed && !p.opts.AuditAllowed {
+		return
+	}
+
+	if p.opts.Audit != nil {
+		p.opts.Audit(ctx, decision)
+		return
+	}
+
+	if !decision.Allowed {
+		ft_supabase.Logf("authz", "Access denied - UserID: %s, Role: %q, Permission: %s:%s, RequiredRole: %q, Reason: %s",
+			decision.UserID.String(), decision.Role, decision.Resource, decision.Action, decision.RequiredRole, decision.Reason)
+	}
+}
+
+// parsePermission parses a "resource:action" permission ("*" alone grants everything).
+func parsePermission(raw string) (permission, error) {
+	var (
+		resource string
+		action   string
+		found    bool
+	)
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return permission{}, ErrEmptyPermission
+	}
+	if raw == "*" {
+		return permission{resource: "*", action: "*"}, nil
+	}
+
+	resource, action, found = strings.Cut(raw, ":")
+	if !found || resource == "" || action == "" {
+		return permission{}, fmt.Errorf("invalid permission %q: expected resource:action", raw)
+	}
+
+	return permission{resource: resource, action: action}, nil
+}
+
+// matches reports whether the permission grants action on resource.
+func (p permission) matches(action, resource string) bool {
+	return (p.resource == "*" || p.resource == resource) && (p.action == "*" || p.action == action)
+}
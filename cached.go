@@ -1,227 +1,333 @@
 package ft_supabase
 
 import (
+	"container/heap"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 // NewUserCache creates a new UserCache instance.
-// Returns an initialized UserCache with empty user maps and default max size of 1000.
+// Returns an initialized UserCache with empty session maps and default max size of 1000.
 func NewUserCache() *UserCache {
+	var (
+		cache *UserCache
+	)
+
 	Log("NewUserCache", "Creating new user cache with max size: 1000")
-	return &UserCache{
-		users:     make(map[string]*CachedUser),
-		usersByID: make(map[uuid.UUID]*CachedUser),
-		MaxSize:   1000,
+	cache = newUserCache(1000)
+
+	return cache
+}
+
+// newUserCache creates an empty UserCache without logging.
+// maxSize is the maximum number of sessions.
+// Used by NewUserCache() and for ShardedUserCache shards.
+func newUserCache(maxSize int) *UserCache {
+	var (
+		cache *UserCache
+	)
+
+	cache = &UserCache{
+		users:     make(map[string]*cacheEntry),
+		sessions:  make(map[string]*cacheEntry),
+		usersByID: make(map[uuid.UUID]map[string]*cacheEntry),
+		emails:    make(map[string]map[string]*cacheEntry),
+		usernames: make(map[string]map[string]*cacheEntry),
+		MaxSize:   maxSize,
+		hooks:     &eventHub{},
 	}
+	cache.lru.init()
+
+	return cache
 }
 
-// Set stores a user in the cache using their access token as the key.
+// Set stores a user session in the cache using its access token as the key.
 // token is the JWT access token used as the cache key.
-// user is the CachedUser pointer to store.
-// Also stores the user by UserID for lookup by ID.
-// If cache size reaches MaxSize, evicts oldest cached users first.
+// user is the session to store; the cache keeps a private copy, so later changes to user have no effect.
+// The stored copy's AccessToken is set to token.
+// The session is also indexed by SessionID (derived from the token's session_id claim when empty)
+// and by UserID, so a user can hold several sessions at once.
+// Storing a session with an existing SessionID replaces it (e.g., after a token refresh),
+// keeps its device info and increments its Version.
+// If cache size reaches MaxSize, evicts expired sessions first, then the least recently used session.
+// Runs in O(log n) time.
 // Thread-safe operation using write lock.
 func (c *UserCache) Set(token string, user *CachedUser) {
 	var (
-		now           time.Time
-		oldestToken   string
-		oldestUser    *CachedUser
-		currentUser   *CachedUser
-		needsEviction bool
-		expiredCount  int
+		now          time.Time
+		previous     *cacheEntry
+		existing     *cacheEntry
+		entry        *cacheEntry
+		evicted      *CachedUser
+		replaced     bool
+		exists       bool
+		full         bool
+		expiredCount int
+		total        int
+		events       []CacheEvent
+		stored       CachedUser
 	)
 
+	// keep a private copy so callers cannot modify cached state
+	stored = *user
+	stored.Metadata = cloneMetadata(user.Metadata)
+	stored.AppMetadata = cloneMetadata(user.AppMetadata)
+	user = &stored
+
+	// the token is always the session's access token
+	user.AccessToken = token
+
+	// derive session ID from token when not provided
+	if user.SessionID == "" {
+		user.SessionID = sessionIDFromToken(token)
+	}
+
+	Logf("UserCache.Set", "Caching session - UserID: %s, Email: %s, SessionID: %s", user.UserID.String(), user.Email, user.SessionID)
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
+	now = time.Now()
+
+	// check if session already exists (refresh/update case)
+	previous, replaced = c.sessions[user.SessionID]
+	if replaced {
+		// keep device info and creation time across refreshes
+		if user.IPAddress == "" {
+			user.IPAddress = previous.user.IPAddress
+		}
+		if user.UserAgent == "" {
+			user.UserAgent = previous.user.UserAgent
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = previous.user.CreatedAt
+		}
+		user.Version = previous.user.Version
+		c.removeLocked(previous, "", "")
+	}
 
-	Logf("UserCache.Set", "Caching user - UserID: %s, Email: %s", user.UserID.String(), user.Email)
+	// token already mapped to another session (should not happen with Supabase tokens)
+	existing, exists = c.users[token]
+	if exists {
+		c.removeLocked(existing, "", "")
+		replaced = true
+	}
 
 	// check if cache is full and needs eviction
-	if len(c.users) >= c.MaxSize {
-		Logf("UserCache.Set", "Cache full (%d/%d), cleaning expired entries", len(c.users), c.MaxSize)
+	if !replaced && len(c.users) >= c.MaxSize {
+		full = true
 
 		// first try to remove expired entries
-		now = time.Now()
-		expiredCount = 0
-		for t, u := range c.users {
-			if now.After(u.ExpiresAt) {
-				delete(c.users, t)
-				delete(c.usersByID, u.UserID)
-				expiredCount++
-			}
-		}
+		expiredCount = c.removeExpiredLocked(now)
 
-		if expiredCount > 0 {
-			Logf("UserCache.Set", "Removed %d expired entries", expiredCount)
-		}
-
-		// if still at max capacity after cleanup, evict oldest entry
+		// if still at max capacity after cleanup, evict least recently used entry
 		if len(c.users) >= c.MaxSize {
-			Logf("UserCache.Set", "Still at max capacity after cleanup, evicting oldest user")
-			needsEviction = true
-			for t, u := range c.users {
-				if oldestUser == nil || u.CachedAt.Before(oldestUser.CachedAt) {
-					oldestToken = t
-					oldestUser = u
-				}
-			}
-
-			// evict oldest user
-			if needsEviction && oldestUser != nil {
-				Logf("UserCache.Set", "Evicting oldest user - UserID: %s, Email: %s", oldestUser.UserID.String(), oldestUser.Email)
-				delete(c.users, oldestToken)
-				delete(c.usersByID, oldestUser.UserID)
-			}
+			evicted = c.evictLRULocked()
 		}
 	}
 
-	// check if user already exists (update case)
-	currentUser, _ = c.usersByID[user.UserID]
-	if currentUser != nil {
-		Log("UserCache.Set", "Updating existing user in cache")
-		// remove old token entry if token changed
-		if currentUser.AccessToken != token {
-			delete(c.users, currentUser.AccessToken)
-		}
+	// fill session timestamps
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.LastSeenAt.IsZero() {
+		user.LastSeenAt = now
+	}
+	user.Version++
+
+	// store new session in all indexes
+	entry = &cacheEntry{user: user, lastSeen: user.LastSeenAt, heapIndex: -1}
+	c.users[token] = entry
+	c.sessions[user.SessionID] = entry
+	if c.usersByID[user.UserID] == nil {
+		c.usersByID[user.UserID] = make(map[string]*cacheEntry)
+	}
+	c.usersByID[user.UserID][user.SessionID] = entry
+	c.indexLookupLocked(entry)
+	c.lru.pushFront(entry)
+	heap.Push(&c.expiry, entry)
+	if c.onStore != nil {
+		c.onStore(user)
+	}
+	if replaced {
+		c.recordLocked(CacheEventSet, ReasonReplaced, user)
+	} else {
+		c.recordLocked(CacheEventSet, ReasonNew, user)
 	}
 
-	// store new user
-	c.users[token] = user
-	c.usersByID[user.UserID] = user
+	total = len(c.users)
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
 
-	Logf("UserCache.Set", "Successfully cached user - Total users: %d", len(c.users))
+	c.hooks.emit(events)
+
+	// log outside the lock
+	if replaced {
+		Log("UserCache.Set", "Updated existing session in cache")
+	}
+	if full {
+		Logf("UserCache.Set", "Cache was full, removed %d expired entries", expiredCount)
+	}
+	if evicted != nil {
+		Logf("UserCache.Set", "Evicted least recently used session - UserID: %s, Email: %s", evicted.UserID.String(), evicted.Email)
+	}
+	Logf("UserCache.Set", "Successfully cached session - Total sessions: %d", total)
 }
 
-// Get retrieves a user from the cache by their access token.
+// Get retrieves a user session from the cache by its access token.
 // token is the JWT access token used as the cache key.
-// Returns the CachedUser pointer and true if found and not expired.
+// Returns a copy of the CachedUser and true if found and not expired.
 // Returns nil and false if not found or expired.
-// Thread-safe operation using read lock.
+// Marks the session as most recently used and updates its LastSeenAt timestamp in O(1).
+// Thread-safe operation using write lock.
 func (c *UserCache) Get(token string) (*CachedUser, bool) {
 	var (
+		entry  *cacheEntry
 		user   *CachedUser
+		now    time.Time
 		exists bool
+		events []CacheEvent
 	)
 
-	c.mu.RLock()
-	defer c.mu.RUnlock()
-
-	user, exists = c.users[token]
-	if !exists {
-		return nil, false
-	}
-
-	// check if token is expired
-	if time.Now().After(user.ExpiresAt) {
-		return nil, false
+	c.mu.Lock()
+	entry, exists = c.users[token]
+	now = time.Now()
+	switch {
+	case !exists:
+		c.recordLocked(CacheEventMiss, ReasonNotFound, nil)
+	case now.After(entry.user.ExpiresAt):
+		// expired sessions stay until cleanup
+		exists = false
+		c.recordLocked(CacheEventMiss, ReasonExpired, entry.user)
+	default:
+		c.lru.moveToFront(entry)
+		entry.lastSeen = now
+		user = entry.snapshot()
+		c.recordLocked(CacheEventHit, "", entry.user)
 	}
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
 
-	return user, true
+	c.hooks.emit(events)
+	return user, exists
 }
 
-// Delete removes a user from the cache by their access token.
+// Delete removes a user session from the cache by its access token.
 // token is the JWT access token used as the cache key.
+// Removes the session from token, session and userID indexes.
 // Thread-safe operation using write lock.
 func (c *UserCache) Delete(token string) {
+	var (
+		entry  *cacheEntry
+		exists bool
+		events []CacheEvent
+	)
+
 	c.mu.Lock()
-	defer c.mu.Unlock()
-	delete(c.users, token)
+	entry, exists = c.users[token]
+	if exists {
+		c.removeLocked(entry, CacheEventDelete, ReasonDeleted)
+	}
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
+
+	c.hooks.emit(events)
 }
 
-// DeleteByUserID removes a user from the cache by their UserID.
+// DeleteByUserID removes every session of a user from the cache.
 // userID is the Supabase user unique identifier (UUID).
-// Removes from both token and userID indexes.
+// Removes from token, session and userID indexes.
 // Thread-safe operation using write lock.
 func (c *UserCache) DeleteByUserID(userID uuid.UUID) {
 	var (
-		user   *CachedUser
-		exists bool
+		events []CacheEvent
 	)
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
-	// get user to find their token
-	user, exists = c.usersByID[userID]
-	if exists {
-		// delete from both maps
-		delete(c.users, user.AccessToken)
-		delete(c.usersByID, userID)
+	// delete every session of the user
+	for _, entry := range c.usersByID[userID] {
+		c.removeLocked(entry, CacheEventDelete, ReasonUserDeleted)
 	}
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
+
+	c.hooks.emit(events)
 }
 
 // IsValid checks if a token exists in cache and is not expired.
 // token is the JWT access token to validate.
 // Returns true if token exists and is valid, false otherwise.
+// Does not change access recency.
 // Thread-safe operation using read lock.
 func (c *UserCache) IsValid(token string) bool {
 	var (
-		user   *CachedUser
+		entry  *cacheEntry
 		exists bool
 	)
 
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	user, exists = c.users[token]
+	entry, exists = c.users[token]
 	if !exists {
 		return false
 	}
 
 	// check if token is expired
-	return time.Now().Before(user.ExpiresAt)
+	return time.Now().Before(entry.user.ExpiresAt)
 }
 
-// Cleanup removes all expired tokens from the cache.
-// Iterates through all cached users and removes expired ones from both indexes.
+// Cleanup removes all expired sessions from the cache.
+// Pops expired sessions from the expiry heap, so only expired entries are visited.
+// Returns the number of removed sessions.
 // Thread-safe operation using write lock.
-func (c *UserCache) Cleanup() {
+func (c *UserCache) Cleanup() int {
 	var (
-		now           time.Time
-		expiredTokens []string
-		expiredUIDs   []uuid.UUID
-		beforeCount   int
-		afterCount    int
+		removed     int
+		beforeCount int
+		afterCount  int
+		events      []CacheEvent
 	)
 
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	beforeCount = len(c.users)
-	Logf("UserCache.Cleanup", "Starting cache cleanup - Current users: %d", beforeCount)
+	removed = c.removeExpiredLocked(time.Now())
+	afterCount = len(c.users)
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
 
-	now = time.Now()
-	expiredTokens = make([]string, 0)
-	expiredUIDs = make([]uuid.UUID, 0)
-
-	// collect expired entries
-	for token, user := range c.users {
-		if now.After(user.ExpiresAt) {
-			expiredTokens = append(expiredTokens, token)
-			expiredUIDs = append(expiredUIDs, user.UserID)
-		}
-	}
+	c.hooks.emit(events)
 
-	// delete expired users from both maps
-	for _, token := range expiredTokens {
-		delete(c.users, token)
-	}
-	for _, userID := range expiredUIDs {
-		delete(c.usersByID, userID)
+	Logf("UserCache.Cleanup", "Cache cleanup - Sessions before: %d", beforeCount)
+	if removed > 0 {
+		Logf("UserCache.Cleanup", "Removed %d expired entries - Remaining sessions: %d", removed, afterCount)
+	} else {
+		Logf("UserCache.Cleanup", "No expired entries found - Remaining sessions: %d", afterCount)
 	}
 
-	afterCount = len(c.users)
+	return removed
+}
 
-	if len(expiredTokens) > 0 {
-		Logf("UserCache.Cleanup", "Removed %d expired entries - Remaining users: %d", len(expiredTokens), afterCount)
-	} else {
-		Logf("UserCache.Cleanup", "No expired entries found - Remaining users: %d", afterCount)
+// NextExpiry returns the earliest ExpiresAt of all cached sessions in O(1).
+// Returns false if the cache is empty.
+// Thread-safe operation using read lock.
+func (c *UserCache) NextExpiry() (time.Time, bool) {
+	var (
+		entry *cacheEntry
+	)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry = c.expiry.peek()
+	if entry == nil {
+		return time.Time{}, false
 	}
+
+	return entry.user.ExpiresAt, true
 }
 
-// Count returns the number of users currently in the cache.
+// Count returns the number of sessions currently in the cache.
 // Thread-safe operation using read lock.
 func (c *UserCache) Count() int {
 	c.mu.RLock()
@@ -229,29 +335,383 @@ func (c *UserCache) Count() int {
 	return len(c.users)
 }
 
-// GetByUserID retrieves a user from the cache by their UserID.
+// GetByUserID retrieves the freshest valid session of a user from the cache.
 // userID is the Supabase user unique identifier (UUID).
-// Returns the CachedUser pointer and true if found and not expired.
-// Returns nil and false if not found or expired.
+// Returns a copy of the non-expired CachedUser with the latest ExpiresAt and true if found.
+// Returns nil and false if the user has no valid session.
 // Thread-safe operation using read lock.
 func (c *UserCache) GetByUserID(userID uuid.UUID) (*CachedUser, bool) {
 	var (
-		user   *CachedUser
-		exists bool
+		freshest *cacheEntry
+		now      time.Time
 	)
 
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	user, exists = c.usersByID[userID]
-	if !exists {
+	now = time.Now()
+	for _, entry := range c.usersByID[userID] {
+		// skip expired sessions
+		if now.After(entry.user.ExpiresAt) {
+			continue
+		}
+		if freshest == nil || entry.user.ExpiresAt.After(freshest.user.ExpiresAt) {
+			freshest = entry
+		}
+	}
+
+	if freshest == nil {
 		return nil, false
 	}
 
-	// check if token is expired
-	if time.Now().After(user.ExpiresAt) {
+	return freshest.snapshot(), true
+}
+
+// GetByEmail retrieves the freshest valid session of the user with an email address.
+// email is the email address, matched case-insensitively.
+// Returns a copy of the CachedUser and true if found.
+// Returns nil and false if no valid session has this email.
+// Thread-safe operation using read lock.
+func (c *UserCache) GetByEmail(email string) (*CachedUser, bool) {
+	return c.getByLookup(c.emails, normalizeLookupKey(email))
+}
+
+// GetByUsername retrieves the freshest valid session of the user with a username.
+// username is the username, matched case-insensitively.
+// Returns a copy of the CachedUser and true if found.
+// Returns nil and false if no valid session has this username.
+// Thread-safe operation using read lock.
+func (c *UserCache) GetByUsername(username string) (*CachedUser, bool) {
+	return c.getByLookup(c.usernames, normalizeLookupKey(username))
+}
+
+// getByLookup returns the freshest valid session among the entries indexed under key.
+// index is the email or username index.
+// key is the normalized lookup key.
+func (c *UserCache) getByLookup(index map[string]map[string]*cacheEntry, key string) (*CachedUser, bool) {
+	var (
+		freshest *cacheEntry
+		now      time.Time
+	)
+
+	if key == "" {
 		return nil, false
 	}
 
-	return user, true
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now = time.Now()
+	for _, entry := range index[key] {
+		if now.After(entry.user.ExpiresAt) {
+			continue
+		}
+		if freshest == nil || entry.user.ExpiresAt.After(freshest.user.ExpiresAt) {
+			freshest = entry
+		}
+	}
+
+	if freshest == nil {
+		return nil, false
+	}
+
+	return freshest.snapshot(), true
+}
+
+// GetBySessionID retrieves a session from the cache by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns a copy of the CachedUser and true if found and not expired.
+// Returns nil and false if not found or expired.
+// Thread-safe operation using read lock.
+func (c *UserCache) GetBySessionID(sessionID string) (*CachedUser, bool) {
+	var (
+		entry  *cacheEntry
+		exists bool
+	)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entry, exists = c.sessions[sessionID]
+	if !exists || time.Now().After(entry.user.ExpiresAt) {
+		return nil, false
+	}
+
+	return entry.snapshot(), true
+}
+
+// ListSessions returns the valid sessions of a user, oldest first.
+// userID is the Supabase user unique identifier (UUID).
+// Returns an empty slice if the user has no valid session.
+// Thread-safe operation using read lock.
+func (c *UserCache) ListSessions(userID uuid.UUID) []SessionInfo {
+	var (
+		sessions []SessionInfo
+		now      time.Time
+	)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	now = time.Now()
+	sessions = make([]SessionInfo, 0, len(c.usersByID[userID]))
+	for _, entry := range c.usersByID[userID] {
+		// skip expired sessions
+		if now.After(entry.user.ExpiresAt) {
+			continue
+		}
+		sessions = append(sessions, SessionInfo{
+			SessionID:  entry.user.SessionID,
+			UserID:     entry.user.UserID,
+			IPAddress:  entry.user.IPAddress,
+			UserAgent:  entry.user.UserAgent,
+			CreatedAt:  entry.user.CreatedAt,
+			LastSeenAt: entry.lastSeen,
+			ExpiresAt:  entry.user.ExpiresAt,
+		})
+	}
+
+	// sort by creation time for stable output
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions
+}
+
+// RevokeSession removes a single session from the cache by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns true if the session was found and removed.
+// Other sessions of the same user are kept.
+// Thread-safe operation using write lock.
+func (c *UserCache) RevokeSession(sessionID string) bool {
+	var (
+		entry  *cacheEntry
+		exists bool
+		events []CacheEvent
+	)
+
+	c.mu.Lock()
+	entry, exists = c.sessions[sessionID]
+	if exists {
+		c.removeLocked(entry, CacheEventDelete, ReasonRevoked)
+	}
+	events = c.takeEventsLocked()
+	c.mu.Unlock()
+
+	c.hooks.emit(events)
+	return exists
+}
+
+// Update applies fn to every cached session of a user using copy-on-write.
+// userID is the Supabase user unique identifier (UUID).
+// fn is called with a copy of each session and may modify profile fields and ExpiresAt;
+// changes to UserID, SessionID and AccessToken are ignored because they are index keys.
+// Each updated session replaces the cached one with its Version incremented, so copies
+// previously returned by Get() are never modified.
+// Thread-safe operation using write lock; fn runs under the lock and must not call the cache.
+func (c *UserCache) Update(userID uuid.UUID, fn func(*CachedUser)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, entry := range c.usersByID[userID] {
+		c.unindexLookupLocked(entry)
+
+		updated := *entry.user
+		updated.LastSeenAt = entry.lastSeen
+		fn(&updated)
+		updated.Metadata = cloneMetadata(updated.Metadata)
+		updated.AppMetadata = cloneMetadata(updated.AppMetadata)
+
+		// index keys cannot change
+		updated.UserID = entry.user.UserID
+		updated.SessionID = entry.user.SessionID
+		updated.AccessToken = entry.user.AccessToken
+		updated.Version = entry.user.Version + 1
+		entry.user = &updated
+		c.indexLookupLocked(entry)
+
+		// keep expiry order if fn changed ExpiresAt
+		heap.Fix(&c.expiry, entry.heapIndex)
+	}
+}
+
+// Stats returns a snapshot of the cache counters, current size and max size.
+// Thread-safe operation using read lock.
+func (c *UserCache) Stats() CacheStats {
+	var (
+		stats CacheStats
+	)
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	stats = c.counters
+	stats.Size = len(c.users)
+	stats.MaxSize = c.MaxSize
+
+	return stats
+}
+
+// Subscribe registers a hook called for every cache event (set, hit, miss, evict, expire, delete).
+// fn is the hook; it runs in the goroutine that triggered the event, after the cache lock is released,
+// so it may call the cache but should return quickly.
+// Returns a function removing the hook.
+func (c *UserCache) Subscribe(fn func(CacheEvent)) func() {
+	return c.hooks.subscribe(fn)
+}
+
+// Events returns a channel receiving every cache event.
+// buffer is the channel capacity; events are dropped when the channel is full so the cache never blocks.
+// Returns the channel and a function unsubscribing and closing it.
+func (c *UserCache) Events(buffer int) (<-chan CacheEvent, func()) {
+	return c.hooks.stream(buffer)
+}
+
+// removeLocked removes an entry from every index, the recency list and the expiry heap.
+// entry is the session entry to remove.
+// eventType and reason describe the removal for event hooks (empty records no event, e.g. when replacing a session).
+// Must be called with mu held for writing.
+func (c *UserCache) removeLocked(entry *cacheEntry, eventType CacheEventType, reason CacheEventReason) {
+	var (
+		user         *CachedUser
+		userSessions map[string]*cacheEntry
+	)
+
+	user = entry.user
+	delete(c.users, user.AccessToken)
+	delete(c.sessions, user.SessionID)
+
+	userSessions = c.usersByID[user.UserID]
+	delete(userSessions, user.SessionID)
+	if len(userSessions) == 0 {
+		delete(c.usersByID, user.UserID)
+	}
+	c.unindexLookupLocked(entry)
+
+	c.lru.remove(entry)
+	c.expiry.removeEntry(entry)
+	if c.onRemove != nil {
+		c.onRemove(user)
+	}
+	if eventType != "" {
+		c.recordLocked(eventType, reason, user)
+	}
+}
+
+// recordLocked counts a cache event and queues it to be dispatched once mu is released.
+// The event is only queued when there are subscribers.
+// Must be called with mu held for writing.
+func (c *UserCache) recordLocked(eventType CacheEventType, reason CacheEventReason, user *CachedUser) {
+	switch eventType {
+	case CacheEventSet:
+		c.counters.Sets++
+	case CacheEventHit:
+		c.counters.Hits++
+	case CacheEventMiss:
+		c.counters.Misses++
+	case CacheEventEvict:
+		c.counters.Evictions++
+	case CacheEventExpire:
+		c.counters.Expirations++
+	case CacheEventDelete:
+		c.counters.Deletes++
+	}
+
+	if !c.hooks.enabled() {
+		return
+	}
+	c.pending = append(c.pending, newCacheEvent(eventType, reason, user))
+}
+
+// takeEventsLocked returns and clears the queued cache events.
+// Must be called with mu held for writing.
+func (c *UserCache) takeEventsLocked() []CacheEvent {
+	var (
+		events []CacheEvent
+	)
+
+	events = c.pending
+	c.pending = nil
+
+	return events
+}
+
+// indexLookupLocked adds an entry to the email and username indexes.
+// Must be called with mu held for writing.
+func (c *UserCache) indexLookupLocked(entry *cacheEntry) {
+	addLookupKey(c.emails, normalizeLookupKey(entry.user.Email), entry)
+	addLookupKey(c.usernames, normalizeLookupKey(entry.user.Username), entry)
+}
+
+// unindexLookupLocked removes an entry from the email and username indexes.
+// Must be called with mu held for writing.
+func (c *UserCache) unindexLookupLocked(entry *cacheEntry) {
+	removeLookupKey(c.emails, normalizeLookupKey(entry.user.Email), entry)
+	removeLookupKey(c.usernames, normalizeLookupKey(entry.user.Username), entry)
+}
+
+// addLookupKey indexes entry under key (empty keys are not indexed).
+func addLookupKey(index map[string]map[string]*cacheEntry, key string, entry *cacheEntry) {
+	if key == "" {
+		return
+	}
+	if index[key] == nil {
+		index[key] = make(map[string]*cacheEntry)
+	}
+	index[key][entry.user.SessionID] = entry
+}
+
+// removeLookupKey removes entry from key, dropping the key once it has no entries.
+func removeLookupKey(index map[string]map[string]*cacheEntry, key string, entry *cacheEntry) {
+	var (
+		entries map[string]*cacheEntry
+	)
+
+	entries = index[key]
+	if entries[entry.user.SessionID] != entry {
+		return
+	}
+	delete(entries, entry.user.SessionID)
+	if len(entries) == 0 {
+		delete(index, key)
+	}
+}
+
+// removeExpiredLocked removes every expired session by popping the expiry heap.
+// now is the reference time for expiry checks.
+// Returns the number of removed sessions.
+// Runs in O(k log n) for k expired sessions.
+// Must be called with mu held for writing.
+func (c *UserCache) removeExpiredLocked(now time.Time) int {
+	var (
+		entry   *cacheEntry
+		removed int
+	)
+
+	for {
+		entry = c.expiry.peek()
+		if entry == nil || !now.After(entry.user.ExpiresAt) {
+			return removed
+		}
+		c.removeLocked(entry, CacheEventExpire, ReasonExpired)
+		removed++
+	}
+}
+
+// evictLRULocked removes the least recently used session in O(log n).
+// Returns the evicted session, or nil if the cache is empty.
+// Must be called with mu held for writing.
+func (c *UserCache) evictLRULocked() *CachedUser {
+	var (
+		entry *cacheEntry
+	)
+
+	entry = c.lru.back()
+	if entry == nil {
+		return nil
+	}
+	c.removeLocked(entry, CacheEventEvict, ReasonCapacity)
+
+	return entry.user
 }
@@ -0,0 +1,257 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestUserCacheLRUEviction tests that a full cache evicts the least recently used session.
+func TestUserCacheLRUEviction(t *testing.T) {
+	var (
+		testName     = "TestUserCacheLRUEviction"
+		cache        *UserCache
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: three sessions, oldest first
+	cache = NewUserCache()
+	cache.MaxSize = 3
+	for i := 1; i <= 3; i++ {
+		cache.Set(fmt.Sprintf("token-%d", i), &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)})
+	}
+
+	// execute: read token-1 so token-2 becomes least recently used, then overflow
+	cache.Get("token-1")
+	cache.Set("token-4", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)})
+
+	// verify
+	if cache.IsValid("token-2") || !cache.IsValid("token-1") || !cache.IsValid("token-4") || cache.Count() != 3 {
+		errorMessage = fmt.Sprintf("Expected token-2 to be evicted (count: %d)", cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Least recently used session evicted\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestUserCacheExpiryHeap tests that expired sessions are removed before live ones on overflow and cleanup.
+func TestUserCacheExpiryHeap(t *testing.T) {
+	var (
+		testName     = "TestUserCacheExpiryHeap"
+		cache        *UserCache
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: one live session read last, two sessions already expired
+	cache = NewUserCache()
+	cache.MaxSize = 3
+	cache.Set("expired-1", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(-time.Minute)})
+	cache.Set("live", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("expired-2", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(-time.Second)})
+
+	// execute: overflow removes expired sessions instead of the LRU live one
+	cache.Set("new", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)})
+
+	// verify
+	if cache.Count() != 2 || !cache.IsValid("live") || !cache.IsValid("new") {
+		errorMessage = fmt.Sprintf("Expected only expired sessions to be removed (count: %d)", cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Expired sessions removed before eviction\n")
+
+	// refresh changes expiry order: cleanup must still find the earliest entry
+	cache.Update(cache.users["live"].user.UserID, func(u *CachedUser) { u.ExpiresAt = time.Now().Add(-time.Millisecond) })
+	cache.Cleanup()
+	if cache.Count() != 1 || !cache.IsValid("new") {
+		errorMessage = fmt.Sprintf("Cleanup should follow updated expiry (count: %d)", cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Cleanup follows heap order after update\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestCachedUserImmutable tests that the cache hands out copies and versions copy-on-write updates.
+func TestCachedUserImmutable(t *testing.T) {
+	var (
+		testName     = "TestCachedUserImmutable"
+		cache        *UserCache
+		userID       uuid.UUID
+		original     *CachedUser
+		first        *CachedUser
+		second       *CachedUser
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup
+	cache = NewUserCache()
+	userID = uuid.New()
+	original = &CachedUser{UserID: userID, SessionID: "s1", DisplayName: "Original", ExpiresAt: time.Now().Add(time.Hour)}
+	cache.Set("token", original)
+
+	// execute: modify the stored value, a returned copy, then update
+	original.DisplayName = "Changed by caller"
+	first, _ = cache.Get("token")
+	first.DisplayName = "Changed by reader"
+	cache.Update(userID, func(u *CachedUser) {
+		u.DisplayName = "Updated"
+		u.SessionID = "ignored"
+	})
+	second, _ = cache.Get("token")
+
+	// verify
+	if first.Version != 1 || second.Version != 2 || second.DisplayName != "Updated" || second.SessionID != "s1" {
+		errorMessage = fmt.Sprintf("Unexpected versions or values: first=%+v second=%+v", first, second)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if first.DisplayName != "Changed by reader" || original.Version != 0 {
+		errorMessage = "Update must not modify previously returned copies or the caller's value"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Copies returned, updates are copy-on-write with a version counter\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestConcurrentLoginUpdateGet hammers login, update and reads of the same user (run with -race).
+func TestConcurrentLoginUpdateGet(t *testing.T) {
+	var (
+		testName     = "TestConcurrentLoginUpdateGet"
+		service      *Service
+		server       *mockAuthServer
+		ctx          context.Context
+		wg           sync.WaitGroup
+		errs         chan error
+		cachedUser   *CachedUser
+		found        bool
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+	service, _, server = newMockService()
+	ctx = context.Background()
+	errs = make(chan error, 64)
+
+	// execute
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				login, err := service.LoginUser(ctx, server.email, "password")
+				if err != nil {
+					errs <- err
+					return
+				}
+				if _, err = service.UpdateUser(ctx, server.userID, map[string]any{"display_name": fmt.Sprintf("name-%d-%d", worker, i)}); err != nil {
+					errs <- err
+					return
+				}
+				if user, found := service.Cache.Get(login.Token); found {
+					// readers may freely modify their copy
+					user.DisplayName = "local"
+				}
+				service.GetUserByID(ctx, server.userID)
+				service.Cache.ListSessions(server.userID)
+			}
+		}(worker)
+	}
+	wg.Wait()
+	close(errs)
+
+	// verify
+	for err := range errs {
+		errorMessage = fmt.Sprintf("Concurrent operation failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	cachedUser, found = service.Cache.GetByUserID(server.userID)
+	if !found || cachedUser.DisplayName == "local" || cachedUser.Version < 1 {
+		errorMessage = fmt.Sprintf("Reader copies leaked into the cache: %+v", cachedUser)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Concurrent login/update/get are race-free\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// fillUserCache creates a full cache of size sessions and returns it with its tokens.
+func fillUserCache(size int) (*UserCache, []string) {
+	var (
+		cache  *UserCache
+		tokens []string
+		now    time.Time
+	)
+
+	cache = NewUserCache()
+	cache.MaxSize = size
+	tokens = make([]string, size)
+	now = time.Now()
+	for i := range tokens {
+		tokens[i] = "token-" + strconv.Itoa(i)
+		cache.Set(tokens[i], &CachedUser{UserID: uuid.New(), ExpiresAt: now.Add(time.Hour + time.Duration(i)*time.Millisecond)})
+	}
+
+	return cache, tokens
+}
+
+// BenchmarkUserCacheSet measures Set on a full cache, where every call evicts (login storm).
+func BenchmarkUserCacheSet(b *testing.B) {
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+
+	for _, size := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cache, _ := fillUserCache(size)
+			expiresAt := time.Now().Add(2 * time.Hour)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Set("new-"+strconv.Itoa(i), &CachedUser{UserID: uuid.New(), ExpiresAt: expiresAt})
+			}
+		})
+	}
+}
+
+// BenchmarkUserCacheGet measures Get hits, which also update access recency.
+func BenchmarkUserCacheGet(b *testing.B) {
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+
+	for _, size := range []int{10_000, 100_000, 1_000_000} {
+		b.Run(strconv.Itoa(size), func(b *testing.B) {
+			cache, tokens := fillUserCache(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				cache.Get(tokens[i%len(tokens)])
+			}
+		})
+	}
+}
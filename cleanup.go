@@ -0,0 +1,292 @@
+package ft_supabase
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default cleanup scheduler bounds.
+const (
+	// DefaultCleanupMinInterval is the minimum delay between two cleanup runs.
+	DefaultCleanupMinInterval = time.Second
+
+	// DefaultCleanupMaxInterval is the maximum delay between two cleanup runs.
+	DefaultCleanupMaxInterval = time.Minute
+)
+
+// ExpiryTracker is implemented by session stores that know when their next session expires.
+// The cleanup scheduler uses it to wake up right after the earliest expiry.
+//
+// Used in:
+// - CleanupScheduler - computes the next run time
+type ExpiryTracker interface {
+	// NextExpiry returns the earliest ExpiresAt of all stored sessions.
+	// Returns false if the store is empty.
+	NextExpiry() (time.Time, bool)
+}
+
+// compile-time checks that the in-memory caches implement ExpiryTracker
+var (
+	_ ExpiryTracker = (*UserCache)(nil)
+	_ ExpiryTracker = (*ShardedUserCache)(nil)
+)
+
+// CleanupOptions configures a CleanupScheduler.
+// Interval runs cleanup at a fixed interval (0 wakes at the next session expiry instead).
+// MinInterval is the minimum delay between runs, batching close expiries (default 1 second).
+// MaxInterval is the maximum delay between runs, used when the store cannot report its next expiry (default 1 minute).
+// OnRun is called after each run with its statistics (optional).
+//
+// Used in:
+// - Service struct - CleanupOptions used by StartCacheCleanup()
+// - NewCleanupScheduler() - configures the scheduler
+type CleanupOptions struct {
+	Interval    time.Duration
+	MinInterval time.Duration
+	MaxInterval time.Duration
+	OnRun       func(CleanupStats)
+}
+
+// CleanupStats describes a single cleanup run.
+// Run is the run number, starting at 1.
+// StartedAt is the timestamp when the run started.
+// Duration is how long the run took.
+// Removed is the number of expired sessions removed.
+// Remaining is the number of sessions left in the store.
+// NextRun is the timestamp of the next scheduled run.
+//
+// Used in:
+// - CleanupOptions.OnRun - reports each run
+// - CleanupScheduler.LastStats() - returns the latest run
+type CleanupStats struct {
+	Run       int
+	StartedAt time.Time
+	Duration  time.Duration
+	Removed   int
+	Remaining int
+	NextRun   time.Time
+}
+
+// CleanupScheduler removes expired sessions from a session store in the background.
+// By default it wakes right after the earliest session expiry, so expired sessions are freed within seconds.
+// store is the session store to clean.
+// opts are the scheduler options with defaults applied.
+// mu guards cancel, done and lastStats.
+// cancel stops the running goroutine (nil when stopped).
+// done is closed when the running goroutine exits.
+// lastStats are the statistics of the latest run.
+//
+// Used in:
+// - Service.StartCacheCleanup() - runs the service's scheduler
+// - Service.StopCacheCleanup() - stops the service's scheduler
+type CleanupScheduler struct {
+	store     SessionStore
+	opts      CleanupOptions
+	mu        sync.Mutex
+	cancel    context.CancelFunc
+	done      chan struct{}
+	lastStats CleanupStats
+}
+
+// NewCleanupScheduler creates a cleanup scheduler for a session store.
+// store is the session store to clean.
+// opts are the scheduler options (zero values use the defaults).
+// Returns a stopped scheduler; call Start() to run it.
+func NewCleanupScheduler(store SessionStore, opts CleanupOptions) *CleanupScheduler {
+	if opts.MinInterval <= 0 {
+		opts.MinInterval = DefaultCleanupMinInterval
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = DefaultCleanupMaxInterval
+	}
+	if opts.MaxInterval < opts.MinInterval {
+		opts.MaxInterval = opts.MinInterval
+	}
+
+	return &CleanupScheduler{
+		store: store,
+		opts:  opts,
+	}
+}
+
+// Start starts a background goroutine that runs cleanup immediately, then on schedule until ctx is done or Stop() is called.
+// ctx is the context controlling the scheduler lifetime.
+// Calling Start on a running scheduler does nothing.
+func (cs *CleanupScheduler) Start(ctx context.Context) {
+	var (
+		runCtx context.Context
+	)
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if cs.cancel != nil {
+		Log("CleanupScheduler.Start", "Cache cleanup already running")
+		return
+	}
+
+	if cs.opts.Interval > 0 {
+		Logf("CleanupScheduler.Start", "Starting cache cleanup - Interval: %s", cs.opts.Interval)
+	} else {
+		Logf("CleanupScheduler.Start", "Starting cache cleanup - Wakes at next expiry (min %s, max %s)", cs.opts.MinInterval, cs.opts.MaxInterval)
+	}
+
+	runCtx, cs.cancel = context.WithCancel(ctx)
+	cs.done = make(chan struct{})
+	go cs.loop(runCtx, cs.done)
+}
+
+// Stop stops the background goroutine and waits for it to exit.
+// Calling Stop on a stopped scheduler does nothing.
+func (cs *CleanupScheduler) Stop() {
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+
+	cs.mu.Lock()
+	cancel, done = cs.cancel, cs.done
+	cs.cancel, cs.done = nil, nil
+	cs.mu.Unlock()
+
+	if cancel == nil {
+		Log("CleanupScheduler.Stop", "Cache cleanup was not running")
+		return
+	}
+
+	cancel()
+	<-done
+	Log("CleanupScheduler.Stop", "Cache cleanup stopped successfully")
+}
+
+// Running reports whether the background goroutine is running.
+func (cs *CleanupScheduler) Running() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.cancel != nil
+}
+
+// LastStats returns the statistics of the latest cleanup run (zero value if none ran yet).
+func (cs *CleanupScheduler) LastStats() CleanupStats {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.lastStats
+}
+
+// RunNow runs a cleanup synchronously and returns its statistics.
+// Does not change the background schedule.
+func (cs *CleanupScheduler) RunNow() CleanupStats {
+	var (
+		stats CleanupStats
+	)
+
+	stats = cs.run()
+	stats.NextRun = cs.nextRun(time.Now())
+	cs.report(stats)
+
+	return stats
+}
+
+// loop runs cleanup until ctx is done.
+// ctx is the scheduler context.
+// done is closed on exit.
+// When ctx ends without Stop() (e.g., the parent context is cancelled), the scheduler is marked stopped so it can be started again.
+func (cs *CleanupScheduler) loop(ctx context.Context, done chan struct{}) {
+	var (
+		timer *time.Timer
+		stats CleanupStats
+	)
+
+	defer func() {
+		cs.mu.Lock()
+		if cs.done == done {
+			cs.cancel()
+			cs.cancel, cs.done = nil, nil
+		}
+		cs.mu.Unlock()
+		close(done)
+	}()
+
+	for {
+		stats = cs.run()
+		stats.NextRun = cs.nextRun(time.Now())
+		cs.report(stats)
+
+		if timer == nil {
+			timer = time.NewTimer(time.Until(stats.NextRun))
+			defer timer.Stop()
+		} else {
+			timer.Reset(time.Until(stats.NextRun))
+		}
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			Log("CleanupScheduler", "Stopping cache cleanup goroutine")
+			return
+		}
+	}
+}
+
+// run removes expired sessions once.
+// Returns the run statistics without NextRun.
+func (cs *CleanupScheduler) run() CleanupStats {
+	var (
+		stats CleanupStats
+	)
+
+	stats.StartedAt = time.Now()
+	stats.Removed = cs.store.Cleanup()
+	stats.Remaining = cs.store.Count()
+	stats.Duration = time.Since(stats.StartedAt)
+
+	return stats
+}
+
+// report numbers a run, records it as the latest run and calls OnRun.
+// stats are the run statistics.
+func (cs *CleanupScheduler) report(stats CleanupStats) {
+	cs.mu.Lock()
+	stats.Run = cs.lastStats.Run + 1
+	cs.lastStats = stats
+	cs.mu.Unlock()
+
+	Logf("CleanupScheduler", "Cleanup run %d - Removed: %d, Remaining: %d, Took: %s, Next run: %s", stats.Run, stats.Removed, stats.Remaining, stats.Duration, stats.NextRun.Format(time.RFC3339))
+
+	if cs.opts.OnRun != nil {
+		cs.opts.OnRun(stats)
+	}
+}
+
+// nextRun computes when the next cleanup should run.
+// now is the reference time.
+// Returns now + Interval in fixed mode, otherwise the next expiry bounded by MinInterval and MaxInterval.
+func (cs *CleanupScheduler) nextRun(now time.Time) time.Time {
+	var (
+		next    time.Time
+		tracker ExpiryTracker
+		expiry  time.Time
+		ok      bool
+	)
+
+	if cs.opts.Interval > 0 {
+		return now.Add(cs.opts.Interval)
+	}
+
+	next = now.Add(cs.opts.MaxInterval)
+	tracker, ok = cs.store.(ExpiryTracker)
+	if ok {
+		expiry, ok = tracker.NextExpiry()
+		// sessions are expired once now is after ExpiresAt
+		if ok && expiry.Before(next) {
+			next = expiry.Add(time.Millisecond)
+		}
+	}
+
+	if next.Before(now.Add(cs.opts.MinInterval)) {
+		next = now.Add(cs.opts.MinInterval)
+	}
+
+	return next
+}
@@ -0,0 +1,144 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestCleanupScheduler tests that expired sessions are removed shortly after they expire.
+func TestCleanupScheduler(t *testing.T) {
+	var (
+		testName     = "TestCleanupScheduler"
+		cache        *UserCache
+		scheduler    *CleanupScheduler
+		runs         chan CleanupStats
+		stats        CleanupStats
+		ctx          context.Context
+		cancel       context.CancelFunc
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: one session expiring soon, one long-lived
+	cache = NewUserCache()
+	cache.Set("short", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(100 * time.Millisecond)})
+	cache.Set("long", &CachedUser{UserID: uuid.New(), ExpiresAt: time.Now().Add(time.Hour)})
+	runs = make(chan CleanupStats, 16)
+	scheduler = NewCleanupScheduler(cache, CleanupOptions{
+		MinInterval: 10 * time.Millisecond,
+		OnRun:       func(stats CleanupStats) { runs <- stats },
+	})
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	// execute: Start twice must not start a second goroutine
+	scheduler.Start(ctx)
+	scheduler.Start(ctx)
+
+	// verify: initial run, then a run right after the short session expires
+	stats = <-runs
+	if stats.Run != 1 || stats.Removed != 0 || stats.Remaining != 2 || time.Until(stats.NextRun) > 200*time.Millisecond {
+		errorMessage = fmt.Sprintf("Unexpected initial run: %+v", stats)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Initial run scheduled next run at the next expiry\n")
+
+	select {
+	case stats = <-runs:
+	case <-time.After(2 * time.Second):
+		errorMessage = "Expired session was not cleaned within 2 seconds"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	if stats.Run != 2 || stats.Removed != 1 || cache.Count() != 1 || scheduler.LastStats().Run != 2 {
+		errorMessage = fmt.Sprintf("Unexpected second run: %+v (count: %d)", stats, cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Expired session removed right after expiry\n")
+
+	// cancelling the context stops the scheduler, which can then be started again
+	cancel()
+	for deadline := time.Now().Add(2 * time.Second); scheduler.Running() && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if scheduler.Running() {
+		errorMessage = "Scheduler should stop when its context is cancelled"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	scheduler.Start(context.Background())
+	select {
+	case stats = <-runs:
+	case <-time.After(2 * time.Second):
+	}
+	if !scheduler.Running() || stats.Run != 3 {
+		errorMessage = fmt.Sprintf("Scheduler should restart after its context was cancelled (running: %t, run: %d)", scheduler.Running(), stats.Run)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Scheduler restarts after its context is cancelled\n")
+
+	// Stop stays idempotent
+	scheduler.Stop()
+	scheduler.Stop()
+	if scheduler.Running() {
+		errorMessage = "Scheduler should be stopped"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Error(errorMessage)
+		return
+	}
+	output.WriteString("✓ Stop is idempotent\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestServiceCacheCleanupRestart tests that StartCacheCleanup can be called repeatedly without leaking goroutines.
+func TestServiceCacheCleanupRestart(t *testing.T) {
+	var (
+		testName     = "TestServiceCacheCleanupRestart"
+		service      *Service
+		first        *CleanupScheduler
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup
+	service, _, _ = newMockService()
+	service.CleanupOptions = CleanupOptions{Interval: time.Hour}
+
+	// execute
+	service.StartCacheCleanup()
+	first = service.CleanupScheduler()
+	service.StartCacheCleanup()
+
+	// verify
+	if service.CleanupScheduler() != first || !first.Running() {
+		errorMessage = "Second StartCacheCleanup should reuse the running scheduler"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	service.StopCacheCleanup()
+	service.StopCacheCleanup()
+	if first.Running() {
+		errorMessage = "StopCacheCleanup should stop the scheduler"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Error(errorMessage)
+		return
+	}
+	output.WriteString("✓ Start/Stop are idempotent\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,583 @@
+package ft_supabase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for cookie sessions.
+var (
+	ErrNoSessionCookie   = errors.New("no session cookie")
+	ErrInvalidCookie     = errors.New("invalid session cookie")
+	ErrCSRFTokenMismatch = errors.New("missing or invalid CSRF token")
+)
+
+// Cookie session defaults.
+const (
+	// DefaultCookieChunkSize is the maximum cookie value size before splitting, as in @supabase/ssr.
+	DefaultCookieChunkSize = 3180
+
+	// DefaultCookieMaxAge is the session cookie lifetime, as in @supabase/ssr (400 days).
+	DefaultCookieMaxAge = 400 * 24 * time.Hour
+
+	// DefaultCookieRefreshMargin is how long before expiry the middleware refreshes the access token.
+	DefaultCookieRefreshMargin = time.Minute
+
+	// cookieBase64Prefix marks base64url encoded session values, as in @supabase/ssr.
+	cookieBase64Prefix = "base64-"
+)
+
+// CookieOptions configures CookieSessions.
+// Name is the session cookie name (default "sb-<ProjectID>-auth-token", as in supabase-js).
+// Domain is the cookie domain (empty for host-only cookies).
+// Path is the cookie path (default "/").
+// MaxAge is the cookie lifetime (default 400 days; the session itself ends when the refresh token is revoked).
+// SameSite is the SameSite attribute (default Lax).
+// Insecure drops the Secure attribute, for local development over plain HTTP only.
+// ScriptAccess drops the HttpOnly attribute so a supabase-js browser client can read the session.
+// RefreshMargin is how long before expiry the middleware refreshes the access token (default 1 minute).
+// CSRFCookieName is the CSRF token cookie name (default Name + "-csrf").
+// CSRFHeaderName is the header carrying the CSRF token (default "X-CSRF-Token").
+// CSRFFormField is the form field carrying the CSRF token (default "csrf_token").
+// DisableCSRF turns off CSRF checks (e.g., when every client sends a custom header anyway).
+//
+// Used in:
+// - Service.CookieSessions() - configures cookie sessions
+type CookieOptions struct {
+	Name           string
+	Domain         string
+	Path           string
+	MaxAge         time.Duration
+	SameSite       http.SameSite
+	Insecure       bool
+	ScriptAccess   bool
+	RefreshMargin  time.Duration
+	CSRFCookieName string
+	CSRFHeaderName string
+	CSRFFormField  string
+	DisableCSRF    bool
+}
+
+// CookieSession is the session stored in cookies, in the supabase-js session format.
+//
+// Used in:
+// - CookieSessions.Read(), CookieSessions.Write() - cookie payload
+type CookieSession struct {
+	AccessToken  string       `json:"access_token"`
+	TokenType    string       `json:"token_type"`
+	ExpiresIn    int          `json:"expires_in"`
+	ExpiresAt    int64        `json:"expires_at"`
+	RefreshToken string       `json:"refresh_token"`
+	User         SupabaseUser `json:"user"`
+}
+
+// CookieSessions stores Supabase sessions in chunked, httpOnly cookies compatible with @supabase/ssr.
+// service is the service used to log in, refresh and validate sessions.
+// opts holds the cookie configuration with defaults applied.
+//
+// Used in:
+// - Server-rendered apps - keeps raw tokens out of browser JavaScript
+type CookieSessions struct {
+	service *Service
+	opts    CookieOptions
+}
+
+// CookieSessions returns a cookie session manager for the service.
+// opts configures cookie names and attributes (zero values use the defaults).
+func (s *Service) CookieSessions(opts CookieOptions) *CookieSessions {
+	if opts.Name == "" {
+		opts.Name = fmt.Sprintf("sb-%s-auth-token", s.ProjectID)
+	}
+	if opts.Path == "" {
+		opts.Path = "/"
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultCookieMaxAge
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	if opts.RefreshMargin <= 0 {
+		opts.RefreshMargin = DefaultCookieRefreshMargin
+	}
+	if opts.CSRFCookieName == "" {
+		opts.CSRFCookieName = opts.Name + "-csrf"
+	}
+	if opts.CSRFHeaderName == "" {
+		opts.CSRFHeaderName = "X-CSRF-Token"
+	}
+	if opts.CSRFFormField == "" {
+		opts.CSRFFormField = "csrf_token"
+	}
+
+	return &CookieSessions{service: s, opts: opts}
+}
+
+// Login authenticates a user and writes the session cookies.
+// w is the response receiving the cookies.
+// r is the login request (its device info is recorded on the session).
+// email and password are the user's credentials.
+// A new CSRF token is issued with the session.
+// Returns the LoginResponse or the login error.
+func (c *CookieSessions) Login(w http.ResponseWriter, r *http.Request, email, password string) (*LoginResponse, error) {
+	var (
+		ctx        context.Context
+		loginResp  *LoginResponse
+		cachedUser *CachedUser
+		found      bool
+		err        error
+	)
+
+	ctx = WithDeviceInfo(r.Context(), DeviceInfoFromRequest(r))
+	loginResp, err = c.service.LoginUser(ctx, email, password)
+	if err != nil {
+		return nil, err
+	}
+
+	// the refresh token is only kept in the session store
+	cachedUser, found = c.service.Cache.Get(loginResp.Token)
+	if !found {
+		Log("CookieSessions.Login", "Session missing from cache after login")
+		return nil, ErrUserNotFound
+	}
+
+	c.Write(w, r, cookieSessionFromCached(cachedUser))
+	c.setCSRFCookie(w, newCSRFToken())
+
+	return loginResp, nil
+}
+
+// Refresh exchanges the refresh token of the request session and rewrites the session cookies.
+// w is the response receiving the cookies.
+// r is the request carrying the session cookies.
+// Concurrent refreshes of the same session share one Supabase request (see RefreshToken()).
+// Returns the refreshed session, ErrNoSessionCookie, or the refresh error.
+func (c *CookieSessions) Refresh(w http.ResponseWriter, r *http.Request) (*CookieSession, error) {
+	var (
+		session *CookieSession
+		err     error
+	)
+
+	session, err = c.Read(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.refresh(w, r, session)
+}
+
+// Logout ends the request session in Supabase and clears the session and CSRF cookies.
+// w is the response receiving the cleared cookies.
+// r is the request carrying the session cookies.
+// Cookies are cleared even if Supabase rejects the logout.
+// Returns the logout error, or nil if there was no session.
+func (c *CookieSessions) Logout(w http.ResponseWriter, r *http.Request) error {
+	var (
+		session *CookieSession
+		err     error
+	)
+
+	session, err = c.Read(r)
+	c.Clear(w, r)
+	http.SetCookie(w, c.cookie(c.opts.CSRFCookieName, "", -1))
+	if err != nil {
+		return nil
+	}
+
+	return c.service.Logout(r.Context(), session.AccessToken)
+}
+
+// Read decodes the session stored in the request cookies.
+// r is the request carrying the session cookies (single or chunked).
+// Returns the session, ErrNoSessionCookie if there is none, or ErrInvalidCookie if it cannot be decoded.
+func (c *CookieSessions) Read(r *http.Request) (*CookieSession, error) {
+	var (
+		value   string
+		decoded []byte
+		session CookieSession
+		err     error
+	)
+
+	value = c.readChunks(r)
+	if value == "" {
+		return nil, ErrNoSessionCookie
+	}
+
+	if strings.HasPrefix(value, cookieBase64Prefix) {
+		decoded, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(value[len(cookieBase64Prefix):], "="))
+	} else {
+		// older supabase-js versions store URI-encoded JSON
+		value, err = url.QueryUnescape(value)
+		decoded = []byte(value)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+
+	if err = json.Unmarshal(decoded, &session); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCookie, err)
+	}
+	if session.AccessToken == "" {
+		return nil, ErrInvalidCookie
+	}
+
+	return &session, nil
+}
+
+// Write stores session in cookies, split into chunks above DefaultCookieChunkSize.
+// w is the response receiving the cookies.
+// r is the current request, used to delete chunks left over from a larger session.
+// session is the session to store.
+func (c *CookieSessions) Write(w http.ResponseWriter, r *http.Request, session *CookieSession) {
+	var (
+		payload []byte
+		value   string
+		written = make(map[string]bool)
+	)
+
+	payload, _ = json.Marshal(session)
+	value = cookieBase64Prefix + base64.RawURLEncoding.EncodeToString(payload)
+
+	if len(value) <= DefaultCookieChunkSize {
+		http.SetCookie(w, c.cookie(c.opts.Name, value, c.opts.MaxAge))
+		written[c.opts.Name] = true
+	} else {
+		for i := 0; len(value) > 0; i++ {
+			size := min(DefaultCookieChunkSize, len(value))
+			name := c.opts.Name + "." + strconv.Itoa(i)
+			http.SetCookie(w, c.cookie(name, value[:size], c.opts.MaxAge))
+			written[name] = true
+			value = value[size:]
+		}
+	}
+
+	// delete the single cookie or chunks from the previous layout
+	for _, name := range c.sessionCookieNames(r) {
+		if !written[name] {
+			http.SetCookie(w, c.cookie(name, "", -1))
+		}
+	}
+}
+
+// Clear deletes the session cookies present on the request.
+// w is the response receiving the cleared cookies.
+// r is the request carrying the session cookies.
+func (c *CookieSessions) Clear(w http.ResponseWriter, r *http.Request) {
+	for _, name := range c.sessionCookieNames(r) {
+		http.SetCookie(w, c.cookie(name, "", -1))
+	}
+}
+
+// Middleware returns net/http middleware authenticating requests with the session cookies.
+// opts configures optional routes, the realm and error responses (token sources are ignored).
+// Access tokens close to expiry are refreshed transparently and the new cookies are written.
+// State-changing requests (not GET, HEAD, OPTIONS or TRACE) carrying a session must send the CSRF token
+// in CSRFHeaderName or CSRFFormField; mismatches get 403.
+// Authenticated requests carry the user, claims and token in their context (see UserFromContext()),
+// and every request carries its CSRF token (see CSRFTokenFromContext()).
+func (c *CookieSessions) Middleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.Realm == "" {
+		opts.Realm = "supabase"
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = writeAuthError
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				session *CookieSession
+				user    *User
+				claims  *TokenClaims
+				csrf    string
+				err     error
+			)
+
+			csrf = c.ensureCSRF(w, r)
+			r = r.WithContext(context.WithValue(r.Context(), csrfContextKey, csrf))
+
+			session, err = c.Read(r)
+			if err == nil && !c.opts.DisableCSRF && !safeMethod(r.Method) && !c.validCSRF(r, csrf) {
+				Logf("CookieSessions.Middleware", "Rejecting %s %s: CSRF token mismatch", r.Method, r.URL.Path)
+				opts.ErrorHandler(w, r, http.StatusForbidden, ErrCSRFTokenMismatch)
+				return
+			}
+
+			if err == nil && time.Until(time.Unix(session.ExpiresAt, 0)) < c.opts.RefreshMargin {
+				session, err = c.refresh(w, r, session)
+			}
+			if err == nil {
+				user, claims, err = c.service.ValidateToken(r.Context(), session.AccessToken)
+			}
+
+			if err != nil {
+				if !errors.Is(err, ErrNoSessionCookie) && !errors.Is(err, ErrInvalidCookie) && !IsTokenError(err) && !isRefreshRejected(err) {
+					Logf("CookieSessions.Middleware", "Session validation unavailable: %v", err)
+					opts.ErrorHandler(w, r, http.StatusServiceUnavailable, err)
+					return
+				}
+				if !errors.Is(err, ErrNoSessionCookie) {
+					// the session cannot be used anymore
+					c.Clear(w, r)
+				}
+				if opts.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, opts.Realm))
+				opts.ErrorHandler(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user, claims, session.AccessToken)))
+		})
+	}
+}
+
+// CSRFTokenFromContext returns the CSRF token set by CookieSessions.Middleware(), to embed in forms.
+// Returns an empty string and false outside the middleware.
+func CSRFTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(csrfContextKey).(string)
+	return token, ok && token != ""
+}
+
+// refresh exchanges the refresh token of session and writes the new session cookies.
+// Returns the refreshed session or the refresh error.
+func (c *CookieSessions) refresh(w http.ResponseWriter, r *http.Request, session *CookieSession) (*CookieSession, error) {
+	var (
+		refreshResp *RefreshTokenResponse
+		refreshed   CookieSession
+		err         error
+	)
+
+	if session.RefreshToken == "" {
+		return nil, ErrInvalidCookie
+	}
+
+	Logf("CookieSessions.refresh", "Refreshing cookie session - UserID: %s", session.User.ID)
+
+	refreshResp, err = c.service.RefreshToken(r.Context(), session.RefreshToken)
+	if err != nil {
+		Logf("CookieSessions.refresh", "Failed to refresh cookie session: %v", err)
+		return nil, err
+	}
+
+	// keep the stored user, replacing the tokens
+	refreshed = *session
+	refreshed.AccessToken = refreshResp.AccessToken
+	refreshed.RefreshToken = refreshResp.RefreshToken
+	refreshed.ExpiresIn = refreshResp.ExpiresIn
+	refreshed.ExpiresAt = refreshResp.ExpiresAt
+	if refreshResp.TokenType != "" {
+		refreshed.TokenType = refreshResp.TokenType
+	}
+
+	c.Write(w, r, &refreshed)
+
+	return &refreshed, nil
+}
+
+// readChunks returns the raw session cookie value, joining chunks when the session is split.
+func (c *CookieSessions) readChunks(r *http.Request) string {
+	var (
+		b      strings.Builder
+		cookie *http.Cookie
+		err    error
+	)
+
+	cookie, err = r.Cookie(c.opts.Name)
+	if err == nil {
+		return cookie.Value
+	}
+
+	for i := 0; ; i++ {
+		cookie, err = r.Cookie(c.opts.Name + "." + strconv.Itoa(i))
+		if err != nil {
+			break
+		}
+		b.WriteString(cookie.Value)
+	}
+
+	return b.String()
+}
+
+// sessionCookieNames returns the names of the session cookies (single or chunks) present on r.
+func (c *CookieSessions) sessionCookieNames(r *http.Request) []string {
+	var (
+		names []string
+	)
+
+	if r == nil {
+		return nil
+	}
+
+	for _, cookie := range r.Cookies() {
+		if cookie.Name == c.opts.Name {
+			names = append(names, cookie.Name)
+			continue
+		}
+		suffix, found := strings.CutPrefix(cookie.Name, c.opts.Name+".")
+		if _, err := strconv.Atoi(suffix); found && err == nil {
+			names = append(names, cookie.Name)
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// cookie builds a cookie with the configured attributes.
+// maxAge is the cookie lifetime (negative deletes the cookie).
+func (c *CookieSessions) cookie(name, value string, maxAge time.Duration) *http.Cookie {
+	var (
+		cookie *http.Cookie
+	)
+
+	cookie = &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     c.opts.Path,
+		Domain:   c.opts.Domain,
+		MaxAge:   int(maxAge / time.Second),
+		Secure:   !c.opts.Insecure,
+		HttpOnly: !c.opts.ScriptAccess,
+		SameSite: c.opts.SameSite,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	}
+
+	return cookie
+}
+
+// ensureCSRF returns the request CSRF token, issuing a new cookie if there is none.
+func (c *CookieSessions) ensureCSRF(w http.ResponseWriter, r *http.Request) string {
+	var (
+		cookie *http.Cookie
+		token  string
+		err    error
+	)
+
+	cookie, err = r.Cookie(c.opts.CSRFCookieName)
+	if err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+
+	token = newCSRFToken()
+	c.setCSRFCookie(w, token)
+	return token
+}
+
+// setCSRFCookie writes the CSRF cookie, readable by scripts so they can echo it in a header.
+func (c *CookieSessions) setCSRFCookie(w http.ResponseWriter, token string) {
+	var (
+		cookie *http.Cookie
+	)
+
+	cookie = c.cookie(c.opts.CSRFCookieName, token, c.opts.MaxAge)
+	cookie.HttpOnly = false
+	http.SetCookie(w, cookie)
+}
+
+// validCSRF reports whether the request echoes the CSRF cookie in the header or form field (double submit).
+func (c *CookieSessions) validCSRF(r *http.Request, expected string) bool {
+	var (
+		sent string
+	)
+
+	cookie, err := r.Cookie(c.opts.CSRFCookieName)
+	if err != nil || cookie.Value != expected {
+		// a token issued with this response cannot have been echoed yet
+		return false
+	}
+
+	sent = r.Header.Get(c.opts.CSRFHeaderName)
+	if sent == "" {
+		sent = r.PostFormValue(c.opts.CSRFFormField)
+	}
+
+	return sent != "" && subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
+
+// newCSRFToken returns a random CSRF token.
+func newCSRFToken() string {
+	var (
+		buf = make([]byte, 32)
+	)
+
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// safeMethod reports whether method does not change state and needs no CSRF token.
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isRefreshRejected reports whether Supabase rejected a refresh token (the session is over).
+func isRefreshRejected(err error) bool {
+	var (
+		apiErr *APIError
+	)
+
+	return errors.As(err, &apiErr) && apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
+
+// cookieSessionFromCached builds a cookie session from a cached session.
+// user_metadata and app_metadata are copies of the session's raw metadata, as stored by Supabase:
+// the role resolved by Service.RoleSource is never written into them.
+func cookieSessionFromCached(cachedUser *CachedUser) *CookieSession {
+	var (
+		metadata    = cloneMetadata(cachedUser.Metadata)
+		appMetadata = cloneMetadata(cachedUser.AppMetadata)
+	)
+
+	// sessions cached without raw metadata only have the well-known fields
+	if metadata == nil {
+		metadata = map[string]any{}
+		for key, value := range map[string]string{
+			"username":      cachedUser.Username,
+			"display_name":  cachedUser.DisplayName,
+			"date_of_birth": cachedUser.DateOfBirth,
+		} {
+			if value != "" {
+				metadata[key] = value
+			}
+		}
+	}
+	if appMetadata == nil {
+		appMetadata = map[string]any{}
+	}
+
+	return &CookieSession{
+		AccessToken:  cachedUser.AccessToken,
+		TokenType:    "bearer",
+		ExpiresIn:    int(time.Until(cachedUser.ExpiresAt) / time.Second),
+		ExpiresAt:    cachedUser.ExpiresAt.Unix(),
+		RefreshToken: cachedUser.RefreshToken,
+		User: SupabaseUser{
+			ID:           cachedUser.UserID.String(),
+			Aud:          "authenticated",
+			Role:         "authenticated",
+			Email:        cachedUser.Email,
+			Phone:        cachedUser.Phone,
+			AppMetadata:  appMetadata,
+			UserMetadata: metadata,
+		},
+	}
+}
@@ -0,0 +1,188 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// requestWithCookies builds a request carrying the cookies set on rec (deleted cookies are skipped).
+func requestWithCookies(method string, rec *httptest.ResponseRecorder, extra ...*http.Cookie) *http.Request {
+	var (
+		req = httptest.NewRequest(method, "/", nil)
+	)
+
+	for _, cookie := range append(rec.Result().Cookies(), extra...) {
+		if cookie.MaxAge >= 0 {
+			req.AddCookie(cookie)
+		}
+	}
+	return req
+}
+
+// TestCookieSessions tests chunked session cookies, transparent refresh, CSRF checks and logout.
+func TestCookieSessions(t *testing.T) {
+	var (
+		testName     = "TestCookieSessions"
+		service      *Service
+		server       *mockAuthServer
+		cookies      *CookieSessions
+		login        *httptest.ResponseRecorder
+		session      *CookieSession
+		handler      http.Handler
+		csrf         string
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, _, server = newMockService()
+	cookies = service.CookieSessions(CookieOptions{})
+	login = httptest.NewRecorder()
+	_, err = cookies.Login(login, httptest.NewRequest("POST", "/login", nil), server.email, "password")
+	if err == nil {
+		session, err = cookies.Read(requestWithCookies("GET", login))
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Login/read failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// verify: secure httpOnly cookies named like supabase-js
+	for _, cookie := range login.Result().Cookies() {
+		if cookie.Name == "sb-mock-auth-token" && (!cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || !strings.HasPrefix(session.AccessToken, "ey")) {
+			errorMessage = fmt.Sprintf("Unexpected session cookie attributes: %+v", cookie)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+		if cookie.Name == "sb-mock-auth-token-csrf" {
+			csrf = cookie.Value
+		}
+	}
+	if session.RefreshToken == "" || csrf == "" || len(login.Result().Cookies()) != 2 {
+		errorMessage = fmt.Sprintf("Expected session and CSRF cookies, got %d cookies", len(login.Result().Cookies()))
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Login writes secure httpOnly session cookies\n")
+	if session.User.UserMetadata["username"] != "mockuser" || session.User.UserMetadata["role"] != nil || session.User.AppMetadata["role"] != "user" {
+		errorMessage = fmt.Sprintf("Unexpected session metadata: %v / %v", session.User.UserMetadata, session.User.AppMetadata)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Session keeps raw user_metadata and the role in app_metadata\n")
+
+	// verify: a user_metadata role is never promoted to app_metadata in the cookie
+	roleService, _, roleServer := newMockService()
+	roleService.RoleSource = RoleSourceUserMetadata
+	roleServer.metadata["role"] = "admin"
+	delete(roleServer.appMetadata, "role")
+	roleLogin := httptest.NewRecorder()
+	_, err = roleService.CookieSessions(CookieOptions{}).Login(roleLogin, httptest.NewRequest("POST", "/login", nil), roleServer.email, "password")
+	roleSession, readErr := roleService.CookieSessions(CookieOptions{}).Read(requestWithCookies("GET", roleLogin))
+	if err != nil || readErr != nil || roleSession.User.AppMetadata["role"] != nil || roleSession.User.UserMetadata["role"] != "admin" {
+		errorMessage = fmt.Sprintf("Cookie metadata should be written unchanged (err: %v, %v, session: %+v)", err, readErr, roleSession)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ User metadata roles are not copied to app_metadata\n")
+
+	// execute: large sessions are split into chunks, and chunks are dropped once the session shrinks
+	large := *session
+	large.User.UserMetadata = map[string]any{"bio": strings.Repeat("x", 2*DefaultCookieChunkSize)}
+	chunked := httptest.NewRecorder()
+	cookies.Write(chunked, nil, &large)
+	decoded, err := cookies.Read(requestWithCookies("GET", chunked))
+	shrunk := httptest.NewRecorder()
+	cookies.Write(shrunk, requestWithCookies("GET", chunked), session)
+	if err != nil || len(chunked.Result().Cookies()) != 3 || decoded.User.UserMetadata["bio"] != large.User.UserMetadata["bio"] || len(shrunk.Result().Cookies()) != 4 {
+		errorMessage = fmt.Sprintf("Chunked session round trip failed (err: %v, chunks: %d)", err, len(chunked.Result().Cookies()))
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Large sessions chunked and reassembled\n")
+
+	// verify: middleware authenticates and enforces CSRF on state-changing requests
+	handler = cookies.Middleware(MiddlewareOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := UserFromContext(r.Context())
+		fmt.Fprint(w, user.UserID.String())
+	}))
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := serve(requestWithCookies("GET", login)); rec.Code != http.StatusOK || rec.Body.String() != server.userID.String() {
+		errorMessage = fmt.Sprintf("Cookie session should authenticate GET (status %d)", rec.Code)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if rec := serve(requestWithCookies("POST", login)); rec.Code != http.StatusForbidden {
+		errorMessage = fmt.Sprintf("POST without CSRF token should get 403 (status %d)", rec.Code)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	req := requestWithCookies("POST", login)
+	req.Header.Set("X-CSRF-Token", csrf)
+	if rec := serve(req); rec.Code != http.StatusOK {
+		errorMessage = fmt.Sprintf("POST with CSRF token should pass (status %d)", rec.Code)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Middleware authenticates cookies and enforces CSRF\n")
+
+	// execute: a session about to expire is refreshed transparently
+	session.ExpiresAt = time.Now().Add(10 * time.Second).Unix()
+	stale := httptest.NewRecorder()
+	cookies.Write(stale, nil, session)
+	rec := serve(requestWithCookies("GET", stale))
+	refreshed, err := cookies.Read(requestWithCookies("GET", rec))
+	if rec.Code != http.StatusOK || err != nil || refreshed.AccessToken == session.AccessToken || refreshed.User.ID != session.User.ID {
+		errorMessage = fmt.Sprintf("Expiring session should be refreshed (status %d, err %v)", rec.Code, err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Expiring sessions refreshed and rewritten\n")
+
+	// execute: logout clears every chunk
+	logout := httptest.NewRecorder()
+	if err = cookies.Logout(logout, requestWithCookies("POST", login)); err != nil {
+		errorMessage = fmt.Sprintf("Logout failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, cookie := range logout.Result().Cookies() {
+		if strings.HasPrefix(cookie.Name, "sb-mock-auth-token") && cookie.MaxAge >= 0 {
+			errorMessage = fmt.Sprintf("Logout should delete %s", cookie.Name)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Errorf("%s", errorMessage)
+			return
+		}
+	}
+	if _, found := service.Cache.Get(session.AccessToken); found || len(logout.Result().Cookies()) < 2 {
+		errorMessage = "Logout should remove the session from cache and clear its cookies"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Logout clears session cookies\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
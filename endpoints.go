@@ -17,6 +17,9 @@ const (
 	// LogoutPath is the endpoint path for user logout.
 	LogoutPath = "/auth/v1/logout"
 
+	// LogoutLocalPath is the endpoint path for ending only the current session.
+	LogoutLocalPath = "/auth/v1/logout?scope=local"
+
 	// RefreshTokenPath is the endpoint path for token refresh.
 	RefreshTokenPath = "/auth/v1/token?grant_type=refresh_token"
 
@@ -28,4 +31,31 @@ const (
 
 	// DeleteUserPath is the endpoint path for user deletion (admin endpoint).
 	DeleteUserPath = "/auth/v1/admin/users"
+
+	// AdminUsersPath is the endpoint path for listing and fetching users (admin endpoint).
+	AdminUsersPath = "/auth/v1/admin/users"
+
+	// RestBasePath is the base path for PostgREST table endpoints.
+	RestBasePath = "/rest/v1/"
+
+	// RestRPCPath is the base path for PostgREST function calls.
+	RestRPCPath = "/rest/v1/rpc/"
+
+	// StorageBucketPath is the endpoint path for storage bucket operations.
+	StorageBucketPath = "/storage/v1/bucket"
+
+	// StorageObjectPath is the base path for storage object operations.
+	StorageObjectPath = "/storage/v1/object"
+
+	// StorageRenderPath is the base path for transformed image downloads.
+	StorageRenderPath = "/storage/v1/render/image"
+
+	// StorageResumablePath is the endpoint path for TUS resumable uploads.
+	StorageResumablePath = "/storage/v1/upload/resumable"
+
+	// RealtimePath is the endpoint path of the Realtime WebSocket.
+	RealtimePath = "/realtime/v1/websocket"
+
+	// FunctionsBasePath is the base path for Edge Function invocations.
+	FunctionsBasePath = "/functions/v1/"
 )
@@ -0,0 +1,200 @@
+package ft_supabase
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CacheEventType identifies what happened to a cached session.
+type CacheEventType string
+
+// Cache event types.
+const (
+	CacheEventSet    CacheEventType = "set"    // session stored
+	CacheEventHit    CacheEventType = "hit"    // Get() found a valid session
+	CacheEventMiss   CacheEventType = "miss"   // Get() found no valid session
+	CacheEventEvict  CacheEventType = "evict"  // session removed to make room
+	CacheEventExpire CacheEventType = "expire" // expired session removed
+	CacheEventDelete CacheEventType = "delete" // session removed on request
+)
+
+// CacheEventReason explains why a cache event happened.
+type CacheEventReason string
+
+// Cache event reasons.
+const (
+	ReasonNew         CacheEventReason = "new"          // set: first time the session is stored
+	ReasonReplaced    CacheEventReason = "replaced"     // set: existing session replaced (e.g., token refresh)
+	ReasonNotFound    CacheEventReason = "not_found"    // miss: token is not cached
+	ReasonExpired     CacheEventReason = "expired"      // miss/expire: session expired
+	ReasonCapacity    CacheEventReason = "capacity"     // evict: cache full, least recently used session removed
+	ReasonDeleted     CacheEventReason = "deleted"      // delete: Delete() by token (e.g., Logout)
+	ReasonUserDeleted CacheEventReason = "user_deleted" // delete: DeleteByUserID() (e.g., DeleteUser)
+	ReasonRevoked     CacheEventReason = "revoked"      // delete: RevokeSession()
+)
+
+// CacheEvent describes a lifecycle event of a cached session.
+// Type is what happened.
+// Reason is why it happened.
+// UserID is the Supabase user unique identifier (zero for misses).
+// SessionID is the Supabase session identifier (empty for misses).
+// Time is when the event happened.
+// Tokens are never included in events.
+//
+// Used in:
+// - UserCache.Subscribe(), ShardedUserCache.Subscribe() - delivered to hooks
+// - UserCache.Events(), ShardedUserCache.Events() - delivered on channels
+type CacheEvent struct {
+	Type      CacheEventType
+	Reason    CacheEventReason
+	UserID    uuid.UUID
+	SessionID string
+	Time      time.Time
+}
+
+// CacheEventSource is implemented by session stores that publish cache events.
+//
+// Used in:
+// - Audit logs and metrics - observe why sessions disappear
+type CacheEventSource interface {
+	// Subscribe registers a hook called for every cache event and returns a function removing it.
+	Subscribe(fn func(CacheEvent)) (unsubscribe func())
+
+	// Events returns a channel receiving cache events and a function closing it.
+	Events(buffer int) (<-chan CacheEvent, func())
+}
+
+// compile-time checks that the in-memory caches implement CacheEventSource
+var (
+	_ CacheEventSource = (*UserCache)(nil)
+	_ CacheEventSource = (*ShardedUserCache)(nil)
+)
+
+// eventHub holds cache event subscribers.
+// mu guards subscribers and nextID.
+// subscribers are the registered hooks in subscription order.
+// nextID is the ID of the next subscriber.
+// active is the number of subscribers, read without locking on hot paths.
+type eventHub struct {
+	mu          sync.RWMutex
+	subscribers []eventSubscriber
+	nextID      uint64
+	active      atomic.Int32
+}
+
+// eventSubscriber is a registered hook.
+type eventSubscriber struct {
+	id uint64
+	fn func(CacheEvent)
+}
+
+// enabled reports whether anyone listens, so callers can skip building events.
+func (h *eventHub) enabled() bool {
+	return h.active.Load() > 0
+}
+
+// subscribe registers fn and returns a function removing it (safe to call more than once).
+func (h *eventHub) subscribe(fn func(CacheEvent)) func() {
+	var (
+		id   uint64
+		once sync.Once
+	)
+
+	h.mu.Lock()
+	h.nextID++
+	id = h.nextID
+	h.subscribers = append(h.subscribers, eventSubscriber{id: id, fn: fn})
+	h.active.Add(1)
+	h.mu.Unlock()
+
+	return func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			for i, sub := range h.subscribers {
+				if sub.id == id {
+					h.subscribers = append(h.subscribers[:i:i], h.subscribers[i+1:]...)
+					h.active.Add(-1)
+					return
+				}
+			}
+		})
+	}
+}
+
+// stream subscribes a buffered channel; events are dropped when the channel is full.
+// buffer is the channel capacity.
+// Returns the channel and a function unsubscribing and closing it.
+func (h *eventHub) stream(buffer int) (<-chan CacheEvent, func()) {
+	var (
+		ch          chan CacheEvent
+		mu          sync.Mutex
+		closed      bool
+		unsubscribe func()
+	)
+
+	ch = make(chan CacheEvent, buffer)
+	unsubscribe = h.subscribe(func(event CacheEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		if closed {
+			return
+		}
+		// never block the cache on a slow consumer
+		select {
+		case ch <- event:
+		default:
+		}
+	})
+
+	return ch, func() {
+		unsubscribe()
+		mu.Lock()
+		defer mu.Unlock()
+		if !closed {
+			closed = true
+			close(ch)
+		}
+	}
+}
+
+// emit calls every subscriber with each event.
+// Must be called without any cache lock held.
+func (h *eventHub) emit(events []CacheEvent) {
+	var (
+		subscribers []eventSubscriber
+	)
+
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	subscribers = h.subscribers
+	h.mu.RUnlock()
+
+	for _, event := range events {
+		for _, sub := range subscribers {
+			sub.fn(event)
+		}
+	}
+}
+
+// newCacheEvent builds an event for a session.
+// user may be nil for misses.
+func newCacheEvent(eventType CacheEventType, reason CacheEventReason, user *CachedUser) CacheEvent {
+	var (
+		event CacheEvent
+	)
+
+	event = CacheEvent{Type: eventType, Reason: reason, Time: time.Now()}
+	if user != nil {
+		event.UserID = user.UserID
+		event.SessionID = user.SessionID
+	}
+
+	return event
+}
@@ -0,0 +1,113 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestCacheEvents tests that every cache lifecycle event is published with its reason.
+func TestCacheEvents(t *testing.T) {
+	var (
+		testName     = "TestCacheEvents"
+		cache        *UserCache
+		events       []string
+		expected     []string
+		unsubscribe  func()
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: the hook calls back into the cache, which would deadlock if run under the lock
+	cache = NewUserCache()
+	cache.MaxSize = 2
+	unsubscribe = cache.Subscribe(func(event CacheEvent) {
+		events = append(events, fmt.Sprintf("%s/%s/%s", event.Type, event.Reason, event.SessionID))
+		cache.Count()
+	})
+
+	// execute
+	cache.Set("a", &CachedUser{UserID: uuid.New(), SessionID: "a", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("b", &CachedUser{UserID: uuid.New(), SessionID: "b", ExpiresAt: time.Now().Add(-time.Second)})
+	cache.Get("a")
+	cache.Get("b")
+	cache.Get("unknown")
+	cache.Set("c", &CachedUser{UserID: uuid.New(), SessionID: "c", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("d", &CachedUser{UserID: uuid.New(), SessionID: "d", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("d2", &CachedUser{UserID: uuid.New(), SessionID: "d", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Delete("c")
+	cache.RevokeSession("d")
+	unsubscribe()
+	cache.Set("e", &CachedUser{UserID: uuid.New(), SessionID: "e", ExpiresAt: time.Now().Add(time.Hour)})
+
+	// verify
+	expected = []string{
+		"set/new/a",
+		"set/new/b",
+		"hit//a",
+		"miss/expired/b",
+		"miss/not_found/",
+		"expire/expired/b",
+		"set/new/c",
+		"evict/capacity/a",
+		"set/new/d",
+		"set/replaced/d",
+		"delete/deleted/c",
+		"delete/revoked/d",
+	}
+	if fmt.Sprint(events) != fmt.Sprint(expected) {
+		errorMessage = fmt.Sprintf("Unexpected events:\n got: %v\nwant: %v", events, expected)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Set, hit, miss, expire, evict and delete events published outside the lock\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestShardedCacheEventStream tests the channel event stream of a ShardedUserCache.
+func TestShardedCacheEventStream(t *testing.T) {
+	var (
+		testName     = "TestShardedCacheEventStream"
+		cache        *ShardedUserCache
+		stream       <-chan CacheEvent
+		stop         func()
+		userID       uuid.UUID
+		deleted      int
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup
+	cache = NewShardedUserCache(4)
+	stream, stop = cache.Events(16)
+	userID = uuid.New()
+
+	// execute
+	cache.Set("a", &CachedUser{UserID: userID, SessionID: "a", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("b", &CachedUser{UserID: userID, SessionID: "b", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Get("missing")
+	cache.DeleteByUserID(userID)
+	stop()
+	stop()
+
+	// verify: channel is closed after stop and received every event
+	for event := range stream {
+		if event.Type == CacheEventDelete && event.Reason == ReasonUserDeleted && event.UserID == userID {
+			deleted++
+		}
+	}
+	if deleted != 2 {
+		errorMessage = fmt.Sprintf("Expected 2 user_deleted events, got %d", deleted)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Event stream delivered events across shards\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,228 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// FunctionsErrorKind tells where an Edge Function invocation failed.
+type FunctionsErrorKind string
+
+// Edge Function error kinds.
+const (
+	FunctionsFetchError    FunctionsErrorKind = "fetch"    // no response (network error, timeout)
+	FunctionsRelayError    FunctionsErrorKind = "relay"    // the Supabase relay failed (x-relay-error header), the function may not have run
+	FunctionsFunctionError FunctionsErrorKind = "function" // the function answered with a non-2xx status
+)
+
+// FunctionsError is a failed Edge Function invocation.
+// Kind tells whether the request, the relay or the function failed.
+// Function is the function name.
+// StatusCode is the HTTP status code (0 for fetch errors).
+// Body is the error response body (e.g., the function's JSON error).
+// Err is the underlying error of fetch errors.
+// Relay and function errors wrap ErrInvalidStatus; fetch errors wrap Err (itself wrapping ErrSendRequest).
+//
+// Used in:
+// - FunctionsClient.Invoke() - returned on failure
+type FunctionsError struct {
+	Kind       FunctionsErrorKind
+	Function   string
+	StatusCode int
+	Body       []byte
+	Err        error
+}
+
+// Error returns the error message with the kind, function name and status.
+func (e *FunctionsError) Error() string {
+	if e.Kind == FunctionsFetchError {
+		return fmt.Sprintf("edge function %s: fetch error: %v", e.Function, e.Err)
+	}
+	return fmt.Sprintf("edge function %s: %s error (status %d): %s", e.Function, e.Kind, e.StatusCode, string(e.Body))
+}
+
+// Unwrap returns Err for fetch errors, ErrInvalidStatus otherwise.
+func (e *FunctionsError) Unwrap() error {
+	if e.Kind == FunctionsFetchError {
+		return e.Err
+	}
+	return ErrInvalidStatus
+}
+
+// DecodeBody decodes a JSON error body into dest (e.g., the error object returned by the function).
+func (e *FunctionsError) DecodeBody(dest any) error {
+	if err := json.Unmarshal(e.Body, dest); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+	return nil
+}
+
+// InvokeOptions configures an Edge Function invocation.
+// Method is the HTTP method (default POST).
+// Token is the user access token to invoke the function with (empty uses the anon key).
+// ServiceRole invokes the function with the service role key (takes precedence over Token).
+// Headers are extra request headers (a Content-Type here overrides the detected one).
+// Query are query string parameters.
+// Region runs the function in a specific region (e.g., "eu-central-1"; empty lets Supabase pick the closest one).
+//
+// Used in:
+// - FunctionsClient.Invoke() - invocation settings
+type InvokeOptions struct {
+	Method      string
+	Token       string
+	ServiceRole bool
+	Headers     map[string]string
+	Query       url.Values
+	Region      string
+}
+
+// FunctionResponse is a successful Edge Function response; the caller must close it.
+// StatusCode is the HTTP status code.
+// Header are the response headers.
+// Body streams the response body (e.g., server-sent events); use JSON() or Bytes() to read it at once.
+//
+// Used in:
+// - FunctionsClient.Invoke() - returned response
+type FunctionResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       io.ReadCloser
+}
+
+// ContentType returns the response content type.
+func (r *FunctionResponse) ContentType() string {
+	return r.Header.Get(HeaderContentType)
+}
+
+// JSON decodes the JSON response body into dest and closes the body.
+func (r *FunctionResponse) JSON(dest any) error {
+	defer r.Body.Close()
+
+	if err := json.NewDecoder(r.Body).Decode(dest); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+	return nil
+}
+
+// Bytes reads the whole response body (e.g., a generated PDF) and closes it.
+func (r *FunctionResponse) Bytes() ([]byte, error) {
+	defer r.Body.Close()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrReadResponse, err)
+	}
+	return body, nil
+}
+
+// Close closes the response body.
+func (r *FunctionResponse) Close() error {
+	return r.Body.Close()
+}
+
+// FunctionsClient invokes Supabase Edge Functions.
+// service is the service providing the project URL, keys and HTTP client.
+//
+// Used in:
+// - Service.Functions() - creates the client
+type FunctionsClient struct {
+	service *Service
+}
+
+// Functions returns an Edge Functions client.
+func (s *Service) Functions() *FunctionsClient {
+	return &FunctionsClient{service: s}
+}
+
+// Invoke calls an Edge Function and returns its response without reading the body, so it can be streamed.
+// ctx is the context for request cancellation and timeout, including reading the body.
+// name is the function name.
+// body is the request body: nil for none, []byte or io.Reader (application/octet-stream), string (text/plain), anything else encoded as JSON.
+// opts select the method, token, headers, query and region.
+// Returns the response whose body the caller must close, or a *FunctionsError.
+func (f *FunctionsClient) Invoke(ctx context.Context, name string, body any, opts InvokeOptions) (*FunctionResponse, error) {
+	var (
+		endpoint    = f.service.ProjectURL + FunctionsBasePath + url.PathEscape(name)
+		payload     io.Reader
+		encoded     []byte
+		contentType string
+		apiKey      = f.service.AnonKey
+		token       = f.service.AnonKey
+		req         *http.Request
+		resp        *http.Response
+		errBody     []byte
+		err         error
+	)
+
+	switch value := body.(type) {
+	case nil:
+	case []byte:
+		payload, contentType = bytes.NewReader(value), "application/octet-stream"
+	case io.Reader:
+		payload, contentType = value, "application/octet-stream"
+	case string:
+		payload, contentType = strings.NewReader(value), "text/plain"
+	default:
+		encoded, err = json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+		}
+		payload, contentType = bytes.NewReader(encoded), ContentTypeJSON
+	}
+
+	if len(opts.Query) > 0 {
+		endpoint += "?" + opts.Query.Encode()
+	}
+
+	req, err = http.NewRequestWithContext(ctx, strings.ToUpper(cmp.Or(opts.Method, http.MethodPost)), endpoint, payload)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCreateRequest, err)
+	}
+
+	switch {
+	case opts.ServiceRole:
+		apiKey, token = f.service.ServiceKey, f.service.ServiceKey
+	case opts.Token != "":
+		token = opts.Token
+	}
+	req.Header.Set(HeaderAPIKey, apiKey)
+	req.Header.Set(HeaderAuthorization, "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set(HeaderContentType, contentType)
+	}
+	if opts.Region != "" {
+		req.Header.Set("x-region", opts.Region)
+	}
+	for key, value := range opts.Headers {
+		req.Header.Set(key, value)
+	}
+
+	Logf("Functions", "Invoking function - Name: %s, Method: %s", name, req.Method)
+
+	resp, err = f.service.doHTTPStream(req, FunctionsBasePath+name)
+	if err != nil {
+		Logf("Functions", "Invocation failed - Name: %s, Error: %v", name, err)
+		return nil, &FunctionsError{Kind: FunctionsFetchError, Function: name, Err: err}
+	}
+
+	if resp.Header.Get("x-relay-error") == "true" || resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		errBody, _ = io.ReadAll(resp.Body)
+
+		kind := FunctionsFunctionError
+		if resp.Header.Get("x-relay-error") == "true" {
+			kind = FunctionsRelayError
+		}
+		Logf("Functions", "Function returned an error - Name: %s, Kind: %s, Status: %d", name, kind, resp.StatusCode)
+		return nil, &FunctionsError{Kind: kind, Function: name, StatusCode: resp.StatusCode, Body: errBody}
+	}
+
+	return &FunctionResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: resp.Body}, nil
+}
@@ -0,0 +1,131 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestFunctionsInvoke tests JSON, binary and streamed responses, auth and region headers, and relay versus function errors.
+func TestFunctionsInvoke(t *testing.T) {
+	var (
+		testName     = "TestFunctionsInvoke"
+		server       *httptest.Server
+		service      *Service
+		last         *http.Request
+		lastBody     []byte
+		resp         *FunctionResponse
+		greeting     map[string]string
+		pdf          []byte
+		events       []string
+		fnErr        *FunctionsError
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: fake functions relay
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		lastBody, _ = io.ReadAll(r.Body)
+		switch r.URL.Path {
+		case "/functions/v1/hello":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"message":"hello %s"}`, r.URL.Query().Get("name"))
+		case "/functions/v1/pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Write([]byte("%PDF-1.7"))
+		case "/functions/v1/stream":
+			w.Header().Set("Content-Type", "text/event-stream")
+			for i := 0; i < 3; i++ {
+				fmt.Fprintf(w, "data: %d\n\n", i)
+				w.(http.Flusher).Flush()
+			}
+		case "/functions/v1/broken":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			io.WriteString(w, `{"error":"invalid invoice"}`)
+		default:
+			w.Header().Set("x-relay-error", "true")
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code":"NOT_FOUND","message":"Requested function was not found"}`)
+		}
+	}))
+	defer server.Close()
+	service = NewService("mock", server.URL, "anon", "service")
+
+	// execute: JSON request and response as a user, in a region
+	resp, err = service.Functions().Invoke(ctx, "hello", map[string]string{"id": "42"}, InvokeOptions{
+		Token:   "user-token",
+		Region:  "eu-central-1",
+		Query:   map[string][]string{"name": {"ada"}},
+		Headers: map[string]string{"X-Trace": "t1"},
+	})
+	if err == nil {
+		err = resp.JSON(&greeting)
+	}
+	if err != nil || greeting["message"] != "hello ada" || string(lastBody) != `{"id":"42"}` || last.Header.Get("Content-Type") != ContentTypeJSON ||
+		last.Header.Get("Authorization") != "Bearer user-token" || last.Header.Get("x-region") != "eu-central-1" || last.Header.Get("X-Trace") != "t1" {
+		errorMessage = fmt.Sprintf("Unexpected JSON invocation (err: %v, greeting: %v, headers: %v)", err, greeting, last.Header)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ JSON invocations send the user token, region and custom headers\n")
+
+	// execute: binary body and response as the service role, then a streamed response
+	resp, err = service.Functions().Invoke(ctx, "pdf", []byte{1, 2, 3}, InvokeOptions{ServiceRole: true})
+	if err == nil {
+		pdf, err = resp.Bytes()
+	}
+	if err != nil || string(pdf) != "%PDF-1.7" || resp.ContentType() != "application/pdf" || last.Header.Get("Content-Type") != "application/octet-stream" || last.Header.Get("Authorization") != "Bearer service" {
+		errorMessage = fmt.Sprintf("Unexpected binary invocation (err: %v, body: %q)", err, pdf)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	resp, err = service.Functions().Invoke(ctx, "stream", nil, InvokeOptions{Method: http.MethodGet})
+	if err == nil {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if line := scanner.Text(); line != "" {
+				events = append(events, line)
+			}
+		}
+		resp.Close()
+	}
+	if err != nil || len(events) != 3 || events[2] != "data: 2" || last.Method != http.MethodGet {
+		errorMessage = fmt.Sprintf("Unexpected streamed invocation (err: %v, events: %v)", err, events)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Binary and streamed responses are returned unread\n")
+
+	// execute: function error versus relay error
+	_, err = service.Functions().Invoke(ctx, "broken", nil, InvokeOptions{})
+	var details map[string]string
+	if !errors.As(err, &fnErr) || fnErr.Kind != FunctionsFunctionError || fnErr.StatusCode != http.StatusUnprocessableEntity || fnErr.DecodeBody(&details) != nil || details["error"] != "invalid invoice" {
+		errorMessage = fmt.Sprintf("Expected a function error, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	_, err = service.Functions().Invoke(ctx, "missing", nil, InvokeOptions{})
+	if !errors.As(err, &fnErr) || fnErr.Kind != FunctionsRelayError || !errors.Is(err, ErrInvalidStatus) {
+		errorMessage = fmt.Sprintf("Expected a relay error, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Relay errors are distinguished from function errors\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,83 @@
+package grpcauth
+
+import (
+	"context"
+	"errors"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// ErrNoToken is returned by a TokenSource with no token to send.
+var ErrNoToken = errors.New("no token available for outgoing call")
+
+// TokenSource returns the access token to send with an outgoing call.
+//
+// Used in:
+// - UnaryClientInterceptor(), StreamClientInterceptor() - inject the token into outgoing metadata
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource always sending token.
+func StaticToken(token string) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// ServiceRoleToken returns a TokenSource sending the service role key, for calls made by the service itself.
+// Keep it for trusted backends: the service role bypasses row-level security.
+// The key carries no user, so grpcauth servers reject it unless their Options.ServiceKey is set to the same key.
+func ServiceRoleToken(service *ft_supabase.Service) TokenSource {
+	return func(ctx context.Context) (string, error) {
+		if service.ServiceKey == "" {
+			return "", ErrNoToken
+		}
+		return service.ServiceKey, nil
+	}
+}
+
+// ForwardedToken returns a TokenSource forwarding the user token of the call context
+// (set by ft_supabase middleware or the server interceptors), to call other services on behalf of the user.
+func ForwardedToken() TokenSource {
+	return func(ctx context.Context) (string, error) {
+		token, ok := ft_supabase.TokenFromContext(ctx)
+		if !ok {
+			return "", ErrNoToken
+		}
+		return token, nil
+	}
+}
+
+// UnaryClientInterceptor returns a unary client interceptor adding "authorization: Bearer <token>" to outgoing calls.
+// source returns the token for each call; its errors fail the call before it is sent.
+func UnaryClientInterceptor(source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := withToken(ctx, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a stream client interceptor adding "authorization: Bearer <token>" to outgoing streams.
+// source returns the token for each stream; its errors fail the stream before it is opened.
+func StreamClientInterceptor(source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := withToken(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// withToken returns ctx with the token of source appended to the outgoing metadata.
+func withToken(ctx context.Context, source TokenSource) (context.Context, error) {
+	token, err := source(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx, DefaultMetadataKey, "Bearer "+token), nil
+}
@@ -0,0 +1,17 @@
+module github.com/Cleroy288/ft_supabase/grpcauth
+
+go 1.25.1
+
+require (
+	github.com/Cleroy288/ft_supabase v0.0.0-20261018123811-ff6b123d73c7
+	github.com/google/uuid v1.6.0
+	google.golang.org/grpc v1.81.1
+)
+
+require (
+	golang.org/x/net v0.51.0 // indirect
+	golang.org/x/sys v0.42.0 // indirect
+	golang.org/x/text v0.34.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20260226221140-a57be14db171 // indirect
+	google.golang.org/protobuf v1.36.11 // indirect
+)
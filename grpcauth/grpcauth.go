@@ -0,0 +1,206 @@
+// Package grpcauth provides gRPC interceptors authenticating calls with Supabase access tokens.
+//
+// It lives in its own module so the core ft_supabase module does not depend on gRPC.
+// Server interceptors read "authorization: Bearer <token>" from incoming metadata, validate
+// the token through ft_supabase.Service.ValidateToken (cache, local JWT or API) and attach
+// the user to the context, readable with ft_supabase.UserFromContext. Client interceptors
+// inject a service role or user token into outgoing metadata.
+package grpcauth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMetadataKey is the metadata key carrying the bearer token (gRPC metadata keys are lower-case).
+const DefaultMetadataKey = "authorization"
+
+// ServiceRole is the User.Role of calls authenticated with Options.ServiceKey.
+const ServiceRole = "service_role"
+
+// TokenValidator validates access tokens; *ft_supabase.Service implements it.
+//
+// Used in:
+// - UnaryServerInterceptor(), StreamServerInterceptor() - validate incoming tokens
+type TokenValidator interface {
+	ValidateToken(ctx context.Context, token string) (*ft_supabase.User, *ft_supabase.TokenClaims, error)
+}
+
+// compile-time check that Service implements TokenValidator
+var _ TokenValidator = (*ft_supabase.Service)(nil)
+
+// Options configures the server interceptors.
+// MetadataKey is the metadata key carrying the bearer token (default "authorization").
+// Optional lets calls without a token through anonymously (except methods listed in Roles); invalid tokens are still rejected.
+// SkipMethods are full method names (e.g., "/grpc.health.v1.Health/Check") that are never authenticated.
+// Roles maps full method names or service prefixes (e.g., "/admin.v1.AdminService/") to the roles allowed to call them.
+// Roles are matched against User.Role, read from the app_metadata claim by default (see ft_supabase.Service.RoleSource).
+// Authorize is an extra check run for authenticated calls (e.g., an authz.Policy); a non-nil error denies the call.
+// ServiceKey opts in to calls made with the service role key (see ServiceRoleToken()): a bearer token equal to it
+// authenticates the call as a user with no ID and Role ServiceRole, still subject to Roles and Authorize.
+// Leave it empty to reject the service key, which carries no user (the default).
+//
+// Used in:
+// - UnaryServerInterceptor(), StreamServerInterceptor() - configure authentication and role checks
+type Options struct {
+	MetadataKey string
+	Optional    bool
+	SkipMethods []string
+	Roles       map[string][]string
+	Authorize   func(ctx context.Context, user *ft_supabase.User, fullMethod string) error
+	ServiceKey  string
+}
+
+// UnaryServerInterceptor returns a unary server interceptor authenticating calls.
+// validator validates tokens (usually the *ft_supabase.Service).
+// opts configures token lookup, skipped methods and role checks.
+// Missing or invalid tokens fail with codes.Unauthenticated, role check failures with codes.PermissionDenied.
+func UnaryServerInterceptor(validator TokenValidator, opts Options) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, validator, opts, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a stream server interceptor authenticating calls.
+// validator validates tokens (usually the *ft_supabase.Service).
+// opts configures token lookup, skipped methods and role checks.
+// The stream passed to the handler returns the authenticated context.
+func StreamServerInterceptor(validator TokenValidator, opts Options) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), validator, opts, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
+
+// authenticatedStream overrides the context of a server stream.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the authenticated context.
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate validates the token of a call and runs the role checks.
+// Returns the context carrying the user, or a gRPC status error.
+func authenticate(ctx context.Context, validator TokenValidator, opts Options, fullMethod string) (context.Context, error) {
+	var (
+		token  string
+		user   *ft_supabase.User
+		claims *ft_supabase.TokenClaims
+		err    error
+	)
+
+	for _, method := range opts.SkipMethods {
+		if method == fullMethod {
+			return ctx, nil
+		}
+	}
+
+	token = tokenFromMetadata(ctx, opts.MetadataKey)
+	if token == "" {
+		if opts.Optional && allowedRoles(opts.Roles, fullMethod) == nil {
+			return ctx, nil
+		}
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token")
+	}
+
+	if opts.ServiceKey != "" && subtle.ConstantTimeCompare([]byte(token), []byte(opts.ServiceKey)) == 1 {
+		user = &ft_supabase.User{Role: ServiceRole}
+		claims, _ = ft_supabase.ParseTokenClaims(token)
+	} else {
+		user, claims, err = validator.ValidateToken(ctx, token)
+	}
+	if err != nil {
+		if ft_supabase.IsTokenError(err) {
+			ft_supabase.Logf("grpcauth", "Rejecting %s: %v", fullMethod, err)
+			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		}
+		ft_supabase.Logf("grpcauth", "Token validation unavailable for %s: %v", fullMethod, err)
+		return nil, status.Error(codes.Unavailable, "authentication service unavailable")
+	}
+
+	if roles := allowedRoles(opts.Roles, fullMethod); roles != nil && !containsRole(roles, user.Role) {
+		ft_supabase.Logf("grpcauth", "Denying %s - UserID: %s, Role: %q", fullMethod, user.UserID.String(), user.Role)
+		return nil, status.Error(codes.PermissionDenied, "insufficient role")
+	}
+
+	ctx = ft_supabase.ContextWithUser(ctx, user, claims, token)
+	if opts.Authorize != nil {
+		if err = opts.Authorize(ctx, user, fullMethod); err != nil {
+			ft_supabase.Logf("grpcauth", "Denying %s - UserID: %s: %v", fullMethod, user.UserID.String(), err)
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, status.Error(codes.PermissionDenied, "permission denied")
+		}
+	}
+
+	return ctx, nil
+}
+
+// tokenFromMetadata returns the bearer token of the incoming metadata, or an empty string.
+func tokenFromMetadata(ctx context.Context, key string) string {
+	if key == "" {
+		key = DefaultMetadataKey
+	}
+
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	for _, value := range md.Get(key) {
+		if len(value) > 7 && strings.EqualFold(value[:7], "bearer ") {
+			return strings.TrimSpace(value[7:])
+		}
+	}
+
+	return ""
+}
+
+// allowedRoles returns the roles configured for a method, preferring the exact method over the longest service prefix.
+// Returns nil if the method has no role requirement.
+func allowedRoles(roles map[string][]string, fullMethod string) []string {
+	var (
+		best   []string
+		length = -1
+	)
+
+	if allowed, ok := roles[fullMethod]; ok {
+		return allowed
+	}
+	for prefix, allowed := range roles {
+		if strings.HasSuffix(prefix, "/") && strings.HasPrefix(fullMethod, prefix) && len(prefix) > length {
+			best, length = allowed, len(prefix)
+		}
+	}
+
+	return best
+}
+
+// containsRole reports whether role is one of roles.
+func containsRole(roles []string, role string) bool {
+	for _, allowed := range roles {
+		if allowed == role {
+			return true
+		}
+	}
+	return false
+}
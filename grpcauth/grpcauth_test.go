@@ -0,0 +1,194 @@
+package grpcauth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	ft_supabase "github.com/Cleroy288/ft_supabase"
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// signToken builds an HS256 access token for userID signed with secret.
+func signToken(userID uuid.UUID, role string, secret []byte) string {
+	var (
+		unsigned string
+		payload  []byte
+		mac      = hmac.New(sha256.New, secret)
+	)
+
+	payload, _ = json.Marshal(ft_supabase.TokenClaims{
+		Subject:     userID.String(),
+		ExpiresAt:   time.Now().Add(time.Hour).Unix(),
+		AppMetadata: map[string]any{"role": role},
+	})
+	unsigned = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestUnaryServerInterceptor tests authentication and role checks on unary calls.
+func TestUnaryServerInterceptor(t *testing.T) {
+	var (
+		service     *ft_supabase.Service
+		interceptor grpc.UnaryServerInterceptor
+		userID      = uuid.New()
+	)
+
+	// setup: tokens verified locally with the JWT secret
+	ft_supabase.SetLoggingEnabled(false)
+	defer ft_supabase.SetLoggingEnabled(true)
+	service = ft_supabase.NewService("test", "http://127.0.0.1:0", "anon", "service")
+	service.JWTSecret = []byte("secret")
+	interceptor = UnaryServerInterceptor(service, Options{
+		SkipMethods: []string{"/grpc.health.v1.Health/Check"},
+		Roles:       map[string][]string{"/admin.v1.Admin/": {"admin"}},
+	})
+	handler := func(ctx context.Context, req any) (any, error) {
+		user, ok := ft_supabase.UserFromContext(ctx)
+		if !ok {
+			return "anonymous", nil
+		}
+		return user.UserID.String(), nil
+	}
+	call := func(method, token string) (any, codes.Code) {
+		ctx := context.Background()
+		if token != "" {
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+		}
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return resp, status.Code(err)
+	}
+
+	// verify
+	if resp, code := call("/posts.v1.Posts/List", signToken(userID, "user", service.JWTSecret)); code != codes.OK || resp != userID.String() {
+		t.Fatalf("Valid token should authenticate, got %v %v", resp, code)
+	}
+	if _, code := call("/posts.v1.Posts/List", ""); code != codes.Unauthenticated {
+		t.Fatalf("Missing token should be Unauthenticated, got %v", code)
+	}
+	if _, code := call("/posts.v1.Posts/List", signToken(userID, "user", []byte("forged"))); code != codes.Unauthenticated {
+		t.Fatalf("Forged token should be Unauthenticated, got %v", code)
+	}
+	if _, code := call("/admin.v1.Admin/Ban", signToken(userID, "user", service.JWTSecret)); code != codes.PermissionDenied {
+		t.Fatalf("Wrong role should be PermissionDenied, got %v", code)
+	}
+	if _, code := call("/admin.v1.Admin/Ban", signToken(userID, "admin", service.JWTSecret)); code != codes.OK {
+		t.Fatalf("Admin role should be allowed, got %v", code)
+	}
+	if resp, code := call("/grpc.health.v1.Health/Check", ""); code != codes.OK || resp != "anonymous" {
+		t.Errorf("Skipped methods should not require a token, got %v %v", resp, code)
+	}
+	if _, code := call("/posts.v1.Posts/List", service.ServiceKey); code != codes.Unauthenticated {
+		t.Fatalf("Service key should be rejected without ServiceKey, got %v", code)
+	}
+}
+
+// TestServiceKeyOptIn tests that ServiceRoleToken calls are accepted only when the server opts in.
+func TestServiceKeyOptIn(t *testing.T) {
+	var (
+		service     *ft_supabase.Service
+		interceptor grpc.UnaryServerInterceptor
+		sent        string
+	)
+
+	// setup: the client sends the service key, the server accepts it for admin methods
+	ft_supabase.SetLoggingEnabled(false)
+	defer ft_supabase.SetLoggingEnabled(true)
+	service = ft_supabase.NewService("test", "http://127.0.0.1:0", "anon", "service-key")
+	service.JWTSecret = []byte("secret")
+	interceptor = UnaryServerInterceptor(service, Options{
+		ServiceKey: service.ServiceKey,
+		Roles:      map[string][]string{"/admin.v1.Admin/": {ServiceRole}, "/billing.v1.Billing/": {"admin"}},
+	})
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get("authorization")[0]
+		return nil
+	}
+	handler := func(ctx context.Context, req any) (any, error) {
+		user, _ := ft_supabase.UserFromContext(ctx)
+		return user.Role, nil
+	}
+	call := func(method string) (any, codes.Code) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", sent))
+		resp, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return resp, status.Code(err)
+	}
+
+	// execute
+	if err := UnaryClientInterceptor(ServiceRoleToken(service))(context.Background(), "/admin.v1.Admin/Ban", nil, nil, nil, invoker); err != nil || sent != "Bearer service-key" {
+		t.Fatalf("Client interceptor should send the service key (err: %v, sent: %q)", err, sent)
+	}
+
+	// verify
+	if resp, code := call("/admin.v1.Admin/Ban"); code != codes.OK || resp != ServiceRole {
+		t.Fatalf("Service key should authenticate as %s, got %v %v", ServiceRole, resp, code)
+	}
+	if _, code := call("/billing.v1.Billing/Refund"); code != codes.PermissionDenied {
+		t.Errorf("Service role should still be subject to Roles, got %v", code)
+	}
+}
+
+// TestStreamAndClientInterceptors tests the stream context override and client token injection.
+func TestStreamAndClientInterceptors(t *testing.T) {
+	var (
+		service *ft_supabase.Service
+		userID  = uuid.New()
+		token   string
+		sent    string
+	)
+
+	// setup
+	ft_supabase.SetLoggingEnabled(false)
+	defer ft_supabase.SetLoggingEnabled(true)
+	service = ft_supabase.NewService("test", "http://127.0.0.1:0", "anon", "service")
+	service.JWTSecret = []byte("secret")
+	token = signToken(userID, "user", service.JWTSecret)
+
+	// execute: the client interceptor forwards the user token of the context
+	invoker := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = md.Get("authorization")[0]
+		return nil
+	}
+	ctx := ft_supabase.ContextWithUser(context.Background(), &ft_supabase.User{UserID: userID}, nil, token)
+	if err := UnaryClientInterceptor(ForwardedToken())(ctx, "/posts.v1.Posts/List", nil, nil, nil, invoker); err != nil || sent != "Bearer "+token {
+		t.Fatalf("Client interceptor should forward the user token (err: %v)", err)
+	}
+	if err := UnaryClientInterceptor(ForwardedToken())(context.Background(), "/posts.v1.Posts/List", nil, nil, nil, invoker); !errors.Is(err, ErrNoToken) {
+		t.Fatalf("Expected ErrNoToken without a user token, got %v", err)
+	}
+
+	// execute: the stream handler sees the authenticated context
+	stream := &fakeServerStream{ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", sent))}
+	err := StreamServerInterceptor(service, Options{})(nil, stream, &grpc.StreamServerInfo{FullMethod: "/chat.v1.Chat/Join"}, func(srv any, stream grpc.ServerStream) error {
+		if user, ok := ft_supabase.UserFromContext(stream.Context()); !ok || user.UserID != userID {
+			return errors.New("user missing from stream context")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Stream interceptor failed: %v", err)
+	}
+}
+
+// fakeServerStream is a grpc.ServerStream carrying a context.
+type fakeServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the stream context.
+func (s *fakeServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,397 @@
+package ft_supabase
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Auth hook defaults.
+const (
+	// DefaultWebhookTolerance is the maximum age (and clock skew) of a webhook timestamp.
+	DefaultWebhookTolerance = 5 * time.Minute
+
+	// maxHookBodySize bounds the size of a hook request body.
+	maxHookBodySize = 1 << 20
+)
+
+// Hook decisions for verification attempt hooks.
+const (
+	HookDecisionContinue = "continue" // let GoTrue apply its default behavior
+	HookDecisionReject   = "reject"   // reject the attempt with Message
+)
+
+// Sentinel errors for webhook verification.
+var (
+	ErrWebhookSecret    = errors.New("invalid webhook secret")
+	ErrWebhookSignature = errors.New("invalid webhook signature")
+	ErrWebhookTimestamp = errors.New("webhook timestamp outside the tolerance window")
+	ErrWebhookReplay    = errors.New("webhook already received")
+)
+
+// HookError is an error returned to GoTrue by a hook handler.
+// HTTPCode is the HTTP status GoTrue reports to the client (e.g., 400, 429).
+// Message is shown to the client.
+// Handlers return it to reject a request with a specific status (400 if HTTPCode is not an error code).
+// It is sent in a 200 response, as GoTrue only reads the error object of successful hook responses.
+// Other errors become 500 with a generic message, and the webhook ID is released.
+//
+// Used in:
+// - AuthHooks handlers - rejecting requests
+type HookError struct {
+	HTTPCode int    `json:"http_code"`
+	Message  string `json:"message"`
+}
+
+// Error returns the error message with the HTTP code.
+func (e *HookError) Error() string {
+	return fmt.Sprintf("hook error (status %d): %s", e.HTTPCode, e.Message)
+}
+
+// CustomAccessTokenInput is the payload of the custom access token hook.
+// UserID is the user the token is issued for.
+// Claims are the claims GoTrue is about to sign.
+// AuthenticationMethod is how the user signed in (e.g., "password", "oauth", "token_refresh").
+//
+// Used in:
+// - AuthHooks.CustomAccessToken() - handler input
+type CustomAccessTokenInput struct {
+	UserID               uuid.UUID      `json:"user_id"`
+	Claims               map[string]any `json:"claims"`
+	AuthenticationMethod string         `json:"authentication_method"`
+}
+
+// CustomAccessTokenOutput is the response of the custom access token hook.
+// Claims are the claims to sign; they must keep the required claims (aud, exp, iat, sub, role, aal, session_id, ...).
+//
+// Used in:
+// - AuthHooks.CustomAccessToken() - handler output
+type CustomAccessTokenOutput struct {
+	Claims map[string]any `json:"claims"`
+}
+
+// EmailData describes the email to send.
+// Token is the OTP code.
+// TokenHash is the hash used in confirmation links.
+// RedirectTo is the redirect URL requested by the client.
+// EmailActionType is the email kind ("signup", "magiclink", "recovery", "invite", "email_change", "reauthentication").
+// SiteURL is the project's site URL.
+// TokenNew and TokenHashNew are the OTP and hash for the new address of email changes.
+//
+// Used in:
+// - SendEmailInput - email details
+type EmailData struct {
+	Token           string `json:"token"`
+	TokenHash       string `json:"token_hash"`
+	RedirectTo      string `json:"redirect_to"`
+	EmailActionType string `json:"email_action_type"`
+	SiteURL         string `json:"site_url"`
+	TokenNew        string `json:"token_new"`
+	TokenHashNew    string `json:"token_hash_new"`
+}
+
+// SendEmailInput is the payload of the send email hook.
+// User is the recipient.
+// EmailData describes the email to send.
+//
+// Used in:
+// - AuthHooks.SendEmail() - handler input
+type SendEmailInput struct {
+	User      SupabaseUser `json:"user"`
+	EmailData EmailData    `json:"email_data"`
+}
+
+// SendSMSInput is the payload of the send SMS hook.
+// User is the recipient.
+// SMS holds the OTP to send.
+//
+// Used in:
+// - AuthHooks.SendSMS() - handler input
+type SendSMSInput struct {
+	User SupabaseUser `json:"user"`
+	SMS  struct {
+		OTP string `json:"otp"`
+	} `json:"sms"`
+}
+
+// MFAVerificationAttemptInput is the payload of the MFA verification attempt hook.
+// FactorID is the MFA factor being verified.
+// FactorType is the factor type ("totp", "phone").
+// UserID is the user verifying the factor.
+// Valid is true if the code was correct.
+//
+// Used in:
+// - AuthHooks.MFAVerificationAttempt() - handler input
+type MFAVerificationAttemptInput struct {
+	FactorID   string    `json:"factor_id"`
+	FactorType string    `json:"factor_type"`
+	UserID     uuid.UUID `json:"user_id"`
+	Valid      bool      `json:"valid"`
+}
+
+// PasswordVerificationAttemptInput is the payload of the password verification attempt hook.
+// UserID is the user signing in.
+// Valid is true if the password was correct.
+//
+// Used in:
+// - AuthHooks.PasswordVerificationAttempt() - handler input
+type PasswordVerificationAttemptInput struct {
+	UserID uuid.UUID `json:"user_id"`
+	Valid  bool      `json:"valid"`
+}
+
+// HookDecision is the response of verification attempt hooks.
+// Decision is HookDecisionContinue or HookDecisionReject.
+// Message is shown to the user when rejecting.
+// ShouldLogoutUser signs the user out of all sessions (password verification attempts only).
+//
+// Used in:
+// - AuthHooks.MFAVerificationAttempt(), AuthHooks.PasswordVerificationAttempt() - handler output
+type HookDecision struct {
+	Decision         string `json:"decision"`
+	Message          string `json:"message,omitempty"`
+	ShouldLogoutUser bool   `json:"should_logout_user,omitempty"`
+}
+
+// AuthHooksOptions configures AuthHooks.
+// Secrets are the hook secrets from the dashboard ("v1,whsec_<base64>"); several secrets allow rotation.
+// Tolerance is the maximum age and clock skew of webhook timestamps (default 5 minutes).
+//
+// Used in:
+// - NewAuthHooks() - configures the receiver
+type AuthHooksOptions struct {
+	Secrets   []string
+	Tolerance time.Duration
+}
+
+// AuthHooks receives Supabase Auth Hooks over HTTP, verifying Standard Webhooks signatures.
+// secrets are the decoded signing keys.
+// tolerance is the accepted timestamp window.
+// mu guards seen.
+// seen maps received webhook IDs to their timestamp, to reject replays within the window.
+//
+// Used in:
+// - NewAuthHooks() - creates the receiver
+type AuthHooks struct {
+	secrets   [][]byte
+	tolerance time.Duration
+	mu        sync.Mutex
+	seen      map[string]time.Time
+}
+
+// NewAuthHooks creates an Auth Hooks receiver.
+// opts are the secrets and tolerance.
+// Returns an error wrapping ErrWebhookSecret if no secret is given or one cannot be decoded.
+func NewAuthHooks(opts AuthHooksOptions) (*AuthHooks, error) {
+	var (
+		hooks = &AuthHooks{tolerance: opts.Tolerance, seen: make(map[string]time.Time)}
+	)
+
+	if hooks.tolerance <= 0 {
+		hooks.tolerance = DefaultWebhookTolerance
+	}
+	if len(opts.Secrets) == 0 {
+		return nil, fmt.Errorf("%w: no secret", ErrWebhookSecret)
+	}
+
+	for _, secret := range opts.Secrets {
+		secret = strings.TrimPrefix(strings.TrimPrefix(secret, "v1,"), "whsec_")
+		key, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil || len(key) == 0 {
+			return nil, fmt.Errorf("%w: expected v1,whsec_<base64>", ErrWebhookSecret)
+		}
+		hooks.secrets = append(hooks.secrets, key)
+	}
+
+	return hooks, nil
+}
+
+// CustomAccessToken returns the handler of the custom access token hook.
+// fn returns the claims to sign (e.g., input.Claims with extra claims).
+func (h *AuthHooks) CustomAccessToken(fn func(ctx context.Context, input CustomAccessTokenInput) (CustomAccessTokenOutput, error)) http.Handler {
+	return hookHandler(h, "custom_access_token", fn)
+}
+
+// SendEmail returns the handler of the send email hook; fn sends the email.
+func (h *AuthHooks) SendEmail(fn func(ctx context.Context, input SendEmailInput) error) http.Handler {
+	return hookHandler(h, "send_email", func(ctx context.Context, input SendEmailInput) (struct{}, error) {
+		return struct{}{}, fn(ctx, input)
+	})
+}
+
+// SendSMS returns the handler of the send SMS hook; fn sends the SMS.
+func (h *AuthHooks) SendSMS(fn func(ctx context.Context, input SendSMSInput) error) http.Handler {
+	return hookHandler(h, "send_sms", func(ctx context.Context, input SendSMSInput) (struct{}, error) {
+		return struct{}{}, fn(ctx, input)
+	})
+}
+
+// MFAVerificationAttempt returns the handler of the MFA verification attempt hook.
+// fn decides whether the attempt continues.
+func (h *AuthHooks) MFAVerificationAttempt(fn func(ctx context.Context, input MFAVerificationAttemptInput) (HookDecision, error)) http.Handler {
+	return hookHandler(h, "mfa_verification_attempt", fn)
+}
+
+// PasswordVerificationAttempt returns the handler of the password verification attempt hook.
+// fn decides whether the attempt continues.
+func (h *AuthHooks) PasswordVerificationAttempt(fn func(ctx context.Context, input PasswordVerificationAttemptInput) (HookDecision, error)) http.Handler {
+	return hookHandler(h, "password_verification_attempt", fn)
+}
+
+// Verify checks the Standard Webhooks headers of a request body.
+// header are the request headers (webhook-id, webhook-timestamp, webhook-signature).
+// body is the raw request body.
+// now is the reference time for the tolerance window.
+// Returns ErrWebhookSignature, ErrWebhookTimestamp or ErrWebhookReplay on failure.
+func (h *AuthHooks) Verify(header http.Header, body []byte, now time.Time) error {
+	var (
+		id        = header.Get("webhook-id")
+		timestamp = header.Get("webhook-timestamp")
+		signed    time.Time
+		valid     bool
+	)
+
+	if id == "" || timestamp == "" || header.Get("webhook-signature") == "" {
+		return fmt.Errorf("%w: missing webhook headers", ErrWebhookSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: invalid timestamp", ErrWebhookTimestamp)
+	}
+	signed = time.Unix(seconds, 0)
+	if now.Sub(signed) > h.tolerance || signed.Sub(now) > h.tolerance {
+		return ErrWebhookTimestamp
+	}
+
+	for _, key := range h.secrets {
+		mac := hmac.New(sha256.New, key)
+		fmt.Fprintf(mac, "%s.%s.", id, timestamp)
+		mac.Write(body)
+		expected := mac.Sum(nil)
+
+		for _, signature := range strings.Fields(header.Get("webhook-signature")) {
+			version, encoded, found := strings.Cut(signature, ",")
+			if !found || version != "v1" {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(encoded)
+			if err == nil && hmac.Equal(decoded, expected) {
+				valid = true
+			}
+		}
+	}
+	if !valid {
+		return ErrWebhookSignature
+	}
+
+	// signatures are only checked once per ID within the window
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for seenID, at := range h.seen {
+		if now.Sub(at) > 2*h.tolerance {
+			delete(h.seen, seenID)
+		}
+	}
+	if _, replayed := h.seen[id]; replayed {
+		return ErrWebhookReplay
+	}
+	h.seen[id] = signed
+
+	return nil
+}
+
+// forget removes a webhook ID from the replay window so a retry of a failed hook is accepted.
+func (h *AuthHooks) forget(id string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.seen, id)
+}
+
+// hookHandler verifies a hook request, decodes its payload, calls fn and writes its response in the GoTrue shape.
+// hooks is the receiver verifying signatures.
+// name is the hook name used in logs.
+// fn is the user handler.
+func hookHandler[In, Out any](hooks *AuthHooks, name string, fn func(ctx context.Context, input In) (Out, error)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var (
+			input    In
+			output   Out
+			hookErr  *HookError
+			body     []byte
+			response []byte
+			err      error
+		)
+
+		if r.Method != http.MethodPost {
+			writeHookError(w, http.StatusMethodNotAllowed, &HookError{HTTPCode: http.StatusMethodNotAllowed, Message: "method not allowed"})
+			return
+		}
+
+		body, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxHookBodySize))
+		if err != nil {
+			writeHookError(w, http.StatusRequestEntityTooLarge, &HookError{HTTPCode: http.StatusRequestEntityTooLarge, Message: "request body too large"})
+			return
+		}
+
+		if err = hooks.Verify(r.Header, body, time.Now()); err != nil {
+			Logf("AuthHooks", "Rejected %s hook: %v", name, err)
+			writeHookError(w, http.StatusUnauthorized, &HookError{HTTPCode: http.StatusUnauthorized, Message: "invalid webhook signature"})
+			return
+		}
+
+		if err = json.Unmarshal(body, &input); err != nil {
+			Logf("AuthHooks", "Invalid %s payload: %v", name, err)
+			writeHookError(w, http.StatusBadRequest, &HookError{HTTPCode: http.StatusBadRequest, Message: "invalid hook payload"})
+			return
+		}
+
+		output, err = fn(r.Context(), input)
+		if errors.As(err, &hookErr) {
+			writeHookError(w, http.StatusOK, hookErr)
+			return
+		}
+		if err != nil {
+			// GoTrue does not retry a 500, but a redelivery of the same message must not be taken for a replay
+			hooks.forget(r.Header.Get("webhook-id"))
+			Logf("AuthHooks", "%s hook failed: %v", name, err)
+			writeHookError(w, http.StatusInternalServerError, &HookError{HTTPCode: http.StatusInternalServerError, Message: "hook failed"})
+			return
+		}
+
+		response, err = json.Marshal(output)
+		if err != nil {
+			Logf("AuthHooks", "Failed to encode %s response: %v", name, err)
+			writeHookError(w, http.StatusInternalServerError, &HookError{HTTPCode: http.StatusInternalServerError, Message: "hook failed"})
+			return
+		}
+
+		w.Header().Set(HeaderContentType, ContentTypeJSON)
+		w.Write(response)
+	})
+}
+
+// writeHookError writes an error in the shape GoTrue expects: {"error": {"http_code": ..., "message": ...}}.
+// status is the HTTP status of the response: 200 for handler HookErrors, an error code for verification,
+// payload and internal failures.
+// HookErrors without a valid error code are sent with http_code 400.
+func writeHookError(w http.ResponseWriter, status int, hookErr *HookError) {
+	if hookErr.HTTPCode < 400 || hookErr.HTTPCode > 599 {
+		hookErr = &HookError{HTTPCode: http.StatusBadRequest, Message: hookErr.Message}
+	}
+	w.Header().Set(HeaderContentType, ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]*HookError{"error": hookErr})
+}
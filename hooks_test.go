@@ -0,0 +1,138 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// signedHookRequest builds a hook request signed like GoTrue (Standard Webhooks).
+func signedHookRequest(key []byte, id string, at time.Time, body string) *http.Request {
+	var (
+		req       = httptest.NewRequest(http.MethodPost, "/hooks", bytes.NewBufferString(body))
+		timestamp = strconv.FormatInt(at.Unix(), 10)
+		mac       = hmac.New(sha256.New, key)
+	)
+
+	mac.Write([]byte(id + "." + timestamp + "." + body))
+	req.Header.Set("webhook-id", id)
+	req.Header.Set("webhook-timestamp", timestamp)
+	req.Header.Set("webhook-signature", "v1,invalid v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return req
+}
+
+// TestAuthHooks tests signature verification, replay and timestamp windows, typed payloads and GoTrue response shapes.
+func TestAuthHooks(t *testing.T) {
+	var (
+		testName     = "TestAuthHooks"
+		key          = []byte("super-secret-hook-key")
+		hooks        *AuthHooks
+		tokenHook    http.Handler
+		emailHook    http.Handler
+		passwordHook http.Handler
+		rec          *httptest.ResponseRecorder
+		claims       CustomAccessTokenOutput
+		hookError    map[string]HookError
+		emails       []SendEmailInput
+		now          = time.Now()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	hooks, err = NewAuthHooks(AuthHooksOptions{Secrets: []string{"v1,whsec_" + base64.StdEncoding.EncodeToString(key)}})
+	if err != nil {
+		errorMessage = fmt.Sprintf("NewAuthHooks failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	tokenHook = hooks.CustomAccessToken(func(ctx context.Context, input CustomAccessTokenInput) (CustomAccessTokenOutput, error) {
+		input.Claims["tenant"] = "acme"
+		return CustomAccessTokenOutput{Claims: input.Claims}, nil
+	})
+	emailHook = hooks.SendEmail(func(ctx context.Context, input SendEmailInput) error {
+		emails = append(emails, input)
+		if len(emails) == 1 {
+			return errors.New("smtp unavailable")
+		}
+		return nil
+	})
+	passwordHook = hooks.PasswordVerificationAttempt(func(ctx context.Context, input PasswordVerificationAttemptInput) (HookDecision, error) {
+		if input.Valid {
+			return HookDecision{Decision: HookDecisionContinue}, nil
+		}
+		return HookDecision{}, &HookError{HTTPCode: http.StatusTooManyRequests, Message: "too many attempts"}
+	})
+
+	// execute: custom access token hook
+	rec = httptest.NewRecorder()
+	tokenHook.ServeHTTP(rec, signedHookRequest(key, "msg_1", now, `{"user_id":"`+hookTestUserID+`","claims":{"sub":"`+hookTestUserID+`","role":"authenticated"},"authentication_method":"password"}`))
+	json.Unmarshal(rec.Body.Bytes(), &claims)
+	if rec.Code != http.StatusOK || claims.Claims["tenant"] != "acme" || claims.Claims["role"] != "authenticated" {
+		errorMessage = fmt.Sprintf("Unexpected token hook response: %d %s", rec.Code, rec.Body.String())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Custom access token hook returns modified claims\n")
+
+	// execute: replayed, stale and forged requests are rejected
+	for name, req := range map[string]*http.Request{
+		"replay": signedHookRequest(key, "msg_1", now, `{"user_id":"`+hookTestUserID+`","claims":{}}`),
+		"stale":  signedHookRequest(key, "msg_2", now.Add(-10*time.Minute), `{"claims":{}}`),
+		"forged": signedHookRequest([]byte("other-key"), "msg_3", now, `{"claims":{}}`),
+	} {
+		rec = httptest.NewRecorder()
+		tokenHook.ServeHTTP(rec, req)
+		hookError = nil
+		json.Unmarshal(rec.Body.Bytes(), &hookError)
+		if rec.Code != http.StatusUnauthorized || hookError["error"].HTTPCode != http.StatusUnauthorized {
+			errorMessage = fmt.Sprintf("Expected %s request to be rejected, got %d %s", name, rec.Code, rec.Body.String())
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ Replayed, stale and forged requests are rejected\n")
+
+	// execute: a failed send email hook releases its ID; handler errors use the GoTrue shape
+	emailBody := `{"user":{"id":"` + hookTestUserID + `","email":"a@example.com"},"email_data":{"token":"123456","email_action_type":"signup"}}`
+	rec = httptest.NewRecorder()
+	emailHook.ServeHTTP(rec, signedHookRequest(key, "msg_4", now, emailBody))
+	retry := httptest.NewRecorder()
+	emailHook.ServeHTTP(retry, signedHookRequest(key, "msg_4", now, emailBody))
+	if rec.Code != http.StatusInternalServerError || retry.Code != http.StatusOK || retry.Body.String() != "{}" || emails[1].EmailData.Token != "123456" || emails[1].User.Email != "a@example.com" {
+		errorMessage = fmt.Sprintf("Unexpected send email responses: %d then %d %s", rec.Code, retry.Code, retry.Body.String())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	rec = httptest.NewRecorder()
+	passwordHook.ServeHTTP(rec, signedHookRequest(key, "msg_5", now, `{"user_id":"`+hookTestUserID+`","valid":false}`))
+	hookError = nil
+	json.Unmarshal(rec.Body.Bytes(), &hookError)
+	if rec.Code != http.StatusOK || hookError["error"].HTTPCode != http.StatusTooManyRequests || hookError["error"].Message != "too many attempts" {
+		errorMessage = fmt.Sprintf("Unexpected password hook error: %d %s", rec.Code, rec.Body.String())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Hook errors are sent as 200 in the GoTrue error shape and failed hooks release their ID\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// hookTestUserID is a fixed user ID used in hook payloads.
+const hookTestUserID = "7d1b5c3e-4a2f-4b8e-9c6d-1e2f3a4b5c6d"
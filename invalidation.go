@@ -0,0 +1,293 @@
+package ft_supabase
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for invalidation buses.
+var (
+	ErrInvalidationBusClosed      = errors.New("invalidation bus is closed")
+	ErrInvalidationBusUnavailable = errors.New("invalidation bus is not connected")
+	ErrInvalidationSecret         = errors.New("invalidation bus requires a Secret unless Insecure is set")
+)
+
+// InvalidationType identifies why cached sessions must be invalidated on other replicas.
+type InvalidationType string
+
+// Invalidation types.
+const (
+	InvalidateLogout     InvalidationType = "logout"      // session ended (Logout, RevokeSession)
+	InvalidateDelete     InvalidationType = "delete"      // user deleted (DeleteUser)
+	InvalidateUpdate     InvalidationType = "update"      // user profile changed (UpdateUser)
+	InvalidateRoleChange InvalidationType = "role_change" // user role changed (UpdateUser)
+)
+
+// InvalidationEvent is broadcast to every replica when cached sessions become stale.
+// Type is why the sessions are invalidated.
+// UserID is the Supabase user unique identifier.
+// SessionID is the ended session for logout events (empty ends every session of the user).
+// User holds the updated user for update and role_change events (nil drops the user's sessions instead).
+// Origin is the ReplicaID of the publishing service, used to skip its own events.
+// Time is when the event was published.
+// Tokens are never included in events.
+//
+// Used in:
+// - InvalidationBus.Publish() - broadcast to replicas
+// - ApplyInvalidation() - applied to a session store
+type InvalidationEvent struct {
+	Type      InvalidationType `json:"type"`
+	UserID    uuid.UUID        `json:"user_id"`
+	SessionID string           `json:"session_id,omitempty"`
+	User      *User            `json:"user,omitempty"`
+	Origin    string           `json:"origin"`
+	Time      time.Time        `json:"time"`
+}
+
+// InvalidationBus broadcasts invalidation events between service replicas.
+// Every subscriber receives every published event, including its own.
+//
+// Implementations:
+// - MemoryInvalidationBus - replicas in the same process (tests, embedded setups)
+// - TCPInvalidationBus - replicas connected to an InvalidationHub
+type InvalidationBus interface {
+	// Publish broadcasts an event to every subscriber.
+	Publish(ctx context.Context, event InvalidationEvent) error
+
+	// Subscribe registers a handler called for every event and returns a function removing it.
+	Subscribe(fn func(InvalidationEvent)) (unsubscribe func())
+
+	// Close releases the bus; later Publish calls return ErrInvalidationBusClosed.
+	Close() error
+}
+
+// compile-time checks that the buses implement InvalidationBus
+var (
+	_ InvalidationBus = (*MemoryInvalidationBus)(nil)
+	_ InvalidationBus = (*TCPInvalidationBus)(nil)
+)
+
+// invalidationSubscribers holds the handlers of a bus.
+// mu guards handlers and nextID.
+// handlers maps subscription IDs to handlers.
+// nextID is the ID of the next subscription.
+type invalidationSubscribers struct {
+	mu       sync.RWMutex
+	handlers map[uint64]func(InvalidationEvent)
+	nextID   uint64
+}
+
+// subscribe registers fn and returns a function removing it (safe to call more than once).
+func (s *invalidationSubscribers) subscribe(fn func(InvalidationEvent)) func() {
+	var (
+		id uint64
+	)
+
+	s.mu.Lock()
+	if s.handlers == nil {
+		s.handlers = make(map[uint64]func(InvalidationEvent))
+	}
+	s.nextID++
+	id = s.nextID
+	s.handlers[id] = fn
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		delete(s.handlers, id)
+		s.mu.Unlock()
+	}
+}
+
+// deliver calls every handler with event.
+// Must be called without any lock held.
+func (s *invalidationSubscribers) deliver(event InvalidationEvent) {
+	var (
+		handlers []func(InvalidationEvent)
+	)
+
+	s.mu.RLock()
+	for _, fn := range s.handlers {
+		handlers = append(handlers, fn)
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range handlers {
+		fn(event)
+	}
+}
+
+// MemoryInvalidationBus is an in-process InvalidationBus delivering events synchronously.
+// subscribers are the registered handlers.
+// mu guards closed.
+// closed is true once Close has been called.
+//
+// Used in:
+// - Tests and setups running several services in one process
+type MemoryInvalidationBus struct {
+	subscribers invalidationSubscribers
+	mu          sync.RWMutex
+	closed      bool
+}
+
+// NewMemoryInvalidationBus creates an in-process invalidation bus.
+// Returns an empty bus ready to use.
+func NewMemoryInvalidationBus() *MemoryInvalidationBus {
+	return &MemoryInvalidationBus{}
+}
+
+// Publish delivers event to every subscriber before returning.
+// ctx is unused; delivery never blocks on the network.
+// Returns ErrInvalidationBusClosed if the bus is closed.
+func (b *MemoryInvalidationBus) Publish(ctx context.Context, event InvalidationEvent) error {
+	b.mu.RLock()
+	closed := b.closed
+	b.mu.RUnlock()
+
+	if closed {
+		return ErrInvalidationBusClosed
+	}
+
+	b.subscribers.deliver(event)
+	return nil
+}
+
+// Subscribe registers fn for every published event.
+// Returns a function removing the subscription.
+func (b *MemoryInvalidationBus) Subscribe(fn func(InvalidationEvent)) func() {
+	return b.subscribers.subscribe(fn)
+}
+
+// Close stops the bus; later Publish calls fail.
+func (b *MemoryInvalidationBus) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	return nil
+}
+
+// ApplyInvalidation applies an invalidation event to a session store.
+// store is the session store to update.
+// event is the received event.
+// Logout events remove the session (or every session without SessionID), delete events remove the user,
+// update and role_change events copy the new user fields into the user's sessions (or remove them without User).
+// The User of an event is trusted as is: buses must only deliver it when the event is authenticated
+// (TCPInvalidationBus drops it unless a Secret is configured).
+func ApplyInvalidation(store SessionStore, event InvalidationEvent) {
+	var (
+		user *User
+	)
+
+	Logf("ApplyInvalidation", "Applying %s invalidation - UserID: %s, Origin: %s", event.Type, event.UserID.String(), event.Origin)
+
+	switch event.Type {
+	case InvalidateLogout:
+		if event.SessionID != "" {
+			store.RevokeSession(event.SessionID)
+			return
+		}
+		store.DeleteByUserID(event.UserID)
+	case InvalidateUpdate, InvalidateRoleChange:
+		if event.User == nil {
+			store.DeleteByUserID(event.UserID)
+			return
+		}
+		user = event.User
+		store.Update(event.UserID, func(session *CachedUser) {
+			session.Email = user.Email
+			session.Username = user.Username
+			session.DisplayName = user.DisplayName
+			session.Role = user.Role
+			session.Phone = user.Phone
+			session.DateOfBirth = user.DateOfBirth
+			session.Metadata = user.Metadata
+			session.AppMetadata = user.AppMetadata
+		})
+	default:
+		// delete and unknown types drop every session of the user
+		store.DeleteByUserID(event.UserID)
+	}
+}
+
+// logoutInvalidation builds the logout event of an access token.
+// token is the JWT access token that was logged out.
+// Returns an event carrying the token's user and session IDs, and false if the token has no valid subject.
+// Without a session_id claim the event ends every session of the user, so the token is never broadcast.
+func logoutInvalidation(token string) (InvalidationEvent, bool) {
+	var (
+		claims *TokenClaims
+		event  InvalidationEvent
+		err    error
+	)
+
+	claims, err = ParseTokenClaims(token)
+	if err != nil {
+		return event, false
+	}
+
+	event = InvalidationEvent{Type: InvalidateLogout, SessionID: claims.SessionID}
+	event.UserID, err = claims.UserID()
+	if err != nil {
+		return event, false
+	}
+
+	return event, true
+}
+
+// SetInvalidationBus connects the service to an invalidation bus.
+// bus is the shared bus (nil disconnects).
+// Logout, RevokeSession, DeleteUser and UpdateUser publish events on the bus, and events
+// published by other replicas (different ReplicaID) are applied to the service's Cache.
+// The bus is not closed by the service.
+func (s *Service) SetInvalidationBus(bus InvalidationBus) {
+	s.invalidationMu.Lock()
+	defer s.invalidationMu.Unlock()
+
+	if s.invalidationStop != nil {
+		s.invalidationStop()
+		s.invalidationStop = nil
+	}
+	s.invalidation = bus
+	if bus == nil {
+		Log("SetInvalidationBus", "Invalidation bus disconnected")
+		return
+	}
+
+	s.invalidationStop = bus.Subscribe(func(event InvalidationEvent) {
+		if event.Origin == s.ReplicaID {
+			return
+		}
+		ApplyInvalidation(s.Cache, event)
+	})
+
+	Logf("SetInvalidationBus", "Invalidation bus connected - ReplicaID: %s", s.ReplicaID)
+}
+
+// publishInvalidation publishes an event on the invalidation bus, if any.
+// ctx is the context for request cancellation and timeout.
+// event is the event to publish; Origin and Time are filled in.
+// Failures are logged only: the operation already succeeded and cached sessions still expire.
+func (s *Service) publishInvalidation(ctx context.Context, event InvalidationEvent) {
+	var (
+		bus InvalidationBus
+		err error
+	)
+
+	s.invalidationMu.Lock()
+	bus = s.invalidation
+	s.invalidationMu.Unlock()
+
+	if bus == nil {
+		return
+	}
+
+	event.Origin = s.ReplicaID
+	event.Time = time.Now()
+	if err = bus.Publish(ctx, event); err != nil {
+		Logf("publishInvalidation", "Failed to publish %s invalidation - UserID: %s: %v", event.Type, event.UserID.String(), err)
+	}
+}
@@ -0,0 +1,537 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxInvalidationLine is the maximum size of an encoded invalidation event on the wire.
+const maxInvalidationLine = 64 * 1024
+
+// hubClientQueue is the number of events buffered for each hub client before it is dropped.
+const hubClientQueue = 256
+
+// signedInvalidation is the wire format of events published by a bus with a Secret.
+// Event is the JSON-encoded InvalidationEvent.
+// MAC is the hex HMAC-SHA256 of Event with the shared secret.
+type signedInvalidation struct {
+	Event json.RawMessage `json:"event"`
+	MAC   string          `json:"mac"`
+}
+
+// InvalidationHub relays invalidation events between TCP clients.
+// Every line received from a client (one JSON event) is written to every connected client, including the sender.
+// Run a single hub on a trusted network. The hub relays lines without checking them: events are
+// authenticated end to end by buses sharing a TCPInvalidationOptions.Secret.
+// listener accepts client connections.
+// mu guards conns and closed.
+// conns are the connected clients and their outgoing queues, each drained by its own writer goroutine.
+// closed is true once Close has been called.
+// wg tracks the accept, client and writer goroutines.
+//
+// Used in:
+// - TCPInvalidationBus - clients connect to the hub
+type InvalidationHub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	conns    map[net.Conn]chan []byte
+	closed   bool
+	wg       sync.WaitGroup
+}
+
+// ListenInvalidationHub starts an invalidation hub listening on addr.
+// addr is the TCP listen address (e.g., ":7070", "127.0.0.1:0").
+// Returns the running hub or an error if the address cannot be bound.
+func ListenInvalidationHub(addr string) (*InvalidationHub, error) {
+	var (
+		hub      *InvalidationHub
+		listener net.Listener
+		err      error
+	)
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		Logf("ListenInvalidationHub", "Failed to listen on %s: %v", addr, err)
+		return nil, err
+	}
+
+	Logf("ListenInvalidationHub", "Invalidation hub listening - Addr: %s", listener.Addr().String())
+
+	hub = &InvalidationHub{
+		listener: listener,
+		conns:    make(map[net.Conn]chan []byte),
+	}
+	hub.wg.Add(1)
+	go hub.acceptLoop()
+
+	return hub, nil
+}
+
+// Addr returns the address the hub listens on.
+func (h *InvalidationHub) Addr() net.Addr {
+	return h.listener.Addr()
+}
+
+// Clients returns the number of connected clients.
+func (h *InvalidationHub) Clients() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.conns)
+}
+
+// Close stops accepting clients, disconnects every client and waits for the hub goroutines to exit.
+func (h *InvalidationHub) Close() error {
+	var (
+		err error
+	)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closed = true
+	err = h.listener.Close()
+	for conn := range h.conns {
+		h.removeLocked(conn)
+	}
+	h.mu.Unlock()
+
+	h.wg.Wait()
+	Log("InvalidationHub.Close", "Invalidation hub stopped")
+
+	return err
+}
+
+// acceptLoop accepts clients until the listener is closed.
+func (h *InvalidationHub) acceptLoop() {
+	defer h.wg.Done()
+
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if !h.add(conn) {
+			return
+		}
+	}
+}
+
+// add registers conn and starts its reader and writer goroutines.
+// conn is the client connection.
+// Returns false (closing conn) if the hub is closed.
+func (h *InvalidationHub) add(conn net.Conn) bool {
+	var (
+		queue = make(chan []byte, hubClientQueue)
+	)
+
+	h.mu.Lock()
+	if h.closed {
+		h.mu.Unlock()
+		conn.Close()
+		return false
+	}
+	h.conns[conn] = queue
+	h.wg.Add(2)
+	h.mu.Unlock()
+
+	Logf("InvalidationHub", "Client connected - Addr: %s", conn.RemoteAddr().String())
+	go h.serve(conn)
+	go h.write(conn, queue)
+
+	return true
+}
+
+// serve relays the lines sent by conn until it disconnects.
+func (h *InvalidationHub) serve(conn net.Conn) {
+	var (
+		scanner *bufio.Scanner
+	)
+
+	defer h.wg.Done()
+	defer h.drop(conn)
+
+	scanner = bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxInvalidationLine)
+	for scanner.Scan() {
+		// the scanner reuses its buffer, and writers send the line later
+		h.broadcast(append(append(make([]byte, 0, len(scanner.Bytes())+1), scanner.Bytes()...), '\n'))
+	}
+}
+
+// write sends the lines queued for conn until its queue is closed or a write fails.
+// conn is the client connection.
+// queue is the client's outgoing queue.
+func (h *InvalidationHub) write(conn net.Conn, queue chan []byte) {
+	defer h.wg.Done()
+
+	for line := range queue {
+		conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+		if _, err := conn.Write(line); err != nil {
+			Logf("InvalidationHub", "Dropping client %s: %v", conn.RemoteAddr().String(), err)
+			h.drop(conn)
+			return
+		}
+	}
+}
+
+// broadcast queues line for every client without blocking, dropping clients whose queue is full.
+func (h *InvalidationHub) broadcast(line []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn, queue := range h.conns {
+		select {
+		case queue <- line:
+		default:
+			Logf("InvalidationHub", "Dropping slow client %s: queue full", conn.RemoteAddr().String())
+			h.removeLocked(conn)
+		}
+	}
+}
+
+// drop closes conn and forgets it.
+func (h *InvalidationHub) drop(conn net.Conn) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.removeLocked(conn)
+}
+
+// removeLocked closes conn and its queue (stopping its writer) and forgets it; h.mu must be held.
+func (h *InvalidationHub) removeLocked(conn net.Conn) {
+	if queue, ok := h.conns[conn]; ok {
+		close(queue)
+		delete(h.conns, conn)
+	}
+	conn.Close()
+}
+
+// TCPInvalidationOptions configures a TCPInvalidationBus.
+// DialTimeout is the timeout for connecting to the hub (default 5 seconds).
+// IOTimeout is the write deadline for each published event (default 5 seconds).
+// ReconnectInterval is the delay between reconnection attempts (default 1 second).
+// Secret is the key shared by every replica to sign and verify events with HMAC-SHA256 (required unless Insecure).
+// MaxEventAge is how far a signed event's Time may be from the local clock (default 2 minutes);
+// a signed event is applied at most once within this window, so captured events cannot be replayed.
+// Insecure allows a bus without a Secret: anyone reaching the hub can then inject events and sign out any user,
+// so only use it on a network no one else can reach. Received events never carry user data in this mode:
+// update and role_change events only drop the user's cached sessions.
+//
+// Used in:
+// - DialInvalidationBus() - configures the bus
+type TCPInvalidationOptions struct {
+	DialTimeout       time.Duration
+	IOTimeout         time.Duration
+	ReconnectInterval time.Duration
+	Secret            []byte
+	MaxEventAge       time.Duration
+	Insecure          bool
+}
+
+// TCPInvalidationBus is an InvalidationBus connected to an InvalidationHub.
+// The connection is re-established in the background if it drops; events published
+// while disconnected fail with ErrInvalidationBusUnavailable and are not replayed.
+// addr is the hub address.
+// opts holds the bus configuration.
+// subscribers are the registered handlers.
+// mu guards conn and closed, and serializes writes.
+// conn is the current hub connection (nil while reconnecting).
+// closed is true once Close has been called.
+// done is closed by Close to stop reconnecting.
+// wg tracks the connection goroutine.
+// seenMu guards seen.
+// seen maps the MACs of applied signed events to when they leave the MaxEventAge window.
+type TCPInvalidationBus struct {
+	addr        string
+	opts        TCPInvalidationOptions
+	subscribers invalidationSubscribers
+	mu          sync.Mutex
+	conn        net.Conn
+	closed      bool
+	done        chan struct{}
+	wg          sync.WaitGroup
+	seenMu      sync.Mutex
+	seen        map[string]time.Time
+}
+
+// DialInvalidationBus connects to the invalidation hub at addr.
+// addr is the hub address (host:port).
+// opts configures timeouts, reconnection and event signing (zero values use defaults).
+// Returns the connected bus, ErrInvalidationSecret if opts has neither a Secret nor Insecure,
+// or an error if the first connection fails.
+func DialInvalidationBus(addr string, opts TCPInvalidationOptions) (*TCPInvalidationBus, error) {
+	var (
+		bus  *TCPInvalidationBus
+		conn net.Conn
+		err  error
+	)
+
+	// apply defaults
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.IOTimeout <= 0 {
+		opts.IOTimeout = 5 * time.Second
+	}
+	if opts.ReconnectInterval <= 0 {
+		opts.ReconnectInterval = time.Second
+	}
+	if opts.MaxEventAge <= 0 {
+		opts.MaxEventAge = 2 * time.Minute
+	}
+	if len(opts.Secret) == 0 {
+		if !opts.Insecure {
+			return nil, ErrInvalidationSecret
+		}
+		Log("DialInvalidationBus", "Insecure bus: received events are not authenticated and only drop sessions")
+	}
+
+	conn, err = net.DialTimeout("tcp", addr, opts.DialTimeout)
+	if err != nil {
+		Logf("DialInvalidationBus", "Failed to connect to hub %s: %v", addr, err)
+		return nil, err
+	}
+
+	Logf("DialInvalidationBus", "Connected to invalidation hub - Addr: %s", addr)
+
+	bus = &TCPInvalidationBus{
+		addr: addr,
+		opts: opts,
+		conn: conn,
+		done: make(chan struct{}),
+	}
+	bus.wg.Add(1)
+	go bus.run(conn)
+
+	return bus, nil
+}
+
+// Publish sends event to the hub, which relays it to every connected bus.
+// ctx bounds the write (its deadline is used when earlier than IOTimeout).
+// Returns ErrInvalidationBusClosed, ErrInvalidationBusUnavailable while reconnecting, or the write error.
+func (b *TCPInvalidationBus) Publish(ctx context.Context, event InvalidationEvent) error {
+	var (
+		line     []byte
+		deadline time.Time
+		err      error
+	)
+
+	line, err = json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if len(b.opts.Secret) > 0 {
+		line, err = json.Marshal(signedInvalidation{Event: line, MAC: invalidationMAC(b.opts.Secret, line)})
+		if err != nil {
+			return err
+		}
+	}
+	line = append(line, '\n')
+
+	deadline = time.Now().Add(b.opts.IOTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrInvalidationBusClosed
+	}
+	if b.conn == nil {
+		return ErrInvalidationBusUnavailable
+	}
+
+	b.conn.SetWriteDeadline(deadline)
+	if _, err = b.conn.Write(line); err != nil {
+		// the read loop notices the broken connection and reconnects
+		b.conn.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Subscribe registers fn for every event relayed by the hub.
+// Returns a function removing the subscription.
+func (b *TCPInvalidationBus) Subscribe(fn func(InvalidationEvent)) func() {
+	return b.subscribers.subscribe(fn)
+}
+
+// Close disconnects from the hub and stops reconnecting.
+func (b *TCPInvalidationBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	if b.conn != nil {
+		b.conn.Close()
+	}
+	b.mu.Unlock()
+
+	b.wg.Wait()
+	Log("TCPInvalidationBus.Close", "Disconnected from invalidation hub")
+
+	return nil
+}
+
+// run reads events from conn, then reconnects until the bus is closed.
+func (b *TCPInvalidationBus) run(conn net.Conn) {
+	defer b.wg.Done()
+
+	for conn != nil {
+		b.readLoop(conn)
+
+		b.mu.Lock()
+		b.conn = nil
+		b.mu.Unlock()
+
+		conn = b.reconnect()
+	}
+}
+
+// readLoop delivers the events received on conn until it fails.
+func (b *TCPInvalidationBus) readLoop(conn net.Conn) {
+	var (
+		scanner *bufio.Scanner
+		event   InvalidationEvent
+		err     error
+	)
+
+	scanner = bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), maxInvalidationLine)
+	for scanner.Scan() {
+		event, err = b.decode(scanner.Bytes())
+		if err != nil {
+			Logf("TCPInvalidationBus", "Skipping event: %v", err)
+			continue
+		}
+		b.subscribers.deliver(event)
+	}
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		Logf("TCPInvalidationBus", "Connection to hub lost: %v", err)
+	}
+}
+
+// decode parses a received line into an event.
+// line is one line read from the hub.
+// With a Secret, the line must be a signedInvalidation with a valid MAC, a fresh Time and a MAC not seen before.
+// Without a Secret, the event's User is dropped so update and role_change events only remove sessions.
+// Returns the event or an error if the line is malformed, unsigned, forged, stale or replayed.
+func (b *TCPInvalidationBus) decode(line []byte) (InvalidationEvent, error) {
+	var (
+		signed InvalidationEvent
+		event  InvalidationEvent
+		wire   signedInvalidation
+		err    error
+	)
+
+	if len(b.opts.Secret) == 0 {
+		if err = json.Unmarshal(line, &event); err != nil {
+			return InvalidationEvent{}, err
+		}
+		event.User = nil
+		return event, nil
+	}
+
+	if err = json.Unmarshal(line, &wire); err != nil {
+		return InvalidationEvent{}, err
+	}
+	if wire.MAC == "" || !hmac.Equal([]byte(wire.MAC), []byte(invalidationMAC(b.opts.Secret, wire.Event))) {
+		return InvalidationEvent{}, errors.New("invalid event signature")
+	}
+	if err = json.Unmarshal(wire.Event, &signed); err != nil {
+		return InvalidationEvent{}, err
+	}
+	if age := time.Since(signed.Time); age > b.opts.MaxEventAge || age < -b.opts.MaxEventAge {
+		return InvalidationEvent{}, errors.New("event time outside MaxEventAge")
+	}
+	if !b.firstSeen(wire.MAC, signed.Time.Add(b.opts.MaxEventAge)) {
+		return InvalidationEvent{}, errors.New("replayed event")
+	}
+
+	return signed, nil
+}
+
+// firstSeen records a signed event and reports whether it was not seen before.
+// mac is the event MAC.
+// expiresAt is when the event leaves the MaxEventAge window (older events are rejected as stale).
+func (b *TCPInvalidationBus) firstSeen(mac string, expiresAt time.Time) bool {
+	var (
+		now = time.Now()
+	)
+
+	b.seenMu.Lock()
+	defer b.seenMu.Unlock()
+
+	for seen, expiry := range b.seen {
+		if now.After(expiry) {
+			delete(b.seen, seen)
+		}
+	}
+	if _, replayed := b.seen[mac]; replayed {
+		return false
+	}
+	if b.seen == nil {
+		b.seen = make(map[string]time.Time)
+	}
+	b.seen[mac] = expiresAt
+
+	return true
+}
+
+// invalidationMAC returns the hex HMAC-SHA256 of an encoded event.
+func invalidationMAC(secret, event []byte) string {
+	var (
+		mac = hmac.New(sha256.New, secret)
+	)
+
+	mac.Write(event)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// reconnect dials the hub every ReconnectInterval until it succeeds or the bus is closed.
+// Returns the new connection, or nil once the bus is closed.
+func (b *TCPInvalidationBus) reconnect() net.Conn {
+	for {
+		select {
+		case <-b.done:
+			return nil
+		case <-time.After(b.opts.ReconnectInterval):
+		}
+
+		conn, err := net.DialTimeout("tcp", b.addr, b.opts.DialTimeout)
+		if err != nil {
+			Logf("TCPInvalidationBus", "Reconnect to hub %s failed: %v", b.addr, err)
+			continue
+		}
+
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		b.conn = conn
+		b.mu.Unlock()
+
+		Logf("TCPInvalidationBus", "Reconnected to invalidation hub - Addr: %s", b.addr)
+		return conn
+	}
+}
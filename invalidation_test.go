@@ -0,0 +1,289 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestMemoryInvalidationBus tests that Logout, UpdateUser and DeleteUser invalidate other replicas.
+func TestMemoryInvalidationBus(t *testing.T) {
+	var (
+		testName     = "TestMemoryInvalidationBus"
+		replicaA     *Service
+		replicaB     *Service
+		server       *mockAuthServer
+		bus          *MemoryInvalidationBus
+		ctx          context.Context
+		laptop       *LoginResponse
+		phone        *LoginResponse
+		cachedUser   *CachedUser
+		received     []InvalidationEvent
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: both replicas cache the same two sessions
+	replicaA, _, server = newMockService()
+	replicaB = NewService("mock", "http://mock.local", "anon", "service")
+	bus = NewMemoryInvalidationBus()
+	replicaA.SetInvalidationBus(bus)
+	replicaB.SetInvalidationBus(bus)
+	bus.Subscribe(func(event InvalidationEvent) { received = append(received, event) })
+	ctx = context.Background()
+
+	laptop, err = replicaA.LoginUser(ctx, server.email, "password")
+	if err == nil {
+		phone, err = replicaA.LoginUser(ctx, server.email, "password")
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Login failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, token := range []string{laptop.Token, phone.Token} {
+		cachedUser, _ = replicaA.Cache.Get(token)
+		replicaB.Cache.Set(token, cachedUser)
+	}
+
+	// execute: logout on A ends only that session on B
+	if err = replicaA.Logout(ctx, laptop.Token); err != nil || replicaB.Cache.IsValid(laptop.Token) || !replicaB.Cache.IsValid(phone.Token) {
+		errorMessage = fmt.Sprintf("Logout should remove the laptop session on B only (err: %v)", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Logout invalidates the session on other replicas\n")
+
+	// execute: role change on A is applied on B
+	_, err = replicaA.SetRole(ctx, server.userID, "admin")
+	cachedUser, _ = replicaB.Cache.Get(phone.Token)
+	if err != nil || cachedUser == nil || cachedUser.Role != "admin" || received[len(received)-1].Type != InvalidateRoleChange {
+		errorMessage = fmt.Sprintf("Role change should update B's cached session (err: %v)", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Role change updates other replicas\n")
+
+	// execute: delete on A clears B
+	if err = replicaA.DeleteUser(ctx, server.userID); err != nil || replicaB.Cache.Count() != 0 {
+		errorMessage = fmt.Sprintf("DeleteUser should clear B (err: %v, count: %d)", err, replicaB.Cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, event := range received {
+		if event.Origin != replicaA.ReplicaID {
+			errorMessage = fmt.Sprintf("Unexpected event origin: %s", event.Origin)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Errorf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ DeleteUser clears other replicas\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestTCPInvalidationBus tests event delivery through a local InvalidationHub.
+func TestTCPInvalidationBus(t *testing.T) {
+	var (
+		testName     = "TestTCPInvalidationBus"
+		hub          *InvalidationHub
+		busA         *TCPInvalidationBus
+		busB         *TCPInvalidationBus
+		replicaB     *Service
+		userID       uuid.UUID
+		received     chan InvalidationEvent
+		event        InvalidationEvent
+		opts         = TCPInvalidationOptions{ReconnectInterval: 10 * time.Millisecond, Secret: []byte("shared-secret")}
+		forger       net.Conn
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	hub, err = ListenInvalidationHub("127.0.0.1:0")
+	if err == nil {
+		defer hub.Close()
+		busA, err = DialInvalidationBus(hub.Addr().String(), opts)
+	}
+	if err == nil {
+		defer busA.Close()
+		busB, err = DialInvalidationBus(hub.Addr().String(), opts)
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Hub setup failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	defer busB.Close()
+	// the hub registers clients asynchronously
+	for deadline := time.Now().Add(5 * time.Second); hub.Clients() < 2 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+
+	userID = uuid.New()
+	replicaB = NewService("mock", "http://mock.local", "anon", "service")
+	replicaB.Cache.Set("token-1", &CachedUser{UserID: userID, SessionID: "s1", ExpiresAt: time.Now().Add(time.Hour)})
+	replicaB.SetInvalidationBus(busB)
+	received = make(chan InvalidationEvent, 4)
+	busB.Subscribe(func(event InvalidationEvent) { received <- event })
+
+	// execute
+	err = busA.Publish(context.Background(), InvalidationEvent{Type: InvalidateLogout, UserID: userID, SessionID: "s1", Origin: "replica-a", Time: time.Now()})
+	if err == nil {
+		select {
+		case event = <-received:
+		case <-time.After(5 * time.Second):
+			err = fmt.Errorf("timed out waiting for event")
+		}
+	}
+
+	// verify
+	if err != nil || event.SessionID != "s1" || replicaB.Cache.IsValid("token-1") {
+		errorMessage = fmt.Sprintf("Event should reach B and remove its session (err: %v)", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Events relayed by the hub invalidate other replicas\n")
+
+	// execute: a signed update carries the new user fields
+	err = busA.Publish(context.Background(), InvalidationEvent{Type: InvalidateRoleChange, UserID: userID, User: &User{UserID: userID, Role: "editor"}, Origin: "replica-a", Time: time.Now()})
+	if err == nil {
+		select {
+		case event = <-received:
+		case <-time.After(5 * time.Second):
+			err = fmt.Errorf("timed out waiting for event")
+		}
+	}
+	if err != nil || event.User == nil || event.User.Role != "editor" {
+		errorMessage = fmt.Sprintf("Signed events should keep their user (err: %v, event: %+v)", err, event)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Signed events are delivered with their user\n")
+
+	// execute: events injected into the hub without the secret are dropped
+	forger, err = net.Dial("tcp", hub.Addr().String())
+	if err == nil {
+		defer forger.Close()
+		for deadline := time.Now().Add(5 * time.Second); hub.Clients() < 3 && time.Now().Before(deadline); {
+			time.Sleep(time.Millisecond)
+		}
+		// capture a genuine signed event relayed by the hub, to replay it
+		err = busA.Publish(context.Background(), InvalidationEvent{Type: InvalidateLogout, UserID: userID, Origin: "replica-a", Time: time.Now()})
+	}
+	if err == nil {
+		<-received
+		var captured string
+		captured, err = bufio.NewReader(forger).ReadString('\n')
+		forged := fmt.Sprintf(`{"type":"role_change","user_id":%q,"user":{"role":"admin"},"origin":"attacker","time":%q}`+"\n", userID, time.Now().Format(time.RFC3339Nano))
+		signed := fmt.Sprintf(`{"event":{"type":"logout","user_id":%q,"origin":"attacker","time":%q},"mac":"00"}`+"\n", userID, time.Now().Format(time.RFC3339Nano))
+		if err == nil {
+			_, err = forger.Write([]byte(forged + signed + captured))
+		}
+	}
+	if err == nil {
+		select {
+		case event = <-received:
+			err = fmt.Errorf("forged event delivered: %+v", event)
+		case <-time.After(200 * time.Millisecond):
+		}
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Unsigned, forged and replayed events should be dropped (err: %v)", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Unsigned, forged and replayed events are dropped\n")
+
+	// execute: a bus needs a secret unless it explicitly opts into insecure mode
+	if _, err = DialInvalidationBus(hub.Addr().String(), TCPInvalidationOptions{}); !errors.Is(err, ErrInvalidationSecret) {
+		errorMessage = fmt.Sprintf("Expected ErrInvalidationSecret, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Buses without a secret must opt into insecure mode\n")
+
+	// execute: without a secret, received events never carry user data
+	event, err = (&TCPInvalidationBus{}).decode([]byte(fmt.Sprintf(`{"type":"role_change","user_id":%q,"user":{"role":"admin"}}`, userID)))
+	if err != nil || event.Type != InvalidateRoleChange || event.User != nil {
+		errorMessage = fmt.Sprintf("Buses without a secret should strip the user (err: %v, event: %+v)", err, event)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Buses without a secret only drop sessions\n")
+
+	busA.Close()
+	if err = busA.Publish(context.Background(), event); err != ErrInvalidationBusClosed {
+		errorMessage = fmt.Sprintf("Expected ErrInvalidationBusClosed, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Closed bus rejects events\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestInvalidationHubSlowClient tests that a client that stops reading is dropped without blocking the hub.
+func TestInvalidationHubSlowClient(t *testing.T) {
+	var (
+		testName     = "TestInvalidationHubSlowClient"
+		hub          *InvalidationHub
+		slow         net.Conn
+		peer         net.Conn
+		started      time.Time
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: a pipe blocks every write until the other end reads, which it never does
+	hub, err = ListenInvalidationHub("127.0.0.1:0")
+	if err != nil {
+		errorMessage = fmt.Sprintf("Hub setup failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	defer hub.Close()
+	slow, peer = net.Pipe()
+	defer peer.Close()
+	hub.add(slow)
+
+	// execute
+	started = time.Now()
+	for i := 0; i < hubClientQueue+2; i++ {
+		hub.broadcast([]byte("{}\n"))
+	}
+
+	// verify
+	if elapsed := time.Since(started); elapsed > time.Second || hub.Clients() != 0 {
+		errorMessage = fmt.Sprintf("Slow client should be dropped without blocking (elapsed: %s, clients: %d)", elapsed, hub.Clients())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Slow clients are dropped when their queue is full\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
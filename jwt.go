@@ -0,0 +1,163 @@
+package ft_supabase
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for token verification.
+var (
+	ErrTokenExpired   = errors.New("token has expired")
+	ErrTokenSignature = errors.New("invalid token signature")
+)
+
+// ParseTokenClaims decodes the claims of a Supabase JWT access token without verifying its signature.
+// token is the JWT access token.
+// Returns the decoded TokenClaims or ErrInvalidToken if the token is malformed.
+// Only use the result for routing and indexing; never trust it for authorization.
+func ParseTokenClaims(token string) (*TokenClaims, error) {
+	var (
+		parts   []string
+		payload []byte
+		claims  TokenClaims
+		err     error
+	)
+
+	// split header.payload.signature
+	parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	// decode base64url payload (unpadded per RFC 7515)
+	payload, err = base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	// parse JSON claims
+	if err = json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	return &claims, nil
+}
+
+// UserID parses the subject claim as a Supabase user UUID.
+// Returns the user UUID or ErrTokenParseUserID if the subject is not a valid UUID.
+func (c *TokenClaims) UserID() (uuid.UUID, error) {
+	var (
+		userID uuid.UUID
+		err    error
+	)
+
+	userID, err = uuid.Parse(c.Subject)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %w", ErrTokenParseUserID, err)
+	}
+
+	return userID, nil
+}
+
+// sessionIDFromToken extracts the session_id claim from a JWT access token.
+// token is the JWT access token.
+// Returns the session ID, or the SHA-256 hex of the token when the claim is unavailable so
+// every token still maps to exactly one session without the token being stored as an ID.
+func sessionIDFromToken(token string) string {
+	var (
+		claims *TokenClaims
+		sum    [sha256.Size]byte
+		err    error
+	)
+
+	claims, err = ParseTokenClaims(token)
+	if err != nil || claims.SessionID == "" {
+		sum = sha256.Sum256([]byte(token))
+		return hex.EncodeToString(sum[:])
+	}
+
+	return claims.SessionID
+}
+
+// sessionClaim returns the session_id claim of a JWT access token.
+// token is the JWT access token.
+// Returns the session ID, or an empty string for malformed tokens and tokens without the claim (e.g., the anon key).
+func sessionClaim(token string) string {
+	var (
+		claims *TokenClaims
+		err    error
+	)
+
+	claims, err = ParseTokenClaims(token)
+	if err != nil {
+		return ""
+	}
+
+	return claims.SessionID
+}
+
+// VerifyTokenHS256 verifies the HS256 signature and expiry of a Supabase JWT access token.
+// token is the JWT access token.
+// secret is the project JWT secret (Project Settings > API > JWT Secret).
+// Returns the verified TokenClaims, ErrInvalidToken if malformed or not HS256,
+// ErrTokenSignature if the signature does not match, or ErrTokenExpired if expired.
+func VerifyTokenHS256(token string, secret []byte) (*TokenClaims, error) {
+	var (
+		parts     []string
+		header    []byte
+		signature []byte
+		expected  []byte
+		alg       struct {
+			Alg string `json:"alg"`
+		}
+		claims *TokenClaims
+		mac    = hmac.New(sha256.New, secret)
+		err    error
+	)
+
+	parts = strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	// reject other algorithms (including "none")
+	header, err = base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(header, &alg) != nil || alg.Alg != "HS256" {
+		return nil, fmt.Errorf("%w: unsupported signing algorithm", ErrInvalidToken)
+	}
+
+	// compare signatures in constant time
+	signature, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	expected = mac.Sum(nil)
+	if !hmac.Equal(signature, expected) {
+		return nil, ErrTokenSignature
+	}
+
+	claims, err = ParseTokenClaims(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Expired(time.Now()) {
+		return nil, ErrTokenExpired
+	}
+
+	return claims, nil
+}
+
+// Expired reports whether the token is expired at now (tokens without exp claim never expire).
+func (c *TokenClaims) Expired(now time.Time) bool {
+	return c.ExpiresAt != 0 && now.Unix() >= c.ExpiresAt
+}
@@ -0,0 +1,257 @@
+package ft_supabase
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// adminUsersPerPage is the page size used when searching users through the Admin API.
+const adminUsersPerPage = 50
+
+// SupabaseAdminUsersResponse represents the Admin API user list response.
+// Users are the users of the requested page.
+//
+// Used in:
+// - GetUserByEmail() - parses the Admin API search result
+type SupabaseAdminUsersResponse struct {
+	Users []SupabaseUser `json:"users"`
+}
+
+// normalizeLookupKey normalizes an email or username for case-insensitive lookups.
+// value is the raw email or username.
+// Returns the trimmed, lower-cased value (empty if value is blank).
+func normalizeLookupKey(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// GetUserByEmail retrieves a user by email address.
+// ctx is the context for request cancellation and timeout.
+// email is the email address, matched case-insensitively.
+// Looks up the cache first, then searches the Admin API (requires the service role key).
+// Returns the User or ErrUserNotFound if no user has this email.
+func (s *Service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	var (
+		cachedUser *CachedUser
+		key        string
+		endpoint   string
+		bodyBytes  []byte
+		listResp   SupabaseAdminUsersResponse
+		found      bool
+		err        error
+	)
+
+	Logf("GetUserByEmail", "Retrieving user by email: %s", email)
+
+	key = normalizeLookupKey(email)
+	if key == "" {
+		return nil, ErrUserNotFound
+	}
+
+	// cache first
+	cachedUser, found = s.Cache.GetByEmail(key)
+	if found {
+		Logf("GetUserByEmail", "Found user in cache - ID: %s", cachedUser.UserID.String())
+		return userFromCached(cachedUser), nil
+	}
+
+	Log("GetUserByEmail", "Cache miss, searching Admin API")
+
+	// the admin filter is a substring search: exact match is checked below, on every page of results
+	for page := 1; ; page++ {
+		endpoint = fmt.Sprintf("%s%s?filter=%s&page=%d&per_page=%d", s.ProjectURL, AdminUsersPath, url.QueryEscape(key), page, adminUsersPerPage)
+		bodyBytes, err = s.sendRequest(ctx, AdminUsersPath, "GET", endpoint, nil, s.getServiceHeaders())
+		if err != nil {
+			Logf("GetUserByEmail", "Failed to search users (page %d): %v", page, err)
+			return nil, err
+		}
+
+		listResp = SupabaseAdminUsersResponse{}
+		if err = json.Unmarshal(bodyBytes, &listResp); err != nil {
+			Logf("GetUserByEmail", "Failed to unmarshal response: %v", err)
+			return nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+		}
+
+		for _, supabaseUser := range listResp.Users {
+			if normalizeLookupKey(supabaseUser.Email) == key {
+				return userFromSupabase(supabaseUser, s.RoleSource)
+			}
+		}
+
+		if len(listResp.Users) < adminUsersPerPage {
+			break
+		}
+	}
+
+	Logf("GetUserByEmail", "No user found with email: %s", email)
+	return nil, ErrUserNotFound
+}
+
+// GetUserByUsername retrieves a user by username.
+// ctx is the context for request cancellation and timeout.
+// username is the username, matched case-insensitively.
+// Looks up the cache first, then the ProfilesTable (id and username columns) through PostgREST
+// and loads the matching user from the Admin API (requires the service role key).
+// Returns the User or ErrUserNotFound if no user has this username (or ProfilesTable is not set).
+func (s *Service) GetUserByUsername(ctx context.Context, username string) (*User, error) {
+	var (
+		cachedUser *CachedUser
+		key        string
+		endpoint   string
+		bodyBytes  []byte
+		profiles   []struct {
+			ID string `json:"id"`
+		}
+		user  *User
+		found bool
+		err   error
+	)
+
+	Logf("GetUserByUsername", "Retrieving user by username: %s", username)
+
+	key = normalizeLookupKey(username)
+	if key == "" {
+		return nil, ErrUserNotFound
+	}
+
+	// cache first
+	cachedUser, found = s.Cache.GetByUsername(key)
+	if found {
+		Logf("GetUserByUsername", "Found user in cache - ID: %s", cachedUser.UserID.String())
+		return userFromCached(cachedUser), nil
+	}
+
+	if s.ProfilesTable == "" {
+		Log("GetUserByUsername", "Cache miss and no profiles table configured")
+		return nil, ErrUserNotFound
+	}
+
+	Logf("GetUserByUsername", "Cache miss, searching profiles table: %s", s.ProfilesTable)
+
+	// ilike is case-insensitive; escape its wildcards so the match is exact
+	endpoint = fmt.Sprintf("%s%s%s?select=id&username=ilike.%s&limit=2", s.ProjectURL, RestBasePath, url.PathEscape(s.ProfilesTable), url.QueryEscape(escapeLikePattern(key)))
+	bodyBytes, err = s.sendRequest(ctx, RestBasePath+s.ProfilesTable, "GET", endpoint, nil, s.getServiceHeaders())
+	if err != nil {
+		Logf("GetUserByUsername", "Failed to search profiles: %v", err)
+		return nil, err
+	}
+
+	if err = json.Unmarshal(bodyBytes, &profiles); err != nil {
+		Logf("GetUserByUsername", "Failed to unmarshal response: %v", err)
+		return nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+
+	for _, profile := range profiles {
+		user, err = s.getAdminUser(ctx, profile.ID)
+		if err != nil {
+			return nil, err
+		}
+		if normalizeLookupKey(user.Username) == key {
+			return user, nil
+		}
+	}
+
+	Logf("GetUserByUsername", "No user found with username: %s", username)
+	return nil, ErrUserNotFound
+}
+
+// getAdminUser fetches a user by ID from the Admin API.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user ID.
+// Returns the User or an error if the request fails.
+func (s *Service) getAdminUser(ctx context.Context, userID string) (*User, error) {
+	var (
+		supabaseUser SupabaseUser
+		err          error
+	)
+
+	supabaseUser, err = s.getAdminSupabaseUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return userFromSupabase(supabaseUser, s.RoleSource)
+}
+
+// getAdminSupabaseUser fetches the raw user object by ID from the Admin API.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user ID.
+// Returns the user object or an error if the request fails.
+func (s *Service) getAdminSupabaseUser(ctx context.Context, userID string) (SupabaseUser, error) {
+	var (
+		endpoint     string
+		bodyBytes    []byte
+		supabaseUser SupabaseUser
+		err          error
+	)
+
+	endpoint = fmt.Sprintf("%s%s/%s", s.ProjectURL, AdminUsersPath, url.PathEscape(userID))
+	bodyBytes, err = s.sendRequest(ctx, AdminUsersPath, "GET", endpoint, nil, s.getServiceHeaders())
+	if err != nil {
+		Logf("getAdminUser", "Failed to fetch user %s: %v", userID, err)
+		return SupabaseUser{}, err
+	}
+
+	if err = json.Unmarshal(bodyBytes, &supabaseUser); err != nil {
+		return SupabaseUser{}, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+
+	return supabaseUser, nil
+}
+
+// userFromCached builds a User from a cached session.
+func userFromCached(cachedUser *CachedUser) *User {
+	return &User{
+		UserID:      cachedUser.UserID,
+		Email:       cachedUser.Email,
+		Username:    cachedUser.Username,
+		DisplayName: cachedUser.DisplayName,
+		Role:        cachedUser.Role,
+		Phone:       cachedUser.Phone,
+		DateOfBirth: cachedUser.DateOfBirth,
+		Metadata:    cachedUser.Metadata,
+		AppMetadata: cachedUser.AppMetadata,
+	}
+}
+
+// userFromSupabase builds a User from a Supabase user object.
+// supabaseUser is the user object.
+// source selects the metadata object the role is read from.
+// Returns an error if the user ID is not a valid UUID.
+func userFromSupabase(supabaseUser SupabaseUser, source RoleSource) (*User, error) {
+	var (
+		userID uuid.UUID
+		err    error
+	)
+
+	userID, err = uuid.Parse(supabaseUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+
+	username, _ := getStringMetadata(supabaseUser.UserMetadata, "username")
+	displayName, _ := getStringMetadata(supabaseUser.UserMetadata, "display_name")
+	role := source.role(supabaseUser.AppMetadata, supabaseUser.UserMetadata)
+	dateOfBirth, _ := getStringMetadata(supabaseUser.UserMetadata, "date_of_birth")
+
+	return &User{
+		UserID:      userID,
+		Email:       supabaseUser.Email,
+		Username:    username,
+		DisplayName: displayName,
+		Role:        role,
+		Phone:       supabaseUser.Phone,
+		DateOfBirth: dateOfBirth,
+		Metadata:    supabaseUser.UserMetadata,
+		AppMetadata: supabaseUser.AppMetadata,
+	}, nil
+}
+
+// escapeLikePattern escapes the LIKE wildcards % and _ (and the escape character) in value.
+func escapeLikePattern(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,154 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestUserCacheLookupIndexes tests that email and username indexes follow Set, Update and Delete.
+func TestUserCacheLookupIndexes(t *testing.T) {
+	var (
+		testName     = "TestUserCacheLookupIndexes"
+		cache        *UserCache
+		userID       uuid.UUID
+		cachedUser   *CachedUser
+		found        bool
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: one user with two sessions
+	cache = NewUserCache()
+	userID = uuid.New()
+	cache.Set("token-1", &CachedUser{UserID: userID, SessionID: "s1", Email: "Jane@Example.com", Username: "Jane", ExpiresAt: time.Now().Add(time.Hour)})
+	cache.Set("token-2", &CachedUser{UserID: userID, SessionID: "s2", Email: "Jane@Example.com", Username: "Jane", ExpiresAt: time.Now().Add(2 * time.Hour)})
+
+	// verify: case-insensitive lookups return the freshest session
+	cachedUser, found = cache.GetByEmail("  jane@EXAMPLE.com ")
+	if !found || cachedUser.SessionID != "s2" {
+		errorMessage = fmt.Sprintf("Expected session s2 by email, got %v", cachedUser)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, found = cache.GetByUsername("JANE"); !found {
+		errorMessage = "Expected username lookup to be case-insensitive"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Lookups by case variants return the freshest session\n")
+
+	// execute: delete the freshest session by token
+	cache.Delete("token-2")
+	cachedUser, found = cache.GetByEmail("jane@example.com")
+	if !found || cachedUser.SessionID != "s1" || len(cache.usersByID[userID]) != 1 || len(cache.emails["jane@example.com"]) != 1 {
+		errorMessage = "Delete should drop the session from usersByID and the lookup indexes"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Delete removes the session from every index\n")
+
+	// execute: change email and username
+	cache.Update(userID, func(u *CachedUser) {
+		u.Email = "jane.doe@example.com"
+		u.Username = "janedoe"
+	})
+	_, foundOld := cache.GetByEmail("jane@example.com")
+	_, foundNew := cache.GetByUsername("JaneDoe")
+	if foundOld || !foundNew || len(cache.emails) != 1 || len(cache.usernames) != 1 {
+		errorMessage = fmt.Sprintf("Update should move index keys (old: %v, new: %v)", foundOld, foundNew)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	cache.DeleteByUserID(userID)
+	if len(cache.emails) != 0 || len(cache.usernames) != 0 || len(cache.usersByID) != 0 {
+		errorMessage = "DeleteByUserID should leave empty indexes"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Update moves index keys, DeleteByUserID clears them\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestGetUserByEmailAndUsername tests cache hits and the Admin API / profiles table fallbacks.
+func TestGetUserByEmailAndUsername(t *testing.T) {
+	var (
+		testName     = "TestGetUserByEmailAndUsername"
+		service      *Service
+		client       *mockHTTPClient
+		server       *mockAuthServer
+		ctx          context.Context
+		user         *User
+		calls        int64
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, client, server = newMockService()
+	ctx = context.Background()
+
+	// execute: cache misses use the Admin API (the match is on the second page of results) and the profiles table
+	user, err = service.GetUserByEmail(ctx, "MOCK@example.com")
+	if err != nil || user.UserID != server.userID || user.Username != "mockuser" {
+		errorMessage = fmt.Sprintf("Admin API fallback failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, err = service.GetUserByEmail(ctx, "mock@example"); !errors.Is(err, ErrUserNotFound) {
+		errorMessage = fmt.Sprintf("Partial email match should return ErrUserNotFound, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, err = service.GetUserByUsername(ctx, "MockUser"); !errors.Is(err, ErrUserNotFound) {
+		errorMessage = fmt.Sprintf("Username lookup without profiles table should miss, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	service.ProfilesTable = "profiles"
+	user, err = service.GetUserByUsername(ctx, "MockUser")
+	if err != nil || user.UserID != server.userID {
+		errorMessage = fmt.Sprintf("Profiles table fallback failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Cache misses fall back to the Admin API and profiles table\n")
+
+	// execute: after login the cache answers without requests
+	if _, err = service.LoginUser(ctx, server.email, "password"); err != nil {
+		errorMessage = fmt.Sprintf("Login failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	calls = client.calls.Load()
+	_, err = service.GetUserByEmail(ctx, "Mock@Example.com")
+	if err == nil {
+		_, err = service.GetUserByUsername(ctx, "MOCKUSER")
+	}
+	if err != nil || client.calls.Load() != calls {
+		errorMessage = fmt.Sprintf("Cached lookups should not call Supabase (err: %v, calls: %d)", err, client.calls.Load()-calls)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Cached lookups served without requests\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
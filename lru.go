@@ -0,0 +1,150 @@
+package ft_supabase
+
+import (
+	"container/heap"
+	"time"
+)
+
+// cacheEntry wraps a cached session with its position in the recency list and expiry heap.
+// user is the cached session; it is immutable once stored and replaced as a whole on update (copy-on-write).
+// lastSeen is the timestamp of the last Get(), kept outside user so reads do not copy the session.
+// prev and next link the entry into the recency list (most recent at the front).
+// heapIndex is the entry's index in the expiry heap (-1 when not in the heap).
+//
+// Used in:
+// - UserCache - every index points to cacheEntry values
+type cacheEntry struct {
+	user      *CachedUser
+	lastSeen  time.Time
+	prev      *cacheEntry
+	next      *cacheEntry
+	heapIndex int
+}
+
+// snapshot returns a private copy of the cached session with its current LastSeenAt.
+func (e *cacheEntry) snapshot() *CachedUser {
+	var (
+		user CachedUser
+	)
+
+	user = *e.user
+	user.LastSeenAt = e.lastSeen
+	user.Metadata = cloneMetadata(e.user.Metadata)
+	user.AppMetadata = cloneMetadata(e.user.AppMetadata)
+
+	return &user
+}
+
+// lruList is an intrusive doubly linked list ordered by access recency.
+// root is a sentinel: root.next is the most recently used entry, root.prev the least recently used.
+//
+// Used in:
+// - UserCache.Set() - inserts new sessions at the front
+// - UserCache.Get() - moves accessed sessions to the front
+// - UserCache eviction - removes the entry at the back
+type lruList struct {
+	root cacheEntry
+	len  int
+}
+
+// init resets the list to empty.
+func (l *lruList) init() {
+	l.root.next = &l.root
+	l.root.prev = &l.root
+	l.len = 0
+}
+
+// pushFront inserts e as the most recently used entry in O(1).
+func (l *lruList) pushFront(e *cacheEntry) {
+	e.prev = &l.root
+	e.next = l.root.next
+	l.root.next.prev = e
+	l.root.next = e
+	l.len++
+}
+
+// remove unlinks e from the list in O(1).
+func (l *lruList) remove(e *cacheEntry) {
+	if e.prev == nil {
+		return
+	}
+	e.prev.next = e.next
+	e.next.prev = e.prev
+	e.prev = nil
+	e.next = nil
+	l.len--
+}
+
+// moveToFront marks e as the most recently used entry in O(1).
+func (l *lruList) moveToFront(e *cacheEntry) {
+	if l.root.next == e {
+		return
+	}
+	l.remove(e)
+	l.pushFront(e)
+}
+
+// back returns the least recently used entry, or nil if the list is empty.
+func (l *lruList) back() *cacheEntry {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.prev
+}
+
+// expiryHeap is a min-heap of cache entries ordered by ExpiresAt.
+// Implements heap.Interface; use the container/heap functions to modify it.
+//
+// Used in:
+// - UserCache.Set() - tracks new sessions
+// - UserCache.Cleanup() - pops expired sessions in O(log n) each
+type expiryHeap []*cacheEntry
+
+// Len returns the number of entries in the heap.
+func (h expiryHeap) Len() int { return len(h) }
+
+// Less orders entries by earliest expiry first.
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].user.ExpiresAt.Before(h[j].user.ExpiresAt)
+}
+
+// Swap swaps two entries and keeps their heap indexes in sync.
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIndex = i
+	h[j].heapIndex = j
+}
+
+// Push appends an entry; called by heap.Push.
+func (h *expiryHeap) Push(x any) {
+	e := x.(*cacheEntry)
+	e.heapIndex = len(*h)
+	*h = append(*h, e)
+}
+
+// Pop removes the last entry; called by heap.Pop.
+func (h *expiryHeap) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.heapIndex = -1
+	*h = old[:n-1]
+	return e
+}
+
+// peek returns the entry with the earliest expiry, or nil if the heap is empty.
+func (h expiryHeap) peek() *cacheEntry {
+	if len(h) == 0 {
+		return nil
+	}
+	return h[0]
+}
+
+// removeEntry removes e from the heap in O(log n).
+func (h *expiryHeap) removeEntry(e *cacheEntry) {
+	if e.heapIndex < 0 || e.heapIndex >= len(*h) || (*h)[e.heapIndex] != e {
+		return
+	}
+	heap.Remove(h, e.heapIndex)
+}
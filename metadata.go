@@ -0,0 +1,164 @@
+package ft_supabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for typed metadata.
+var (
+	ErrInvalidMetadata = errors.New("metadata must encode to a JSON object")
+)
+
+// RegisterUserWith registers a new user with Supabase Auth API using typed metadata.
+// ctx is the context for request cancellation and timeout.
+// s is the Service to register with.
+// email is the user's email address.
+// password is the user's password.
+// phone is the user's phone number (optional, can be empty string).
+// metadata is any value encoding to a JSON object (usually a struct with json tags), stored as user_metadata.
+// The well-known fields (username, display_name, date_of_birth) are still copied to the cached session;
+// a "role" key is ignored unless Service.RoleSource reads user_metadata (see SetRole()).
+// Returns a RegisterResponse with user details or an error if encoding or registration fails.
+func RegisterUserWith[M any](ctx context.Context, s *Service, email, password, phone string, metadata M) (*RegisterResponse, error) {
+	var (
+		metadataMap map[string]any
+		err         error
+	)
+
+	metadataMap, err = encodeMetadata(metadata)
+	if err != nil {
+		Logf("RegisterUserWith", "Failed to encode metadata: %v", err)
+		return nil, err
+	}
+
+	return s.registerUser(ctx, email, password, phone, metadataMap)
+}
+
+// GetMetadata decodes the raw user_metadata of a user into M.
+// user is a User returned by the Service (e.g., GetUserByID(), GetCurrentUser(), UserFromContext()).
+// Fields missing from the metadata keep their zero value.
+// Returns the decoded metadata or an error wrapping ErrInvalidMetadata if it does not fit M.
+func GetMetadata[M any](user *User) (M, error) {
+	var (
+		metadata M
+	)
+
+	if user == nil {
+		return metadata, ErrUserNotFound
+	}
+
+	return DecodeMetadata[M](user.Metadata)
+}
+
+// DecodeMetadata decodes a raw metadata map (e.g., CachedUser.Metadata or TokenClaims.UserMetadata) into M.
+// data is the metadata map to decode; nil decodes to the zero value.
+// Returns the decoded metadata or an error wrapping ErrInvalidMetadata if it does not fit M.
+func DecodeMetadata[M any](data map[string]any) (M, error) {
+	var (
+		metadata M
+		encoded  []byte
+		err      error
+	)
+
+	if data == nil {
+		return metadata, nil
+	}
+
+	encoded, err = json.Marshal(data)
+	if err != nil {
+		return metadata, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if err = json.Unmarshal(encoded, &metadata); err != nil {
+		return metadata, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+
+	return metadata, nil
+}
+
+// UpdateMetadata updates a user's user_metadata in Supabase with typed metadata and refreshes the cache.
+// ctx is the context for request cancellation and timeout.
+// s is the Service holding the user's session.
+// userID is the Supabase user unique identifier (UUID).
+// metadata is any value encoding to a JSON object; Supabase merges its top-level keys into user_metadata,
+// so fields tagged omitempty are left untouched when empty and keys set to null are removed.
+// Returns the updated User (with the full raw metadata) or an error if encoding or the update fails.
+func UpdateMetadata[M any](ctx context.Context, s *Service, userID uuid.UUID, metadata M) (*User, error) {
+	var (
+		metadataMap map[string]any
+		err         error
+	)
+
+	metadataMap, err = encodeMetadata(metadata)
+	if err != nil {
+		Logf("UpdateMetadata", "Failed to encode metadata: %v", err)
+		return nil, err
+	}
+
+	return s.UpdateUser(ctx, userID, metadataMap)
+}
+
+// encodeMetadata converts a metadata value to the map sent to Supabase.
+// metadata is any value encoding to a JSON object; a map[string]any is used as is.
+// Returns the metadata map or an error wrapping ErrInvalidMetadata.
+func encodeMetadata(metadata any) (map[string]any, error) {
+	var (
+		metadataMap map[string]any
+		encoded     []byte
+		err         error
+	)
+
+	if m, ok := metadata.(map[string]any); ok && m != nil {
+		return m, nil
+	}
+
+	encoded, err = json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMetadata, err)
+	}
+	if err = json.Unmarshal(encoded, &metadataMap); err != nil || metadataMap == nil {
+		return nil, fmt.Errorf("%w: got %s", ErrInvalidMetadata, encoded)
+	}
+
+	return metadataMap, nil
+}
+
+// cloneMetadata returns a deep copy of a JSON-like metadata map (nested maps and slices are copied).
+// data is the metadata map to copy; nil returns nil.
+// Used so cached sessions never share metadata with callers.
+func cloneMetadata(data map[string]any) map[string]any {
+	var (
+		clone map[string]any
+	)
+
+	if data == nil {
+		return nil
+	}
+
+	clone = make(map[string]any, len(data))
+	for key, value := range data {
+		clone[key] = cloneMetadataValue(value)
+	}
+
+	return clone
+}
+
+// cloneMetadataValue deep-copies one metadata value.
+func cloneMetadataValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		return cloneMetadata(v)
+	case []any:
+		items := make([]any, len(v))
+		for i, item := range v {
+			items[i] = cloneMetadataValue(item)
+		}
+		return items
+	default:
+		return v
+	}
+}
@@ -0,0 +1,98 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// testProfile is a product profile stored in user_metadata.
+type testProfile struct {
+	Username  string   `json:"username,omitempty"`
+	Company   string   `json:"company,omitempty"`
+	Plan      string   `json:"plan,omitempty"`
+	Seats     int      `json:"seats,omitempty"`
+	Languages []string `json:"languages,omitempty"`
+}
+
+// TestTypedMetadata tests registering and updating users with typed metadata and reading it back from the cache.
+func TestTypedMetadata(t *testing.T) {
+	var (
+		testName     = "TestTypedMetadata"
+		service      *Service
+		server       *mockAuthServer
+		ctx          = context.Background()
+		registered   *RegisterResponse
+		user         *User
+		profile      testProfile
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, _, server = newMockService()
+
+	// execute: register with custom fields
+	registered, err = RegisterUserWith(ctx, service, "mock@example.com", "password", "", testProfile{
+		Username:  "acme_admin",
+		Company:   "Acme",
+		Plan:      "pro",
+		Seats:     12,
+		Languages: []string{"go", "sql"},
+	})
+	if err != nil || registered.UserName != "acme_admin" {
+		errorMessage = fmt.Sprintf("RegisterUserWith failed: %v (%+v)", err, registered)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	user, _ = service.GetUserByID(ctx, server.userID)
+	profile, err = GetMetadata[testProfile](user)
+	if err != nil || profile.Company != "Acme" || profile.Seats != 12 || len(profile.Languages) != 2 || user.Username != "acme_admin" {
+		errorMessage = fmt.Sprintf("Unexpected cached metadata: %+v (%v)", profile, err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Custom metadata fields are kept on cached users\n")
+
+	// execute: modifying returned metadata does not change the cache
+	user.Metadata["languages"].([]any)[0] = "rust"
+	user, _ = service.GetUserByID(ctx, user.UserID)
+	if user.Metadata["languages"].([]any)[0] != "go" {
+		errorMessage = "Cached metadata was modified through a returned copy"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Returned metadata is a private copy\n")
+
+	// execute: typed update merges into the existing metadata
+	user, err = UpdateMetadata(ctx, service, user.UserID, testProfile{Plan: "enterprise", Seats: 50})
+	if err == nil {
+		user, _ = service.GetUserByID(ctx, user.UserID)
+		profile, err = GetMetadata[testProfile](user)
+	}
+	if err != nil || profile.Plan != "enterprise" || profile.Seats != 50 || profile.Company != "Acme" {
+		errorMessage = fmt.Sprintf("Unexpected metadata after update: %+v (%v)", profile, err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ UpdateMetadata merges typed fields into the cached metadata\n")
+
+	// execute: values that are not JSON objects are rejected
+	_, err = UpdateMetadata(ctx, service, user.UserID, []string{"not", "an", "object"})
+	if !errors.Is(err, ErrInvalidMetadata) {
+		errorMessage = fmt.Sprintf("Expected ErrInvalidMetadata, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Non-object metadata is rejected\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
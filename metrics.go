@@ -0,0 +1,323 @@
+package ft_supabase
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds (in seconds) of the Supabase request latency histogram.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// CacheStats is a snapshot of cache counters.
+// Hits is the number of Get() calls that found a valid session.
+// Misses is the number of Get() calls that found no valid session.
+// Sets is the number of stored sessions.
+// Evictions is the number of sessions removed because the cache was full.
+// Expirations is the number of expired sessions removed.
+// Deletes is the number of sessions removed on request (Delete, DeleteByUserID, RevokeSession).
+// Size is the current number of sessions.
+// MaxSize is the maximum number of sessions.
+//
+// Used in:
+// - UserCache.Stats(), ShardedUserCache.Stats() - returns cache counters
+// - ServiceStats - embedded cache counters
+type CacheStats struct {
+	Hits        uint64 `json:"hits"`
+	Misses      uint64 `json:"misses"`
+	Sets        uint64 `json:"sets"`
+	Evictions   uint64 `json:"evictions"`
+	Expirations uint64 `json:"expirations"`
+	Deletes     uint64 `json:"deletes"`
+	Size        int    `json:"size"`
+	MaxSize     int    `json:"max_size"`
+}
+
+// CacheStatsProvider is implemented by session stores that count cache operations.
+//
+// Used in:
+// - Service.Stats() - includes cache counters when available
+type CacheStatsProvider interface {
+	// Stats returns a snapshot of the cache counters.
+	Stats() CacheStats
+}
+
+// compile-time checks that the in-memory caches implement CacheStatsProvider
+var (
+	_ CacheStatsProvider = (*UserCache)(nil)
+	_ CacheStatsProvider = (*ShardedUserCache)(nil)
+)
+
+// RequestStats holds the latency histogram of one Supabase endpoint, method and status.
+// Endpoint is the API path constant (e.g., LoginPath).
+// Method is the HTTP method.
+// Status is the HTTP status code, "2xx" for success, or "error" if no response was received.
+// Count is the number of requests.
+// TotalSeconds is the sum of request durations in seconds.
+// Buckets are cumulative request counts for each LatencyBuckets upper bound.
+//
+// Used in:
+// - ServiceStats - request latency by endpoint and status
+type RequestStats struct {
+	Endpoint     string   `json:"endpoint"`
+	Method       string   `json:"method"`
+	Status       string   `json:"status"`
+	Count        uint64   `json:"count"`
+	TotalSeconds float64  `json:"total_seconds"`
+	Buckets      []uint64 `json:"buckets"`
+}
+
+// ServiceStats is a snapshot of service metrics.
+// Requests are the Supabase request latency histograms, sorted by endpoint, method and status.
+// LoginSuccess is the number of successful LoginUser() calls.
+// LoginFailure is the number of failed LoginUser() calls.
+// Cache are the session store counters (nil if the store does not count operations).
+//
+// Used in:
+// - Service.Stats() - returns service metrics
+// - Service.MetricsHandler() - rendered in Prometheus format
+// - Service.PublishExpvar() - published as JSON
+type ServiceStats struct {
+	Requests     []RequestStats `json:"requests"`
+	LoginSuccess uint64         `json:"login_success"`
+	LoginFailure uint64         `json:"login_failure"`
+	Cache        *CacheStats    `json:"cache,omitempty"`
+}
+
+// serviceMetrics collects service metrics.
+// mu guards requests.
+// requests maps endpoint, method and status to latency histograms.
+// loginSuccess and loginFailure count LoginUser() results.
+type serviceMetrics struct {
+	mu           sync.Mutex
+	requests     map[requestKey]*RequestStats
+	loginSuccess atomic.Uint64
+	loginFailure atomic.Uint64
+}
+
+// requestKey identifies a request histogram.
+type requestKey struct {
+	endpoint string
+	method   string
+	status   string
+}
+
+// newServiceMetrics creates an empty metrics collector.
+func newServiceMetrics() *serviceMetrics {
+	return &serviceMetrics{requests: make(map[requestKey]*RequestStats)}
+}
+
+// observeRequest records the duration of a Supabase request.
+// endpoint is the API path constant.
+// method is the HTTP method.
+// duration is the request duration.
+// err is the request error (nil on success).
+func (m *serviceMetrics) observeRequest(endpoint, method string, duration time.Duration, err error) {
+	var (
+		status = "2xx"
+		apiErr *APIError
+	)
+
+	if errors.As(err, &apiErr) {
+		status = strconv.Itoa(apiErr.StatusCode)
+	} else if err != nil {
+		status = "error"
+	}
+
+	m.observeStatus(endpoint, method, duration, status)
+}
+
+// observeStatus records the duration of a Supabase request with its status label.
+// endpoint is the API path constant.
+// method is the HTTP method.
+// duration is the request duration.
+// status is "2xx", the HTTP status code, or "error".
+func (m *serviceMetrics) observeStatus(endpoint, method string, duration time.Duration, status string) {
+	var (
+		key     requestKey
+		stats   *RequestStats
+		seconds float64
+		exists  bool
+	)
+
+	if m == nil {
+		return
+	}
+
+	key = requestKey{endpoint: endpoint, method: method, status: status}
+	seconds = duration.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats, exists = m.requests[key]
+	if !exists {
+		stats = &RequestStats{Endpoint: endpoint, Method: method, Status: key.status, Buckets: make([]uint64, len(LatencyBuckets))}
+		m.requests[key] = stats
+	}
+	stats.Count++
+	stats.TotalSeconds += seconds
+	for i, bound := range LatencyBuckets {
+		if seconds <= bound {
+			stats.Buckets[i]++
+		}
+	}
+}
+
+// observeLogin records a LoginUser() result.
+// success is true if the login succeeded.
+func (m *serviceMetrics) observeLogin(success bool) {
+	if m == nil {
+		return
+	}
+	if success {
+		m.loginSuccess.Add(1)
+	} else {
+		m.loginFailure.Add(1)
+	}
+}
+
+// sendRequest sends a Supabase request through HTTPClient and records its latency.
+// endpoint is the API path constant used as metrics label (never the full URL, which may contain IDs).
+// The other parameters are passed to HTTPClient.Ft_SupabaseSendRequest().
+// Returns the response body or an error.
+func (s *Service) sendRequest(ctx context.Context, endpoint, method, url string, body any, headers map[string]string) ([]byte, error) {
+	var (
+		start     time.Time
+		bodyBytes []byte
+		err       error
+	)
+
+	start = time.Now()
+	bodyBytes, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, method, url, body, headers)
+	s.metrics.observeRequest(endpoint, method, time.Since(start), err)
+
+	return bodyBytes, err
+}
+
+// Stats returns a snapshot of the service metrics, including cache counters when the store provides them.
+func (s *Service) Stats() ServiceStats {
+	var (
+		stats    ServiceStats
+		provider CacheStatsProvider
+		ok       bool
+	)
+
+	if s.metrics != nil {
+		s.metrics.mu.Lock()
+		for _, request := range s.metrics.requests {
+			copied := *request
+			copied.Buckets = append([]uint64(nil), request.Buckets...)
+			stats.Requests = append(stats.Requests, copied)
+		}
+		s.metrics.mu.Unlock()
+
+		stats.LoginSuccess = s.metrics.loginSuccess.Load()
+		stats.LoginFailure = s.metrics.loginFailure.Load()
+	}
+
+	sort.Slice(stats.Requests, func(i, j int) bool {
+		a, b := stats.Requests[i], stats.Requests[j]
+		if a.Endpoint != b.Endpoint {
+			return a.Endpoint < b.Endpoint
+		}
+		if a.Method != b.Method {
+			return a.Method < b.Method
+		}
+		return a.Status < b.Status
+	})
+
+	provider, ok = s.Cache.(CacheStatsProvider)
+	if ok {
+		cacheStats := provider.Stats()
+		stats.Cache = &cacheStats
+	}
+
+	return stats
+}
+
+// MetricsHandler returns an http.Handler rendering the service metrics in Prometheus text exposition format.
+// Mount it on your metrics endpoint (e.g., mux.Handle("/metrics", service.MetricsHandler())).
+func (s *Service) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, s.Stats())
+	})
+}
+
+// PublishExpvar publishes the service metrics as JSON under name in the expvar registry (/debug/vars).
+// name is the expvar variable name.
+// Panics if name is already published, like expvar.Publish.
+func (s *Service) PublishExpvar(name string) {
+	Logf("PublishExpvar", "Publishing service metrics to expvar - Name: %s", name)
+	expvar.Publish(name, expvar.Func(func() any { return s.Stats() }))
+}
+
+// WritePrometheus renders stats in Prometheus text exposition format.
+// w is the destination writer.
+// stats is the metrics snapshot to render.
+// Returns the first write error.
+func WritePrometheus(w io.Writer, stats ServiceStats) error {
+	var (
+		b strings.Builder
+	)
+
+	writeMetricHeader(&b, "ft_supabase_login_total", "counter", "LoginUser calls by result.")
+	fmt.Fprintf(&b, "ft_supabase_login_total{result=\"success\"} %d\n", stats.LoginSuccess)
+	fmt.Fprintf(&b, "ft_supabase_login_total{result=\"failure\"} %d\n", stats.LoginFailure)
+
+	writeMetricHeader(&b, "ft_supabase_request_duration_seconds", "histogram", "Supabase API request latency by endpoint, method and status.")
+	for _, request := range stats.Requests {
+		labels := fmt.Sprintf("endpoint=\"%s\",method=\"%s\",status=\"%s\"", escapeLabel(request.Endpoint), escapeLabel(request.Method), escapeLabel(request.Status))
+		for i, bound := range LatencyBuckets {
+			fmt.Fprintf(&b, "ft_supabase_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", labels, strconv.FormatFloat(bound, 'g', -1, 64), request.Buckets[i])
+		}
+		fmt.Fprintf(&b, "ft_supabase_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, request.Count)
+		fmt.Fprintf(&b, "ft_supabase_request_duration_seconds_sum{%s} %s\n", labels, strconv.FormatFloat(request.TotalSeconds, 'g', -1, 64))
+		fmt.Fprintf(&b, "ft_supabase_request_duration_seconds_count{%s} %d\n", labels, request.Count)
+	}
+
+	if stats.Cache != nil {
+		for _, counter := range []struct {
+			name  string
+			help  string
+			value uint64
+		}{
+			{"ft_supabase_cache_hits_total", "Cache lookups that found a valid session.", stats.Cache.Hits},
+			{"ft_supabase_cache_misses_total", "Cache lookups that found no valid session.", stats.Cache.Misses},
+			{"ft_supabase_cache_sets_total", "Sessions stored in the cache.", stats.Cache.Sets},
+			{"ft_supabase_cache_evictions_total", "Sessions evicted because the cache was full.", stats.Cache.Evictions},
+			{"ft_supabase_cache_expirations_total", "Expired sessions removed from the cache.", stats.Cache.Expirations},
+			{"ft_supabase_cache_deletes_total", "Sessions removed on request.", stats.Cache.Deletes},
+		} {
+			writeMetricHeader(&b, counter.name, "counter", counter.help)
+			fmt.Fprintf(&b, "%s %d\n", counter.name, counter.value)
+		}
+		writeMetricHeader(&b, "ft_supabase_cache_size", "gauge", "Sessions currently in the cache.")
+		fmt.Fprintf(&b, "ft_supabase_cache_size %d\n", stats.Cache.Size)
+		writeMetricHeader(&b, "ft_supabase_cache_max_size", "gauge", "Maximum number of sessions in the cache.")
+		fmt.Fprintf(&b, "ft_supabase_cache_max_size %d\n", stats.Cache.MaxSize)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric.
+func writeMetricHeader(b *strings.Builder, name, metricType, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// escapeLabel escapes a Prometheus label value.
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
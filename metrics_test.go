@@ -0,0 +1,100 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestServiceStats tests request, login and cache metrics and their Prometheus rendering.
+func TestServiceStats(t *testing.T) {
+	var (
+		testName     = "TestServiceStats"
+		service      *Service
+		server       *mockAuthServer
+		ctx          context.Context
+		login        *LoginResponse
+		stats        ServiceStats
+		recorder     *httptest.ResponseRecorder
+		body         string
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, _, server = newMockService()
+	ctx = context.Background()
+
+	// execute: one failed and one successful login, a cache hit and a miss
+	_, err = service.LoginUser(ctx, server.email, "wrong")
+	if !errors.Is(err, ErrInvalidStatus) {
+		errorMessage = fmt.Sprintf("Expected ErrInvalidStatus, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	login, err = service.LoginUser(ctx, server.email, "password")
+	if err != nil {
+		errorMessage = fmt.Sprintf("LoginUser failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	service.GetCurrentUser(ctx, login.Token)
+	service.GetCurrentUser(ctx, "unknown-token")
+
+	// verify
+	stats = service.Stats()
+	if stats.LoginSuccess != 1 || stats.LoginFailure != 1 || len(stats.Requests) != 2 {
+		errorMessage = fmt.Sprintf("Unexpected service stats: %+v", stats)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if stats.Requests[0].Status != "2xx" || stats.Requests[1].Status != "400" || stats.Requests[0].Endpoint != LoginPath {
+		errorMessage = fmt.Sprintf("Unexpected request labels: %+v", stats.Requests)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if stats.Cache == nil || stats.Cache.Hits != 1 || stats.Cache.Misses != 1 || stats.Cache.Sets != 1 || stats.Cache.Size != 1 || stats.Cache.MaxSize != 1000 {
+		errorMessage = fmt.Sprintf("Unexpected cache stats: %+v", stats.Cache)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Stats count logins, requests by status and cache operations\n")
+
+	recorder = httptest.NewRecorder()
+	service.MetricsHandler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body = recorder.Body.String()
+	for _, line := range []string{
+		`ft_supabase_login_total{result="failure"} 1`,
+		`ft_supabase_request_duration_seconds_count{endpoint="/auth/v1/token?grant_type=password",method="POST",status="400"} 1`,
+		`ft_supabase_request_duration_seconds_bucket{endpoint="/auth/v1/token?grant_type=password",method="POST",status="2xx",le="+Inf"} 1`,
+		"ft_supabase_cache_hits_total 1",
+		"ft_supabase_cache_max_size 1000",
+		"# TYPE ft_supabase_request_duration_seconds histogram",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			errorMessage = fmt.Sprintf("Metrics output missing %q:\n%s", line, body)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		errorMessage = "Unexpected metrics content type: " + recorder.Header().Get("Content-Type")
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Prometheus exposition format rendered\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
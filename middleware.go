@@ -0,0 +1,316 @@
+package ft_supabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ErrMissingToken is returned when a request carries no access token.
+var ErrMissingToken = errors.New("missing access token")
+
+// contextKey is the type of the request context keys set by the middleware.
+type contextKey int
+
+// Request context keys.
+const (
+	userContextKey contextKey = iota
+	claimsContextKey
+	tokenContextKey
+	csrfContextKey
+)
+
+// MiddlewareOptions configures Service.Middleware().
+// CookieName is the cookie read when the Authorization header is absent (empty disables).
+// QueryParam is the query parameter read last, e.g. for WebSocket upgrades (empty disables; tokens in URLs end up in logs).
+// Optional lets requests without a token through anonymously; requests with an invalid token are still rejected.
+// Realm is the realm of the WWW-Authenticate challenge (default "supabase").
+// ErrorHandler writes the response of rejected requests (default: JSON error body).
+//
+// Used in:
+// - Service.Middleware() - configures token extraction and rejection
+type MiddlewareOptions struct {
+	CookieName   string
+	QueryParam   string
+	Optional     bool
+	Realm        string
+	ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+}
+
+// Middleware returns net/http middleware authenticating requests with Supabase access tokens.
+// opts configures where tokens are read from and how failures are answered.
+// The token is read from the Authorization Bearer header, then CookieName, then QueryParam, and validated with ValidateToken().
+// Authenticated requests carry the user, claims and token in their context (see UserFromContext()).
+// Rejected requests get 401 with a WWW-Authenticate header, or 503 if Supabase cannot be reached.
+func (s *Service) Middleware(opts MiddlewareOptions) func(http.Handler) http.Handler {
+	if opts.Realm == "" {
+		opts.Realm = "supabase"
+	}
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = writeAuthError
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				token  string
+				user   *User
+				claims *TokenClaims
+				err    error
+			)
+
+			token = extractToken(r, opts)
+			if token == "" {
+				if opts.Optional {
+					next.ServeHTTP(w, r)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s"`, opts.Realm))
+				opts.ErrorHandler(w, r, http.StatusUnauthorized, ErrMissingToken)
+				return
+			}
+
+			user, claims, err = s.ValidateToken(r.Context(), token)
+			if err != nil {
+				if !IsTokenError(err) {
+					Logf("Middleware", "Token validation unavailable: %v", err)
+					opts.ErrorHandler(w, r, http.StatusServiceUnavailable, err)
+					return
+				}
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s", error="invalid_token", error_description="%s"`, opts.Realm, tokenErrorDescription(err)))
+				opts.ErrorHandler(w, r, http.StatusUnauthorized, err)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(ContextWithUser(r.Context(), user, claims, token)))
+		})
+	}
+}
+
+// ValidateToken validates a Supabase access token and returns its user.
+// ctx is the context for request cancellation and timeout.
+// token is the JWT access token.
+// Tokens are checked against the cache first, then verified locally when JWTSecret is set,
+// then validated with the Supabase API (GET /auth/v1/user) and cached until they expire, unless their session is
+// already cached (its entry, with the refresh token and device info, is kept).
+// Returns the User and token claims, or ErrInvalidToken, ErrTokenExpired, ErrTokenSignature or the API error.
+func (s *Service) ValidateToken(ctx context.Context, token string) (*User, *TokenClaims, error) {
+	var (
+		claims       *TokenClaims
+		cachedUser   *CachedUser
+		user         *User
+		url          string
+		bodyBytes    []byte
+		supabaseUser SupabaseUser
+		found        bool
+		err          error
+	)
+
+	// reject malformed and expired tokens without any lookup
+	claims, err = ParseTokenClaims(token)
+	if err != nil {
+		return nil, nil, err
+	}
+	if claims.Expired(time.Now()) {
+		return nil, nil, ErrTokenExpired
+	}
+
+	// cached tokens were issued by Supabase through this service
+	cachedUser, found = s.Cache.Get(token)
+	if found {
+		return userFromCached(cachedUser), claims, nil
+	}
+
+	// local verification avoids a network round trip
+	if len(s.JWTSecret) > 0 {
+		claims, err = VerifyTokenHS256(token, s.JWTSecret)
+		if err != nil {
+			Logf("ValidateToken", "Local token verification failed: %v", err)
+			return nil, nil, err
+		}
+		user, err = userFromClaims(claims, s.RoleSource)
+		if err != nil {
+			return nil, nil, err
+		}
+		return user, claims, nil
+	}
+
+	Log("ValidateToken", "Validating token with Supabase")
+
+	url = fmt.Sprintf("%s%s", s.ProjectURL, UserPath)
+	bodyBytes, err = s.sendRequest(ctx, UserPath, "GET", url, nil, s.getAuthHeaders(token))
+	if err != nil {
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusUnauthorized || apiErr.StatusCode == http.StatusForbidden) {
+			return nil, nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		Logf("ValidateToken", "Failed to validate token: %v", err)
+		return nil, nil, err
+	}
+
+	if err = json.Unmarshal(bodyBytes, &supabaseUser); err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+	user, err = userFromSupabase(supabaseUser, s.RoleSource)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// a cached session already holds the refresh token and device info of this session ID,
+	// and caching this token would replace it
+	if claims.SessionID != "" {
+		if _, found = s.Cache.GetBySessionID(claims.SessionID); found {
+			return user, claims, nil
+		}
+	}
+
+	// cache the validated token until it expires
+	s.Cache.Set(token, &CachedUser{
+		UserID:      user.UserID,
+		Email:       user.Email,
+		Username:    user.Username,
+		DisplayName: user.DisplayName,
+		Role:        user.Role,
+		Phone:       user.Phone,
+		DateOfBirth: user.DateOfBirth,
+		Metadata:    user.Metadata,
+		AppMetadata: user.AppMetadata,
+		AccessToken: token,
+		ExpiresAt:   time.Unix(claims.ExpiresAt, 0),
+		CachedAt:    time.Now(),
+		SessionID:   claims.SessionID,
+	})
+
+	return user, claims, nil
+}
+
+// ContextWithUser returns a copy of ctx carrying an authenticated user, its claims and token.
+// Used by Middleware(); also useful to build contexts in tests and other transports.
+func ContextWithUser(ctx context.Context, user *User, claims *TokenClaims, token string) context.Context {
+	ctx = context.WithValue(ctx, userContextKey, user)
+	ctx = context.WithValue(ctx, claimsContextKey, claims)
+	return context.WithValue(ctx, tokenContextKey, token)
+}
+
+// UserFromContext returns the authenticated user stored by Middleware().
+// Returns nil and false for anonymous requests.
+func UserFromContext(ctx context.Context) (*User, bool) {
+	user, ok := ctx.Value(userContextKey).(*User)
+	return user, ok && user != nil
+}
+
+// ClaimsFromContext returns the token claims stored by Middleware().
+// Returns nil and false for anonymous requests.
+func ClaimsFromContext(ctx context.Context) (*TokenClaims, bool) {
+	claims, ok := ctx.Value(claimsContextKey).(*TokenClaims)
+	return claims, ok && claims != nil
+}
+
+// TokenFromContext returns the access token stored by Middleware(), e.g. to call Supabase on behalf of the user.
+// Returns an empty string and false for anonymous requests.
+func TokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(tokenContextKey).(string)
+	return token, ok && token != ""
+}
+
+// extractToken reads the access token of a request.
+// Returns the token from the Authorization Bearer header, the cookie or the query parameter, or an empty string.
+func extractToken(r *http.Request, opts MiddlewareOptions) string {
+	var (
+		header string
+		cookie *http.Cookie
+		err    error
+	)
+
+	header = r.Header.Get(HeaderAuthorization)
+	if len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+
+	if opts.CookieName != "" {
+		cookie, err = r.Cookie(opts.CookieName)
+		if err == nil && cookie.Value != "" {
+			return cookie.Value
+		}
+	}
+
+	if opts.QueryParam != "" {
+		return r.URL.Query().Get(opts.QueryParam)
+	}
+
+	return ""
+}
+
+// userFromClaims builds a User from verified token claims.
+// claims are the verified token claims.
+// source selects the metadata object the role is read from.
+// Returns an error if the subject is not a valid UUID.
+func userFromClaims(claims *TokenClaims, source RoleSource) (*User, error) {
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := getStringMetadata(claims.UserMetadata, "username")
+	displayName, _ := getStringMetadata(claims.UserMetadata, "display_name")
+	role := source.role(claims.AppMetadata, claims.UserMetadata)
+	dateOfBirth, _ := getStringMetadata(claims.UserMetadata, "date_of_birth")
+
+	return &User{
+		UserID:      userID,
+		Email:       claims.Email,
+		Username:    username,
+		DisplayName: displayName,
+		Role:        role,
+		Phone:       claims.Phone,
+		DateOfBirth: dateOfBirth,
+		Metadata:    cloneMetadata(claims.UserMetadata),
+		AppMetadata: cloneMetadata(claims.AppMetadata),
+	}, nil
+}
+
+// IsTokenError reports whether err means the token itself was rejected (401 rather than 503),
+// as opposed to Supabase being unreachable.
+// err is an error returned by ValidateToken().
+// Used by Middleware() and other transports (e.g., grpcauth) to choose between an authentication and an availability error.
+func IsTokenError(err error) bool {
+	return errors.Is(err, ErrInvalidToken) || errors.Is(err, ErrTokenExpired) ||
+		errors.Is(err, ErrTokenSignature) || errors.Is(err, ErrTokenParseUserID)
+}
+
+// tokenErrorDescription returns a WWW-Authenticate error_description that never echoes the token.
+func tokenErrorDescription(err error) string {
+	switch {
+	case errors.Is(err, ErrTokenExpired):
+		return "token has expired"
+	case errors.Is(err, ErrTokenSignature):
+		return "invalid token signature"
+	default:
+		return "invalid token"
+	}
+}
+
+// writeAuthError writes a JSON error body with status.
+func writeAuthError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	var (
+		code        = "invalid_token"
+		description = tokenErrorDescription(err)
+	)
+
+	switch {
+	case errors.Is(err, ErrMissingToken), errors.Is(err, ErrNoSessionCookie):
+		code, description = "unauthorized", ErrMissingToken.Error()
+	case errors.Is(err, ErrCSRFTokenMismatch):
+		code, description = "csrf_token_mismatch", ErrCSRFTokenMismatch.Error()
+	case status == http.StatusServiceUnavailable:
+		code, description = "temporarily_unavailable", "authentication service unavailable"
+	}
+
+	w.Header().Set(HeaderContentType, ContentTypeJSON)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
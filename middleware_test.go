@@ -0,0 +1,169 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// signTestJWT builds an HS256 JWT carrying claims signed with secret.
+func signTestJWT(claims TokenClaims, secret []byte) string {
+	var (
+		unsigned string
+		payload  []byte
+		mac      = hmac.New(sha256.New, secret)
+	)
+
+	payload, _ = json.Marshal(claims)
+	unsigned = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// TestMiddleware tests token extraction, validation sources, optional routes and 401 responses.
+func TestMiddleware(t *testing.T) {
+	var (
+		testName     = "TestMiddleware"
+		service      *Service
+		client       *mockHTTPClient
+		server       *mockAuthServer
+		login        *LoginResponse
+		handler      http.Handler
+		optional     http.Handler
+		apiToken     string
+		calls        int64
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: the handler echoes the authenticated user ID
+	service, client, server = newMockService()
+	login, err = service.LoginUser(context.Background(), server.email, "password")
+	if err != nil {
+		errorMessage = fmt.Sprintf("Login failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, ok := UserFromContext(r.Context()); ok {
+			fmt.Fprint(w, user.UserID.String())
+			return
+		}
+		fmt.Fprint(w, "anonymous")
+	})
+	handler = service.Middleware(MiddlewareOptions{CookieName: "sb-access-token", QueryParam: "access_token"})(echo)
+	optional = service.Middleware(MiddlewareOptions{Optional: true})(echo)
+
+	serve := func(h http.Handler, mutate func(*http.Request)) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/", nil)
+		mutate(req)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// verify: cached token from header, cookie and query param
+	for name, mutate := range map[string]func(*http.Request){
+		"header": func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+login.Token) },
+		"cookie": func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "sb-access-token", Value: login.Token}) },
+		"query":  func(r *http.Request) { r.URL.RawQuery = "access_token=" + login.Token },
+	} {
+		rec := serve(handler, mutate)
+		if rec.Code != http.StatusOK || rec.Body.String() != server.userID.String() {
+			errorMessage = fmt.Sprintf("Token from %s should authenticate (status %d)", name, rec.Code)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ Tokens from header, cookie and query param authenticate\n")
+
+	// verify: missing token
+	rec := serve(handler, func(r *http.Request) {})
+	if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") != `Bearer realm="supabase"` {
+		errorMessage = fmt.Sprintf("Missing token should get 401 with a challenge (status %d, header %q)", rec.Code, rec.Header().Get("WWW-Authenticate"))
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if rec = serve(optional, func(r *http.Request) {}); rec.Code != http.StatusOK || rec.Body.String() != "anonymous" {
+		errorMessage = "Optional routes should let anonymous requests through"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Missing tokens get 401 unless the route is optional\n")
+
+	// verify: uncached token validated by the API once, then cached
+	apiToken = mockJWT(TokenClaims{Subject: server.userID.String(), SessionID: "api-session", ExpiresAt: time.Now().Add(time.Hour).Unix()})
+	calls = client.calls.Load()
+	for i := 0; i < 2; i++ {
+		rec = serve(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+apiToken) })
+	}
+	if rec.Code != http.StatusOK || client.calls.Load()-calls != 1 {
+		errorMessage = fmt.Sprintf("API validation should run once (status %d, calls %d)", rec.Code, client.calls.Load()-calls)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	revoked := strings.TrimSuffix(apiToken, "signature") + "revoked"
+	rec = serve(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+revoked) })
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		errorMessage = fmt.Sprintf("Token rejected by the API should get 401 (status %d)", rec.Code)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ API validation cached, rejected tokens get invalid_token\n")
+
+	// verify: validating another token of a cached session keeps the login session
+	loginClaims, _ := ParseTokenClaims(login.Token)
+	sibling := mockJWT(TokenClaims{Subject: server.userID.String(), SessionID: loginClaims.SessionID, ExpiresAt: time.Now().Add(time.Hour).Unix(), IssuedAt: 1})
+	rec = serve(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+sibling) })
+	session, found := service.Cache.Get(login.Token)
+	if rec.Code != http.StatusOK || !found || session.RefreshToken == "" {
+		errorMessage = fmt.Sprintf("Validating a sibling token should not replace the login session (status %d, found %t)", rec.Code, found)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ API validation keeps existing sessions and their refresh token\n")
+
+	// verify: local HS256 verification
+	service.JWTSecret = []byte("super-secret")
+	userID := uuid.New()
+	signed := signTestJWT(TokenClaims{Subject: userID.String(), ExpiresAt: time.Now().Add(time.Hour).Unix(), UserMetadata: map[string]any{"role": "admin"}}, service.JWTSecret)
+	expired := signTestJWT(TokenClaims{Subject: userID.String(), ExpiresAt: time.Now().Add(-time.Minute).Unix()}, service.JWTSecret)
+	forged := signTestJWT(TokenClaims{Subject: userID.String(), ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("other"))
+	calls = client.calls.Load()
+	if rec = serve(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+signed) }); rec.Code != http.StatusOK || rec.Body.String() != userID.String() || client.calls.Load() != calls {
+		errorMessage = fmt.Sprintf("Locally verified token should authenticate without requests (status %d)", rec.Code)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, token := range []string{expired, forged} {
+		if rec = serve(handler, func(r *http.Request) { r.Header.Set("Authorization", "Bearer "+token) }); rec.Code != http.StatusUnauthorized {
+			errorMessage = fmt.Sprintf("Expired or forged token should get 401 (status %d)", rec.Code)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Errorf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ Local HS256 verification rejects expired and forged tokens\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
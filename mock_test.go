@@ -0,0 +1,248 @@
+package ft_supabase
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// mockHTTPClient is an in-memory HTTPClient used by offline tests.
+// handler builds the response body for each request.
+// delay simulates network latency before the handler runs.
+// calls counts the number of requests sent.
+type mockHTTPClient struct {
+	handler func(method, url string, body any, headers map[string]string) ([]byte, error)
+	delay   time.Duration
+	calls   atomic.Int64
+}
+
+// Ft_SupabaseSendRequest implements HTTPClient by delegating to handler.
+func (m *mockHTTPClient) Ft_SupabaseSendRequest(ctx context.Context, method, url string, body any, headers map[string]string) ([]byte, error) {
+	m.calls.Add(1)
+
+	if m.delay > 0 {
+		select {
+		case <-time.After(m.delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	return m.handler(method, url, body, headers)
+}
+
+// mockAuthServer fakes the Supabase auth endpoints used by the Service.
+// userID is the user every token is issued for.
+// email is the email address of that user.
+// mu guards counter, sessions, metadata and appMetadata.
+// counter is used to mint unique tokens.
+// sessions maps refresh tokens to the session ID they belong to.
+// metadata is the user_metadata returned for the user.
+// appMetadata is the app_metadata returned for the user.
+type mockAuthServer struct {
+	userID      uuid.UUID
+	email       string
+	mu          sync.Mutex
+	counter     int
+	sessions    map[string]string
+	metadata    map[string]any
+	appMetadata map[string]any
+}
+
+// newMockService creates a Service backed by a mockHTTPClient and mockAuthServer.
+// Returns the service, the mock client, and the fake auth server.
+func newMockService() (*Service, *mockHTTPClient, *mockAuthServer) {
+	var (
+		service *Service
+		client  *mockHTTPClient
+		server  *mockAuthServer
+	)
+
+	server = &mockAuthServer{
+		userID:   uuid.New(),
+		email:    "mock@example.com",
+		sessions: make(map[string]string),
+		metadata: map[string]any{
+			"username":     "mockuser",
+			"display_name": "Mock User",
+		},
+		appMetadata: map[string]any{
+			"role": "user",
+		},
+	}
+	client = &mockHTTPClient{handler: server.handle}
+	service = NewService("mock", "http://mock.local", "anon", "service")
+	service.HTTPClient = client
+
+	return service, client, server
+}
+
+// mockJWT builds an unsigned JWT carrying the given claims.
+func mockJWT(claims TokenClaims) string {
+	var (
+		header  string
+		payload []byte
+	)
+
+	header = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, _ = json.Marshal(claims)
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".signature"
+}
+
+// authResponse mints a new SupabaseAuthResponse for sessionID with unique tokens.
+// An empty sessionID starts a new session.
+func (m *mockAuthServer) authResponse(sessionID string) SupabaseAuthResponse {
+	var (
+		n            int
+		expiresAt    time.Time
+		refreshToken string
+		metadata     map[string]any
+		appMetadata  map[string]any
+	)
+
+	m.mu.Lock()
+	m.counter++
+	n = m.counter
+	if sessionID == "" {
+		sessionID = uuid.NewString()
+	}
+	refreshToken = fmt.Sprintf("refresh-%d", n)
+	m.sessions[refreshToken] = sessionID
+	metadata = make(map[string]any, len(m.metadata))
+	for k, v := range m.metadata {
+		metadata[k] = v
+	}
+	appMetadata = make(map[string]any, len(m.appMetadata))
+	for k, v := range m.appMetadata {
+		appMetadata[k] = v
+	}
+	m.mu.Unlock()
+
+	expiresAt = time.Now().Add(time.Hour)
+
+	return SupabaseAuthResponse{
+		AccessToken: mockJWT(TokenClaims{
+			Subject:   m.userID.String(),
+			SessionID: sessionID,
+			Email:     m.email,
+			Role:      "authenticated",
+			ExpiresAt: expiresAt.Unix(),
+			IssuedAt:  int64(n),
+		}),
+		TokenType:    "bearer",
+		ExpiresIn:    3600,
+		ExpiresAt:    expiresAt.Unix(),
+		RefreshToken: refreshToken,
+		User: SupabaseUser{
+			ID:           m.userID.String(),
+			Email:        m.email,
+			AppMetadata:  appMetadata,
+			UserMetadata: metadata,
+		},
+	}
+}
+
+// handle serves fake responses for the auth endpoints.
+func (m *mockAuthServer) handle(method, url string, body any, headers map[string]string) ([]byte, error) {
+	var (
+		sessionID string
+		resp      SupabaseAuthResponse
+	)
+
+	switch {
+	case strings.Contains(url, "grant_type=refresh_token"):
+		// refreshed tokens keep the session of the refresh token
+		if req, ok := body.(RefreshTokenRequest); ok {
+			m.mu.Lock()
+			sessionID = m.sessions[req.RefreshToken]
+			m.mu.Unlock()
+		}
+		return json.Marshal(m.authResponse(sessionID))
+	case strings.HasSuffix(url, UpdateUserPath) && method == "PUT":
+		// merge metadata updates and return the user object
+		if req, ok := body.(UpdateUserRequest); ok {
+			m.mu.Lock()
+			for k, v := range req.Data {
+				m.metadata[k] = v
+			}
+			m.mu.Unlock()
+		}
+		resp = m.authResponse("")
+		return json.Marshal(resp.User)
+	case strings.HasSuffix(url, SignupPath) && method == "POST":
+		// store the registration metadata and return a session
+		if req, ok := body.(SupabaseRegisterRequest); ok {
+			m.mu.Lock()
+			for k, v := range req.Data {
+				m.metadata[k] = v
+			}
+			m.mu.Unlock()
+		}
+		return json.Marshal(m.authResponse(""))
+	case strings.HasSuffix(url, UserPath) && method == "GET":
+		// token validation returns the user object
+		if strings.Contains(headers[HeaderAuthorization], "revoked") {
+			return nil, &APIError{StatusCode: 401, Body: []byte(`{"msg":"invalid JWT"}`)}
+		}
+		resp = m.authResponse("")
+		return json.Marshal(resp.User)
+	case strings.Contains(url, LogoutPath):
+		return nil, nil
+	case strings.Contains(url, AdminUsersPath+"?filter=") && method == "GET":
+		// admin search returns a full first page of near matches, then the mock user; callers must check the match
+		if strings.Contains(url, "&page=") && !strings.Contains(url, "&page=1&") {
+			resp = m.authResponse("")
+			return json.Marshal(SupabaseAdminUsersResponse{Users: []SupabaseUser{resp.User}})
+		}
+		users := make([]SupabaseUser, adminUsersPerPage)
+		for i := range users {
+			users[i] = SupabaseUser{ID: uuid.NewString(), Email: fmt.Sprintf("other%d.%s", i, m.email)}
+		}
+		return json.Marshal(SupabaseAdminUsersResponse{Users: users})
+	case strings.Contains(url, AdminUsersPath+"?page=") && method == "GET":
+		// the user list has a single page holding the mock user
+		resp = m.authResponse("")
+		return json.Marshal(SupabaseAdminUsersResponse{Users: []SupabaseUser{resp.User}})
+	case strings.Contains(url, AdminUsersPath+"/") && method == "PUT":
+		// admin updates merge both metadata objects, null removes a key
+		if req, ok := body.(AdminUpdateUserRequest); ok {
+			m.mu.Lock()
+			for target, data := range map[*map[string]any]map[string]any{&m.appMetadata: req.AppMetadata, &m.metadata: req.UserMetadata} {
+				for k, v := range data {
+					if v == nil {
+						delete(*target, k)
+						continue
+					}
+					(*target)[k] = v
+				}
+			}
+			m.mu.Unlock()
+		}
+		resp = m.authResponse("")
+		return json.Marshal(resp.User)
+	case strings.Contains(url, AdminUsersPath+"/") && method == "GET":
+		resp = m.authResponse("")
+		return json.Marshal(resp.User)
+	case strings.Contains(url, RestBasePath+"profiles?") && method == "GET":
+		// profiles table holding the mock user's username
+		m.mu.Lock()
+		username, _ := m.metadata["username"].(string)
+		m.mu.Unlock()
+		if !strings.Contains(url, "username=ilike."+username) {
+			return []byte(`[]`), nil
+		}
+		return json.Marshal([]map[string]string{{"id": m.userID.String()}})
+	case strings.HasSuffix(url, LoginPath) && body.(SupabaseLoginRequest).Password == "wrong":
+		// rejected credentials
+		return nil, &APIError{StatusCode: 400, Body: []byte(`{"error":"invalid_grant"}`)}
+	default:
+		return json.Marshal(m.authResponse(""))
+	}
+}
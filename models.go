@@ -8,10 +8,20 @@ import (
 )
 
 // UserCache manages cached user sessions with thread-safe operations.
-// users is a map where JWT tokens are keys and CachedUser pointers are values.
-// usersByID is a map where UserIDs (UUID) are keys and CachedUser pointers are values.
+// A single user may hold several sessions (one per device/login), each keyed by session ID.
+// users is a map where JWT tokens are keys and cache entries are values.
+// sessions is a map where session IDs are keys and cache entries are values.
+// usersByID is a map where UserIDs (UUID) are keys and the user's entries (by session ID) are values.
+// emails and usernames map normalized (lower-cased) emails and usernames to entries (by session ID).
+// lru orders entries by access recency for O(1) least-recently-used eviction.
+// expiry is a min-heap on ExpiresAt for O(log n) expiry.
 // mu is a read-write mutex for thread-safe access to the cache.
-// MaxSize is the maximum number of users allowed in cache (default 1000).
+// MaxSize is the maximum number of sessions allowed in cache (default 1000).
+// snapshotKey is the AES key used to encrypt snapshots (nil disables snapshots).
+// onStore and onRemove are called under mu when a session is stored or removed (used by ShardedUserCache).
+// hooks are the cache event subscribers (shared by every shard of a ShardedUserCache).
+// pending are the events recorded under mu, dispatched to hooks once mu is released.
+// counters count cache operations (Size and MaxSize are filled by Stats()).
 //
 // Used in:
 // - Service struct - holds the cache instance
@@ -21,11 +31,24 @@ import (
 // - GetUserByID() - retrieves user from cache
 // - UpdateUser() - updates cached user data
 // - DeleteUser() - removes user from cache
+// - ListSessions() - lists a user's sessions
+// - RevokeSession() - removes a single session
 type UserCache struct {
-	users     map[string]*CachedUser
-	usersByID map[uuid.UUID]*CachedUser
-	mu        sync.RWMutex
-	MaxSize   int
+	users       map[string]*cacheEntry
+	sessions    map[string]*cacheEntry
+	usersByID   map[uuid.UUID]map[string]*cacheEntry
+	emails      map[string]map[string]*cacheEntry
+	usernames   map[string]map[string]*cacheEntry
+	lru         lruList
+	expiry      expiryHeap
+	mu          sync.RWMutex
+	MaxSize     int
+	snapshotKey []byte
+	onStore     func(*CachedUser)
+	onRemove    func(*CachedUser)
+	hooks       *eventHub
+	pending     []CacheEvent
+	counters    CacheStats
 }
 
 // CachedUser represents a cached user session with authentication details.
@@ -36,10 +59,19 @@ type UserCache struct {
 // Role is the user's application role.
 // Phone is the user's phone number.
 // DateOfBirth is the user's date of birth.
+// Metadata is the user's raw user_metadata (decode it with DecodeMetadata()).
+// AppMetadata is the user's raw app_metadata (writable only with the service key).
 // AccessToken is the JWT authentication token.
 // RefreshToken is the token used to refresh the access token.
 // ExpiresAt is the timestamp when the access token expires.
 // CachedAt is the timestamp when the user was cached.
+// SessionID is the Supabase session identifier (session_id claim of the access token).
+// IPAddress is the client IP address the session was created from.
+// UserAgent is the client user agent the session was created from.
+// CreatedAt is the timestamp when the session was first cached.
+// LastSeenAt is the timestamp when the session was last used.
+// Version is incremented each time the cached session is replaced or updated.
+// Values returned by the cache are private copies: modifying them does not change the cache.
 //
 // Used in:
 // - Cache.Set() - stores user in cache
@@ -58,10 +90,80 @@ type CachedUser struct {
 	Role         string
 	Phone        string
 	DateOfBirth  string
+	Metadata     map[string]any
+	AppMetadata  map[string]any
 	AccessToken  string
 	RefreshToken string
 	ExpiresAt    time.Time
 	CachedAt     time.Time
+	SessionID    string
+	IPAddress    string
+	UserAgent    string
+	CreatedAt    time.Time
+	LastSeenAt   time.Time
+	Version      uint64
+}
+
+// SessionInfo describes one cached session of a user.
+// SessionID is the Supabase session identifier.
+// UserID is the Supabase user unique identifier (UUID).
+// IPAddress is the client IP address the session was created from.
+// UserAgent is the client user agent the session was created from.
+// CreatedAt is the timestamp when the session was first cached.
+// LastSeenAt is the timestamp when the session was last used.
+// ExpiresAt is the timestamp when the session's access token expires.
+//
+// Used in:
+// - Cache.ListSessions() - returns the sessions of a user
+// - ListSessions() - returns the sessions of a user
+type SessionInfo struct {
+	SessionID  string    `json:"session_id"`
+	UserID     uuid.UUID `json:"user_id"`
+	IPAddress  string    `json:"ip_address,omitempty"`
+	UserAgent  string    `json:"user_agent,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// DeviceInfo describes the client device a login originates from.
+// IPAddress is the client IP address.
+// UserAgent is the client user agent.
+//
+// Used in:
+// - WithDeviceInfo() - attaches device info to a context
+// - RegisterUser(), LoginUser() - record device info on new sessions
+type DeviceInfo struct {
+	IPAddress string
+	UserAgent string
+}
+
+// TokenClaims represents the claims of a Supabase JWT access token.
+// Subject is the user ID (sub claim).
+// SessionID is the Supabase session identifier.
+// Email is the user's email address.
+// Phone is the user's phone number.
+// Role is the Postgres role of the token (e.g., "authenticated").
+// AAL is the authenticator assurance level (e.g., "aal1").
+// ExpiresAt is the expiration time as a Unix timestamp.
+// IssuedAt is the issue time as a Unix timestamp.
+// AppMetadata contains application metadata (writable only with the service key).
+// UserMetadata contains user metadata.
+//
+// Used in:
+// - ParseTokenClaims() - decodes token claims
+// - UserCache.Set() - derives session IDs from tokens
+type TokenClaims struct {
+	Subject      string         `json:"sub"`
+	SessionID    string         `json:"session_id"`
+	Email        string         `json:"email"`
+	Phone        string         `json:"phone"`
+	Role         string         `json:"role"`
+	AAL          string         `json:"aal"`
+	ExpiresAt    int64          `json:"exp"`
+	IssuedAt     int64          `json:"iat"`
+	AppMetadata  map[string]any `json:"app_metadata"`
+	UserMetadata map[string]any `json:"user_metadata"`
 }
 
 // User represents a user object returned from cache or API.
@@ -69,21 +171,25 @@ type CachedUser struct {
 // Email is the user's email address.
 // Username is the user's unique username.
 // DisplayName is the user's display name.
-// Role is the user's application role.
+// Role is the user's application role (read according to Service.RoleSource).
 // Phone is the user's phone number.
 // DateOfBirth is the user's date of birth.
+// Metadata is the user's raw user_metadata, including fields without a dedicated field (decode it with GetMetadata()).
+// AppMetadata is the user's raw app_metadata (decode it with GetAppMetadata()).
 //
 // Used in:
 // - GetUserByID() - returns User object from cache
 // - UpdateUser() - returns updated User object
 type User struct {
-	UserID      uuid.UUID `json:"user_id"`
-	Email       string    `json:"email"`
-	Username    string    `json:"username"`
-	DisplayName string    `json:"display_name"`
-	Role        string    `json:"role"`
-	Phone       string    `json:"phone"`
-	DateOfBirth string    `json:"date_of_birth,omitempty"`
+	UserID      uuid.UUID      `json:"user_id"`
+	Email       string         `json:"email"`
+	Username    string         `json:"username"`
+	DisplayName string         `json:"display_name"`
+	Role        string         `json:"role"`
+	Phone       string         `json:"phone"`
+	DateOfBirth string         `json:"date_of_birth,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	AppMetadata map[string]any `json:"app_metadata,omitempty"`
 }
 
 // UserMetadata represents custom user metadata stored in Supabase.
@@ -91,6 +197,8 @@ type User struct {
 // Common fields like FullName, DisplayName, AvatarURL are optional.
 // App-specific fields like Username, Role, DateOfBirth can be customized.
 //
+// Other fields can be stored with RegisterUserWith() and UpdateMetadata() using any struct.
+//
 // Used in:
 // - RegisterUser() - accepts metadata parameter for user registration
 type UserMetadata struct {
@@ -101,7 +209,7 @@ type UserMetadata struct {
 
 	// Custom app fields
 	Username    string `json:"username,omitempty"`      // Unique identifier (e.g., "@johnsmith")
-	Role        string `json:"role,omitempty"`          // User role (e.g., "admin", "user")
+	Role        string `json:"role,omitempty"`          // User role (e.g., "admin", "user"), stored in app_metadata unless Service.RoleSource is RoleSourceUserMetadata
 	DateOfBirth string `json:"date_of_birth,omitempty"` // Format: YYYY-MM-DD
 }
 
@@ -213,7 +321,7 @@ type LoginResponse struct {
 }
 
 // UpdateUserRequest represents the request payload for updating user metadata.
-// Data contains the metadata fields to update (e.g., {"display_name": "New Name", "role": "admin"}).
+// Data contains the metadata fields to update (e.g., {"display_name": "New Name"}).
 //
 // Used in:
 // - UpdateUser() - builds request body for Supabase update endpoint
@@ -0,0 +1,514 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sentinel errors for PostgREST queries.
+var (
+	ErrNoOperation  = errors.New("query has no operation")
+	ErrInvalidRange = errors.New("invalid query range")
+)
+
+// CountOption selects how PostgREST counts rows (Prefer: count=...).
+type CountOption string
+
+// Count options.
+const (
+	CountExact     CountOption = "exact"     // exact count (slow on large tables)
+	CountPlanned   CountOption = "planned"   // Postgres planner estimate
+	CountEstimated CountOption = "estimated" // exact below the max rows, estimate above
+)
+
+// ReturnOption selects what write operations return (Prefer: return=...).
+type ReturnOption string
+
+// Return options.
+const (
+	ReturnMinimal        ReturnOption = "minimal"        // no body (default for writes)
+	ReturnRepresentation ReturnOption = "representation" // written rows
+	ReturnHeadersOnly    ReturnOption = "headers-only"   // Location header only
+)
+
+// PostgrestError is a PostgREST error response.
+// StatusCode is the HTTP status code.
+// Code is the Postgres or PostgREST error code (e.g., "23505", "PGRST116").
+// Message, Details and Hint describe the error.
+// Wraps ErrInvalidStatus, so errors.Is(err, ErrInvalidStatus) keeps working.
+//
+// Used in:
+// - QueryBuilder.Execute() - returned for non-2xx responses
+type PostgrestError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	Details    string `json:"details"`
+	Hint       string `json:"hint"`
+}
+
+// Error returns the error message with the status code and PostgREST code.
+func (e *PostgrestError) Error() string {
+	var (
+		b strings.Builder
+	)
+
+	fmt.Fprintf(&b, "postgrest (status %d", e.StatusCode)
+	if e.Code != "" {
+		fmt.Fprintf(&b, ", code %s", e.Code)
+	}
+	fmt.Fprintf(&b, "): %s", e.Message)
+	if e.Details != "" {
+		fmt.Fprintf(&b, " (%s)", e.Details)
+	}
+
+	return b.String()
+}
+
+// Unwrap returns ErrInvalidStatus.
+func (e *PostgrestError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
+// PostgrestResult describes a PostgREST response.
+// StatusCode is the HTTP status code.
+// Count is the total row count from Content-Range (-1 unless Count() was requested).
+//
+// Used in:
+// - QueryBuilder.Execute() - returned with the decoded rows
+type PostgrestResult struct {
+	StatusCode int
+	Count      int64
+}
+
+// PostgrestClient runs PostgREST requests with a fixed API key and token.
+// service is the service providing the project URL and HTTP client.
+// apiKey is sent in the apikey header.
+// token is sent as Bearer token; it selects the Postgres role (anon, authenticated or service_role).
+// schema is the exposed schema to use (empty for the default "public").
+//
+// Used in:
+// - Service.AsUser(), Service.AsAnon(), Service.AsServiceRole() - create clients
+type PostgrestClient struct {
+	service *Service
+	apiKey  string
+	token   string
+	schema  string
+}
+
+// AsUser returns a data API client acting as a user, so row-level security policies apply.
+// token is the user's access token (e.g., from TokenFromContext()).
+func (s *Service) AsUser(token string) *PostgrestClient {
+	return &PostgrestClient{service: s, apiKey: s.AnonKey, token: token}
+}
+
+// AsAnon returns a data API client acting as the anonymous role.
+func (s *Service) AsAnon() *PostgrestClient {
+	return &PostgrestClient{service: s, apiKey: s.AnonKey, token: s.AnonKey}
+}
+
+// AsServiceRole returns a data API client acting as the service role, which bypasses row-level security.
+// Only use it for trusted server-side operations.
+func (s *Service) AsServiceRole() *PostgrestClient {
+	return &PostgrestClient{service: s, apiKey: s.ServiceKey, token: s.ServiceKey}
+}
+
+// Schema returns a copy of the client using another exposed schema (Accept-Profile/Content-Profile).
+// schema is the schema name (must be listed in the API's exposed schemas).
+func (c *PostgrestClient) Schema(schema string) *PostgrestClient {
+	copied := *c
+	copied.schema = schema
+	return &copied
+}
+
+// From starts a query on a table or view.
+// table is the table or view name.
+func (c *PostgrestClient) From(table string) *QueryBuilder {
+	return &QueryBuilder{client: c, table: table, path: url.PathEscape(table), params: url.Values{}, headers: http.Header{}}
+}
+
+// QueryBuilder builds a PostgREST request with a fluent API.
+// Builders are not safe for concurrent use; build one per request.
+// client is the client running the request.
+// table is the table or view name ("rpc/<function>" for function calls), used as metrics label.
+// path is the escaped URL path below RestBasePath.
+// method is the HTTP method of the operation (empty until an operation is chosen).
+// body is the JSON body of write operations.
+// params are the query string parameters (select, filters, order, limit, offset).
+// headers are extra request headers (Prefer, Accept).
+// prefer are the Prefer header options.
+// err is a build error reported by Execute().
+//
+// Used in:
+// - PostgrestClient.From() - starts a query
+type QueryBuilder struct {
+	client  *PostgrestClient
+	table   string
+	path    string
+	method  string
+	body    any
+	params  url.Values
+	headers http.Header
+	prefer  []string
+	err     error
+}
+
+// Select reads rows, returning the given columns.
+// After a write operation or on a function call it only selects the returned columns.
+// columns is the PostgREST select list (e.g., "id,title,author:profiles(username)"; empty selects "*").
+func (q *QueryBuilder) Select(columns string) *QueryBuilder {
+	if columns == "" {
+		columns = "*"
+	}
+	if q.method == "" {
+		q.method = http.MethodGet
+	}
+	q.params.Set("select", columns)
+	return q
+}
+
+// Insert inserts one row (struct or map) or several rows (slice).
+// values are the rows to insert, encoded as JSON.
+func (q *QueryBuilder) Insert(values any) *QueryBuilder {
+	q.method = http.MethodPost
+	q.body = values
+	return q
+}
+
+// Upsert inserts rows, updating the existing ones on conflict.
+// values are the rows to upsert, encoded as JSON.
+// onConflict is the comma-separated unique columns to match (empty uses the primary key).
+func (q *QueryBuilder) Upsert(values any, onConflict string) *QueryBuilder {
+	q.method = http.MethodPost
+	q.body = values
+	q.prefer = append(q.prefer, "resolution=merge-duplicates")
+	if onConflict != "" {
+		q.params.Set("on_conflict", onConflict)
+	}
+	return q
+}
+
+// Update updates the rows matching the filters.
+// values are the columns to set, encoded as JSON.
+func (q *QueryBuilder) Update(values any) *QueryBuilder {
+	q.method = http.MethodPatch
+	q.body = values
+	return q
+}
+
+// Delete deletes the rows matching the filters.
+func (q *QueryBuilder) Delete() *QueryBuilder {
+	q.method = http.MethodDelete
+	return q
+}
+
+// Eq filters rows where column equals value.
+func (q *QueryBuilder) Eq(column string, value any) *QueryBuilder {
+	return q.Filter(column, "eq", formatFilterValue(value))
+}
+
+// Neq filters rows where column is not equal to value.
+func (q *QueryBuilder) Neq(column string, value any) *QueryBuilder {
+	return q.Filter(column, "neq", formatFilterValue(value))
+}
+
+// Gt filters rows where column is greater than value.
+func (q *QueryBuilder) Gt(column string, value any) *QueryBuilder {
+	return q.Filter(column, "gt", formatFilterValue(value))
+}
+
+// Gte filters rows where column is greater than or equal to value.
+func (q *QueryBuilder) Gte(column string, value any) *QueryBuilder {
+	return q.Filter(column, "gte", formatFilterValue(value))
+}
+
+// Lt filters rows where column is less than value.
+func (q *QueryBuilder) Lt(column string, value any) *QueryBuilder {
+	return q.Filter(column, "lt", formatFilterValue(value))
+}
+
+// Lte filters rows where column is less than or equal to value.
+func (q *QueryBuilder) Lte(column string, value any) *QueryBuilder {
+	return q.Filter(column, "lte", formatFilterValue(value))
+}
+
+// Like filters rows where column matches a case-sensitive pattern ("*" or "%" as wildcard).
+func (q *QueryBuilder) Like(column, pattern string) *QueryBuilder {
+	return q.Filter(column, "like", pattern)
+}
+
+// ILike filters rows where column matches a case-insensitive pattern ("*" or "%" as wildcard).
+func (q *QueryBuilder) ILike(column, pattern string) *QueryBuilder {
+	return q.Filter(column, "ilike", pattern)
+}
+
+// In filters rows where column is one of values.
+func (q *QueryBuilder) In(column string, values ...any) *QueryBuilder {
+	var (
+		items = make([]string, len(values))
+	)
+
+	for i, value := range values {
+		items[i] = quoteListValue(formatFilterValue(value))
+	}
+
+	return q.Filter(column, "in", "("+strings.Join(items, ",")+")")
+}
+
+// Is filters rows where column IS value (nil, true, false or "unknown").
+func (q *QueryBuilder) Is(column string, value any) *QueryBuilder {
+	return q.Filter(column, "is", formatFilterValue(value))
+}
+
+// Not negates a filter (e.g., Not("status", "eq", "archived")).
+func (q *QueryBuilder) Not(column, operator string, value any) *QueryBuilder {
+	return q.Filter(column, "not."+operator, formatFilterValue(value))
+}
+
+// Or adds a disjunction in PostgREST syntax (e.g., "age.lt.18,age.gt.65").
+func (q *QueryBuilder) Or(filters string) *QueryBuilder {
+	q.params.Add("or", "("+filters+")")
+	return q
+}
+
+// Filter adds a raw PostgREST filter "column=operator.value"; value is sent as is.
+// Filters are combined with AND and apply to reads, updates and deletes.
+func (q *QueryBuilder) Filter(column, operator, value string) *QueryBuilder {
+	q.params.Add(column, operator+"."+value)
+	return q
+}
+
+// Order sorts the rows by column; call it again to add more sort columns.
+// ascending is the sort direction (nulls sort last ascending and first descending, as in Postgres).
+func (q *QueryBuilder) Order(column string, ascending bool) *QueryBuilder {
+	var (
+		term = column + ".desc"
+	)
+
+	if ascending {
+		term = column + ".asc"
+	}
+	if existing := q.params.Get("order"); existing != "" {
+		term = existing + "," + term
+	}
+	q.params.Set("order", term)
+	return q
+}
+
+// Limit returns at most count rows.
+func (q *QueryBuilder) Limit(count int) *QueryBuilder {
+	q.params.Set("limit", strconv.Itoa(count))
+	return q
+}
+
+// Range returns the rows from index from to index to, both included and 0-based.
+// A negative from or a to below from makes Execute() fail with ErrInvalidRange.
+func (q *QueryBuilder) Range(from, to int) *QueryBuilder {
+	if from < 0 || to < from {
+		if q.err == nil {
+			q.err = fmt.Errorf("%w: from %d to %d", ErrInvalidRange, from, to)
+		}
+		return q
+	}
+	q.params.Set("offset", strconv.Itoa(from))
+	q.params.Set("limit", strconv.Itoa(to-from+1))
+	return q
+}
+
+// Single expects exactly one row and decodes it as an object instead of an array.
+// PostgREST answers 406 (code PGRST116) if zero or several rows match.
+func (q *QueryBuilder) Single() *QueryBuilder {
+	q.headers.Set("Accept", "application/vnd.pgrst.object+json")
+	return q
+}
+
+// Count requests the total row count, reported in PostgrestResult.Count.
+func (q *QueryBuilder) Count(option CountOption) *QueryBuilder {
+	q.prefer = append(q.prefer, "count="+string(option))
+	return q
+}
+
+// Returning selects what write operations return (ReturnRepresentation to decode the written rows).
+// For ReturnRepresentation the returned columns follow Select() or Columns() called after the write operation.
+func (q *QueryBuilder) Returning(option ReturnOption) *QueryBuilder {
+	q.prefer = append(q.prefer, "return="+string(option))
+	return q
+}
+
+// Columns restricts returned columns of a write operation (e.g., Insert(...).Returning(ReturnRepresentation).Columns("id")).
+func (q *QueryBuilder) Columns(columns string) *QueryBuilder {
+	q.params.Set("select", columns)
+	return q
+}
+
+// Execute runs the query and decodes the response into dest.
+// ctx is the context for request cancellation and timeout.
+// dest is a pointer to a slice of structs (or a struct with Single()); nil discards the body.
+// Returns the status and count, a *PostgrestError for PostgREST errors, or an error if the request fails.
+func (q *QueryBuilder) Execute(ctx context.Context, dest any) (*PostgrestResult, error) {
+	var (
+		req       *http.Request
+		resp      *http.Response
+		bodyBytes []byte
+		result    *PostgrestResult
+		err       error
+	)
+
+	req, err = q.request(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	Logf("Postgrest", "%s %s", req.Method, q.table)
+
+	resp, bodyBytes, err = q.client.service.doHTTP(req, RestBasePath+q.table)
+	if err != nil {
+		Logf("Postgrest", "Request failed: %v", err)
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err = parsePostgrestError(resp.StatusCode, bodyBytes)
+		Logf("Postgrest", "%s %s failed: %v", req.Method, q.table, err)
+		return nil, err
+	}
+
+	result = &PostgrestResult{StatusCode: resp.StatusCode, Count: parseContentRangeCount(resp.Header.Get("Content-Range"))}
+
+	if dest != nil && len(bytes.TrimSpace(bodyBytes)) > 0 {
+		if err = json.Unmarshal(bodyBytes, dest); err != nil {
+			return result, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+		}
+	}
+
+	return result, nil
+}
+
+// request builds the HTTP request of the query.
+func (q *QueryBuilder) request(ctx context.Context) (*http.Request, error) {
+	var (
+		endpoint string
+		payload  []byte
+		req      *http.Request
+		err      error
+	)
+
+	if q.err != nil {
+		return nil, q.err
+	}
+	if q.method == "" {
+		return nil, ErrNoOperation
+	}
+
+	endpoint = fmt.Sprintf("%s%s%s", q.client.service.ProjectURL, RestBasePath, q.path)
+	if len(q.params) > 0 {
+		endpoint += "?" + q.params.Encode()
+	}
+
+	if q.body != nil {
+		payload, err = json.Marshal(q.body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+		}
+	}
+
+	req, err = http.NewRequestWithContext(ctx, q.method, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCreateRequest, err)
+	}
+
+	q.client.setHeaders(req, q.method)
+	for key, values := range q.headers {
+		req.Header[key] = values
+	}
+	if q.body != nil {
+		req.Header.Set(HeaderContentType, ContentTypeJSON)
+	}
+	if len(q.prefer) > 0 {
+		req.Header.Set("Prefer", strings.Join(q.prefer, ","))
+	}
+
+	return req, nil
+}
+
+// setHeaders sets the API key, token and schema headers on a request.
+func (c *PostgrestClient) setHeaders(req *http.Request, method string) {
+	req.Header.Set(HeaderAPIKey, c.apiKey)
+	if c.token != "" {
+		req.Header.Set(HeaderAuthorization, "Bearer "+c.token)
+	}
+	if c.schema != "" {
+		if method == http.MethodGet || method == http.MethodHead {
+			req.Header.Set("Accept-Profile", c.schema)
+		} else {
+			req.Header.Set("Content-Profile", c.schema)
+		}
+	}
+}
+
+// parsePostgrestError decodes a PostgREST error body.
+// Returns a *PostgrestError, or an *APIError if the body is not a PostgREST error.
+func parsePostgrestError(statusCode int, body []byte) error {
+	var (
+		pgErr PostgrestError
+	)
+
+	if err := json.Unmarshal(body, &pgErr); err != nil || (pgErr.Message == "" && pgErr.Code == "") {
+		return &APIError{StatusCode: statusCode, Body: body}
+	}
+	pgErr.StatusCode = statusCode
+
+	return &pgErr
+}
+
+// parseContentRangeCount returns the total of a Content-Range header ("0-24/3573"), or -1 if unknown.
+func parseContentRangeCount(header string) int64 {
+	var (
+		total string
+		found bool
+	)
+
+	_, total, found = strings.Cut(header, "/")
+	if !found || total == "*" {
+		return -1
+	}
+
+	count, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+
+	return count
+}
+
+// formatFilterValue formats a filter value for the query string.
+func formatFilterValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// quoteListValue double-quotes an in() list item containing PostgREST reserved characters.
+func quoteListValue(value string) string {
+	if !strings.ContainsAny(value, ",().:\\"+`"`) {
+		return value
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
@@ -0,0 +1,125 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// todoRow is a row of the test "todos" table.
+type todoRow struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Done  bool   `json:"done"`
+}
+
+// TestPostgrestQueryBuilder tests query strings, headers, counts, typed decoding and error parsing.
+func TestPostgrestQueryBuilder(t *testing.T) {
+	var (
+		testName     = "TestPostgrestQueryBuilder"
+		service      *Service
+		server       *httptest.Server
+		last         *http.Request
+		lastBody     []byte
+		todos        []todoRow
+		todo         todoRow
+		result       *PostgrestResult
+		pgErr        *PostgrestError
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: fake PostgREST recording the last request
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		lastBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Query().Get("id") == "eq.404":
+			w.WriteHeader(http.StatusNotAcceptable)
+			io.WriteString(w, `{"code":"PGRST116","message":"JSON object requested, multiple (or no) rows returned","details":"The result contains 0 rows","hint":null}`)
+		case r.Header.Get("Accept") == "application/vnd.pgrst.object+json":
+			io.WriteString(w, `{"id":1,"title":"write tests","done":true}`)
+		case r.Method == http.MethodGet:
+			w.Header().Set("Content-Range", "0-1/42")
+			w.WriteHeader(http.StatusPartialContent)
+			io.WriteString(w, `[{"id":1,"title":"write tests","done":true},{"id":2,"title":"ship","done":false}]`)
+		default:
+			w.WriteHeader(http.StatusCreated)
+			io.WriteString(w, `[{"id":3,"title":"new","done":false}]`)
+		}
+	}))
+	defer server.Close()
+	service = NewService("mock", server.URL, "anon", "service")
+
+	// execute: filtered, ordered, paginated read as a user with an exact count
+	result, err = service.AsUser("user-token").From("todos").
+		Select("id,title,done").Eq("done", true).In("title", "a,b", "c").Is("deleted_at", nil).
+		Order("id", false).Range(0, 1).Count(CountExact).Execute(ctx, &todos)
+	if err != nil || len(todos) != 2 || todos[1].Title != "ship" || result.Count != 42 || result.StatusCode != http.StatusPartialContent {
+		errorMessage = fmt.Sprintf("Unexpected read result (err: %v, rows: %v, result: %+v)", err, todos, result)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	query := last.URL.Query()
+	if query.Get("done") != "eq.true" || query.Get("title") != `in.("a,b",c)` || query.Get("deleted_at") != "is.null" ||
+		query.Get("order") != "id.desc" || query.Get("offset") != "0" || query.Get("limit") != "2" ||
+		last.Header.Get("Prefer") != "count=exact" || last.Header.Get("Authorization") != "Bearer user-token" || last.Header.Get("apikey") != "anon" {
+		errorMessage = fmt.Sprintf("Unexpected read request: %s %v", last.URL.RawQuery, last.Header)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Reads send filters and the user token, and decode rows and counts\n")
+
+	// execute: single row, and upsert as the service role in another schema
+	_, err = service.AsUser("user-token").From("todos").Select("").Eq("id", 1).Single().Execute(ctx, &todo)
+	if err == nil {
+		_, err = service.AsServiceRole().Schema("private").From("todos").
+			Upsert([]todoRow{{Title: "new"}}, "title").Returning(ReturnRepresentation).Execute(ctx, &todos)
+	}
+	if err != nil || todo.ID != 1 || len(todos) != 1 || todos[0].ID != 3 || last.Method != http.MethodPost ||
+		last.Header.Get("Prefer") != "resolution=merge-duplicates,return=representation" ||
+		last.URL.Query().Get("on_conflict") != "title" || last.Header.Get("Content-Profile") != "private" ||
+		last.Header.Get("Authorization") != "Bearer service" || !bytes.Contains(lastBody, []byte(`"title":"new"`)) {
+		errorMessage = fmt.Sprintf("Unexpected single/upsert result (err: %v, todo: %+v, headers: %v)", err, todo, last.Header)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Single and upsert send Prefer, schema and service role headers\n")
+
+	// execute: PostgREST errors are parsed
+	_, err = service.AsAnon().From("todos").Select("*").Eq("id", 404).Single().Execute(ctx, &todo)
+	if !errors.As(err, &pgErr) || pgErr.Code != "PGRST116" || pgErr.StatusCode != http.StatusNotAcceptable || !errors.Is(err, ErrInvalidStatus) {
+		errorMessage = fmt.Sprintf("Expected a parsed PGRST116 error, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, err = service.AsAnon().From("todos").Execute(ctx, nil); !errors.Is(err, ErrNoOperation) {
+		errorMessage = fmt.Sprintf("Expected ErrNoOperation, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, bounds := range [][2]int{{5, 4}, {-1, 3}} {
+		if _, err = service.AsAnon().From("todos").Select("*").Range(bounds[0], bounds[1]).Execute(ctx, nil); !errors.Is(err, ErrInvalidRange) {
+			errorMessage = fmt.Sprintf("Expected ErrInvalidRange for %v, got %v", bounds, err)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ PostgREST errors are parsed\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,1070 @@
+package ft_supabase
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default Realtime client settings.
+const (
+	// DefaultRealtimeHeartbeat is the interval between two heartbeats.
+	DefaultRealtimeHeartbeat = 25 * time.Second
+
+	// DefaultRealtimeTimeout is how long joins, pushes and heartbeats wait for their reply.
+	DefaultRealtimeTimeout = 10 * time.Second
+
+	// DefaultRealtimeReconnectMin is the delay before the first reconnection attempt.
+	DefaultRealtimeReconnectMin = time.Second
+
+	// DefaultRealtimeReconnectMax is the maximum delay between two reconnection attempts.
+	DefaultRealtimeReconnectMax = 30 * time.Second
+)
+
+// Sentinel errors for Realtime.
+var (
+	ErrRealtimeNotConnected = errors.New("realtime client is not connected")
+	ErrRealtimeTimeout      = errors.New("realtime reply timed out")
+	ErrRealtimeJoin         = errors.New("realtime channel join failed")
+	ErrRealtimePush         = errors.New("realtime push rejected")
+	ErrRealtimeNotJoined    = errors.New("realtime channel is not joined")
+)
+
+// Postgres change event types.
+const (
+	PostgresChangeAll    = "*"
+	PostgresChangeInsert = "INSERT"
+	PostgresChangeUpdate = "UPDATE"
+	PostgresChangeDelete = "DELETE"
+)
+
+// RealtimeOptions configures a RealtimeClient.
+// Token is the user access token sent when joining channels, so Realtime authorization and RLS apply (empty uses the anon key).
+// HeartbeatInterval is the interval between two heartbeats (default 25 seconds).
+// Timeout is how long joins, pushes and heartbeats wait for their reply (default 10 seconds).
+// ReconnectMin is the delay before the first reconnection attempt, doubled after each failure (default 1 second).
+// ReconnectMax is the maximum delay between two reconnection attempts (default 30 seconds).
+//
+// Used in:
+// - Service.Realtime() - configures the client
+type RealtimeOptions struct {
+	Token             string
+	HeartbeatInterval time.Duration
+	Timeout           time.Duration
+	ReconnectMin      time.Duration
+	ReconnectMax      time.Duration
+}
+
+// ChannelOptions configures a RealtimeChannel.
+// BroadcastSelf delivers this client's own broadcasts back to it.
+// BroadcastAck makes Send() wait until the server acknowledges each broadcast.
+// PresenceKey is the key this client is tracked under (empty lets the server pick one).
+// Private joins a private channel, authorized by Realtime RLS policies.
+//
+// Used in:
+// - RealtimeClient.Channel() - configures the channel
+type ChannelOptions struct {
+	BroadcastSelf bool
+	BroadcastAck  bool
+	PresenceKey   string
+	Private       bool
+}
+
+// PostgresChangesFilter selects database changes to receive.
+// Event is the change type: "*" (default), "INSERT", "UPDATE" or "DELETE".
+// Schema is the table schema (default "public").
+// Table is the table name (empty for all tables of the schema).
+// Filter is a PostgREST-style row filter (e.g., "user_id=eq.42").
+//
+// Used in:
+// - RealtimeChannel.OnPostgresChanges() - subscription filter
+type PostgresChangesFilter struct {
+	Event  string `json:"event"`
+	Schema string `json:"schema"`
+	Table  string `json:"table,omitempty"`
+	Filter string `json:"filter,omitempty"`
+}
+
+// PostgresChange is a database change received on a channel.
+// Schema and Table identify the changed table.
+// EventType is "INSERT", "UPDATE" or "DELETE".
+// CommitTimestamp is when the change was committed.
+// New is the new row (inserts and updates).
+// Old is the old row, or its primary key without REPLICA IDENTITY FULL (updates and deletes).
+//
+// Used in:
+// - RealtimeChannel.OnPostgresChanges() - passed to handlers
+type PostgresChange struct {
+	Schema          string          `json:"schema"`
+	Table           string          `json:"table"`
+	EventType       string          `json:"eventType"`
+	CommitTimestamp time.Time       `json:"commit_timestamp"`
+	New             json.RawMessage `json:"new"`
+	Old             json.RawMessage `json:"old"`
+}
+
+// DecodeNew decodes the new row into dest.
+func (c PostgresChange) DecodeNew(dest any) error {
+	return decodeRealtimeRow(c.New, dest)
+}
+
+// DecodeOld decodes the old row into dest.
+func (c PostgresChange) DecodeOld(dest any) error {
+	return decodeRealtimeRow(c.Old, dest)
+}
+
+// BroadcastMessage is a broadcast received on a channel.
+// Event is the broadcast event name.
+// Payload is the JSON payload.
+//
+// Used in:
+// - RealtimeChannel.OnBroadcast() - passed to handlers
+type BroadcastMessage struct {
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// PresenceMeta is the state tracked by one client (with the server-assigned "phx_ref").
+//
+// Used in:
+// - RealtimeChannel.PresenceState(), RealtimeChannel.OnPresenceSync() - presence state
+type PresenceMeta map[string]any
+
+// phoenixMessage is a Phoenix channel message (serializer 1.0.0).
+type phoenixMessage struct {
+	Topic   string          `json:"topic"`
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+	Ref     string          `json:"ref"`
+	JoinRef string          `json:"join_ref,omitempty"`
+}
+
+// phoenixReply is the payload of a phx_reply message.
+type phoenixReply struct {
+	Status   string          `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// RealtimeClient is a Supabase Realtime connection multiplexing channels over one WebSocket.
+// It sends heartbeats, reconnects with exponential backoff and rejoins its channels after reconnecting.
+// service is the service providing the project URL and keys.
+// opts are the client options with defaults applied.
+// mu guards every field below.
+// conn is the current connection (nil while disconnected).
+// token is the access token sent to channels.
+// ref is the last message reference.
+// pending maps message references to reply waiters.
+// channels maps topics to channels.
+// cancel stops the connection goroutine (nil when not started).
+// done is closed when the connection goroutine exits.
+// connecting is closed when the Connect() call currently dialing finishes (nil when none is dialing).
+//
+// Used in:
+// - Service.Realtime() - creates clients
+type RealtimeClient struct {
+	service    *Service
+	opts       RealtimeOptions
+	mu         sync.Mutex
+	conn       *wsConn
+	token      string
+	ref        uint64
+	pending    map[string]chan phoenixReply
+	channels   map[string]*RealtimeChannel
+	cancel     context.CancelFunc
+	done       chan struct{}
+	connecting chan struct{}
+}
+
+// RealtimeChannel is a Realtime topic with its postgres_changes, broadcast and presence handlers.
+// Handlers run on the client's read goroutine: they must not block, nor call methods waiting for replies
+// (Subscribe, Unsubscribe, Track, Untrack, Send with BroadcastAck); start a goroutine for those.
+// client is the client carrying the channel.
+// topic is the Phoenix topic ("realtime:<name>").
+// opts are the channel options.
+// mu guards every field below.
+// wanted is true between Subscribe() and Unsubscribe(), so the channel is rejoined after reconnections.
+// joined is true while the server considers the channel joined.
+// joinRef is the reference of the current join.
+// changes are the postgres_changes handlers.
+// broadcasts are the broadcast handlers.
+// presenceSync are the presence sync handlers.
+// presence is the presence state by key.
+//
+// Used in:
+// - RealtimeClient.Channel() - creates channels
+type RealtimeChannel struct {
+	client       *RealtimeClient
+	topic        string
+	opts         ChannelOptions
+	mu           sync.Mutex
+	wanted       bool
+	joined       bool
+	joinRef      string
+	changes      []*changeBinding
+	broadcasts   []broadcastBinding
+	presenceSync []func(map[string][]PresenceMeta)
+	presence     map[string][]PresenceMeta
+}
+
+// changeBinding is a postgres_changes handler with the ID assigned by the server on join.
+type changeBinding struct {
+	filter PostgresChangesFilter
+	fn     func(PostgresChange)
+	id     int64
+}
+
+// broadcastBinding is a broadcast handler.
+type broadcastBinding struct {
+	event string
+	fn    func(BroadcastMessage)
+}
+
+// Realtime creates a Realtime client; call Connect() to open the connection.
+// opts are the client options (zero values use the defaults).
+func (s *Service) Realtime(opts RealtimeOptions) *RealtimeClient {
+	if opts.HeartbeatInterval <= 0 {
+		opts.HeartbeatInterval = DefaultRealtimeHeartbeat
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRealtimeTimeout
+	}
+	if opts.ReconnectMin <= 0 {
+		opts.ReconnectMin = DefaultRealtimeReconnectMin
+	}
+	if opts.ReconnectMax < opts.ReconnectMin {
+		opts.ReconnectMax = max(DefaultRealtimeReconnectMax, opts.ReconnectMin)
+	}
+
+	return &RealtimeClient{
+		service:  s,
+		opts:     opts,
+		token:    cmp.Or(opts.Token, s.AnonKey),
+		pending:  make(map[string]chan phoenixReply),
+		channels: make(map[string]*RealtimeChannel),
+	}
+}
+
+// Connect opens the WebSocket and keeps it open, reconnecting with backoff, until Close() is called.
+// ctx bounds the first connection attempt only.
+// Returns an error if the first connection fails; calling Connect on a connected client does nothing,
+// and concurrent calls wait for the one dialing so a single connection is opened.
+func (c *RealtimeClient) Connect(ctx context.Context) error {
+	var (
+		conn   *wsConn
+		runCtx context.Context
+		err    error
+	)
+
+	// only one caller dials at a time; the others wait for its result
+	for {
+		c.mu.Lock()
+		if c.cancel != nil {
+			c.mu.Unlock()
+			return nil
+		}
+		connecting := c.connecting
+		if connecting == nil {
+			c.connecting = make(chan struct{})
+			c.mu.Unlock()
+			break
+		}
+		c.mu.Unlock()
+
+		select {
+		case <-connecting:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	Logf("Realtime", "Connecting - URL: %s%s", c.service.ProjectURL, RealtimePath)
+	conn, err = c.dial(ctx)
+
+	c.mu.Lock()
+	close(c.connecting)
+	c.connecting = nil
+	if err != nil {
+		c.mu.Unlock()
+		Logf("Realtime", "Connection failed: %v", err)
+		return err
+	}
+	runCtx, c.cancel = context.WithCancel(context.Background())
+	c.done = make(chan struct{})
+	c.conn = conn
+	go c.run(runCtx, conn, c.done)
+	c.mu.Unlock()
+
+	c.service.registerRealtime(c)
+
+	return nil
+}
+
+// Close closes the connection and stops reconnecting. Channels are left without leaving them.
+func (c *RealtimeClient) Close() error {
+	var (
+		cancel context.CancelFunc
+		done   chan struct{}
+	)
+
+	c.mu.Lock()
+	cancel, done = c.cancel, c.done
+	c.cancel, c.done = nil, nil
+	c.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	c.service.unregisterRealtime(c)
+	cancel()
+	<-done
+	Log("Realtime", "Connection closed")
+
+	return nil
+}
+
+// Connected reports whether the WebSocket is currently open.
+func (c *RealtimeClient) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// SetAuth replaces the access token and pushes it to joined channels.
+// Called automatically by Service.RefreshToken() for clients connected with a token of the refreshed session.
+// token is the new access token.
+func (c *RealtimeClient) SetAuth(token string) {
+	var (
+		channels []*RealtimeChannel
+	)
+
+	c.mu.Lock()
+	c.token = token
+	for _, channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	c.mu.Unlock()
+
+	for _, channel := range channels {
+		channel.mu.Lock()
+		joined, joinRef := channel.joined, channel.joinRef
+		channel.mu.Unlock()
+		if joined {
+			c.send(phoenixMessage{Topic: channel.topic, Event: "access_token", Payload: mustJSON(map[string]string{"access_token": token}), Ref: c.nextRef(), JoinRef: joinRef})
+		}
+	}
+}
+
+// Channel returns the channel with this name, creating it if needed.
+// name is the channel name (the topic is "realtime:<name>").
+// opts are the channel options (ignored if the channel exists).
+func (c *RealtimeClient) Channel(name string, opts ChannelOptions) *RealtimeChannel {
+	var (
+		topic = "realtime:" + name
+	)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if channel, exists := c.channels[topic]; exists {
+		return channel
+	}
+	channel := &RealtimeChannel{client: c, topic: topic, opts: opts, presence: make(map[string][]PresenceMeta)}
+	c.channels[topic] = channel
+
+	return channel
+}
+
+// run serves connections until ctx is done, reconnecting with exponential backoff.
+func (c *RealtimeClient) run(ctx context.Context, conn *wsConn, done chan struct{}) {
+	var (
+		backoff = c.opts.ReconnectMin
+		err     error
+	)
+
+	defer close(done)
+
+	for {
+		c.serve(ctx, conn)
+		c.disconnected()
+		if ctx.Err() != nil {
+			return
+		}
+
+		for {
+			Logf("Realtime", "Reconnecting in %s", backoff)
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return
+			}
+
+			dialCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+			conn, err = c.dial(dialCtx)
+			cancel()
+			if err == nil {
+				break
+			}
+			Logf("Realtime", "Reconnection failed: %v", err)
+			backoff = min(2*backoff, c.opts.ReconnectMax)
+		}
+
+		Log("Realtime", "Reconnected, rejoining channels")
+		backoff = c.opts.ReconnectMin
+		c.mu.Lock()
+		c.conn = conn
+		c.mu.Unlock()
+		go c.rejoin(ctx)
+	}
+}
+
+// serve reads and dispatches messages until the connection fails or ctx is done, sending heartbeats meanwhile.
+func (c *RealtimeClient) serve(ctx context.Context, conn *wsConn) {
+	var (
+		serveCtx, stop = context.WithCancel(ctx)
+		message        phoenixMessage
+	)
+
+	defer stop()
+
+	go func() {
+		<-serveCtx.Done()
+		conn.Close()
+	}()
+	go c.heartbeat(serveCtx, conn)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() == nil {
+				Logf("Realtime", "Connection lost: %v", err)
+			}
+			return
+		}
+
+		message = phoenixMessage{}
+		if err = json.Unmarshal(data, &message); err != nil {
+			Logf("Realtime", "Ignoring malformed message: %v", err)
+			continue
+		}
+		c.dispatch(message)
+	}
+}
+
+// heartbeat sends heartbeats and closes the connection when one is not answered in time.
+func (c *RealtimeClient) heartbeat(ctx context.Context, conn *wsConn) {
+	var (
+		ticker = time.NewTicker(c.opts.HeartbeatInterval)
+	)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		_, err := c.request(ctx, phoenixMessage{Topic: "phoenix", Event: "heartbeat", Payload: json.RawMessage("{}"), Ref: c.nextRef()})
+		if err != nil && ctx.Err() == nil {
+			Logf("Realtime", "Heartbeat failed, closing connection: %v", err)
+			conn.Close()
+			return
+		}
+	}
+}
+
+// disconnected clears the connection, fails pending requests and marks channels as not joined.
+func (c *RealtimeClient) disconnected() {
+	c.mu.Lock()
+	c.conn = nil
+	for ref, waiter := range c.pending {
+		delete(c.pending, ref)
+		waiter <- phoenixReply{Status: "disconnected"}
+	}
+	channels := make([]*RealtimeChannel, 0, len(c.channels))
+	for _, channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	c.mu.Unlock()
+
+	for _, channel := range channels {
+		channel.mu.Lock()
+		channel.joined = false
+		channel.mu.Unlock()
+	}
+}
+
+// rejoin joins again every subscribed channel after a reconnection.
+func (c *RealtimeClient) rejoin(ctx context.Context) {
+	var (
+		channels []*RealtimeChannel
+	)
+
+	c.mu.Lock()
+	for _, channel := range c.channels {
+		channels = append(channels, channel)
+	}
+	c.mu.Unlock()
+
+	for _, channel := range channels {
+		channel.mu.Lock()
+		wanted := channel.wanted
+		channel.mu.Unlock()
+		if !wanted {
+			continue
+		}
+
+		joinCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		if err := channel.join(joinCtx); err != nil {
+			Logf("Realtime", "Rejoin failed - Topic: %s, Error: %v", channel.topic, err)
+		}
+		cancel()
+	}
+}
+
+// dispatch routes a received message to its reply waiter or channel.
+func (c *RealtimeClient) dispatch(message phoenixMessage) {
+	var (
+		reply   phoenixReply
+		waiter  chan phoenixReply
+		channel *RealtimeChannel
+	)
+
+	if message.Event == "phx_reply" {
+		if err := json.Unmarshal(message.Payload, &reply); err != nil {
+			return
+		}
+		c.mu.Lock()
+		waiter = c.pending[message.Ref]
+		delete(c.pending, message.Ref)
+		c.mu.Unlock()
+		if waiter != nil {
+			waiter <- reply
+		}
+		return
+	}
+
+	c.mu.Lock()
+	channel = c.channels[message.Topic]
+	c.mu.Unlock()
+	if channel != nil {
+		channel.handle(message)
+	}
+}
+
+// request sends a message and waits for its reply.
+// Returns the reply response, ErrRealtimePush for non-ok replies, or an error if no reply arrives in time.
+func (c *RealtimeClient) request(ctx context.Context, message phoenixMessage) (json.RawMessage, error) {
+	var (
+		waiter = make(chan phoenixReply, 1)
+		timer  = time.NewTimer(c.opts.Timeout)
+		reply  phoenixReply
+	)
+
+	defer timer.Stop()
+
+	c.mu.Lock()
+	c.pending[message.Ref] = waiter
+	c.mu.Unlock()
+
+	if err := c.send(message); err != nil {
+		c.mu.Lock()
+		delete(c.pending, message.Ref)
+		c.mu.Unlock()
+		return nil, err
+	}
+
+	select {
+	case reply = <-waiter:
+	case <-timer.C:
+		c.mu.Lock()
+		delete(c.pending, message.Ref)
+		c.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s %s", ErrRealtimeTimeout, message.Topic, message.Event)
+	case <-ctx.Done():
+		c.mu.Lock()
+		delete(c.pending, message.Ref)
+		c.mu.Unlock()
+		return nil, ctx.Err()
+	}
+
+	switch reply.Status {
+	case "ok":
+		return reply.Response, nil
+	case "disconnected":
+		return nil, ErrRealtimeNotConnected
+	default:
+		return reply.Response, fmt.Errorf("%w: %s %s: %s %s", ErrRealtimePush, message.Topic, message.Event, reply.Status, reply.Response)
+	}
+}
+
+// send writes a message on the current connection.
+func (c *RealtimeClient) send(message phoenixMessage) error {
+	c.mu.Lock()
+	conn := c.conn
+	c.mu.Unlock()
+
+	if conn == nil {
+		return ErrRealtimeNotConnected
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+	}
+
+	return conn.WriteText(data)
+}
+
+// nextRef returns a new message reference.
+func (c *RealtimeClient) nextRef() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ref++
+	return strconv.FormatUint(c.ref, 10)
+}
+
+// dial opens a WebSocket to the Realtime endpoint.
+func (c *RealtimeClient) dial(ctx context.Context) (*wsConn, error) {
+	var (
+		endpoint = c.service.ProjectURL + RealtimePath + "?" + url.Values{"apikey": {c.service.AnonKey}, "vsn": {"1.0.0"}}.Encode()
+	)
+
+	endpoint = strings.Replace(strings.Replace(endpoint, "https://", "wss://", 1), "http://", "ws://", 1)
+
+	return dialWebSocket(ctx, endpoint, http.Header{})
+}
+
+// sessionID returns the session_id claim of the client's token (empty for the anon key).
+func (c *RealtimeClient) sessionID() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return sessionClaim(c.token)
+}
+
+// OnPostgresChanges registers a handler for database changes; register handlers before Subscribe().
+// filter selects the changes (event, schema, table and row filter).
+// fn is called for each change.
+// Returns the channel for chaining.
+func (ch *RealtimeChannel) OnPostgresChanges(filter PostgresChangesFilter, fn func(PostgresChange)) *RealtimeChannel {
+	filter.Event = cmp.Or(strings.ToUpper(filter.Event), PostgresChangeAll)
+	filter.Schema = cmp.Or(filter.Schema, "public")
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.changes = append(ch.changes, &changeBinding{filter: filter, fn: fn})
+
+	return ch
+}
+
+// OnBroadcast registers a handler for broadcasts.
+// event is the broadcast event name ("*" for all events).
+// fn is called for each broadcast.
+// Returns the channel for chaining.
+func (ch *RealtimeChannel) OnBroadcast(event string, fn func(BroadcastMessage)) *RealtimeChannel {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.broadcasts = append(ch.broadcasts, broadcastBinding{event: event, fn: fn})
+
+	return ch
+}
+
+// OnPresenceSync registers a handler called with the full presence state after each presence change.
+// fn receives a copy of the state by presence key.
+// Returns the channel for chaining.
+func (ch *RealtimeChannel) OnPresenceSync(fn func(map[string][]PresenceMeta)) *RealtimeChannel {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	ch.presenceSync = append(ch.presenceSync, fn)
+
+	return ch
+}
+
+// Subscribe joins the channel and keeps it joined across reconnections until Unsubscribe().
+// ctx is the context for the join.
+// Returns an error wrapping ErrRealtimeJoin if the server refuses the join (e.g., unauthorized private channel).
+func (ch *RealtimeChannel) Subscribe(ctx context.Context) error {
+	ch.mu.Lock()
+	ch.wanted = true
+	ch.mu.Unlock()
+
+	Logf("Realtime", "Subscribing - Topic: %s", ch.topic)
+	return ch.join(ctx)
+}
+
+// Unsubscribe leaves the channel and removes it from the client.
+// ctx is the context for the leave request.
+// Returns an error if the server does not acknowledge the leave (the channel is removed anyway).
+func (ch *RealtimeChannel) Unsubscribe(ctx context.Context) error {
+	var (
+		joined  bool
+		joinRef string
+		err     error
+	)
+
+	ch.mu.Lock()
+	ch.wanted = false
+	joined, joinRef = ch.joined, ch.joinRef
+	ch.joined = false
+	ch.mu.Unlock()
+
+	ch.client.mu.Lock()
+	if ch.client.channels[ch.topic] == ch {
+		delete(ch.client.channels, ch.topic)
+	}
+	ch.client.mu.Unlock()
+
+	if joined {
+		_, err = ch.client.request(ctx, phoenixMessage{Topic: ch.topic, Event: "phx_leave", Payload: json.RawMessage("{}"), Ref: ch.client.nextRef(), JoinRef: joinRef})
+	}
+	Logf("Realtime", "Unsubscribed - Topic: %s", ch.topic)
+
+	return err
+}
+
+// Send broadcasts a message to the channel's subscribers.
+// ctx is the context for the acknowledgement when BroadcastAck is set.
+// event is the broadcast event name.
+// payload is encoded as JSON.
+// Returns ErrRealtimeNotJoined if the channel is not joined, or an error if the broadcast is not acknowledged.
+func (ch *RealtimeChannel) Send(ctx context.Context, event string, payload any) error {
+	var (
+		message phoenixMessage
+		err     error
+	)
+
+	message, err = ch.message("broadcast", map[string]any{"type": "broadcast", "event": event, "payload": payload})
+	if err != nil {
+		return err
+	}
+	if !ch.opts.BroadcastAck {
+		return ch.client.send(message)
+	}
+
+	_, err = ch.client.request(ctx, message)
+	return err
+}
+
+// Track starts tracking this client's presence state.
+// ctx is the context for the request.
+// state is the presence state encoded as JSON (e.g., map[string]any{"user_id": id, "status": "online"}).
+// Returns an error if the channel is not joined or the server rejects the state.
+func (ch *RealtimeChannel) Track(ctx context.Context, state any) error {
+	message, err := ch.message("presence", map[string]any{"type": "presence", "event": "track", "payload": state})
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.client.request(ctx, message)
+	return err
+}
+
+// Untrack stops tracking this client's presence state.
+// ctx is the context for the request.
+// Returns an error if the channel is not joined or the request fails.
+func (ch *RealtimeChannel) Untrack(ctx context.Context) error {
+	message, err := ch.message("presence", map[string]any{"type": "presence", "event": "untrack"})
+	if err != nil {
+		return err
+	}
+
+	_, err = ch.client.request(ctx, message)
+	return err
+}
+
+// PresenceState returns a copy of the presence state by presence key.
+func (ch *RealtimeChannel) PresenceState() map[string][]PresenceMeta {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return copyPresence(ch.presence)
+}
+
+// Joined reports whether the server considers the channel joined.
+func (ch *RealtimeChannel) Joined() bool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.joined
+}
+
+// join sends phx_join with the channel configuration and the current token, then records the server's binding IDs.
+func (ch *RealtimeChannel) join(ctx context.Context) error {
+	var (
+		filters  []PostgresChangesFilter
+		bindings []*changeBinding
+		ref      = ch.client.nextRef()
+		payload  []byte
+		response json.RawMessage
+		joined   struct {
+			PostgresChanges []struct {
+				ID int64 `json:"id"`
+				PostgresChangesFilter
+			} `json:"postgres_changes"`
+		}
+		err error
+	)
+
+	ch.mu.Lock()
+	bindings = slices.Clone(ch.changes)
+	ch.mu.Unlock()
+	filters = make([]PostgresChangesFilter, 0, len(bindings))
+	for _, binding := range bindings {
+		filters = append(filters, binding.filter)
+	}
+
+	ch.client.mu.Lock()
+	token := ch.client.token
+	ch.client.mu.Unlock()
+
+	payload, err = json.Marshal(map[string]any{
+		"config": map[string]any{
+			"broadcast":        map[string]bool{"self": ch.opts.BroadcastSelf, "ack": ch.opts.BroadcastAck},
+			"presence":         map[string]string{"key": ch.opts.PresenceKey},
+			"postgres_changes": filters,
+			"private":          ch.opts.Private,
+		},
+		"access_token": token,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+	}
+
+	response, err = ch.client.request(ctx, phoenixMessage{Topic: ch.topic, Event: "phx_join", Payload: payload, Ref: ref, JoinRef: ref})
+	if errors.Is(err, ErrRealtimePush) {
+		return fmt.Errorf("%w: %s: %s", ErrRealtimeJoin, ch.topic, response)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(response) > 0 {
+		if err = json.Unmarshal(response, &joined); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+		}
+	}
+	if len(joined.PostgresChanges) != len(bindings) {
+		return fmt.Errorf("%w: %s: server returned %d postgres_changes bindings, expected %d", ErrRealtimeJoin, ch.topic, len(joined.PostgresChanges), len(bindings))
+	}
+
+	ch.mu.Lock()
+	for i, binding := range bindings {
+		server := joined.PostgresChanges[i].PostgresChangesFilter
+		if server.Event != binding.filter.Event || server.Schema != binding.filter.Schema || server.Table != binding.filter.Table || server.Filter != binding.filter.Filter {
+			ch.mu.Unlock()
+			return fmt.Errorf("%w: %s: mismatch between server and client postgres_changes bindings", ErrRealtimeJoin, ch.topic)
+		}
+		binding.id = joined.PostgresChanges[i].ID
+	}
+	ch.joined = true
+	ch.joinRef = ref
+	ch.mu.Unlock()
+
+	Logf("Realtime", "Joined - Topic: %s", ch.topic)
+
+	return nil
+}
+
+// message builds a push on the joined channel.
+func (ch *RealtimeChannel) message(event string, payload any) (phoenixMessage, error) {
+	ch.mu.Lock()
+	joined, joinRef := ch.joined, ch.joinRef
+	ch.mu.Unlock()
+
+	if !joined {
+		return phoenixMessage{}, fmt.Errorf("%w: %s", ErrRealtimeNotJoined, ch.topic)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return phoenixMessage{}, fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+	}
+
+	return phoenixMessage{Topic: ch.topic, Event: event, Payload: data, Ref: ch.client.nextRef(), JoinRef: joinRef}, nil
+}
+
+// handle delivers a channel message to the matching handlers.
+func (ch *RealtimeChannel) handle(message phoenixMessage) {
+	switch message.Event {
+	case "postgres_changes":
+		var payload struct {
+			IDs  []int64        `json:"ids"`
+			Data PostgresChange `json:"data"`
+		}
+		if json.Unmarshal(message.Payload, &payload) != nil {
+			return
+		}
+		ch.mu.Lock()
+		bindings := slices.Clone(ch.changes)
+		ch.mu.Unlock()
+		for _, binding := range bindings {
+			if slices.Contains(payload.IDs, binding.id) {
+				binding.fn(payload.Data)
+			}
+		}
+
+	case "broadcast":
+		var broadcast BroadcastMessage
+		if json.Unmarshal(message.Payload, &broadcast) != nil {
+			return
+		}
+		ch.mu.Lock()
+		bindings := slices.Clone(ch.broadcasts)
+		ch.mu.Unlock()
+		for _, binding := range bindings {
+			if binding.event == "*" || binding.event == broadcast.Event {
+				binding.fn(broadcast)
+			}
+		}
+
+	case "presence_state", "presence_diff":
+		ch.handlePresence(message)
+
+	case "phx_error", "phx_close":
+		Logf("Realtime", "Channel %s - Topic: %s", strings.TrimPrefix(message.Event, "phx_"), ch.topic)
+		ch.mu.Lock()
+		ch.joined = false
+		rejoin := ch.wanted && message.Event == "phx_error"
+		ch.mu.Unlock()
+		if rejoin {
+			time.AfterFunc(ch.client.opts.ReconnectMin, func() {
+				ctx, cancel := context.WithTimeout(context.Background(), ch.client.opts.Timeout)
+				defer cancel()
+				if err := ch.join(ctx); err != nil {
+					Logf("Realtime", "Rejoin failed - Topic: %s, Error: %v", ch.topic, err)
+				}
+			})
+		}
+
+	case "system":
+		Logf("Realtime", "System message - Topic: %s, Payload: %s", ch.topic, message.Payload)
+	}
+}
+
+// handlePresence applies presence_state and presence_diff messages and calls the sync handlers.
+func (ch *RealtimeChannel) handlePresence(message phoenixMessage) {
+	type presenceEntry struct {
+		Metas []PresenceMeta `json:"metas"`
+	}
+	var (
+		state map[string]presenceEntry
+		diff  struct {
+			Joins  map[string]presenceEntry `json:"joins"`
+			Leaves map[string]presenceEntry `json:"leaves"`
+		}
+		handlers []func(map[string][]PresenceMeta)
+		snapshot map[string][]PresenceMeta
+	)
+
+	ch.mu.Lock()
+	if message.Event == "presence_state" {
+		if json.Unmarshal(message.Payload, &state) != nil {
+			ch.mu.Unlock()
+			return
+		}
+		ch.presence = make(map[string][]PresenceMeta, len(state))
+		for key, entry := range state {
+			ch.presence[key] = entry.Metas
+		}
+	} else {
+		if json.Unmarshal(message.Payload, &diff) != nil {
+			ch.mu.Unlock()
+			return
+		}
+		for key, entry := range diff.Leaves {
+			ch.presence[key] = slices.DeleteFunc(ch.presence[key], func(meta PresenceMeta) bool {
+				return slices.ContainsFunc(entry.Metas, func(left PresenceMeta) bool { return left["phx_ref"] == meta["phx_ref"] })
+			})
+			if len(ch.presence[key]) == 0 {
+				delete(ch.presence, key)
+			}
+		}
+		for key, entry := range diff.Joins {
+			ch.presence[key] = append(ch.presence[key], entry.Metas...)
+		}
+	}
+	handlers = slices.Clone(ch.presenceSync)
+	snapshot = copyPresence(ch.presence)
+	ch.mu.Unlock()
+
+	for _, fn := range handlers {
+		fn(snapshot)
+	}
+}
+
+// registerRealtime tracks a connected client so refreshed tokens reach it.
+func (s *Service) registerRealtime(client *RealtimeClient) {
+	s.realtimeMu.Lock()
+	defer s.realtimeMu.Unlock()
+
+	// lazily initialize map for services not built with NewService
+	if s.realtimeClients == nil {
+		s.realtimeClients = make(map[*RealtimeClient]struct{})
+	}
+	s.realtimeClients[client] = struct{}{}
+}
+
+// unregisterRealtime stops tracking a closed client.
+func (s *Service) unregisterRealtime(client *RealtimeClient) {
+	s.realtimeMu.Lock()
+	defer s.realtimeMu.Unlock()
+	delete(s.realtimeClients, client)
+}
+
+// pushRealtimeToken sends a refreshed access token to the clients connected with a token of the same session.
+// token is the new access token.
+func (s *Service) pushRealtimeToken(token string) {
+	var (
+		sessionID = sessionClaim(token)
+		clients   []*RealtimeClient
+	)
+
+	if sessionID == "" {
+		return
+	}
+
+	s.realtimeMu.Lock()
+	for client := range s.realtimeClients {
+		clients = append(clients, client)
+	}
+	s.realtimeMu.Unlock()
+
+	for _, client := range clients {
+		if client.sessionID() == sessionID {
+			Log("Realtime", "Pushing refreshed token to channels")
+			client.SetAuth(token)
+		}
+	}
+}
+
+// copyPresence returns a copy of a presence state (metas are shared, they are never modified).
+func copyPresence(state map[string][]PresenceMeta) map[string][]PresenceMeta {
+	copied := make(map[string][]PresenceMeta, len(state))
+	for key, metas := range state {
+		copied[key] = slices.Clone(metas)
+	}
+	return copied
+}
+
+// decodeRealtimeRow decodes a row of a postgres change.
+func decodeRealtimeRow(row json.RawMessage, dest any) error {
+	if err := json.Unmarshal(row, dest); err != nil {
+		return fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+	return nil
+}
+
+// mustJSON encodes a value that cannot fail to encode.
+func mustJSON(value any) json.RawMessage {
+	data, _ := json.Marshal(value)
+	return data
+}
@@ -0,0 +1,311 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mockRealtimeServer is a local Phoenix/Realtime stand-in.
+// mu guards every field below.
+// conns are the open server-side connections.
+// joins are the phx_join payloads received, in order.
+// tokens are the access tokens received through access_token messages.
+// heartbeats counts heartbeats.
+type mockRealtimeServer struct {
+	mu         sync.Mutex
+	conns      []*wsConn
+	joins      []map[string]any
+	tokens     []string
+	heartbeats int
+}
+
+// handle upgrades the request and answers Phoenix messages.
+func (m *mockRealtimeServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != RealtimePath || r.URL.Query().Get("apikey") != "anon" || r.Header.Get("Upgrade") != "websocket" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", wsAcceptKey(r.Header.Get("Sec-WebSocket-Key")))
+	rw.Flush()
+	conn := &wsConn{conn: netConn, reader: bufio.NewReader(rw)}
+
+	m.mu.Lock()
+	m.conns = append(m.conns, conn)
+	m.mu.Unlock()
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message phoenixMessage
+		var payload map[string]any
+		json.Unmarshal(data, &message)
+		json.Unmarshal(message.Payload, &payload)
+
+		reply := map[string]any{}
+		m.mu.Lock()
+		switch message.Event {
+		case "heartbeat":
+			m.heartbeats++
+		case "phx_join":
+			m.joins = append(m.joins, payload)
+			var changes []map[string]any
+			for i, change := range payload["config"].(map[string]any)["postgres_changes"].([]any) {
+				binding := change.(map[string]any)
+				binding["id"] = 100 + i
+				changes = append(changes, binding)
+			}
+			reply["postgres_changes"] = changes
+		case "access_token":
+			m.tokens = append(m.tokens, payload["access_token"].(string))
+			m.mu.Unlock()
+			continue
+		}
+		m.mu.Unlock()
+
+		m.push(conn, phoenixMessage{Topic: message.Topic, Event: "phx_reply", Ref: message.Ref, Payload: mustJSON(map[string]any{"status": "ok", "response": reply})})
+		switch {
+		case message.Event == "broadcast":
+			m.push(conn, phoenixMessage{Topic: message.Topic, Event: "broadcast", Payload: mustJSON(payload)})
+		case message.Event == "presence" && payload["event"] == "track":
+			meta := payload["payload"].(map[string]any)
+			meta["phx_ref"] = "ref-1"
+			m.push(conn, phoenixMessage{Topic: message.Topic, Event: "presence_diff", Payload: mustJSON(map[string]any{
+				"joins":  map[string]any{"user-1": map[string]any{"metas": []any{meta}}},
+				"leaves": map[string]any{},
+			})})
+		}
+	}
+}
+
+// push writes a message to a connection.
+func (m *mockRealtimeServer) push(conn *wsConn, message phoenixMessage) {
+	data, _ := json.Marshal(message)
+	conn.WriteText(data)
+}
+
+// last returns the latest connection.
+func (m *mockRealtimeServer) last() *wsConn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.conns[len(m.conns)-1]
+}
+
+// TestRealtime tests joins with postgres_changes filters, broadcasts, presence, token pushes, heartbeats and reconnection.
+func TestRealtime(t *testing.T) {
+	var (
+		testName     = "TestRealtime"
+		realtime     = &mockRealtimeServer{}
+		server       *httptest.Server
+		service      *Service
+		authServer   *mockAuthServer
+		login        *LoginResponse
+		client       *RealtimeClient
+		channel      *RealtimeChannel
+		changes      = make(chan PostgresChange, 1)
+		broadcasts   = make(chan BroadcastMessage, 1)
+		presence     = make(chan map[string][]PresenceMeta, 1)
+		row          todoRow
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: mock auth for tokens, local server for the WebSocket
+	server = httptest.NewServer(http.HandlerFunc(realtime.handle))
+	defer server.Close()
+	service, _, authServer = newMockService()
+	service.ProjectURL = server.URL
+	login, err = service.LoginUser(ctx, authServer.email, "password")
+	if err == nil {
+		client = service.Realtime(RealtimeOptions{Token: login.Token, HeartbeatInterval: 20 * time.Millisecond, Timeout: time.Second, ReconnectMin: 10 * time.Millisecond})
+		err = client.Connect(ctx)
+	}
+	if err == nil {
+		defer client.Close()
+		channel = client.Channel("room", ChannelOptions{BroadcastSelf: true, BroadcastAck: true}).
+			OnPostgresChanges(PostgresChangesFilter{Event: "insert", Table: "todos", Filter: "user_id=eq.1"}, func(c PostgresChange) { changes <- c }).
+			OnBroadcast("cursor", func(b BroadcastMessage) { broadcasts <- b }).
+			OnPresenceSync(func(state map[string][]PresenceMeta) { presence <- state })
+		err = channel.Subscribe(ctx)
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Connect/subscribe failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// verify: the join carries the user token and the filter
+	realtime.mu.Lock()
+	join := realtime.joins[0]
+	realtime.mu.Unlock()
+	filters := join["config"].(map[string]any)["postgres_changes"].([]any)
+	if join["access_token"] != login.Token || len(filters) != 1 || filters[0].(map[string]any)["filter"] != "user_id=eq.1" || filters[0].(map[string]any)["event"] != "INSERT" {
+		errorMessage = fmt.Sprintf("Unexpected join payload: %v", join)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// execute: server change, broadcast round trip, presence track
+	realtime.push(realtime.last(), phoenixMessage{Topic: "realtime:room", Event: "postgres_changes", Payload: mustJSON(map[string]any{
+		"ids":  []int{100},
+		"data": map[string]any{"schema": "public", "table": "todos", "eventType": "INSERT", "new": map[string]any{"id": 7, "title": "live"}},
+	})})
+	select {
+	case change := <-changes:
+		err = change.DecodeNew(&row)
+	case <-time.After(time.Second):
+		err = fmt.Errorf("no postgres change received")
+	}
+	if err != nil || row.ID != 7 || row.Title != "live" {
+		errorMessage = fmt.Sprintf("Unexpected postgres change (err: %v, row: %+v)", err, row)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Postgres changes are routed by server binding ID\n")
+
+	if err = channel.Send(ctx, "cursor", map[string]int{"x": 3}); err == nil {
+		err = channel.Track(ctx, map[string]any{"status": "online"})
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Send/track failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	select {
+	case broadcast := <-broadcasts:
+		state := <-presence
+		if string(broadcast.Payload) != `{"x":3}` || len(state["user-1"]) != 1 || state["user-1"][0]["status"] != "online" {
+			err = fmt.Errorf("broadcast %s, presence %v", broadcast.Payload, state)
+		}
+	case <-time.After(time.Second):
+		err = fmt.Errorf("no broadcast received")
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Unexpected broadcast/presence: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Broadcast and presence round trips work\n")
+
+	// execute: refreshing the session pushes the new token, and a dropped connection rejoins with it
+	cachedUser, _ := service.Cache.Get(login.Token)
+	refreshed, err := service.RefreshToken(ctx, cachedUser.RefreshToken)
+	if err != nil {
+		errorMessage = fmt.Sprintf("RefreshToken failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	time.Sleep(50 * time.Millisecond)
+	realtime.last().conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		realtime.mu.Lock()
+		rejoined := len(realtime.joins) == 2
+		realtime.mu.Unlock()
+		if rejoined && channel.Joined() {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	realtime.mu.Lock()
+	defer realtime.mu.Unlock()
+	if len(realtime.tokens) != 1 || realtime.tokens[0] != refreshed.AccessToken || len(realtime.joins) != 2 ||
+		realtime.joins[1]["access_token"] != refreshed.AccessToken || realtime.heartbeats == 0 || !channel.Joined() {
+		errorMessage = fmt.Sprintf("Expected token push and rejoin (tokens: %d, joins: %d, heartbeats: %d, joined: %t)", len(realtime.tokens), len(realtime.joins), realtime.heartbeats, channel.Joined())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Refreshed tokens are pushed and channels rejoin after reconnecting\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestRealtimeConcurrentConnect tests that concurrent Connect calls open a single connection.
+func TestRealtimeConcurrentConnect(t *testing.T) {
+	var (
+		testName     = "TestRealtimeConcurrentConnect"
+		realtime     = &mockRealtimeServer{}
+		server       *httptest.Server
+		service      *Service
+		client       *RealtimeClient
+		wg           sync.WaitGroup
+		errs         = make(chan error, 8)
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup
+	server = httptest.NewServer(http.HandlerFunc(realtime.handle))
+	defer server.Close()
+	service, _, _ = newMockService()
+	service.ProjectURL = server.URL
+	client = service.Realtime(RealtimeOptions{HeartbeatInterval: time.Hour})
+	defer client.Close()
+
+	// execute
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- client.Connect(context.Background())
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	time.Sleep(50 * time.Millisecond)
+
+	// verify
+	for err := range errs {
+		if err != nil {
+			errorMessage = fmt.Sprintf("Connect failed: %v", err)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	realtime.mu.Lock()
+	conns := len(realtime.conns)
+	realtime.mu.Unlock()
+	if conns != 1 || !client.Connected() {
+		errorMessage = fmt.Sprintf("Expected a single connection, got %d", conns)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Concurrent Connect calls open one connection\n")
+
+	// verify: clients using the anon key have no session to receive refreshed tokens
+	if sessionID := client.sessionID(); sessionID != "" {
+		errorMessage = fmt.Sprintf("Anon key client should have no session ID, got %q", sessionID)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Anon key clients have no session ID\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,948 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for Redis operations.
+var (
+	ErrRedisProtocol = errors.New("invalid redis protocol reply")
+	ErrRedisClosed   = errors.New("redis store is closed")
+)
+
+// RedisError is an error reply returned by a Redis server.
+type RedisError struct {
+	Message string
+}
+
+// Error returns the Redis error message.
+func (e *RedisError) Error() string {
+	return "redis: " + e.Message
+}
+
+// RedisOptions configures a RedisStore.
+// Password is the AUTH password (optional).
+// DB is the database index selected after connecting (default 0).
+// Prefix is prepended to every key (default "ft_supabase:").
+// DialTimeout is the timeout for establishing connections (default 5 seconds).
+// IOTimeout is the read/write deadline for each command (default 5 seconds).
+// PoolSize is the maximum number of idle connections kept open (default 10).
+//
+// Used in:
+// - NewRedisStore() - configures the store
+type RedisOptions struct {
+	Password    string
+	DB          int
+	Prefix      string
+	DialTimeout time.Duration
+	IOTimeout   time.Duration
+	PoolSize    int
+}
+
+// RedisStore implements SessionStore on top of any server speaking the Redis protocol (RESP).
+// Sessions are shared by every replica pointing at the same server and expire
+// through per-key TTLs matching their ExpiresAt.
+// addr is the Redis server address (host:port).
+// opts holds the store configuration.
+// pool holds idle connections.
+// mu guards closed.
+// closed is true once Close has been called.
+//
+// Key layout (with default prefix):
+// - ft_supabase:session:<sessionID> - JSON encoded CachedUser
+// - ft_supabase:token:<sha256(token)> - session ID of the token
+// - ft_supabase:user:<userID> - set of the user's session IDs
+// - ft_supabase:email:<email>, ft_supabase:username:<username> - user ID (normalized keys, checked on read)
+//
+// SessionStore methods do not return errors; Redis failures are logged and treated as cache misses.
+type RedisStore struct {
+	addr   string
+	opts   RedisOptions
+	pool   chan *redisConn
+	mu     sync.Mutex
+	closed bool
+}
+
+// redisConn is a single connection to a Redis server.
+type redisConn struct {
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// compile-time check that RedisStore implements SessionStore
+var _ SessionStore = (*RedisStore)(nil)
+
+// NewRedisStore creates a new RedisStore for the server at addr.
+// addr is the Redis server address (host:port).
+// opts configures authentication, key prefix, timeouts and pool size (zero values use defaults).
+// Connections are opened lazily on first use.
+func NewRedisStore(addr string, opts RedisOptions) *RedisStore {
+	Logf("NewRedisStore", "Creating Redis session store - Addr: %s, DB: %d", addr, opts.DB)
+
+	// apply defaults
+	if opts.Prefix == "" {
+		opts.Prefix = "ft_supabase:"
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 5 * time.Second
+	}
+	if opts.IOTimeout <= 0 {
+		opts.IOTimeout = 5 * time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+
+	return &RedisStore{
+		addr: addr,
+		opts: opts,
+		pool: make(chan *redisConn, opts.PoolSize),
+	}
+}
+
+// Ping checks connectivity with the Redis server.
+// Returns an error if the server cannot be reached.
+func (r *RedisStore) Ping() error {
+	_, err := r.do("PING")
+	return err
+}
+
+// Close closes every idle connection and rejects further commands.
+// Returns nil; provided to satisfy io.Closer.
+func (r *RedisStore) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.pool)
+
+	for rc := range r.pool {
+		rc.conn.Close()
+	}
+
+	return nil
+}
+
+// Set stores a session with a TTL matching its ExpiresAt.
+// token is the JWT access token used as the cache key.
+// user is the CachedUser to store (its AccessToken is set to token).
+// Replacing a session with the same SessionID removes its previous token and keeps its device info.
+func (r *RedisStore) Set(token string, user *CachedUser) {
+	var (
+		now      time.Time
+		ttl      time.Duration
+		previous *CachedUser
+		data     []byte
+		stored   CachedUser
+		err      error
+	)
+
+	// never modify the caller's value
+	stored = *user
+	user = &stored
+
+	now = time.Now()
+	user.AccessToken = token
+	if user.SessionID == "" {
+		user.SessionID = sessionIDFromToken(token)
+	}
+
+	// expired sessions are never stored
+	ttl = user.ExpiresAt.Sub(now)
+	if ttl <= 0 {
+		Logf("RedisStore.Set", "Skipping expired session - UserID: %s", user.UserID.String())
+		return
+	}
+
+	Logf("RedisStore.Set", "Caching session - UserID: %s, SessionID: %s", user.UserID.String(), user.SessionID)
+
+	// carry over device info from a replaced session
+	previous = r.loadSession(user.SessionID)
+	if previous != nil {
+		if user.IPAddress == "" {
+			user.IPAddress = previous.IPAddress
+		}
+		if user.UserAgent == "" {
+			user.UserAgent = previous.UserAgent
+		}
+		if user.CreatedAt.IsZero() {
+			user.CreatedAt = previous.CreatedAt
+		}
+		user.Version = previous.Version
+		if previous.AccessToken != token {
+			r.logErr("RedisStore.Set", r.del(r.tokenKey(previous.AccessToken)))
+		}
+	}
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	if user.LastSeenAt.IsZero() {
+		user.LastSeenAt = now
+	}
+	user.Version++
+
+	data, err = json.Marshal(user)
+	if err != nil {
+		Logf("RedisStore.Set", "Failed to marshal session: %v", err)
+		return
+	}
+
+	// write session, token pointer and user index
+	if err = r.setPX(r.sessionKey(user.SessionID), string(data), ttl); err != nil {
+		r.logErr("RedisStore.Set", err)
+		return
+	}
+	r.logErr("RedisStore.Set", r.setPX(r.tokenKey(token), user.SessionID, ttl))
+	r.logErr("RedisStore.Set", r.addUserSession(user.UserID, user.SessionID, ttl))
+	r.logErr("RedisStore.Set", r.setLookup("email:", user.Email, user.UserID, ttl))
+	r.logErr("RedisStore.Set", r.setLookup("username:", user.Username, user.UserID, ttl))
+}
+
+// Get retrieves a non-expired session by its access token.
+// token is the JWT access token used as the cache key.
+// Returns the CachedUser and true if found, nil and false otherwise.
+func (r *RedisStore) Get(token string) (*CachedUser, bool) {
+	var (
+		sessionID string
+		user      *CachedUser
+		ok        bool
+		err       error
+	)
+
+	sessionID, ok, err = r.get(r.tokenKey(token))
+	if err != nil || !ok {
+		r.logErr("RedisStore.Get", err)
+		return nil, false
+	}
+
+	user = r.loadSession(sessionID)
+	if user == nil || user.AccessToken != token || time.Now().After(user.ExpiresAt) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// GetByUserID retrieves the freshest non-expired session of a user.
+// userID is the Supabase user unique identifier (UUID).
+// Returns the CachedUser with the latest ExpiresAt and true if found.
+func (r *RedisStore) GetByUserID(userID uuid.UUID) (*CachedUser, bool) {
+	var (
+		freshest *CachedUser
+	)
+
+	for _, user := range r.loadUserSessions(userID) {
+		if freshest == nil || user.ExpiresAt.After(freshest.ExpiresAt) {
+			freshest = user
+		}
+	}
+
+	return freshest, freshest != nil
+}
+
+// GetByEmail retrieves the freshest non-expired session of the user with an email address.
+// email is the email address, matched case-insensitively.
+// Returns the CachedUser and true if found, nil and false otherwise.
+func (r *RedisStore) GetByEmail(email string) (*CachedUser, bool) {
+	return r.getByLookup("email:", email, func(user *CachedUser) string { return user.Email })
+}
+
+// GetByUsername retrieves the freshest non-expired session of the user with a username.
+// username is the username, matched case-insensitively.
+// Returns the CachedUser and true if found, nil and false otherwise.
+func (r *RedisStore) GetByUsername(username string) (*CachedUser, bool) {
+	return r.getByLookup("username:", username, func(user *CachedUser) string { return user.Username })
+}
+
+// getByLookup resolves an email or username key to a user and returns their freshest session still matching value.
+// kind is the key kind ("email:" or "username:").
+// value is the email or username.
+// field extracts the matched field from a session.
+func (r *RedisStore) getByLookup(kind, value string, field func(*CachedUser) string) (*CachedUser, bool) {
+	var (
+		key      string
+		data     string
+		userID   uuid.UUID
+		freshest *CachedUser
+		ok       bool
+		err      error
+	)
+
+	key = normalizeLookupKey(value)
+	if key == "" {
+		return nil, false
+	}
+
+	data, ok, err = r.get(r.opts.Prefix + kind + key)
+	if err != nil || !ok {
+		r.logErr("RedisStore.getByLookup", err)
+		return nil, false
+	}
+	userID, err = uuid.Parse(data)
+	if err != nil {
+		return nil, false
+	}
+
+	// keys are not removed with sessions, so check the session still matches
+	for _, user := range r.loadUserSessions(userID) {
+		if normalizeLookupKey(field(user)) != key {
+			continue
+		}
+		if freshest == nil || user.ExpiresAt.After(freshest.ExpiresAt) {
+			freshest = user
+		}
+	}
+
+	return freshest, freshest != nil
+}
+
+// GetBySessionID retrieves a non-expired session by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns the CachedUser and true if found, nil and false otherwise.
+func (r *RedisStore) GetBySessionID(sessionID string) (*CachedUser, bool) {
+	var (
+		user *CachedUser
+	)
+
+	user = r.loadSession(sessionID)
+	if user == nil || time.Now().After(user.ExpiresAt) {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// Delete removes a session by its access token.
+// token is the JWT access token used as the cache key.
+func (r *RedisStore) Delete(token string) {
+	var (
+		sessionID string
+		ok        bool
+		err       error
+	)
+
+	sessionID, ok, err = r.get(r.tokenKey(token))
+	if err != nil || !ok {
+		r.logErr("RedisStore.Delete", err)
+		return
+	}
+
+	r.RevokeSession(sessionID)
+}
+
+// DeleteByUserID removes every session of a user.
+// userID is the Supabase user unique identifier (UUID).
+func (r *RedisStore) DeleteByUserID(userID uuid.UUID) {
+	var (
+		sessionIDs []string
+		err        error
+	)
+
+	sessionIDs, err = r.members(r.userKey(userID))
+	if err != nil {
+		r.logErr("RedisStore.DeleteByUserID", err)
+		return
+	}
+
+	for _, sessionID := range sessionIDs {
+		r.RevokeSession(sessionID)
+	}
+	r.logErr("RedisStore.DeleteByUserID", r.del(r.userKey(userID)))
+}
+
+// IsValid checks if a token exists and is not expired.
+// token is the JWT access token to validate.
+func (r *RedisStore) IsValid(token string) bool {
+	_, ok := r.Get(token)
+	return ok
+}
+
+// Update applies fn to every session of a user and writes them back with their remaining TTL.
+// userID is the Supabase user unique identifier (UUID).
+// fn is called with each session of the user and may modify profile fields.
+// Concurrent updates of the same user are last-writer-wins.
+func (r *RedisStore) Update(userID uuid.UUID, fn func(*CachedUser)) {
+	var (
+		ttl  time.Duration
+		data []byte
+		err  error
+	)
+
+	for _, user := range r.loadUserSessions(userID) {
+		sessionID, accessToken := user.SessionID, user.AccessToken
+		fn(user)
+
+		// index keys cannot change
+		user.UserID, user.SessionID, user.AccessToken = userID, sessionID, accessToken
+		user.Version++
+
+		ttl = time.Until(user.ExpiresAt)
+		if ttl <= 0 {
+			continue
+		}
+		data, err = json.Marshal(user)
+		if err != nil {
+			Logf("RedisStore.Update", "Failed to marshal session: %v", err)
+			continue
+		}
+		r.logErr("RedisStore.Update", r.setPX(r.sessionKey(user.SessionID), string(data), ttl))
+		r.logErr("RedisStore.Update", r.setLookup("email:", user.Email, userID, ttl))
+		r.logErr("RedisStore.Update", r.setLookup("username:", user.Username, userID, ttl))
+	}
+}
+
+// ListSessions returns the non-expired sessions of a user, oldest first.
+// userID is the Supabase user unique identifier (UUID).
+func (r *RedisStore) ListSessions(userID uuid.UUID) []SessionInfo {
+	var (
+		sessions []SessionInfo
+	)
+
+	sessions = make([]SessionInfo, 0)
+	for _, user := range r.loadUserSessions(userID) {
+		sessions = append(sessions, SessionInfo{
+			SessionID:  user.SessionID,
+			UserID:     user.UserID,
+			IPAddress:  user.IPAddress,
+			UserAgent:  user.UserAgent,
+			CreatedAt:  user.CreatedAt,
+			LastSeenAt: user.LastSeenAt,
+			ExpiresAt:  user.ExpiresAt,
+		})
+	}
+
+	// sort by creation time for stable output
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].CreatedAt.Before(sessions[j].CreatedAt)
+	})
+
+	return sessions
+}
+
+// RevokeSession removes a single session by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns true if the session existed.
+func (r *RedisStore) RevokeSession(sessionID string) bool {
+	var (
+		user *CachedUser
+	)
+
+	user = r.loadSession(sessionID)
+	if user == nil {
+		return false
+	}
+
+	r.logErr("RedisStore.RevokeSession", r.del(r.sessionKey(sessionID), r.tokenKey(user.AccessToken)))
+	_, err := r.do("SREM", r.userKey(user.UserID), sessionID)
+	r.logErr("RedisStore.RevokeSession", err)
+
+	return true
+}
+
+// Cleanup removes stale session IDs from user index sets.
+// Session and token keys expire on their own through Redis TTLs, so it always returns 0.
+func (r *RedisStore) Cleanup() int {
+	var (
+		userKeys []string
+		err      error
+	)
+
+	Log("RedisStore.Cleanup", "Pruning stale user session indexes")
+
+	userKeys, err = r.scan(r.opts.Prefix + "user:*")
+	if err != nil {
+		r.logErr("RedisStore.Cleanup", err)
+		return 0
+	}
+
+	for _, key := range userKeys {
+		userID, err := uuid.Parse(strings.TrimPrefix(key, r.opts.Prefix+"user:"))
+		if err != nil {
+			continue
+		}
+		// loading prunes members whose session key has expired
+		r.loadUserSessions(userID)
+	}
+
+	return 0
+}
+
+// Count returns the number of stored sessions.
+func (r *RedisStore) Count() int {
+	var (
+		keys []string
+		err  error
+	)
+
+	keys, err = r.scan(r.opts.Prefix + "session:*")
+	if err != nil {
+		r.logErr("RedisStore.Count", err)
+		return 0
+	}
+
+	return len(keys)
+}
+
+// sessionKey returns the key holding a session.
+func (r *RedisStore) sessionKey(sessionID string) string {
+	return r.opts.Prefix + "session:" + sessionID
+}
+
+// tokenKey returns the key mapping a token to its session; tokens are hashed to keep keys short.
+func (r *RedisStore) tokenKey(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return r.opts.Prefix + "token:" + hex.EncodeToString(sum[:])
+}
+
+// userKey returns the key holding the set of a user's session IDs.
+func (r *RedisStore) userKey(userID uuid.UUID) string {
+	return r.opts.Prefix + "user:" + userID.String()
+}
+
+// loadSession reads and decodes a session.
+// Returns nil if the session does not exist or cannot be decoded.
+func (r *RedisStore) loadSession(sessionID string) *CachedUser {
+	var (
+		data string
+		ok   bool
+		user CachedUser
+		err  error
+	)
+
+	data, ok, err = r.get(r.sessionKey(sessionID))
+	if err != nil || !ok {
+		r.logErr("RedisStore.loadSession", err)
+		return nil
+	}
+
+	if err = json.Unmarshal([]byte(data), &user); err != nil {
+		Logf("RedisStore.loadSession", "Failed to unmarshal session: %v", err)
+		return nil
+	}
+
+	return &user
+}
+
+// loadUserSessions reads every non-expired session of a user and prunes missing ones from the index.
+func (r *RedisStore) loadUserSessions(userID uuid.UUID) []*CachedUser {
+	var (
+		sessionIDs []string
+		users      []*CachedUser
+		user       *CachedUser
+		now        time.Time
+		err        error
+	)
+
+	sessionIDs, err = r.members(r.userKey(userID))
+	if err != nil {
+		r.logErr("RedisStore.loadUserSessions", err)
+		return nil
+	}
+
+	now = time.Now()
+	for _, sessionID := range sessionIDs {
+		user = r.loadSession(sessionID)
+		if user == nil {
+			// session key expired, drop it from the index
+			_, err = r.do("SREM", r.userKey(userID), sessionID)
+			r.logErr("RedisStore.loadUserSessions", err)
+			continue
+		}
+		if now.After(user.ExpiresAt) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// addUserSession adds a session to the user index and extends the index TTL to cover it.
+func (r *RedisStore) addUserSession(userID uuid.UUID, sessionID string, ttl time.Duration) error {
+	var (
+		key     string
+		reply   any
+		current int64
+		err     error
+	)
+
+	key = r.userKey(userID)
+	if _, err = r.do("SADD", key, sessionID); err != nil {
+		return err
+	}
+
+	// only extend the index TTL, never shorten it below another session's lifetime
+	reply, err = r.do("PTTL", key)
+	if err != nil {
+		return err
+	}
+	current, _ = reply.(int64)
+	if current >= 0 && time.Duration(current)*time.Millisecond >= ttl {
+		return nil
+	}
+
+	_, err = r.do("PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// setLookup maps a normalized email or username to a user, never shortening the key TTL.
+// kind is the key kind ("email:" or "username:").
+// value is the email or username (empty values are not indexed).
+// userID is the user the value belongs to.
+// ttl is the lifetime of the session carrying the value.
+func (r *RedisStore) setLookup(kind, value string, userID uuid.UUID, ttl time.Duration) error {
+	var (
+		key     string
+		reply   any
+		current int64
+		err     error
+	)
+
+	value = normalizeLookupKey(value)
+	if value == "" {
+		return nil
+	}
+	key = r.opts.Prefix + kind + value
+
+	// keep the key alive as long as the longest session using it
+	reply, err = r.do("PTTL", key)
+	if err != nil {
+		return err
+	}
+	current, _ = reply.(int64)
+	if remaining := time.Duration(current) * time.Millisecond; remaining > ttl {
+		ttl = remaining
+	}
+
+	return r.setPX(key, userID.String(), ttl)
+}
+
+// get runs GET and returns the value and whether the key exists.
+func (r *RedisStore) get(key string) (string, bool, error) {
+	reply, err := r.do("GET", key)
+	if err != nil || reply == nil {
+		return "", false, err
+	}
+
+	value, ok := reply.(string)
+	if !ok {
+		return "", false, ErrRedisProtocol
+	}
+
+	return value, true, nil
+}
+
+// setPX runs SET with a millisecond TTL.
+func (r *RedisStore) setPX(key, value string, ttl time.Duration) error {
+	_, err := r.do("SET", key, value, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// del runs DEL on the given keys.
+func (r *RedisStore) del(keys ...string) error {
+	_, err := r.do("DEL", keys...)
+	return err
+}
+
+// members runs SMEMBERS and returns the set members.
+func (r *RedisStore) members(key string) ([]string, error) {
+	reply, err := r.do("SMEMBERS", key)
+	if err != nil {
+		return nil, err
+	}
+
+	return replyStrings(reply)
+}
+
+// scan iterates SCAN with MATCH and returns every matching key.
+func (r *RedisStore) scan(pattern string) ([]string, error) {
+	var (
+		cursor = "0"
+		keys   []string
+		reply  any
+		parts  []any
+		batch  []string
+		err    error
+	)
+
+	for {
+		reply, err = r.do("SCAN", cursor, "MATCH", pattern, "COUNT", "1000")
+		if err != nil {
+			return nil, err
+		}
+
+		parts, _ = reply.([]any)
+		if len(parts) != 2 {
+			return nil, ErrRedisProtocol
+		}
+		cursor, _ = parts[0].(string)
+		batch, err = replyStrings(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// logErr logs a Redis error if not nil.
+func (r *RedisStore) logErr(context string, err error) {
+	if err != nil {
+		Logf(context, "Redis command failed: %v", err)
+	}
+}
+
+// do sends a command and reads its reply using a pooled connection.
+// cmd is the command name.
+// args are the command arguments.
+// Returns the decoded reply: string, int64, nil, []any, or a *RedisError.
+func (r *RedisStore) do(cmd string, args ...string) (any, error) {
+	var (
+		rc    *redisConn
+		reply any
+		err   error
+	)
+
+	rc, err = r.acquire()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err = rc.roundTrip(r.opts.IOTimeout, append([]string{cmd}, args...))
+	if err != nil {
+		var redisErr *RedisError
+		// error replies leave the connection usable
+		if errors.As(err, &redisErr) {
+			r.release(rc)
+		} else {
+			rc.conn.Close()
+		}
+		return nil, err
+	}
+
+	r.release(rc)
+	return reply, nil
+}
+
+// acquire returns an idle connection or dials a new one.
+func (r *RedisStore) acquire() (*redisConn, error) {
+	var (
+		rc   *redisConn
+		conn net.Conn
+		err  error
+	)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrRedisClosed
+	}
+	select {
+	case rc = <-r.pool:
+		r.mu.Unlock()
+		return rc, nil
+	default:
+	}
+	r.mu.Unlock()
+
+	conn, err = net.DialTimeout("tcp", r.addr, r.opts.DialTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("redis dial %s: %w", r.addr, err)
+	}
+	rc = &redisConn{conn: conn, rd: bufio.NewReader(conn)}
+
+	// authenticate and select database on new connections
+	if r.opts.Password != "" {
+		if _, err = rc.roundTrip(r.opts.IOTimeout, []string{"AUTH", r.opts.Password}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.opts.DB != 0 {
+		if _, err = rc.roundTrip(r.opts.IOTimeout, []string{"SELECT", strconv.Itoa(r.opts.DB)}); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+// release returns a connection to the pool or closes it when the pool is full or closed.
+func (r *RedisStore) release(rc *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		rc.conn.Close()
+		return
+	}
+	select {
+	case r.pool <- rc:
+	default:
+		rc.conn.Close()
+	}
+}
+
+// roundTrip writes a command as a RESP array of bulk strings and reads one reply.
+func (rc *redisConn) roundTrip(timeout time.Duration, args []string) (any, error) {
+	var (
+		buf []byte
+		err error
+	)
+
+	rc.conn.SetDeadline(time.Now().Add(timeout))
+
+	// encode *<n>\r\n$<len>\r\n<arg>\r\n...
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+
+	if _, err = rc.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	return readRESP(rc.rd)
+}
+
+// Limits on lengths announced by the server, checked before allocating.
+const (
+	// maxRESPBulkLen is the largest bulk string accepted (Redis proto-max-bulk-len default).
+	maxRESPBulkLen = 512 << 20
+
+	// maxRESPArrayLen is the largest array accepted.
+	maxRESPArrayLen = 1 << 20
+)
+
+// readRESP reads a single RESP2 reply.
+// Returns string for simple and bulk strings, int64 for integers, nil for null replies,
+// []any for arrays, and a *RedisError for error replies.
+// Bulk strings longer than maxRESPBulkLen and arrays longer than maxRESPArrayLen fail with ErrRedisProtocol.
+func readRESP(rd *bufio.Reader) (any, error) {
+	var (
+		line  string
+		n     int64
+		data  []byte
+		items []any
+		err   error
+	)
+
+	line, err = rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, ErrRedisProtocol
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, &RedisError{Message: line[1:]}
+	case ':':
+		n, err = strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, ErrRedisProtocol
+		}
+		return n, nil
+	case '$':
+		n, err = strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, ErrRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRESPBulkLen {
+			return nil, ErrRedisProtocol
+		}
+		data = make([]byte, n+2)
+		if _, err = io.ReadFull(rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err = strconv.ParseInt(line[1:], 10, 64)
+		if err != nil {
+			return nil, ErrRedisProtocol
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		if n > maxRESPArrayLen {
+			return nil, ErrRedisProtocol
+		}
+		items = make([]any, 0, min(n, 1024))
+		for i := int64(0); i < n; i++ {
+			item, err := readRESP(rd)
+			if err != nil {
+				var redisErr *RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				item = redisErr
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, ErrRedisProtocol
+	}
+}
+
+// replyStrings converts an array reply to a string slice.
+func replyStrings(reply any) ([]string, error) {
+	var (
+		items  []any
+		values []string
+	)
+
+	if reply == nil {
+		return nil, nil
+	}
+
+	items, ok := reply.([]any)
+	if !ok {
+		return nil, ErrRedisProtocol
+	}
+
+	values = make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok {
+			return nil, ErrRedisProtocol
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
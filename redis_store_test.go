@@ -0,0 +1,329 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// respTestServer is a minimal in-process stand-in for a Redis server.
+// It supports the commands used by RedisStore with lazy key expiry.
+// listener is the TCP listener accepting client connections.
+// mu guards strings, sets and expiry.
+type respTestServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	strings  map[string]string
+	sets     map[string]map[string]bool
+	expiry   map[string]time.Time
+}
+
+// newRESPTestServer starts a respTestServer on a random local port.
+func newRESPTestServer(t *testing.T) *respTestServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	srv := &respTestServer{
+		listener: listener,
+		strings:  make(map[string]string),
+		sets:     make(map[string]map[string]bool),
+		expiry:   make(map[string]time.Time),
+	}
+	go srv.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return srv
+}
+
+// serve accepts connections until the listener is closed.
+func (s *respTestServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// handle reads commands from a connection and writes replies.
+func (s *respTestServer) handle(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+
+	for {
+		reply, err := readRESP(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]any)
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		conn.Write([]byte(s.exec(args)))
+	}
+}
+
+// expireLocked drops key if its TTL has passed.
+func (s *respTestServer) expireLocked(key string) {
+	if at, ok := s.expiry[key]; ok && time.Now().After(at) {
+		delete(s.strings, key)
+		delete(s.sets, key)
+		delete(s.expiry, key)
+	}
+}
+
+// exec runs one command and returns the encoded RESP reply.
+func (s *respTestServer) exec(args []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, arg := range args[1:] {
+		s.expireLocked(arg)
+	}
+
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return "+PONG\r\n"
+	case "GET":
+		value, ok := s.strings[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return bulk(value)
+	case "SET":
+		s.strings[args[1]] = args[2]
+		delete(s.expiry, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.ParseInt(args[4], 10, 64)
+			s.expiry[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			_, isString := s.strings[key]
+			_, isSet := s.sets[key]
+			if isString || isSet {
+				n++
+			}
+			delete(s.strings, key)
+			delete(s.sets, key)
+			delete(s.expiry, key)
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	case "SADD":
+		if s.sets[args[1]] == nil {
+			s.sets[args[1]] = make(map[string]bool)
+		}
+		for _, member := range args[2:] {
+			s.sets[args[1]][member] = true
+		}
+		return ":1\r\n"
+	case "SREM":
+		for _, member := range args[2:] {
+			delete(s.sets[args[1]], member)
+		}
+		if len(s.sets[args[1]]) == 0 {
+			delete(s.sets, args[1])
+		}
+		return ":1\r\n"
+	case "SMEMBERS":
+		members := make([]string, 0)
+		for member := range s.sets[args[1]] {
+			members = append(members, member)
+		}
+		return array(members)
+	case "PTTL":
+		at, ok := s.expiry[args[1]]
+		if !ok {
+			return ":-1\r\n"
+		}
+		return fmt.Sprintf(":%d\r\n", time.Until(at).Milliseconds())
+	case "PEXPIRE":
+		ms, _ := strconv.ParseInt(args[2], 10, 64)
+		s.expiry[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		return ":1\r\n"
+	case "SCAN":
+		keys := make([]string, 0)
+		for key := range s.strings {
+			s.expireLocked(key)
+			if _, ok := s.strings[key]; ok {
+				if matched, _ := path.Match(args[3], key); matched {
+					keys = append(keys, key)
+				}
+			}
+		}
+		for key := range s.sets {
+			if matched, _ := path.Match(args[3], key); matched {
+				keys = append(keys, key)
+			}
+		}
+		return "*2\r\n" + bulk("0") + array(keys)
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+// bulk encodes a RESP bulk string.
+func bulk(value string) string {
+	return fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+}
+
+// array encodes a RESP array of bulk strings.
+func array(values []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(values))
+	for _, value := range values {
+		b.WriteString(bulk(value))
+	}
+	return b.String()
+}
+
+// TestRedisStore tests RedisStore against the in-process RESP stand-in.
+func TestRedisStore(t *testing.T) {
+	var (
+		testName     = "TestRedisStore"
+		srv          *respTestServer
+		replicaA     *RedisStore
+		replicaB     *RedisStore
+		userID       uuid.UUID
+		user         *CachedUser
+		found        bool
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: two replicas sharing the same server
+	srv = newRESPTestServer(t)
+	replicaA = NewRedisStore(srv.listener.Addr().String(), RedisOptions{})
+	replicaB = NewRedisStore(srv.listener.Addr().String(), RedisOptions{})
+	defer replicaA.Close()
+	defer replicaB.Close()
+
+	if err := replicaA.Ping(); err != nil {
+		errorMessage = fmt.Sprintf("Ping failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// execute: replica A stores two sessions
+	userID = uuid.New()
+	replicaA.Set("token-laptop", &CachedUser{UserID: userID, Email: "redis@example.com", SessionID: "s1", UserAgent: "laptop", ExpiresAt: time.Now().Add(time.Hour)})
+	replicaA.Set("token-phone", &CachedUser{UserID: userID, Email: "redis@example.com", SessionID: "s2", ExpiresAt: time.Now().Add(2 * time.Hour)})
+
+	// verify replica B sees them
+	user, found = replicaB.Get("token-laptop")
+	if !found || user.Email != "redis@example.com" || user.UserAgent != "laptop" {
+		errorMessage = "Replica B should read sessions written by replica A"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	user, found = replicaB.GetByUserID(userID)
+	if !found || user.SessionID != "s2" || replicaB.Count() != 2 || len(replicaB.ListSessions(userID)) != 2 {
+		errorMessage = fmt.Sprintf("Expected freshest session s2 and 2 sessions (count: %d)", replicaB.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Sessions shared across replicas\n")
+
+	// refresh replaces the session's token and keeps device info
+	replicaB.Set("token-laptop-2", &CachedUser{UserID: userID, Email: "redis@example.com", SessionID: "s1", ExpiresAt: time.Now().Add(time.Hour)})
+	if replicaA.IsValid("token-laptop") {
+		errorMessage = "Old token should be removed after refresh"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	user, found = replicaA.Get("token-laptop-2")
+	if !found || user.UserAgent != "laptop" {
+		errorMessage = "Refreshed session should keep device info"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Refresh replaced token within session\n")
+
+	// update applies to every session
+	replicaA.Update(userID, func(u *CachedUser) { u.DisplayName = "Updated" })
+	user, _ = replicaB.Get("token-phone")
+	if user.DisplayName != "Updated" {
+		errorMessage = "Update should be visible on other replicas"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+
+	// revoke and delete
+	if !replicaB.RevokeSession("s2") || replicaA.IsValid("token-phone") {
+		errorMessage = "RevokeSession should remove the phone session"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	replicaA.DeleteByUserID(userID)
+	if _, found = replicaB.GetByUserID(userID); found || replicaB.Count() != 0 {
+		errorMessage = "DeleteByUserID should remove every session"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Update, revoke and delete propagated\n")
+
+	// per-entry TTL matches ExpiresAt
+	replicaA.Set("token-short", &CachedUser{UserID: userID, SessionID: "s3", ExpiresAt: time.Now().Add(50 * time.Millisecond)})
+	time.Sleep(100 * time.Millisecond)
+	replicaA.Cleanup()
+	if replicaB.IsValid("token-short") || replicaB.Count() != 0 {
+		errorMessage = "Session should expire with its TTL"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Sessions expire through TTL\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestReadRESPLimits tests that oversized lengths announced by the server are rejected before allocating.
+func TestReadRESPLimits(t *testing.T) {
+	var (
+		testName     = "TestReadRESPLimits"
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// execute and verify
+	for _, reply := range []string{
+		"$9223372036854775807\r\n",
+		fmt.Sprintf("$%d\r\n", maxRESPBulkLen+1),
+		"*9223372036854775807\r\n",
+		fmt.Sprintf("*%d\r\n", maxRESPArrayLen+1),
+	} {
+		if _, err := readRESP(bufio.NewReader(strings.NewReader(reply))); !errors.Is(err, ErrRedisProtocol) {
+			errorMessage = fmt.Sprintf("Expected ErrRedisProtocol for %q, got %v", reply, err)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ Huge bulk and array lengths are rejected\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,133 @@
+package ft_supabase
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultRefreshReuseInterval is the default time a completed refresh is replayed to late callers.
+// Matches the Supabase default refresh token reuse interval of 10 seconds.
+const DefaultRefreshReuseInterval = 10 * time.Second
+
+// refreshTimeout bounds a refresh request that is detached from its caller's context.
+const refreshTimeout = 30 * time.Second
+
+// refreshCall represents an in-flight or recently completed token refresh.
+// done is closed once resp and err are set.
+// resp is the refresh result shared by every caller of the same refresh token.
+// err is the refresh error shared by every caller of the same refresh token.
+// completedAt is the timestamp when the refresh succeeded (zero while in flight).
+//
+// Used in:
+// - RefreshToken() - deduplicates concurrent refreshes of the same token
+type refreshCall struct {
+	done        chan struct{}
+	resp        *RefreshTokenResponse
+	err         error
+	completedAt time.Time
+}
+
+// RefreshToken refreshes an access token using a refresh token.
+// ctx is the context for request cancellation and timeout.
+// refreshToken is the refresh token obtained during login or registration.
+// Returns a RefreshTokenResponse with new access token and user details or an error if refresh fails.
+// Concurrent calls with the same refresh token share a single request to Supabase, and
+// calls arriving within RefreshReuseInterval after a successful refresh receive the same result.
+// This prevents Supabase from revoking the session family on refresh token reuse.
+func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error) {
+	var (
+		call   *refreshCall
+		exists bool
+	)
+
+	s.refreshMu.Lock()
+
+	// lazily initialize map for services not built with NewService
+	if s.refreshCalls == nil {
+		s.refreshCalls = make(map[string]*refreshCall)
+	}
+
+	// drop completed refreshes that are outside the reuse interval
+	s.pruneRefreshCallsLocked(time.Now())
+
+	// join an in-flight or recently completed refresh
+	call, exists = s.refreshCalls[refreshToken]
+	if exists {
+		s.refreshMu.Unlock()
+		Log("RefreshToken", "Joining existing refresh for this refresh token")
+		return waitRefreshCall(ctx, call)
+	}
+
+	// register new in-flight refresh
+	call = &refreshCall{done: make(chan struct{})}
+	s.refreshCalls[refreshToken] = call
+	s.refreshMu.Unlock()
+
+	// run the refresh detached from the caller so a cancelled caller cannot lose the rotated token
+	go s.runRefreshCall(context.WithoutCancel(ctx), refreshToken, call)
+
+	return waitRefreshCall(ctx, call)
+}
+
+// runRefreshCall performs the refresh request for a refreshCall and publishes its result.
+// ctx is the detached context for the refresh request.
+// refreshToken is the refresh token being exchanged.
+// call is the refreshCall to complete.
+func (s *Service) runRefreshCall(ctx context.Context, refreshToken string, call *refreshCall) {
+	var (
+		cancel context.CancelFunc
+	)
+
+	ctx, cancel = context.WithTimeout(ctx, refreshTimeout)
+	defer cancel()
+
+	call.resp, call.err = s.refreshToken(ctx, refreshToken)
+
+	s.refreshMu.Lock()
+	if call.err != nil {
+		// failed refreshes are not replayed so callers can retry
+		delete(s.refreshCalls, refreshToken)
+	} else {
+		call.completedAt = time.Now()
+	}
+	s.refreshMu.Unlock()
+
+	close(call.done)
+}
+
+// waitRefreshCall waits for a refreshCall to complete or for ctx to be done.
+// ctx is the caller's context.
+// call is the refreshCall to wait for.
+// Returns a copy of the shared response so callers cannot modify each other's results.
+func waitRefreshCall(ctx context.Context, call *refreshCall) (*RefreshTokenResponse, error) {
+	var (
+		resp RefreshTokenResponse
+	)
+
+	select {
+	case <-call.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if call.err != nil {
+		return nil, call.err
+	}
+
+	resp = *call.resp
+	return &resp, nil
+}
+
+// pruneRefreshCallsLocked removes completed refreshes older than RefreshReuseInterval.
+// now is the current time.
+// Must be called with refreshMu held.
+func (s *Service) pruneRefreshCallsLocked(now time.Time) {
+	for token, call := range s.refreshCalls {
+		if call.completedAt.IsZero() {
+			continue
+		}
+		if now.Sub(call.completedAt) > s.RefreshReuseInterval {
+			delete(s.refreshCalls, token)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestRefreshTokenSingleFlight tests that concurrent refreshes of the same token share one request.
+func TestRefreshTokenSingleFlight(t *testing.T) {
+	var (
+		testName     = "TestRefreshTokenSingleFlight"
+		service      *Service
+		client       *mockHTTPClient
+		ctx          context.Context
+		wg           sync.WaitGroup
+		responses    []*RefreshTokenResponse
+		errs         []error
+		late         *RefreshTokenResponse
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, client, _ = newMockService()
+	client.delay = 50 * time.Millisecond
+	ctx = context.Background()
+
+	responses = make([]*RefreshTokenResponse, 20)
+	errs = make([]error, 20)
+
+	// execute concurrent refreshes with the same refresh token
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i], errs[i] = service.RefreshToken(ctx, "shared-refresh-token")
+		}(i)
+	}
+	wg.Wait()
+
+	// verify
+	for i := range responses {
+		if errs[i] != nil {
+			errorMessage = fmt.Sprintf("RefreshToken %d failed: %v", i, errs[i])
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Fatalf("%s", errorMessage)
+			return
+		}
+		if responses[i].AccessToken != responses[0].AccessToken {
+			errorMessage = fmt.Sprintf("Caller %d got token %s, expected %s", i, responses[i].AccessToken, responses[0].AccessToken)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Errorf("%s", errorMessage)
+			return
+		}
+	}
+	if client.calls.Load() != 1 {
+		errorMessage = fmt.Sprintf("Expected 1 refresh request, got %d", client.calls.Load())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ 20 concurrent callers shared 1 refresh request\n")
+
+	// late caller within the reuse interval gets the same result
+	late, err = service.RefreshToken(ctx, "shared-refresh-token")
+	if err != nil || late.AccessToken != responses[0].AccessToken || client.calls.Load() != 1 {
+		errorMessage = fmt.Sprintf("Late caller should reuse result (err: %v, calls: %d)", err, client.calls.Load())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Late caller served from reuse map\n")
+
+	// caller after the reuse interval triggers a new refresh
+	service.RefreshReuseInterval = 0
+	time.Sleep(time.Millisecond)
+	late, err = service.RefreshToken(ctx, "shared-refresh-token")
+	if err != nil || client.calls.Load() != 2 {
+		errorMessage = fmt.Sprintf("Expected a new refresh after reuse interval (err: %v, calls: %d)", err, client.calls.Load())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Expired reuse entry triggers new refresh\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestRefreshTokenErrorNotReused tests that failed refreshes are not replayed to later callers.
+func TestRefreshTokenErrorNotReused(t *testing.T) {
+	var (
+		testName     = "TestRefreshTokenErrorNotReused"
+		service      *Service
+		client       *mockHTTPClient
+		server       *mockAuthServer
+		ctx          context.Context
+		failures     int
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: first request fails, following requests succeed
+	service, client, server = newMockService()
+	client.handler = func(method, url string, body any, headers map[string]string) ([]byte, error) {
+		if failures == 0 {
+			failures++
+			return nil, ErrInvalidStatus
+		}
+		return server.handle(method, url, body, headers)
+	}
+	ctx = context.Background()
+
+	// execute
+	_, err = service.RefreshToken(ctx, "refresh-token")
+	if err == nil {
+		errorMessage = "Expected first refresh to fail"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	_, err = service.RefreshToken(ctx, "refresh-token")
+	if err != nil {
+		errorMessage = fmt.Sprintf("Expected retry to succeed, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Failed refresh was retried\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
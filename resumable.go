@@ -0,0 +1,628 @@
+package ft_supabase
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TUS protocol constants and resumable upload defaults.
+const (
+	// TusVersion is the TUS protocol version sent in the Tus-Resumable header.
+	TusVersion = "1.0.0"
+
+	// DefaultResumableChunkSize is the default chunk size (Supabase Storage requires 6 MiB chunks).
+	DefaultResumableChunkSize = 6 << 20
+
+	// DefaultResumableConcurrency is the default number of concurrent uploads per uploader.
+	DefaultResumableConcurrency = 4
+
+	// DefaultResumableRetries is the default number of retries per chunk.
+	DefaultResumableRetries = 3
+
+	// DefaultResumableRetryDelay is the default delay before the first retry (doubled after each retry).
+	DefaultResumableRetryDelay = time.Second
+)
+
+// Sentinel errors for resumable uploads.
+var (
+	ErrUploadOffsetMismatch = errors.New("upload offset does not match the server offset")
+	ErrUploadExpired        = errors.New("resumable upload no longer exists on the server")
+)
+
+// UploadURLStore persists upload URLs by fingerprint so uploads resume after a process restart.
+// Implementations must be safe for concurrent use.
+//
+// Used in:
+// - ResumableOptions.Store - where the uploader keeps upload URLs
+type UploadURLStore interface {
+	// Get returns the upload URL stored for fingerprint.
+	Get(fingerprint string) (string, bool, error)
+
+	// Set stores the upload URL for fingerprint.
+	Set(fingerprint, uploadURL string) error
+
+	// Delete removes the upload URL of fingerprint (finished or expired uploads).
+	Delete(fingerprint string) error
+}
+
+// compile-time checks that the stores implement UploadURLStore
+var (
+	_ UploadURLStore = (*MemoryUploadURLStore)(nil)
+	_ UploadURLStore = (*FileUploadURLStore)(nil)
+)
+
+// UploadProgress reports the progress of a resumable upload.
+// Path is the object path in the bucket.
+// Uploaded is the number of bytes stored on the server.
+// Total is the object size in bytes.
+// Resumed is true if the upload continued a previous upload.
+//
+// Used in:
+// - ResumableOptions.OnProgress - called after each chunk
+type UploadProgress struct {
+	Path     string
+	Uploaded int64
+	Total    int64
+	Resumed  bool
+}
+
+// ResumableOptions configures a ResumableUploader.
+// ChunkSize is the size of each PATCH request in bytes (default 6 MiB, required by Supabase Storage).
+// Concurrency is the maximum number of uploads running at once (default 4); other uploads wait.
+// Retries is the number of retries per chunk after network or server errors (default 3; -1 disables retries).
+// RetryDelay is the delay before the first retry, doubled after each retry (default 1 second).
+// Store persists upload URLs so uploads resume after a restart (default in-memory, resuming within the process only).
+// OnProgress is called after the upload is created or resumed and after each chunk (optional).
+//
+// Used in:
+// - BucketClient.Resumable() - configures the uploader
+type ResumableOptions struct {
+	ChunkSize   int64
+	Concurrency int
+	Retries     int
+	RetryDelay  time.Duration
+	Store       UploadURLStore
+	OnProgress  func(UploadProgress)
+}
+
+// ResumableUploader uploads large objects with the TUS 1.0 protocol.
+// Interrupted uploads continue from the last offset stored on the server.
+// bucket is the bucket client providing credentials and the project URL.
+// opts are the uploader options with defaults applied.
+// slots bounds the number of concurrent uploads.
+//
+// Used in:
+// - BucketClient.Resumable() - creates uploaders
+type ResumableUploader struct {
+	bucket *BucketClient
+	opts   ResumableOptions
+	slots  chan struct{}
+}
+
+// Resumable returns a TUS uploader for the bucket.
+// opts are the uploader options (zero values use the defaults).
+func (b *BucketClient) Resumable(opts ResumableOptions) *ResumableUploader {
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = DefaultResumableChunkSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultResumableConcurrency
+	}
+	if opts.Retries == 0 {
+		opts.Retries = DefaultResumableRetries
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultResumableRetryDelay
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryUploadURLStore()
+	}
+
+	return &ResumableUploader{bucket: b, opts: opts, slots: make(chan struct{}, opts.Concurrency)}
+}
+
+// Upload uploads an object, resuming a previous upload of the same path, size and content if one is stored.
+// Waits for a free slot when Concurrency uploads are already running.
+// ctx is the context for cancellation; a cancelled upload can be resumed later.
+// path is the object path in the bucket.
+// src is the object content, read by offset so chunks can be retried (e.g., *os.File).
+// size is the object size in bytes.
+// opts are the content type, cache control, upsert and fingerprint settings (ContentLength is ignored).
+// Returns nil once the whole object is stored, or an error.
+func (u *ResumableUploader) Upload(ctx context.Context, path string, src io.ReaderAt, size int64, opts UploadOptions) error {
+	var (
+		fingerprint string
+		uploadURL   string
+		offset      int64
+		resumed     bool
+		err         error
+	)
+
+	fingerprint, err = u.Fingerprint(path, src, size, opts)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case u.slots <- struct{}{}:
+		defer func() { <-u.slots }()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	uploadURL, offset, resumed, err = u.resume(ctx, fingerprint)
+	if err != nil {
+		return err
+	}
+	if !resumed {
+		uploadURL, err = u.create(ctx, path, size, opts)
+		if err != nil {
+			return err
+		}
+		if err = u.opts.Store.Set(fingerprint, uploadURL); err != nil {
+			Logf("Storage", "Failed to persist upload URL - Path: %s, Error: %v", path, err)
+		}
+	}
+
+	Logf("Storage", "Resumable upload - Bucket: %s, Path: %s, Offset: %d/%d, Resumed: %t", u.bucket.bucket, path, offset, size, resumed)
+	u.progress(path, offset, size, resumed)
+
+	for offset < size {
+		offset, err = u.sendChunk(ctx, uploadURL, src, offset, size)
+		if errors.Is(err, ErrUploadExpired) {
+			u.opts.Store.Delete(fingerprint)
+			return err
+		}
+		if err != nil {
+			Logf("Storage", "Resumable upload interrupted - Path: %s, Offset: %d/%d, Error: %v", path, offset, size, err)
+			return err
+		}
+		u.progress(path, offset, size, resumed)
+	}
+
+	if err = u.opts.Store.Delete(fingerprint); err != nil {
+		Logf("Storage", "Failed to delete upload URL - Path: %s, Error: %v", path, err)
+	}
+	Logf("Storage", "Resumable upload complete - Bucket: %s, Path: %s, Size: %d", u.bucket.bucket, path, size)
+
+	return nil
+}
+
+// Fingerprint returns the key identifying an upload in the store (bucket, path, size and content).
+// The content is identified by opts.Fingerprint, or by the SHA-256 of the whole of src when empty,
+// so a changed file of the same size never resumes the upload of its previous content.
+// Hashing reads src once more before uploading; set opts.Fingerprint (e.g., a stored hash, or mtime and inode)
+// to avoid it, making sure it changes whenever the content does.
+// path is the object path in the bucket.
+// src is the object content.
+// size is the object size in bytes.
+// opts are the upload options of the object.
+// Returns the fingerprint or an error if the content cannot be read.
+func (u *ResumableUploader) Fingerprint(path string, src io.ReaderAt, size int64, opts UploadOptions) (string, error) {
+	var (
+		content = opts.Fingerprint
+		hash    = sha256.New()
+	)
+
+	if content == "" {
+		if _, err := io.Copy(hash, io.NewSectionReader(src, 0, size)); err != nil {
+			return "", fmt.Errorf("failed to read upload content: %w", err)
+		}
+		content = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	return fmt.Sprintf("%s/%s/%s:%d:%s", u.bucket.storage.service.ProjectURL, u.bucket.bucket, strings.Trim(path, "/"), size, content), nil
+}
+
+// resume looks up a stored upload URL and asks the server for its offset.
+// Returns the URL and offset with resumed set, or resumed false if a new upload must be created.
+func (u *ResumableUploader) resume(ctx context.Context, fingerprint string) (string, int64, bool, error) {
+	var (
+		uploadURL string
+		offset    int64
+		found     bool
+		err       error
+	)
+
+	uploadURL, found, err = u.opts.Store.Get(fingerprint)
+	if err != nil || !found {
+		return "", 0, false, err
+	}
+
+	offset, err = u.headOffset(ctx, uploadURL)
+	if errors.Is(err, ErrUploadExpired) {
+		Log("Storage", "Stored upload expired, starting a new upload")
+		u.opts.Store.Delete(fingerprint)
+		return "", 0, false, nil
+	}
+	if err != nil {
+		return "", 0, false, err
+	}
+
+	return uploadURL, offset, true, nil
+}
+
+// create starts a TUS upload (POST) and returns its absolute upload URL.
+func (u *ResumableUploader) create(ctx context.Context, path string, size int64, opts UploadOptions) (string, error) {
+	var (
+		endpoint = u.bucket.storage.service.ProjectURL + StorageResumablePath
+		metadata []string
+		req      *http.Request
+		resp     *http.Response
+		location *url.URL
+		base     *url.URL
+		err      error
+	)
+
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	metadata = []string{
+		"bucketName " + base64.StdEncoding.EncodeToString([]byte(u.bucket.bucket)),
+		"objectName " + base64.StdEncoding.EncodeToString([]byte(strings.Trim(path, "/"))),
+		"contentType " + base64.StdEncoding.EncodeToString([]byte(opts.ContentType)),
+	}
+	if opts.CacheControl > 0 {
+		metadata = append(metadata, "cacheControl "+base64.StdEncoding.EncodeToString([]byte(strconv.Itoa(int(opts.CacheControl.Seconds())))))
+	}
+
+	req, err = u.bucket.storage.newRequest(ctx, http.MethodPost, StorageResumablePath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Tus-Resumable", TusVersion)
+	req.Header.Set("Upload-Length", strconv.FormatInt(size, 10))
+	req.Header.Set("Upload-Metadata", strings.Join(metadata, ","))
+	if opts.Upsert {
+		req.Header.Set("x-upsert", "true")
+	}
+
+	resp, err = u.send(req)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", fmt.Errorf("%w: expected 201 Created, got %d", ErrInvalidStatus, resp.StatusCode)
+	}
+
+	location, err = url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return "", fmt.Errorf("%w: invalid upload location %q", ErrInvalidStatus, resp.Header.Get("Location"))
+	}
+	base, _ = url.Parse(endpoint)
+
+	return base.ResolveReference(location).String(), nil
+}
+
+// sendChunk uploads one chunk (PATCH), retrying after network or server errors.
+// Before each retry the server offset is fetched with HEAD, so bytes already stored are not resent.
+// Returns the new offset, or the last known offset with an error.
+func (u *ResumableUploader) sendChunk(ctx context.Context, uploadURL string, src io.ReaderAt, offset, size int64) (int64, error) {
+	var (
+		delay = u.opts.RetryDelay
+		next  int64
+		err   error
+	)
+
+	for attempt := 0; ; attempt++ {
+		next, err = u.patch(ctx, uploadURL, src, offset, size)
+		if err == nil {
+			return next, nil
+		}
+		if ctx.Err() != nil || errors.Is(err, ErrUploadExpired) || !retryableUploadError(err) || attempt >= u.opts.Retries {
+			return offset, err
+		}
+
+		Logf("Storage", "Chunk upload failed, retrying in %s - Offset: %d, Error: %v", delay, offset, err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return offset, ctx.Err()
+		}
+		delay *= 2
+
+		// the server may have stored part of the failed chunk
+		if recovered, headErr := u.headOffset(ctx, uploadURL); headErr == nil {
+			offset = recovered
+			if offset >= size {
+				return offset, nil
+			}
+		} else if errors.Is(headErr, ErrUploadExpired) {
+			return offset, headErr
+		}
+	}
+}
+
+// patch sends the chunk starting at offset and returns the new server offset.
+func (u *ResumableUploader) patch(ctx context.Context, uploadURL string, src io.ReaderAt, offset, size int64) (int64, error) {
+	var (
+		length = min(u.opts.ChunkSize, size-offset)
+		req    *http.Request
+		resp   *http.Response
+		next   int64
+		err    error
+	)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodPatch, uploadURL, io.NewSectionReader(src, offset, length))
+	if err != nil {
+		return offset, fmt.Errorf("%w: %w", ErrCreateRequest, err)
+	}
+	u.setHeaders(req)
+	req.ContentLength = length
+	req.Header.Set(HeaderContentType, "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+
+	resp, err = u.send(req)
+	if err != nil {
+		return offset, err
+	}
+
+	next, err = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || next <= offset || next > size {
+		return offset, fmt.Errorf("%w: server offset %q after sending %d bytes at %d", ErrUploadOffsetMismatch, resp.Header.Get("Upload-Offset"), length, offset)
+	}
+
+	return next, nil
+}
+
+// headOffset asks the server for the current offset of an upload (HEAD).
+// Returns ErrUploadExpired if the upload no longer exists.
+func (u *ResumableUploader) headOffset(ctx context.Context, uploadURL string) (int64, error) {
+	var (
+		req    *http.Request
+		resp   *http.Response
+		offset int64
+		err    error
+	)
+
+	req, err = http.NewRequestWithContext(ctx, http.MethodHead, uploadURL, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrCreateRequest, err)
+	}
+	u.setHeaders(req)
+
+	resp, err = u.send(req)
+	if err != nil {
+		return 0, err
+	}
+
+	offset, err = strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid Upload-Offset %q", ErrUploadOffsetMismatch, resp.Header.Get("Upload-Offset"))
+	}
+
+	return offset, nil
+}
+
+// send runs a TUS request and converts error statuses.
+// Returns ErrUploadExpired for 404 and 410 on upload URLs, and a *StorageError or *APIError for other non-2xx statuses.
+func (u *ResumableUploader) send(req *http.Request) (*http.Response, error) {
+	resp, bodyBytes, err := u.bucket.storage.service.doHTTP(req, StorageResumablePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		if req.Method != http.MethodPost && (resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone) {
+			return nil, ErrUploadExpired
+		}
+		return nil, parseStorageError(resp.StatusCode, bodyBytes)
+	}
+
+	return resp, nil
+}
+
+// setHeaders sets the TUS and credential headers on requests to an upload URL.
+func (u *ResumableUploader) setHeaders(req *http.Request) {
+	req.Header.Set("Tus-Resumable", TusVersion)
+	req.Header.Set(HeaderAPIKey, u.bucket.storage.apiKey)
+	req.Header.Set(HeaderAuthorization, "Bearer "+u.bucket.storage.token)
+}
+
+// progress calls OnProgress when set.
+func (u *ResumableUploader) progress(path string, uploaded, total int64, resumed bool) {
+	if u.opts.OnProgress != nil {
+		u.opts.OnProgress(UploadProgress{Path: path, Uploaded: uploaded, Total: total, Resumed: resumed})
+	}
+}
+
+// retryableUploadError reports whether a chunk can be retried (network errors, offset conflicts, 5xx and 423 Locked).
+func retryableUploadError(err error) bool {
+	var (
+		storageErr *StorageError
+		apiErr     *APIError
+		statusCode int
+	)
+
+	switch {
+	case errors.As(err, &storageErr):
+		statusCode = storageErr.StatusCode
+	case errors.As(err, &apiErr):
+		statusCode = apiErr.StatusCode
+	default:
+		return true
+	}
+
+	return statusCode >= 500 || statusCode == http.StatusConflict || statusCode == http.StatusLocked
+}
+
+// MemoryUploadURLStore keeps upload URLs in memory; uploads only resume within the process.
+// mu guards urls.
+// urls maps fingerprints to upload URLs.
+//
+// Used in:
+// - ResumableOptions.Store - default store
+type MemoryUploadURLStore struct {
+	mu   sync.Mutex
+	urls map[string]string
+}
+
+// NewMemoryUploadURLStore creates an empty in-memory upload URL store.
+func NewMemoryUploadURLStore() *MemoryUploadURLStore {
+	return &MemoryUploadURLStore{urls: make(map[string]string)}
+}
+
+// Get returns the upload URL stored for fingerprint.
+func (m *MemoryUploadURLStore) Get(fingerprint string) (string, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	uploadURL, found := m.urls[fingerprint]
+	return uploadURL, found, nil
+}
+
+// Set stores the upload URL for fingerprint.
+func (m *MemoryUploadURLStore) Set(fingerprint, uploadURL string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.urls[fingerprint] = uploadURL
+	return nil
+}
+
+// Delete removes the upload URL of fingerprint.
+func (m *MemoryUploadURLStore) Delete(fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.urls, fingerprint)
+	return nil
+}
+
+// FileUploadURLStore keeps upload URLs in a JSON file so uploads resume after a process restart.
+// The file is rewritten atomically (temporary file, fsync, rename) with 0600 permissions on each change.
+// path is the JSON file path.
+// mu serializes file access within the process.
+//
+// Used in:
+// - ResumableOptions.Store - persistent store
+type FileUploadURLStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileUploadURLStore creates a store backed by a JSON file (created on first write).
+// path is the JSON file path.
+func NewFileUploadURLStore(path string) *FileUploadURLStore {
+	return &FileUploadURLStore{path: path}
+}
+
+// Get returns the upload URL stored for fingerprint.
+func (f *FileUploadURLStore) Get(fingerprint string) (string, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	urls, err := f.read()
+	if err != nil {
+		return "", false, err
+	}
+	uploadURL, found := urls[fingerprint]
+
+	return uploadURL, found, nil
+}
+
+// Set stores the upload URL for fingerprint.
+func (f *FileUploadURLStore) Set(fingerprint, uploadURL string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	urls, err := f.read()
+	if err != nil {
+		return err
+	}
+	urls[fingerprint] = uploadURL
+
+	return f.write(urls)
+}
+
+// Delete removes the upload URL of fingerprint.
+func (f *FileUploadURLStore) Delete(fingerprint string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	urls, err := f.read()
+	if err != nil {
+		return err
+	}
+	if _, found := urls[fingerprint]; !found {
+		return nil
+	}
+	delete(urls, fingerprint)
+
+	return f.write(urls)
+}
+
+// read loads the stored URLs (empty if the file does not exist).
+func (f *FileUploadURLStore) read() (map[string]string, error) {
+	var (
+		urls    = make(map[string]string)
+		content []byte
+		err     error
+	)
+
+	content, err = os.ReadFile(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return urls, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(content, &urls); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+
+	return urls, nil
+}
+
+// write replaces the file with urls.
+func (f *FileUploadURLStore) write(urls map[string]string) error {
+	var (
+		content []byte
+		tmp     *os.File
+		err     error
+	)
+
+	content, err = json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+
+	// write to a temporary file in the same directory so rename is atomic
+	tmp, err = os.CreateTemp(filepath.Dir(f.path), ".ft_supabase-uploads-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), f.path)
+}
@@ -0,0 +1,200 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// mockTusServer is a local TUS 1.0 stand-in for the Storage resumable endpoint.
+// mu guards uploads and failNext.
+// uploads maps upload IDs to received bytes.
+// failNext makes the next PATCH store half of its chunk and answer 500.
+// creates counts created uploads.
+// active and maxActive track concurrent PATCH requests.
+type mockTusServer struct {
+	mu        sync.Mutex
+	uploads   map[string][]byte
+	failNext  bool
+	creates   atomic.Int32
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+// handle serves the TUS requests.
+func (m *mockTusServer) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Tus-Resumable") != TusVersion || r.Header.Get("Authorization") == "" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, StorageResumablePath+"/")
+
+	switch r.Method {
+	case http.MethodPost:
+		if !strings.Contains(r.Header.Get("Upload-Metadata"), "bucketName dmlkZW9z") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		id = strconv.Itoa(int(m.creates.Add(1)))
+		m.mu.Lock()
+		m.uploads[id] = []byte{}
+		m.mu.Unlock()
+		w.Header().Set("Location", StorageResumablePath+"/"+id)
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead:
+		m.mu.Lock()
+		data, exists := m.uploads[id]
+		m.mu.Unlock()
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(data)))
+	case http.MethodPatch:
+		if active := m.active.Add(1); active > m.maxActive.Load() {
+			m.maxActive.Store(active)
+		}
+		defer m.active.Add(-1)
+		time.Sleep(5 * time.Millisecond)
+
+		chunk, _ := io.ReadAll(r.Body)
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if strconv.Itoa(len(m.uploads[id])) != r.Header.Get("Upload-Offset") {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		if m.failNext {
+			m.failNext = false
+			m.uploads[id] = append(m.uploads[id], chunk[:len(chunk)/2]...)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		m.uploads[id] = append(m.uploads[id], chunk...)
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(m.uploads[id])))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// TestResumableUpload tests chunked uploads, HEAD offset recovery, resuming after a restart and bounded concurrency.
+func TestResumableUpload(t *testing.T) {
+	var (
+		testName     = "TestResumableUpload"
+		tus          = &mockTusServer{uploads: make(map[string][]byte)}
+		server       *httptest.Server
+		service      *Service
+		bucket       *BucketClient
+		content      = []byte(strings.Repeat("0123456789", 5))
+		progress     []UploadProgress
+		storePath    string
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+	server = httptest.NewServer(http.HandlerFunc(tus.handle))
+	defer server.Close()
+	service = NewService("mock", server.URL, "anon", "service")
+	bucket = service.Storage(StorageOptions{Token: "user-token"}).From("videos")
+	storePath = filepath.Join(t.TempDir(), "uploads.json")
+
+	// execute: a failing chunk is recovered with HEAD and only the missing bytes are resent
+	tus.failNext = true
+	err = bucket.Resumable(ResumableOptions{ChunkSize: 20, RetryDelay: time.Millisecond, OnProgress: func(p UploadProgress) {
+		progress = append(progress, p)
+	}}).Upload(ctx, "a.mp4", bytes.NewReader(content), int64(len(content)), UploadOptions{ContentType: "video/mp4"})
+	if err != nil || !bytes.Equal(tus.uploads["1"], content) || len(progress) == 0 || progress[len(progress)-1].Uploaded != int64(len(content)) {
+		errorMessage = fmt.Sprintf("Unexpected recovered upload (err: %v, stored: %q, progress: %+v)", err, tus.uploads["1"], progress)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Failed chunks resume from the server offset\n")
+
+	// execute: an interrupted upload resumes with a new uploader and store sharing the same file
+	cancelCtx, cancel := context.WithCancel(ctx)
+	err = bucket.Resumable(ResumableOptions{ChunkSize: 20, Store: NewFileUploadURLStore(storePath), OnProgress: func(p UploadProgress) {
+		if p.Uploaded > 0 {
+			cancel()
+		}
+	}}).Upload(cancelCtx, "b.mp4", bytes.NewReader(content), int64(len(content)), UploadOptions{})
+	cancel()
+	if !errors.Is(err, context.Canceled) || len(tus.uploads["2"]) != 20 {
+		errorMessage = fmt.Sprintf("Expected an interrupted upload (err: %v, stored: %d bytes)", err, len(tus.uploads["2"]))
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	progress = nil
+	store := NewFileUploadURLStore(storePath)
+	err = bucket.Resumable(ResumableOptions{ChunkSize: 20, Store: store, OnProgress: func(p UploadProgress) {
+		progress = append(progress, p)
+	}}).Upload(ctx, "b.mp4", bytes.NewReader(content), int64(len(content)), UploadOptions{})
+	fingerprint, _ := bucket.Resumable(ResumableOptions{ChunkSize: 20}).Fingerprint("b.mp4", bytes.NewReader(content), int64(len(content)), UploadOptions{})
+	_, stillStored, _ := store.Get(fingerprint)
+	if err != nil || tus.creates.Load() != 2 || !bytes.Equal(tus.uploads["2"], content) || !progress[0].Resumed || progress[0].Uploaded != 20 || stillStored {
+		errorMessage = fmt.Sprintf("Expected the upload to resume at 20 bytes (err: %v, creates: %d, progress: %+v, stored: %t)", err, tus.creates.Load(), progress, stillStored)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Uploads resume after a restart from the persisted store\n")
+
+	// execute: a file of the same size differing only after the first chunk starts a new upload instead of resuming
+	other := bytes.Clone(content)
+	other[len(other)-1] = 'X'
+	cancelCtx, cancel = context.WithCancel(ctx)
+	bucket.Resumable(ResumableOptions{ChunkSize: 20, Store: store, OnProgress: func(p UploadProgress) {
+		if p.Uploaded > 0 {
+			cancel()
+		}
+	}}).Upload(cancelCtx, "d.mp4", bytes.NewReader(content), int64(len(content)), UploadOptions{})
+	cancel()
+	progress = nil
+	err = bucket.Resumable(ResumableOptions{ChunkSize: 20, Store: store, OnProgress: func(p UploadProgress) {
+		progress = append(progress, p)
+	}}).Upload(ctx, "d.mp4", bytes.NewReader(other), int64(len(other)), UploadOptions{})
+	if err != nil || tus.creates.Load() != 4 || !bytes.Equal(tus.uploads["4"], other) || progress[0].Resumed {
+		errorMessage = fmt.Sprintf("Expected a new upload for different content (err: %v, creates: %d, stored: %q)", err, tus.creates.Load(), tus.uploads["4"])
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Same-size files with different content do not resume each other\n")
+
+	// execute: concurrent uploads are bounded
+	var wg sync.WaitGroup
+	uploader := bucket.Resumable(ResumableOptions{ChunkSize: 10, Concurrency: 2})
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uploader.Upload(ctx, fmt.Sprintf("c%d.mp4", i), bytes.NewReader(content), int64(len(content)), UploadOptions{})
+		}(i)
+	}
+	wg.Wait()
+	if tus.maxActive.Load() > 2 || tus.creates.Load() != 10 {
+		errorMessage = fmt.Sprintf("Expected at most 2 concurrent uploads (max: %d, creates: %d)", tus.maxActive.Load(), tus.creates.Load())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Concurrent uploads are bounded\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,362 @@
+package ft_supabase
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"github.com/google/uuid"
+)
+
+// RoleSource selects the metadata object the application role is read from.
+//
+// Used in:
+// - Service.RoleSource - configures where roles come from
+// - RegisterUser(), LoginUser(), RefreshToken(), UpdateUser(), ValidateToken() - read roles
+type RoleSource string
+
+const (
+	// RoleSourceAppMetadata reads the role from app_metadata, writable only with the service key (default).
+	RoleSourceAppMetadata RoleSource = "app_metadata"
+
+	// RoleSourceUserMetadata reads the role from user_metadata, which users can overwrite themselves.
+	// Only use it for applications where roles grant no privileges.
+	RoleSourceUserMetadata RoleSource = "user_metadata"
+
+	// RoleSourceAppMetadataFallback reads app_metadata and falls back to user_metadata when it has no role.
+	// Meant for the migration period only (see MigrateRoles()): users without an app_metadata role can still pick their own.
+	RoleSourceAppMetadataFallback RoleSource = "app_metadata_fallback"
+)
+
+// Sentinel errors for role assignments and migrations.
+var (
+	ErrRoleMigrationPolicy = errors.New("role migration requires an Allow callback")
+	ErrRoleNotApplied      = errors.New("user registered but role was not applied")
+)
+
+// roleMetadataKey is the metadata key holding the application role.
+const roleMetadataKey = "role"
+
+// AdminUpdateUserRequest represents the request payload of the admin user update endpoint.
+// AppMetadata contains the app_metadata keys to set (null removes a key).
+// UserMetadata contains the user_metadata keys to set (null removes a key).
+//
+// Used in:
+// - SetAppMetadata() - updates app_metadata
+// - MigrateRole() - moves a role from user_metadata to app_metadata
+type AdminUpdateUserRequest struct {
+	AppMetadata  map[string]any `json:"app_metadata,omitempty"`
+	UserMetadata map[string]any `json:"user_metadata,omitempty"`
+}
+
+// role returns the application role of a user according to the role source.
+// appMetadata is the user's app_metadata.
+// userMetadata is the user's user_metadata.
+// An empty source reads app_metadata.
+// Returns the role or an empty string if none is set.
+func (source RoleSource) role(appMetadata, userMetadata map[string]any) string {
+	var (
+		role string
+	)
+
+	switch source {
+	case RoleSourceUserMetadata:
+		role, _ = getStringMetadata(userMetadata, roleMetadataKey)
+	case RoleSourceAppMetadataFallback:
+		role, _ = getStringMetadata(appMetadata, roleMetadataKey)
+		if role == "" {
+			role, _ = getStringMetadata(userMetadata, roleMetadataKey)
+		}
+	default:
+		role, _ = getStringMetadata(appMetadata, roleMetadataKey)
+	}
+
+	return role
+}
+
+// GetAppMetadata decodes the raw app_metadata of a user into M (e.g., roles, plans, tenant claims).
+// user is a User returned by the Service.
+// Returns the decoded metadata or an error wrapping ErrInvalidMetadata if it does not fit M.
+func GetAppMetadata[M any](user *User) (M, error) {
+	var (
+		metadata M
+	)
+
+	if user == nil {
+		return metadata, ErrUserNotFound
+	}
+
+	return DecodeMetadata[M](user.AppMetadata)
+}
+
+// SetAppMetadata updates a user's app_metadata through the Admin API and refreshes the cache.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user unique identifier (UUID).
+// data contains the app_metadata keys to set; Supabase merges them into app_metadata and removes keys set to nil.
+// Cached sessions get the new role and app metadata at once; access tokens carry them after their next refresh.
+// Returns the updated User or an error if the update fails.
+// Note: Requires service role key for admin operations.
+func (s *Service) SetAppMetadata(ctx context.Context, userID uuid.UUID, data map[string]any) (*User, error) {
+	Logf("SetAppMetadata", "Updating app metadata - UserID: %s, Keys: %d", userID.String(), len(data))
+
+	return s.adminUpdateUser(ctx, userID, AdminUpdateUserRequest{AppMetadata: data})
+}
+
+// SetRole sets a user's application role in app_metadata.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user unique identifier (UUID).
+// role is the new role; an empty role removes it.
+// Returns the updated User or an error if the update fails.
+// Note: Requires service role key for admin operations.
+func (s *Service) SetRole(ctx context.Context, userID uuid.UUID, role string) (*User, error) {
+	var (
+		value any
+	)
+
+	if role != "" {
+		value = role
+	}
+
+	return s.SetAppMetadata(ctx, userID, map[string]any{roleMetadataKey: value})
+}
+
+// RoleMigrationAction is what a role migration does with a user's user_metadata role.
+//
+// Used in:
+// - RoleMigration.Action - reports the decision for one user
+type RoleMigrationAction string
+
+const (
+	// RoleMigrationPromote copies the user_metadata role to app_metadata and removes it from user_metadata.
+	RoleMigrationPromote RoleMigrationAction = "promote"
+
+	// RoleMigrationKeep keeps the existing app_metadata role and removes the user_metadata role.
+	RoleMigrationKeep RoleMigrationAction = "keep"
+
+	// RoleMigrationReject removes the user_metadata role without promoting it (Allow returned false).
+	RoleMigrationReject RoleMigrationAction = "reject"
+)
+
+// RoleMigrationOptions configures MigrateRole() and MigrateRoles().
+// Allow decides whether a self-assigned user_metadata role may become the user's authoritative role (required).
+// user_metadata roles were writable by every user, so never allow privileged roles without checking them elsewhere.
+// DryRun only reports what would change, without updating any user.
+//
+// Used in:
+// - MigrateRole(), MigrateRoles() - configure the migration
+type RoleMigrationOptions struct {
+	Allow  func(user SupabaseUser, role string) bool
+	DryRun bool
+}
+
+// RoleMigration reports the migration of one user's user_metadata role.
+// UserID is the Supabase user unique identifier (UUID).
+// Email is the user's email address.
+// Role is the user_metadata role found.
+// AppRole is the app_metadata role before the migration (empty if none).
+// Action is what the migration does with Role.
+// Applied is true once the user was updated (always false in dry-run mode).
+//
+// Used in:
+// - MigrateRole(), MigrateRoles() - report each migrated user
+type RoleMigration struct {
+	UserID  uuid.UUID           `json:"user_id"`
+	Email   string              `json:"email"`
+	Role    string              `json:"role"`
+	AppRole string              `json:"app_role,omitempty"`
+	Action  RoleMigrationAction `json:"action"`
+	Applied bool                `json:"applied"`
+}
+
+// AllowRoles returns a RoleMigrationOptions.Allow callback accepting only the listed roles.
+// roles are the roles that may be promoted to app_metadata (e.g., "user", "viewer").
+func AllowRoles(roles ...string) func(user SupabaseUser, role string) bool {
+	return func(user SupabaseUser, role string) bool {
+		return slices.Contains(roles, role)
+	}
+}
+
+// MigrateRole moves a user's role from user_metadata to app_metadata.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user unique identifier (UUID).
+// opts decides which roles are promoted and enables dry runs.
+// An existing app_metadata role is kept; the user_metadata role is removed unless opts.DryRun is set.
+// Returns the migration report, nil if the user has no user_metadata role, or an error if the request fails.
+// Note: Requires service role key for admin operations.
+func (s *Service) MigrateRole(ctx context.Context, userID uuid.UUID, opts RoleMigrationOptions) (*RoleMigration, error) {
+	var (
+		supabaseUser SupabaseUser
+		err          error
+	)
+
+	if opts.Allow == nil {
+		return nil, ErrRoleMigrationPolicy
+	}
+
+	supabaseUser, err = s.getAdminSupabaseUser(ctx, userID.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return s.migrateRole(ctx, supabaseUser, opts)
+}
+
+// MigrateRoles moves the user_metadata role of every user to app_metadata (see MigrateRole()).
+// ctx is the context for request cancellation and timeout.
+// opts decides which roles are promoted and enables dry runs.
+// Pages through all users of the project with the Admin API; safe to run again after a failure.
+// Returns the reports of the users holding a user_metadata role (those handled before a failure included)
+// or an error if a request fails.
+// Note: Requires service role key for admin operations.
+func (s *Service) MigrateRoles(ctx context.Context, opts RoleMigrationOptions) ([]RoleMigration, error) {
+	var (
+		endpoint   string
+		bodyBytes  []byte
+		listResp   SupabaseAdminUsersResponse
+		migration  *RoleMigration
+		migrations []RoleMigration
+		err        error
+	)
+
+	if opts.Allow == nil {
+		return nil, ErrRoleMigrationPolicy
+	}
+
+	Logf("MigrateRoles", "Migrating user_metadata roles to app_metadata - DryRun: %t", opts.DryRun)
+
+	for page := 1; ; page++ {
+		endpoint = fmt.Sprintf("%s%s?page=%d&per_page=%d", s.ProjectURL, AdminUsersPath, page, adminUsersPerPage)
+		bodyBytes, err = s.sendRequest(ctx, AdminUsersPath, "GET", endpoint, nil, s.getServiceHeaders())
+		if err != nil {
+			Logf("MigrateRoles", "Failed to list users (page %d): %v", page, err)
+			return migrations, err
+		}
+
+		listResp = SupabaseAdminUsersResponse{}
+		if err = json.Unmarshal(bodyBytes, &listResp); err != nil {
+			return migrations, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+		}
+
+		for _, supabaseUser := range listResp.Users {
+			migration, err = s.migrateRole(ctx, supabaseUser, opts)
+			if migration != nil {
+				migrations = append(migrations, *migration)
+			}
+			if err != nil {
+				return migrations, err
+			}
+		}
+
+		if len(listResp.Users) < adminUsersPerPage {
+			break
+		}
+	}
+
+	Logf("MigrateRoles", "Handled %d user_metadata roles", len(migrations))
+	return migrations, nil
+}
+
+// migrateRole moves the user_metadata role of a user object to app_metadata.
+// ctx is the context for request cancellation and timeout.
+// supabaseUser is the user as returned by the Admin API.
+// opts decides which roles are promoted and enables dry runs.
+// Returns the migration report, nil if the user has no user_metadata role, or an error if the update fails
+// (the report is returned with Applied false).
+func (s *Service) migrateRole(ctx context.Context, supabaseUser SupabaseUser, opts RoleMigrationOptions) (*RoleMigration, error) {
+	var (
+		migration RoleMigration
+		request   AdminUpdateUserRequest
+		err       error
+	)
+
+	migration.Role, _ = getStringMetadata(supabaseUser.UserMetadata, roleMetadataKey)
+	if migration.Role == "" {
+		return nil, nil
+	}
+
+	migration.UserID, err = uuid.Parse(supabaseUser.ID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid user ID format: %w", err)
+	}
+	migration.Email = supabaseUser.Email
+	migration.AppRole, _ = getStringMetadata(supabaseUser.AppMetadata, roleMetadataKey)
+
+	// an existing authoritative role wins, self-assigned roles are only promoted when allowed
+	request.UserMetadata = map[string]any{roleMetadataKey: nil}
+	switch {
+	case migration.AppRole != "":
+		migration.Action = RoleMigrationKeep
+	case opts.Allow(supabaseUser, migration.Role):
+		migration.Action = RoleMigrationPromote
+		request.AppMetadata = map[string]any{roleMetadataKey: migration.Role}
+	default:
+		migration.Action = RoleMigrationReject
+	}
+
+	Logf("migrateRole", "Role migration - UserID: %s, Role: %s, AppRole: %s, Action: %s, DryRun: %t", supabaseUser.ID, migration.Role, migration.AppRole, migration.Action, opts.DryRun)
+
+	if opts.DryRun {
+		return &migration, nil
+	}
+
+	_, err = s.adminUpdateUser(ctx, migration.UserID, request)
+	if err != nil {
+		return &migration, err
+	}
+	migration.Applied = true
+
+	return &migration, nil
+}
+
+// adminUpdateUser updates a user through the Admin API and refreshes the cache.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user unique identifier (UUID).
+// request contains the metadata keys to set.
+// Returns the updated User or an error if the update fails.
+func (s *Service) adminUpdateUser(ctx context.Context, userID uuid.UUID, request AdminUpdateUserRequest) (*User, error) {
+	var (
+		cachedUser   *CachedUser
+		found        bool
+		endpoint     string
+		bodyBytes    []byte
+		supabaseUser SupabaseUser
+		user         *User
+		err          error
+	)
+
+	endpoint = fmt.Sprintf("%s%s/%s", s.ProjectURL, AdminUsersPath, url.PathEscape(userID.String()))
+	bodyBytes, err = s.sendRequest(ctx, AdminUsersPath, "PUT", endpoint, request, s.getServiceHeaders())
+	if err != nil {
+		Logf("adminUpdateUser", "Failed to update user %s: %v", userID.String(), err)
+		return nil, err
+	}
+
+	if err = json.Unmarshal(bodyBytes, &supabaseUser); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+	user, err = userFromSupabase(supabaseUser, s.RoleSource)
+	if err != nil {
+		return nil, err
+	}
+
+	// update every cached session of the user with new values
+	cachedUser, found = s.Cache.GetByUserID(userID)
+	s.Cache.Update(userID, func(session *CachedUser) {
+		session.Role = user.Role
+		session.AppMetadata = user.AppMetadata
+		session.Metadata = user.Metadata
+	})
+
+	// let other replicas refresh their cached sessions
+	invalidation := InvalidationEvent{Type: InvalidateUpdate, UserID: userID, User: user}
+	if found && user.Role != cachedUser.Role {
+		invalidation.Type = InvalidateRoleChange
+	}
+	s.publishInvalidation(ctx, invalidation)
+
+	Logf("adminUpdateUser", "Successfully updated user - ID: %s, Role: %s", userID.String(), user.Role)
+	return user, nil
+}
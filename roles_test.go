@@ -0,0 +1,133 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestRoleSource tests that roles come from app_metadata, are set with the service key and can be migrated.
+func TestRoleSource(t *testing.T) {
+	var (
+		testName     = "TestRoleSource"
+		service      *Service
+		server       *mockAuthServer
+		ctx          = context.Background()
+		login        *LoginResponse
+		user         *User
+		cachedUser   *CachedUser
+		migrations   []RoleMigration
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: the mock user has role "user" in app_metadata
+	service, _, server = newMockService()
+	login, err = service.LoginUser(ctx, server.email, "password")
+	if err != nil || login.Role != "user" {
+		errorMessage = fmt.Sprintf("Login should read the app_metadata role (err: %v, role: %+v)", err, login)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// execute: a user_metadata role written by the user grants nothing
+	user, err = service.UpdateUser(ctx, server.userID, map[string]any{"role": "admin"})
+	cachedUser, _ = service.Cache.Get(login.Token)
+	if err != nil || user.Role != "user" || cachedUser.Role != "user" {
+		errorMessage = fmt.Sprintf("Self-assigned role should be ignored (err: %v, role: %s)", err, cachedUser.Role)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Self-assigned user_metadata roles are ignored\n")
+
+	// execute: the service key sets the authoritative role
+	user, err = service.SetRole(ctx, server.userID, "editor")
+	cachedUser, _ = service.Cache.Get(login.Token)
+	if err != nil || user.Role != "editor" || cachedUser.Role != "editor" || cachedUser.AppMetadata["role"] != "editor" {
+		errorMessage = fmt.Sprintf("SetRole should update the user and its sessions (err: %v, role: %s)", err, cachedUser.Role)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ SetRole updates app_metadata and cached sessions\n")
+
+	// execute: locally verified tokens read the role from app_metadata claims
+	service.JWTSecret = []byte("super-secret")
+	signed := signTestJWT(TokenClaims{
+		Subject:      server.userID.String(),
+		ExpiresAt:    time.Now().Add(time.Hour).Unix(),
+		AppMetadata:  map[string]any{"role": "user"},
+		UserMetadata: map[string]any{"role": "admin"},
+	}, service.JWTSecret)
+	user, _, err = service.ValidateToken(ctx, signed)
+	if err != nil || user.Role != "user" {
+		errorMessage = fmt.Sprintf("Token claims should use the app_metadata role (err: %v, user: %+v)", err, user)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Token claims use the app_metadata role\n")
+
+	// execute: during migration the fallback source still honours user_metadata roles
+	service.SetRole(ctx, server.userID, "")
+	service.RoleSource = RoleSourceAppMetadataFallback
+	login, err = service.LoginUser(ctx, server.email, "password")
+	if err != nil || login.Role != "admin" {
+		errorMessage = fmt.Sprintf("Fallback source should read the user_metadata role (err: %v, role: %+v)", err, login)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// execute: migrations need a decision callback, and dry runs change nothing
+	_, err = service.MigrateRoles(ctx, RoleMigrationOptions{})
+	migrations, dryErr := service.MigrateRoles(ctx, RoleMigrationOptions{Allow: AllowRoles("user"), DryRun: true})
+	if !errors.Is(err, ErrRoleMigrationPolicy) || dryErr != nil || len(migrations) != 1 || migrations[0].Action != RoleMigrationReject || migrations[0].Applied || server.metadata["role"] != "admin" {
+		errorMessage = fmt.Sprintf("Dry run should report a rejected role without changes (err: %v, %v, migrations: %+v)", err, dryErr, migrations)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ MigrateRoles requires an Allow callback and supports dry runs\n")
+
+	// execute: MigrateRoles promotes allowed roles to app_metadata once
+	migrations, err = service.MigrateRoles(ctx, RoleMigrationOptions{Allow: AllowRoles("admin")})
+	if err == nil && len(migrations) == 1 && migrations[0].Action == RoleMigrationPromote && migrations[0].Applied {
+		migrations, err = service.MigrateRoles(ctx, RoleMigrationOptions{Allow: AllowRoles("admin")})
+	}
+	service.RoleSource = RoleSourceAppMetadata
+	login, _ = service.LoginUser(ctx, server.email, "password")
+	if err != nil || len(migrations) != 0 || login.Role != "admin" || server.metadata["role"] != nil {
+		errorMessage = fmt.Sprintf("MigrateRoles should move the role once (err: %v, second run: %+v, role: %s)", err, migrations, login.Role)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ MigrateRoles moves user_metadata roles to app_metadata\n")
+
+	// execute: a failed role assignment after signup still returns the created user
+	service, client, server := newMockService()
+	client.handler = func(method, url string, body any, headers map[string]string) ([]byte, error) {
+		if method == "PUT" && strings.Contains(url, AdminUsersPath+"/") {
+			return nil, &APIError{StatusCode: 503, Body: []byte(`{"msg":"unavailable"}`)}
+		}
+		return server.handle(method, url, body, headers)
+	}
+	registered, err := service.RegisterUser(ctx, server.email, "password", "", UserMetadata{Username: "mockuser", Role: "editor"})
+	if !errors.Is(err, ErrRoleNotApplied) || registered == nil || registered.ID != server.userID.String() || service.Cache.Count() != 1 {
+		errorMessage = fmt.Sprintf("RegisterUser should return the created user with ErrRoleNotApplied (err: %v, resp: %+v)", err, registered)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ RegisterUser returns the created user when the role cannot be set\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -0,0 +1,186 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// RPCOptions configures a Postgres function call.
+// Method is the HTTP method: POST (default), GET for STABLE/IMMUTABLE functions (cacheable, arguments in the query string),
+// or HEAD to only run the function and read the count.
+// Token is the user access token to run as, so row-level security applies (empty runs as anon).
+// ServiceRole runs the function as the service role, bypassing row-level security (takes precedence over Token).
+// Schema is the exposed schema containing the function (empty for the default "public").
+// Count requests the total row count of a set-returning function, reported in PostgrestResult.Count.
+// Query adds filters, ordering and pagination applied to the rows of a set-returning function (optional).
+//
+// Used in:
+// - Service.RPC(), RPC() - configure the call
+type RPCOptions struct {
+	Method      string
+	Token       string
+	ServiceRole bool
+	Schema      string
+	Count       CountOption
+	Query       func(q *QueryBuilder)
+}
+
+// RPC starts a call to a Postgres function; chain filters and pagination for set-returning functions.
+// fn is the function name.
+// args are the named arguments (struct or map encoded as JSON; nil for none).
+// method is the HTTP method (POST, GET or HEAD; empty uses POST).
+func (c *PostgrestClient) RPC(fn string, args any, method string) *QueryBuilder {
+	var (
+		q = &QueryBuilder{client: c, table: "rpc/" + fn, path: "rpc/" + url.PathEscape(fn), params: url.Values{}, headers: http.Header{}}
+	)
+
+	switch strings.ToUpper(method) {
+	case "", http.MethodPost:
+		q.method = http.MethodPost
+		q.body = args
+		if args == nil {
+			q.body = struct{}{}
+		}
+	case http.MethodGet, http.MethodHead:
+		q.method = strings.ToUpper(method)
+		q.err = encodeRPCArgs(q.params, args)
+	default:
+		q.err = fmt.Errorf("%w: unsupported RPC method %q", ErrCreateRequest, method)
+	}
+
+	return q
+}
+
+// RPC calls a Postgres function through /rest/v1/rpc.
+// ctx is the context for request cancellation and timeout.
+// fn is the function name.
+// args are the named arguments (struct or map encoded as JSON; nil for none).
+// opts select the method, token, schema, count and row filters.
+// Returns the raw JSON result (empty for void functions and HEAD calls), the status and count, or an error (*PostgrestError for PostgREST errors).
+func (s *Service) RPC(ctx context.Context, fn string, args any, opts RPCOptions) (json.RawMessage, *PostgrestResult, error) {
+	var (
+		client *PostgrestClient
+		q      *QueryBuilder
+		raw    json.RawMessage
+		result *PostgrestResult
+		err    error
+	)
+
+	switch {
+	case opts.ServiceRole:
+		client = s.AsServiceRole()
+	case opts.Token != "":
+		client = s.AsUser(opts.Token)
+	default:
+		client = s.AsAnon()
+	}
+	if opts.Schema != "" {
+		client = client.Schema(opts.Schema)
+	}
+
+	q = client.RPC(fn, args, opts.Method)
+	if opts.Count != "" {
+		q.Count(opts.Count)
+	}
+	if opts.Query != nil {
+		opts.Query(q)
+	}
+
+	result, err = q.Execute(ctx, &raw)
+	if err != nil {
+		return nil, result, err
+	}
+
+	return raw, result, nil
+}
+
+// RPC calls a Postgres function and decodes its result into T.
+// Use a slice for set-returning functions and a scalar or struct for the others (e.g., RPC[[]Order] or RPC[int]).
+// ctx is the context for request cancellation and timeout.
+// s is the service running the call.
+// fn is the function name.
+// args are the named arguments (struct or map encoded as JSON; nil for none).
+// opts select the method, token, schema, count and row filters.
+// Returns the decoded result (zero value for void functions and HEAD calls), the status and count, or an error.
+func RPC[T any](ctx context.Context, s *Service, fn string, args any, opts RPCOptions) (T, *PostgrestResult, error) {
+	var (
+		value  T
+		raw    json.RawMessage
+		result *PostgrestResult
+		err    error
+	)
+
+	raw, result, err = s.RPC(ctx, fn, args, opts)
+	if err != nil || len(raw) == 0 {
+		return value, result, err
+	}
+
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return value, result, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+	}
+
+	return value, result, nil
+}
+
+// encodeRPCArgs adds function arguments to the query string of GET and HEAD calls.
+// params are the query parameters to fill.
+// args are the named arguments (struct or map encoded as JSON; nil for none).
+// Returns an error if args do not encode to a JSON object.
+func encodeRPCArgs(params url.Values, args any) error {
+	var (
+		encoded []byte
+		fields  map[string]any
+		names   []string
+		err     error
+	)
+
+	if args == nil {
+		return nil
+	}
+
+	encoded, err = json.Marshal(args)
+	if err == nil {
+		// keep numbers as written (no float64 rounding of bigint arguments)
+		decoder := json.NewDecoder(bytes.NewReader(encoded))
+		decoder.UseNumber()
+		err = decoder.Decode(&fields)
+	}
+	if err != nil {
+		return fmt.Errorf("%w: RPC arguments must encode to a JSON object: %w", ErrMarshalRequest, err)
+	}
+
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		params.Set(name, formatRPCArg(fields[name]))
+	}
+
+	return nil
+}
+
+// formatRPCArg formats a decoded JSON argument for the query string.
+// Arrays use the Postgres array literal syntax ({a,b}); objects are sent as JSON; numbers are kept as written.
+func formatRPCArg(value any) string {
+	switch v := value.(type) {
+	case []any:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = quoteListValue(formatRPCArg(item))
+		}
+		return "{" + strings.Join(items, ",") + "}"
+	case map[string]any:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	default:
+		return formatFilterValue(v)
+	}
+}
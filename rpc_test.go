@@ -0,0 +1,101 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// TestRPC tests POST, GET and HEAD function calls, typed decoding, token and schema selection, and row filters.
+func TestRPC(t *testing.T) {
+	var (
+		testName     = "TestRPC"
+		service      *Service
+		server       *httptest.Server
+		last         *http.Request
+		lastBody     []byte
+		total        int
+		orders       []todoRow
+		result       *PostgrestResult
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: fake PostgREST function endpoints
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = r
+		lastBody, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/rest/v1/rpc/order_total":
+			io.WriteString(w, "1250")
+		case "/rest/v1/rpc/search_todos":
+			w.Header().Set("Content-Range", "0-0/7")
+			if r.Method != http.MethodHead {
+				io.WriteString(w, `[{"id":4,"title":"urgent","done":false}]`)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"code":"PGRST202","message":"Could not find the function"}`)
+		}
+	}))
+	defer server.Close()
+	service = NewService("mock", server.URL, "anon", "service")
+
+	// execute: POST call as a user in another schema, decoded as a scalar
+	total, _, err = RPC[int](ctx, service, "order_total", map[string]any{"order_id": 12}, RPCOptions{Token: "user-token", Schema: "billing"})
+	if err != nil || total != 1250 || last.Method != http.MethodPost || string(lastBody) != `{"order_id":12}` ||
+		last.Header.Get("Authorization") != "Bearer user-token" || last.Header.Get("Content-Profile") != "billing" {
+		errorMessage = fmt.Sprintf("Unexpected POST call (err: %v, total: %d, body: %s, headers: %v)", err, total, lastBody, last.Header)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ POST calls send JSON arguments with the user token and schema\n")
+
+	// execute: GET call of a set-returning function with filters, pagination and count, as the service role
+	orders, result, err = RPC[[]todoRow](ctx, service, "search_todos", struct {
+		Query string   `json:"query"`
+		Tags  []string `json:"tags"`
+		Limit int64    `json:"max"`
+	}{"urgent", []string{"a", "b,c"}, 9007199254740993}, RPCOptions{
+		Method:      http.MethodGet,
+		ServiceRole: true,
+		Count:       CountExact,
+		Query:       func(q *QueryBuilder) { q.Eq("done", false).Order("id", true).Range(0, 9) },
+	})
+	query := last.URL.Query()
+	if err != nil || len(orders) != 1 || orders[0].ID != 4 || result.Count != 7 || last.Method != http.MethodGet ||
+		query.Get("query") != "urgent" || query.Get("tags") != `{a,"b,c"}` || query.Get("max") != "9007199254740993" ||
+		query.Get("done") != "eq.false" || query.Get("limit") != "10" || last.Header.Get("Authorization") != "Bearer service" {
+		errorMessage = fmt.Sprintf("Unexpected GET call (err: %v, rows: %v, query: %s)", err, orders, last.URL.RawQuery)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ GET calls encode arguments in the query string and apply row filters\n")
+
+	// execute: HEAD call only reads the count, as anon
+	orders, result, err = RPC[[]todoRow](ctx, service, "search_todos", map[string]string{"query": "x"}, RPCOptions{Method: http.MethodHead, Count: CountExact})
+	if err != nil || orders != nil || result.Count != 7 || last.Method != http.MethodHead || last.Header.Get("Authorization") != "Bearer anon" {
+		errorMessage = fmt.Sprintf("Unexpected HEAD call (err: %v, result: %+v)", err, result)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, _, err = service.RPC(ctx, "missing", nil, RPCOptions{}); err == nil || string(lastBody) != "{}" {
+		errorMessage = fmt.Sprintf("Expected a PostgREST error for an unknown function (err: %v, body: %s)", err, lastBody)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ HEAD calls return counts and unknown functions return errors\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
@@ -25,16 +27,50 @@ var (
 // AnonKey is the anonymous/public API key for client-side operations.
 // ServiceKey is the service role key for server-side operations.
 // HTTPClient is the HTTP client for making requests.
-// Cache is the user session cache for storing authenticated users.
-// cleanupDone is a channel to signal cleanup goroutine shutdown.
+// Cache is the session store for authenticated users (in-memory UserCache by default).
+// RefreshReuseInterval is how long a completed refresh result is served to late callers.
+// CleanupOptions configures the cache cleanup scheduler started by StartCacheCleanup().
+// ProfilesTable is the table (with id and username columns) used by GetUserByUsername() on cache misses (empty disables).
+// ReplicaID identifies this service on the invalidation bus (random by default).
+// DataHTTPClient is the HTTP client for the data APIs (PostgREST, Storage, Functions); nil uses http.DefaultClient.
+// JWTSecret is the project JWT secret used by ValidateToken() to verify HS256 tokens locally (empty validates with the API).
+// RoleSource is the metadata object roles are read from (RoleSourceAppMetadata by default).
+// cleanupMu guards cleanup.
+// cleanup is the cache cleanup scheduler (nil until StartCacheCleanup() is called).
+// metrics collects request latency and login results.
+// invalidationMu guards invalidation and invalidationStop.
+// invalidation is the bus set by SetInvalidationBus() (nil disables publishing).
+// invalidationStop removes the service's bus subscription.
+// snapshotPath is the snapshot file written on Close (empty disables snapshots).
+// refreshMu guards refreshCalls.
+// refreshCalls maps refresh tokens to in-flight or recently completed refreshes.
+// realtimeMu guards realtimeClients.
+// realtimeClients are the connected Realtime clients, which receive refreshed tokens.
 type Service struct {
-	ProjectID   string
-	ProjectURL  string
-	AnonKey     string
-	ServiceKey  string
-	HTTPClient  HTTPClient
-	Cache       *UserCache
-	cleanupDone chan struct{}
+	ProjectID            string
+	ProjectURL           string
+	AnonKey              string
+	ServiceKey           string
+	HTTPClient           HTTPClient
+	Cache                SessionStore
+	RefreshReuseInterval time.Duration
+	CleanupOptions       CleanupOptions
+	ProfilesTable        string
+	ReplicaID            string
+	JWTSecret            []byte
+	DataHTTPClient       *http.Client
+	RoleSource           RoleSource
+	cleanupMu            sync.Mutex
+	cleanup              *CleanupScheduler
+	metrics              *serviceMetrics
+	invalidationMu       sync.Mutex
+	invalidation         InvalidationBus
+	invalidationStop     func()
+	snapshotPath         string
+	refreshMu            sync.Mutex
+	refreshCalls         map[string]*refreshCall
+	realtimeMu           sync.Mutex
+	realtimeClients      map[*RealtimeClient]struct{}
 }
 
 // ServiceInterface defines the interface for Supabase authentication operations.
@@ -62,6 +98,21 @@ type ServiceInterface interface {
 
 	// RefreshToken refreshes an access token using a refresh token.
 	RefreshToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error)
+
+	// ListSessions lists the cached sessions of a user with their device info.
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]SessionInfo, error)
+
+	// RevokeSession ends a single session in Supabase and removes it from cache.
+	RevokeSession(ctx context.Context, sessionID string) error
+
+	// GetUserByEmail retrieves a user by email from cache, falling back to the Admin API.
+	GetUserByEmail(ctx context.Context, email string) (*User, error)
+
+	// GetUserByUsername retrieves a user by username from cache, falling back to the profiles table.
+	GetUserByUsername(ctx context.Context, username string) (*User, error)
+
+	// ValidateToken validates an access token through the cache, local verification or the API.
+	ValidateToken(ctx context.Context, token string) (*User, *TokenClaims, error)
 }
 
 // NewService creates a new Supabase service instance.
@@ -74,12 +125,17 @@ func NewService(projectID, projectURL, anonKey, serviceKey string) *Service {
 
 	// create service instance
 	service := &Service{
-		ProjectID:  projectID,
-		ProjectURL: projectURL,
-		AnonKey:    anonKey,
-		ServiceKey: serviceKey,
-		HTTPClient: NewFt_SupabaseHTTPClient(),
-		Cache:      NewUserCache(),
+		ProjectID:            projectID,
+		ProjectURL:           projectURL,
+		AnonKey:              anonKey,
+		ServiceKey:           serviceKey,
+		HTTPClient:           NewFt_SupabaseHTTPClient(),
+		Cache:                NewUserCache(),
+		RefreshReuseInterval: DefaultRefreshReuseInterval,
+		ReplicaID:            uuid.NewString(),
+		RoleSource:           RoleSourceAppMetadata,
+		refreshCalls:         make(map[string]*refreshCall),
+		metrics:              newServiceMetrics(),
 	}
 
 	Log("NewService", "Successfully created Supabase service instance")
@@ -129,25 +185,19 @@ func getStringMetadata(data map[string]any, key string) (string, bool) {
 // email is the user's email address.
 // password is the user's password.
 // phone is the user's phone number (optional, can be empty string).
-// metadata contains user metadata (all stored in user_metadata in Supabase).
+// metadata contains user metadata (stored in user_metadata in Supabase).
+// metadata.Role is stored in app_metadata with the service key after signup, unless RoleSource is RoleSourceUserMetadata.
 // Returns a RegisterResponse with user details or an error if registration fails.
+// If the user was created but the role could not be set, the user's session is cached and the RegisterResponse
+// (with an empty Role) is returned together with an error wrapping ErrRoleNotApplied; retry with SetRole().
 func (s *Service) RegisterUser(ctx context.Context, email, password, phone string, metadata UserMetadata) (*RegisterResponse, error) {
 	var (
-		url          string
-		reqBody      SupabaseRegisterRequest
-		bodyBytes    []byte
-		supabaseResp SupabaseAuthResponse
-		metadataMap  map[string]any
-		usernameVal  string
-		roleVal      string
-		err          error
+		metadataMap map[string]any
+		resp        *RegisterResponse
+		userID      uuid.UUID
+		err         error
 	)
 
-	Logf("RegisterUser", "Starting user registration for email: %s", email)
-
-	// build signup endpoint URL
-	url = fmt.Sprintf("%s%s", s.ProjectURL, SignupPath)
-
 	// build metadata map from struct (all fields go into user_metadata)
 	metadataMap = make(map[string]any)
 
@@ -166,13 +216,59 @@ func (s *Service) RegisterUser(ctx context.Context, email, password, phone strin
 	if metadata.Username != "" {
 		metadataMap["username"] = metadata.Username
 	}
-	if metadata.Role != "" {
+	if metadata.Role != "" && s.RoleSource == RoleSourceUserMetadata {
 		metadataMap["role"] = metadata.Role
 	}
 	if metadata.DateOfBirth != "" {
 		metadataMap["date_of_birth"] = metadata.DateOfBirth
 	}
 
+	resp, err = s.registerUser(ctx, email, password, phone, metadataMap)
+	if err != nil || metadata.Role == "" || s.RoleSource == RoleSourceUserMetadata {
+		return resp, err
+	}
+
+	// users cannot write app_metadata themselves, so the role is set with the service key
+	userID, err = uuid.Parse(resp.ID)
+	if err == nil {
+		_, err = s.SetRole(ctx, userID, metadata.Role)
+	}
+	if err != nil {
+		Logf("RegisterUser", "User %s registered but role was not applied: %v", resp.ID, err)
+		return resp, fmt.Errorf("%w: %w", ErrRoleNotApplied, err)
+	}
+	resp.Role = metadata.Role
+
+	return resp, nil
+}
+
+// registerUser registers a new user with Supabase Auth API and caches the new session.
+// ctx is the context for request cancellation and timeout.
+// email is the user's email address.
+// password is the user's password.
+// phone is the user's phone number (optional, can be empty string).
+// metadataMap is sent as user_metadata.
+// Used by RegisterUser() and RegisterUserWith().
+// Returns a RegisterResponse with user details or an error if registration fails.
+func (s *Service) registerUser(ctx context.Context, email, password, phone string, metadataMap map[string]any) (*RegisterResponse, error) {
+	var (
+		url            string
+		reqBody        SupabaseRegisterRequest
+		bodyBytes      []byte
+		supabaseResp   SupabaseAuthResponse
+		usernameVal    string
+		roleVal        string
+		displayNameVal string
+		dobVal         string
+		device         DeviceInfo
+		err            error
+	)
+
+	Logf("RegisterUser", "Starting user registration for email: %s", email)
+
+	// build signup endpoint URL
+	url = fmt.Sprintf("%s%s", s.ProjectURL, SignupPath)
+
 	// prepare request body with user metadata
 	reqBody = SupabaseRegisterRequest{
 		Email:    email,
@@ -184,7 +280,7 @@ func (s *Service) RegisterUser(ctx context.Context, email, password, phone strin
 	Log("RegisterUser", "Sending registration request to Supabase")
 
 	// send request to Supabase
-	bodyBytes, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "POST", url, reqBody, s.getDefaultHeaders())
+	bodyBytes, err = s.sendRequest(ctx, SignupPath, "POST", url, reqBody, s.getDefaultHeaders())
 	if err != nil {
 		Logf("RegisterUser", "Failed to send request: %v", err)
 		return nil, err
@@ -200,7 +296,9 @@ func (s *Service) RegisterUser(ctx context.Context, email, password, phone strin
 
 	// extract custom metadata with safe type assertions
 	usernameVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "username")
-	roleVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "role")
+	roleVal = s.RoleSource.role(supabaseResp.User.AppMetadata, supabaseResp.User.UserMetadata)
+	displayNameVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "display_name")
+	dobVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "date_of_birth")
 
 	// parse user ID to UUID
 	userUUID, err := uuid.Parse(supabaseResp.User.ID)
@@ -211,19 +309,26 @@ func (s *Service) RegisterUser(ctx context.Context, email, password, phone strin
 
 	Log("RegisterUser", "Caching user session")
 
+	// record originating device for the new session
+	device = DeviceInfoFromContext(ctx)
+
 	// cache user session
 	s.Cache.Set(supabaseResp.AccessToken, &CachedUser{
 		UserID:       userUUID,
 		Email:        supabaseResp.User.Email,
 		Username:     usernameVal,
-		DisplayName:  metadata.DisplayName,
+		DisplayName:  displayNameVal,
 		Role:         roleVal,
 		Phone:        supabaseResp.User.Phone,
-		DateOfBirth:  metadata.DateOfBirth,
+		DateOfBirth:  dobVal,
+		Metadata:     supabaseResp.User.UserMetadata,
+		AppMetadata:  supabaseResp.User.AppMetadata,
 		AccessToken:  supabaseResp.AccessToken,
 		RefreshToken: supabaseResp.RefreshToken,
 		ExpiresAt:    time.Unix(supabaseResp.ExpiresAt, 0),
 		CachedAt:     time.Now(),
+		IPAddress:    device.IPAddress,
+		UserAgent:    device.UserAgent,
 	})
 
 	Logf("RegisterUser", "Successfully registered user - ID: %s, Email: %s, Username: %s, Role: %s", supabaseResp.User.ID, supabaseResp.User.Email, usernameVal, roleVal)
@@ -250,6 +355,7 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 		supabaseResp SupabaseAuthResponse
 		usernameVal  string
 		roleVal      string
+		device       DeviceInfo
 		err          error
 	)
 
@@ -267,9 +373,10 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 	Log("LoginUser", "Sending login request to Supabase")
 
 	// send request to Supabase
-	bodyBytes, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "POST", url, reqBody, s.getDefaultHeaders())
+	bodyBytes, err = s.sendRequest(ctx, LoginPath, "POST", url, reqBody, s.getDefaultHeaders())
 	if err != nil {
 		Logf("LoginUser", "Failed to send login request: %v", err)
+		s.metrics.observeLogin(false)
 		return nil, err
 	}
 
@@ -278,12 +385,13 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 	// parse JSON response
 	if err = json.Unmarshal(bodyBytes, &supabaseResp); err != nil {
 		Logf("LoginUser", "Failed to unmarshal response: %v", err)
+		s.metrics.observeLogin(false)
 		return nil, fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
 	}
 
 	// extract custom metadata with safe type assertions
 	usernameVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "username")
-	roleVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "role")
+	roleVal = s.RoleSource.role(supabaseResp.User.AppMetadata, supabaseResp.User.UserMetadata)
 	displayNameVal, _ := getStringMetadata(supabaseResp.User.UserMetadata, "display_name")
 	dobVal, _ := getStringMetadata(supabaseResp.User.UserMetadata, "date_of_birth")
 
@@ -291,11 +399,15 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 	userUUID, err := uuid.Parse(supabaseResp.User.ID)
 	if err != nil {
 		Logf("LoginUser", "Invalid user ID format: %v", err)
+		s.metrics.observeLogin(false)
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
 	Log("LoginUser", "Caching user session")
 
+	// record originating device for the new session
+	device = DeviceInfoFromContext(ctx)
+
 	// cache user session
 	s.Cache.Set(supabaseResp.AccessToken, &CachedUser{
 		UserID:       userUUID,
@@ -305,14 +417,20 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 		Role:         roleVal,
 		Phone:        supabaseResp.User.Phone,
 		DateOfBirth:  dobVal,
+		Metadata:     supabaseResp.User.UserMetadata,
+		AppMetadata:  supabaseResp.User.AppMetadata,
 		AccessToken:  supabaseResp.AccessToken,
 		RefreshToken: supabaseResp.RefreshToken,
 		ExpiresAt:    time.Unix(supabaseResp.ExpiresAt, 0),
 		CachedAt:     time.Now(),
+		IPAddress:    device.IPAddress,
+		UserAgent:    device.UserAgent,
 	})
 
 	Logf("LoginUser", "Successfully logged in user - ID: %s, Email: %s, Username: %s, Role: %s", supabaseResp.User.ID, supabaseResp.User.Email, usernameVal, roleVal)
 
+	s.metrics.observeLogin(true)
+
 	// return formatted response
 	return &LoginResponse{
 		Token:    supabaseResp.AccessToken,
@@ -326,6 +444,7 @@ func (s *Service) LoginUser(ctx context.Context, email, password string) (*Login
 // GetUserByID retrieves a user by their ID from the cache.
 // ctx is the context for request cancellation and timeout.
 // userID is the Supabase user unique identifier (UUID).
+// Uses the user's freshest valid session when several are cached.
 // Returns a User object with user details or an error if not found in cache.
 func (s *Service) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, error) {
 	var (
@@ -353,6 +472,8 @@ func (s *Service) GetUserByID(ctx context.Context, userID uuid.UUID) (*User, err
 		Role:        cachedUser.Role,
 		Phone:       cachedUser.Phone,
 		DateOfBirth: cachedUser.DateOfBirth,
+		Metadata:    cachedUser.Metadata,
+		AppMetadata: cachedUser.AppMetadata,
 	}, nil
 }
 
@@ -386,13 +507,15 @@ func (s *Service) GetCurrentUser(ctx context.Context, token string) (*User, erro
 		Role:        cachedUser.Role,
 		Phone:       cachedUser.Phone,
 		DateOfBirth: cachedUser.DateOfBirth,
+		Metadata:    cachedUser.Metadata,
+		AppMetadata: cachedUser.AppMetadata,
 	}, nil
 }
 
 // UpdateUser updates a user's information in Supabase and refreshes the cache.
 // ctx is the context for request cancellation and timeout.
 // userID is the Supabase user unique identifier (UUID).
-// updates is a map of fields to update (e.g., {"display_name": "New Name", "role": "admin"}).
+// updates is a map of user_metadata fields to update (e.g., {"display_name": "New Name"}); roles are set with SetRole().
 // Returns updated User object or an error if update fails.
 func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, updates map[string]any) (*User, error) {
 	var (
@@ -407,7 +530,7 @@ func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, updates map[
 
 	Logf("UpdateUser", "Starting user update - UserID: %s, Updates: %v", userID.String(), updates)
 
-	// lookup user in cache to get access token
+	// lookup freshest valid session in cache to get access token
 	cachedUser, found = s.Cache.GetByUserID(userID)
 	if !found {
 		Logf("UpdateUser", "User not found in cache - UserID: %s", userID.String())
@@ -425,7 +548,7 @@ func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, updates map[
 	Log("UpdateUser", "Sending update request to Supabase")
 
 	// send PUT request to Supabase with user's auth token
-	bodyBytes, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "PUT", url, reqBody, s.getAuthHeaders(cachedUser.AccessToken))
+	bodyBytes, err = s.sendRequest(ctx, UpdateUserPath, "PUT", url, reqBody, s.getAuthHeaders(cachedUser.AccessToken))
 	if err != nil {
 		Logf("UpdateUser", "Failed to send update request: %v", err)
 		return nil, err
@@ -441,35 +564,50 @@ func (s *Service) UpdateUser(ctx context.Context, userID uuid.UUID, updates map[
 
 	// extract updated metadata with safe type assertions
 	usernameVal, _ := getStringMetadata(updateResp.UserMetadata, "username")
-	roleVal, _ := getStringMetadata(updateResp.UserMetadata, "role")
+	roleVal := s.RoleSource.role(updateResp.AppMetadata, updateResp.UserMetadata)
 	displayNameVal, _ := getStringMetadata(updateResp.UserMetadata, "display_name")
 	dobVal, _ := getStringMetadata(updateResp.UserMetadata, "date_of_birth")
 
 	Log("UpdateUser", "Updating cached user data")
 
-	// update cache with new values
-	cachedUser.Username = usernameVal
-	cachedUser.Role = roleVal
-	cachedUser.DisplayName = displayNameVal
-	cachedUser.DateOfBirth = dobVal
-	cachedUser.Email = updateResp.Email
-	cachedUser.Phone = updateResp.Phone
+	// update every cached session of the user with new values
+	s.Cache.Update(userID, func(session *CachedUser) {
+		session.Username = usernameVal
+		session.Role = roleVal
+		session.DisplayName = displayNameVal
+		session.DateOfBirth = dobVal
+		session.Email = updateResp.Email
+		session.Phone = updateResp.Phone
+		session.Metadata = updateResp.UserMetadata
+		session.AppMetadata = updateResp.AppMetadata
+	})
+
+	Logf("UpdateUser", "Successfully updated user - ID: %s, Email: %s, Username: %s", userID.String(), updateResp.Email, usernameVal)
 
-	Logf("UpdateUser", "Successfully updated user - ID: %s, Email: %s, Username: %s", cachedUser.UserID.String(), cachedUser.Email, cachedUser.Username)
+	user := &User{
+		UserID:      userID,
+		Email:       updateResp.Email,
+		Username:    usernameVal,
+		DisplayName: displayNameVal,
+		Role:        roleVal,
+		Phone:       updateResp.Phone,
+		DateOfBirth: dobVal,
+		Metadata:    cloneMetadata(updateResp.UserMetadata),
+		AppMetadata: cloneMetadata(updateResp.AppMetadata),
+	}
+
+	// let other replicas refresh their cached sessions
+	invalidation := InvalidationEvent{Type: InvalidateUpdate, UserID: userID, User: user}
+	if roleVal != cachedUser.Role {
+		invalidation.Type = InvalidateRoleChange
+	}
+	s.publishInvalidation(ctx, invalidation)
 
 	// return updated user object
-	return &User{
-		UserID:      cachedUser.UserID,
-		Email:       cachedUser.Email,
-		Username:    cachedUser.Username,
-		DisplayName: cachedUser.DisplayName,
-		Role:        cachedUser.Role,
-		Phone:       cachedUser.Phone,
-		DateOfBirth: cachedUser.DateOfBirth,
-	}, nil
+	return user, nil
 }
 
-// DeleteUser deletes a user from Supabase and removes from cache.
+// DeleteUser deletes a user from Supabase and removes all their sessions from cache.
 // ctx is the context for request cancellation and timeout.
 // userID is the Supabase user unique identifier (UUID).
 // Returns an error if deletion fails.
@@ -488,7 +626,7 @@ func (s *Service) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 	Log("DeleteUser", "Sending delete request to Supabase")
 
 	// send DELETE request to Supabase with service role key
-	_, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "DELETE", url, nil, s.getServiceHeaders())
+	_, err = s.sendRequest(ctx, DeleteUserPath, "DELETE", url, nil, s.getServiceHeaders())
 	if err != nil {
 		Logf("DeleteUser", "Failed to delete user from Supabase: %v", err)
 		return err
@@ -496,8 +634,9 @@ func (s *Service) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 
 	Log("DeleteUser", "Removing user from cache")
 
-	// delete user from cache
+	// delete user from cache, here and on other replicas
 	s.Cache.DeleteByUserID(userID)
+	s.publishInvalidation(ctx, InvalidationEvent{Type: InvalidateDelete, UserID: userID})
 
 	Logf("DeleteUser", "Successfully deleted user - UserID: %s", userID.String())
 
@@ -507,6 +646,7 @@ func (s *Service) DeleteUser(ctx context.Context, userID uuid.UUID) error {
 // Logout invalidates a user session in Supabase and removes from cache.
 // ctx is the context for request cancellation and timeout.
 // token is the JWT access token to invalidate.
+// Only the token's session ends (local scope): the user's other sessions stay signed in, here and in Supabase.
 // Returns an error if logout fails.
 func (s *Service) Logout(ctx context.Context, token string) error {
 	var (
@@ -516,13 +656,13 @@ func (s *Service) Logout(ctx context.Context, token string) error {
 
 	Log("Logout", "Starting user logout")
 
-	// build logout endpoint URL
-	url = fmt.Sprintf("%s%s", s.ProjectURL, LogoutPath)
+	// build local-scope logout endpoint URL, matching the single session removed from the cache
+	url = fmt.Sprintf("%s%s", s.ProjectURL, LogoutLocalPath)
 
 	Log("Logout", "Sending logout request to Supabase")
 
 	// send POST request to Supabase with user's auth token
-	_, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "POST", url, nil, s.getAuthHeaders(token))
+	_, err = s.sendRequest(ctx, LogoutLocalPath, "POST", url, nil, s.getAuthHeaders(token))
 	if err != nil {
 		Logf("Logout", "Failed to logout from Supabase: %v", err)
 		return err
@@ -530,19 +670,23 @@ func (s *Service) Logout(ctx context.Context, token string) error {
 
 	Log("Logout", "Removing user from cache")
 
-	// remove user from cache
+	// remove user from cache, here and on other replicas (by session ID, tokens are never broadcast)
 	s.Cache.Delete(token)
+	if invalidation, ok := logoutInvalidation(token); ok {
+		s.publishInvalidation(ctx, invalidation)
+	}
 
 	Log("Logout", "Successfully logged out user")
 
 	return nil
 }
 
-// RefreshToken refreshes an access token using a refresh token.
+// refreshToken exchanges a refresh token with Supabase and re-caches the user session.
 // ctx is the context for request cancellation and timeout.
 // refreshToken is the refresh token obtained during login or registration.
 // Returns a RefreshTokenResponse with new access token and user details or an error if refresh fails.
-func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error) {
+// Callers should go through RefreshToken, which deduplicates concurrent refreshes.
+func (s *Service) refreshToken(ctx context.Context, refreshToken string) (*RefreshTokenResponse, error) {
 	var (
 		url          string
 		reqBody      RefreshTokenRequest
@@ -551,9 +695,6 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 		usernameVal  string
 		roleVal      string
 		userUUID     uuid.UUID
-		oldToken     string
-		cachedUser   *CachedUser
-		found        bool
 		err          error
 	)
 
@@ -570,7 +711,7 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 	Log("RefreshToken", "Sending refresh request to Supabase")
 
 	// send request to Supabase
-	bodyBytes, err = s.HTTPClient.Ft_SupabaseSendRequest(ctx, "POST", url, reqBody, s.getDefaultHeaders())
+	bodyBytes, err = s.sendRequest(ctx, RefreshTokenPath, "POST", url, reqBody, s.getDefaultHeaders())
 	if err != nil {
 		Logf("RefreshToken", "Failed to send refresh request: %v", err)
 		return nil, err
@@ -586,7 +727,7 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 
 	// extract custom metadata with safe type assertions
 	usernameVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "username")
-	roleVal, _ = getStringMetadata(supabaseResp.User.UserMetadata, "role")
+	roleVal = s.RoleSource.role(supabaseResp.User.AppMetadata, supabaseResp.User.UserMetadata)
 	displayNameVal, _ := getStringMetadata(supabaseResp.User.UserMetadata, "display_name")
 	dobVal, _ := getStringMetadata(supabaseResp.User.UserMetadata, "date_of_birth")
 
@@ -597,21 +738,10 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 		return nil, fmt.Errorf("invalid user ID format: %w", err)
 	}
 
-	Log("RefreshToken", "Removing old token from cache")
-
-	// find and remove old cache entry by user ID
-	cachedUser, found = s.Cache.GetByUserID(userUUID)
-	if found {
-		oldToken = cachedUser.AccessToken
-		s.Cache.Delete(oldToken)
-		Log("RefreshToken", "Old token removed from cache")
-	} else {
-		Log("RefreshToken", "No old token found in cache")
-	}
-
 	Log("RefreshToken", "Caching new token")
 
 	// cache user session with new tokens
+	// the refreshed token keeps its session ID, so Set replaces the old token of this session only
 	s.Cache.Set(supabaseResp.AccessToken, &CachedUser{
 		UserID:       userUUID,
 		Email:        supabaseResp.User.Email,
@@ -620,12 +750,17 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 		Role:         roleVal,
 		Phone:        supabaseResp.User.Phone,
 		DateOfBirth:  dobVal,
+		Metadata:     supabaseResp.User.UserMetadata,
+		AppMetadata:  supabaseResp.User.AppMetadata,
 		AccessToken:  supabaseResp.AccessToken,
 		RefreshToken: supabaseResp.RefreshToken,
 		ExpiresAt:    time.Unix(supabaseResp.ExpiresAt, 0),
 		CachedAt:     time.Now(),
 	})
 
+	// open Realtime channels of this session must switch to the new token before the old one expires
+	s.pushRealtimeToken(supabaseResp.AccessToken)
+
 	Logf("RefreshToken", "Successfully refreshed token for user: %s", supabaseResp.User.Email)
 
 	// return formatted response
@@ -642,54 +777,53 @@ func (s *Service) RefreshToken(ctx context.Context, refreshToken string) (*Refre
 	}, nil
 }
 
-// StartCacheCleanup starts a background goroutine that cleans expired cache entries every 24 hours.
-// The cleanup runs immediately on start, then repeats every 24 hours.
+// StartCacheCleanup starts a background goroutine that removes expired cache entries.
+// The cleanup runs immediately on start, then right after the next session expiry
+// (or every CleanupOptions.Interval if set), so expired sessions are freed within seconds.
+// Calling it again while running does nothing.
 // Call StopCacheCleanup() to stop the cleanup goroutine.
 func (s *Service) StartCacheCleanup() {
-	var (
-		ticker *time.Ticker
-	)
+	s.StartCacheCleanupContext(context.Background())
+}
+
+// StartCacheCleanupContext starts the cache cleanup like StartCacheCleanup().
+// ctx is the context controlling the cleanup lifetime; the goroutine stops when ctx is done.
+func (s *Service) StartCacheCleanupContext(ctx context.Context) {
+	s.CleanupScheduler().Start(ctx)
+}
+
+// CleanupScheduler returns the service's cache cleanup scheduler, creating it on first use
+// for the current Cache with CleanupOptions.
+// Use it to read LastStats() or run a cleanup on demand.
+func (s *Service) CleanupScheduler() *CleanupScheduler {
+	s.cleanupMu.Lock()
+	defer s.cleanupMu.Unlock()
 
-	Log("StartCacheCleanup", "Starting automatic cache cleanup (24-hour interval)")
-
-	// initialize cleanup done channel
-	s.cleanupDone = make(chan struct{})
-
-	// run cleanup immediately on start
-	go func() {
-		Log("CacheCleanup", "Running initial cache cleanup")
-		// initial cleanup
-		s.Cache.Cleanup()
-
-		// setup ticker for 24-hour interval
-		ticker = time.NewTicker(24 * time.Hour)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-ticker.C:
-				Log("CacheCleanup", "Running scheduled cache cleanup (24-hour interval)")
-				// run cleanup every 24 hours
-				s.Cache.Cleanup()
-			case <-s.cleanupDone:
-				Log("CacheCleanup", "Stopping cache cleanup goroutine")
-				// stop cleanup goroutine
-				return
-			}
-		}
-	}()
+	if s.cleanup == nil {
+		s.cleanup = NewCleanupScheduler(s.Cache, s.CleanupOptions)
+	}
+
+	return s.cleanup
 }
 
-// StopCacheCleanup stops the background cache cleanup goroutine.
+// StopCacheCleanup stops the background cache cleanup goroutine and waits for it to exit.
 // Should be called when shutting down the service to prevent goroutine leaks.
+// Calling it when cleanup is not running does nothing.
 func (s *Service) StopCacheCleanup() {
+	var (
+		cleanup *CleanupScheduler
+	)
+
 	Log("StopCacheCleanup", "Stopping cache cleanup")
 
-	if s.cleanupDone != nil {
-		close(s.cleanupDone)
-		s.cleanupDone = nil
-		Log("StopCacheCleanup", "Cache cleanup stopped successfully")
-	} else {
+	s.cleanupMu.Lock()
+	cleanup = s.cleanup
+	s.cleanupMu.Unlock()
+
+	if cleanup == nil {
 		Log("StopCacheCleanup", "Cache cleanup was not running")
+		return
 	}
+
+	cleanup.Stop()
 }
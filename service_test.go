@@ -527,14 +527,16 @@ func TestUpdateUser(t *testing.T) {
 		return
 	}
 
-	// prepare updates
+	// prepare updates (roles live in app_metadata, which users cannot update themselves)
 	updates = map[string]any{
 		"display_name": "Updated Display Name",
-		"role":         "admin",
 	}
 
 	// execute
-	updatedUser, err = service.UpdateUser(ctx, userID, updates)
+	_, err = service.SetRole(ctx, userID, "admin")
+	if err == nil {
+		updatedUser, err = service.UpdateUser(ctx, userID, updates)
+	}
 	if err != nil {
 		errorMessage = fmt.Sprintf("UpdateUser failed: %v", err)
 		recordTestResult(testName, false, output.String(), errorMessage)
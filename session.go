@@ -0,0 +1,133 @@
+package ft_supabase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Sentinel errors for session operations.
+var (
+	ErrSessionNotFound = errors.New("session not found in cache")
+)
+
+// deviceInfoKey is the context key for DeviceInfo.
+type deviceInfoKey struct{}
+
+// WithDeviceInfo returns a copy of ctx carrying device info for new sessions.
+// ctx is the parent context.
+// device is the client device information (IP address and user agent).
+// Pass the returned context to RegisterUser or LoginUser to record the device on the session.
+func WithDeviceInfo(ctx context.Context, device DeviceInfo) context.Context {
+	return context.WithValue(ctx, deviceInfoKey{}, device)
+}
+
+// DeviceInfoFromContext returns the device info attached with WithDeviceInfo.
+// ctx is the context to read from.
+// Returns an empty DeviceInfo if none is attached.
+func DeviceInfoFromContext(ctx context.Context) DeviceInfo {
+	var (
+		device DeviceInfo
+	)
+
+	device, _ = ctx.Value(deviceInfoKey{}).(DeviceInfo)
+	return device
+}
+
+// DeviceInfoFromRequest extracts device info from an incoming HTTP request.
+// r is the incoming HTTP request.
+// The IP address is taken from the first X-Forwarded-For entry when present, otherwise from RemoteAddr.
+// Only trust X-Forwarded-For when the service runs behind a proxy that sets it.
+func DeviceInfoFromRequest(r *http.Request) DeviceInfo {
+	var (
+		ip        string
+		forwarded string
+		host      string
+		err       error
+	)
+
+	// prefer the original client address set by a proxy
+	forwarded = r.Header.Get("X-Forwarded-For")
+	if forwarded != "" {
+		ip = strings.TrimSpace(strings.Split(forwarded, ",")[0])
+	} else {
+		host, _, err = net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		ip = host
+	}
+
+	return DeviceInfo{
+		IPAddress: ip,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// ListSessions returns the cached sessions of a user with their device info.
+// ctx is the context for request cancellation and timeout.
+// userID is the Supabase user unique identifier (UUID).
+// Returns the user's valid sessions, oldest first, or ErrUserNotFound if none are cached.
+func (s *Service) ListSessions(ctx context.Context, userID uuid.UUID) ([]SessionInfo, error) {
+	var (
+		sessions []SessionInfo
+	)
+
+	Logf("ListSessions", "Listing sessions - UserID: %s", userID.String())
+
+	sessions = s.Cache.ListSessions(userID)
+	if len(sessions) == 0 {
+		Logf("ListSessions", "No sessions found in cache - UserID: %s", userID.String())
+		return nil, ErrUserNotFound
+	}
+
+	Logf("ListSessions", "Found %d sessions - UserID: %s", len(sessions), userID.String())
+	return sessions, nil
+}
+
+// RevokeSession ends a single session in Supabase and removes it from cache.
+// ctx is the context for request cancellation and timeout.
+// sessionID is the Supabase session identifier.
+// Other sessions of the same user stay valid.
+// Returns ErrSessionNotFound if the session is not cached, or an error if the logout request fails.
+func (s *Service) RevokeSession(ctx context.Context, sessionID string) error {
+	var (
+		session *CachedUser
+		found   bool
+		url     string
+		err     error
+	)
+
+	Logf("RevokeSession", "Revoking session - SessionID: %s", sessionID)
+
+	// lookup session to get its access token
+	session, found = s.Cache.GetBySessionID(sessionID)
+	if !found {
+		Logf("RevokeSession", "Session not found in cache - SessionID: %s", sessionID)
+		return ErrSessionNotFound
+	}
+
+	// build local-scope logout endpoint URL
+	url = fmt.Sprintf("%s%s", s.ProjectURL, LogoutLocalPath)
+
+	Log("RevokeSession", "Sending local logout request to Supabase")
+
+	// send POST request with the session's own token so only this session ends
+	_, err = s.sendRequest(ctx, LogoutLocalPath, "POST", url, nil, s.getAuthHeaders(session.AccessToken))
+	if err != nil {
+		Logf("RevokeSession", "Failed to revoke session in Supabase: %v", err)
+		return err
+	}
+
+	// remove session from cache, here and on other replicas
+	s.Cache.RevokeSession(sessionID)
+	s.publishInvalidation(ctx, InvalidationEvent{Type: InvalidateLogout, UserID: session.UserID, SessionID: sessionID})
+
+	Logf("RevokeSession", "Successfully revoked session - SessionID: %s", sessionID)
+	return nil
+}
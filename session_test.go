@@ -0,0 +1,207 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestMultipleSessions tests that several logins of the same user are cached as separate sessions.
+func TestMultipleSessions(t *testing.T) {
+	var (
+		testName     = "TestMultipleSessions"
+		service      *Service
+		server       *mockAuthServer
+		ctx          context.Context
+		laptop       *LoginResponse
+		phone        *LoginResponse
+		refreshed    *RefreshTokenResponse
+		sessions     []SessionInfo
+		cachedLaptop *CachedUser
+		found        bool
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, _, server = newMockService()
+	ctx = context.Background()
+
+	// execute: login from two devices
+	laptop, err = service.LoginUser(WithDeviceInfo(ctx, DeviceInfo{IPAddress: "10.0.0.1", UserAgent: "laptop"}), server.email, "password")
+	if err != nil {
+		errorMessage = fmt.Sprintf("Laptop login failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	phone, err = service.LoginUser(WithDeviceInfo(ctx, DeviceInfo{IPAddress: "10.0.0.2", UserAgent: "phone"}), server.email, "password")
+	if err != nil {
+		errorMessage = fmt.Sprintf("Phone login failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// verify both sessions are cached
+	if !service.Cache.IsValid(laptop.Token) || !service.Cache.IsValid(phone.Token) {
+		errorMessage = "Both device tokens should stay valid"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	sessions, err = service.ListSessions(ctx, server.userID)
+	if err != nil || len(sessions) != 2 {
+		errorMessage = fmt.Sprintf("Expected 2 sessions, got %d (err: %v)", len(sessions), err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if sessions[0].UserAgent != "laptop" || sessions[1].IPAddress != "10.0.0.2" {
+		errorMessage = fmt.Sprintf("Unexpected device info: %+v", sessions)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Two sessions cached with device info\n")
+
+	// refresh the laptop session: it keeps its session ID and device info
+	cachedLaptop, _ = service.Cache.Get(laptop.Token)
+	refreshed, err = service.RefreshToken(ctx, cachedLaptop.RefreshToken)
+	if err != nil {
+		errorMessage = fmt.Sprintf("RefreshToken failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if service.Cache.IsValid(laptop.Token) || !service.Cache.IsValid(refreshed.AccessToken) || !service.Cache.IsValid(phone.Token) {
+		errorMessage = "Refresh should only replace the laptop token"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	cachedLaptop, found = service.Cache.Get(refreshed.AccessToken)
+	if !found || cachedLaptop.UserAgent != "laptop" || service.Cache.Count() != 2 {
+		errorMessage = fmt.Sprintf("Refreshed session lost device info or count changed (count: %d)", service.Cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Refresh replaced only its own session\n")
+
+	// update applies to every session
+	_, err = service.UpdateUser(ctx, server.userID, map[string]any{"display_name": "Updated"})
+	if err != nil {
+		errorMessage = fmt.Sprintf("UpdateUser failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	for _, token := range []string{refreshed.AccessToken, phone.Token} {
+		cachedUser, _ := service.Cache.Get(token)
+		if cachedUser.DisplayName != "Updated" {
+			errorMessage = fmt.Sprintf("Session not updated: %s", cachedUser.DisplayName)
+			recordTestResult(testName, false, output.String(), errorMessage)
+			t.Errorf("%s", errorMessage)
+			return
+		}
+	}
+	output.WriteString("✓ Update applied to all sessions\n")
+
+	// revoke the phone session only
+	err = service.RevokeSession(ctx, sessions[1].SessionID)
+	if err != nil {
+		errorMessage = fmt.Sprintf("RevokeSession failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if service.Cache.IsValid(phone.Token) || !service.Cache.IsValid(refreshed.AccessToken) {
+		errorMessage = "RevokeSession should only remove the phone session"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ RevokeSession removed one session\n")
+
+	// deleting the last token clears the user index
+	service.Cache.Delete(refreshed.AccessToken)
+	if _, found = service.Cache.GetByUserID(server.userID); found {
+		errorMessage = "GetByUserID should miss after last session is deleted"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	if err = service.RevokeSession(ctx, uuid.NewString()); err != ErrSessionNotFound {
+		errorMessage = fmt.Sprintf("Expected ErrSessionNotFound, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Indexes consistent after delete\n")
+
+	// tokens without a session_id claim are keyed by their hash, never by the token itself
+	service.Cache.Set("opaque-token", &CachedUser{UserID: server.userID, ExpiresAt: time.Now().Add(time.Hour)})
+	sessions = service.Cache.ListSessions(server.userID)
+	if len(sessions) != 1 || len(sessions[0].SessionID) != 64 || strings.Contains(sessions[0].SessionID, "opaque-token") {
+		errorMessage = fmt.Sprintf("Session ID should be the token hash, got %+v", sessions)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Tokens without session_id use a hashed session ID\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestLogoutEndsOnlyItsSession tests that Logout ends one session in Supabase and in the cache.
+func TestLogoutEndsOnlyItsSession(t *testing.T) {
+	var (
+		testName     = "TestLogoutEndsOnlyItsSession"
+		service      *Service
+		client       *mockHTTPClient
+		server       *mockAuthServer
+		ctx          = context.Background()
+		laptop       *LoginResponse
+		phone        *LoginResponse
+		logoutURL    string
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup: two sessions of the same user
+	service, client, server = newMockService()
+	client.handler = func(method, url string, body any, headers map[string]string) ([]byte, error) {
+		if strings.Contains(url, LogoutPath) {
+			logoutURL = url
+		}
+		return server.handle(method, url, body, headers)
+	}
+	laptop, err = service.LoginUser(ctx, server.email, "password")
+	if err == nil {
+		phone, err = service.LoginUser(ctx, server.email, "password")
+	}
+
+	// execute
+	if err == nil {
+		err = service.Logout(ctx, laptop.Token)
+	}
+
+	// verify
+	if err != nil || service.Cache.IsValid(laptop.Token) || !service.Cache.IsValid(phone.Token) || !strings.HasSuffix(logoutURL, LogoutLocalPath) {
+		errorMessage = fmt.Sprintf("Logout should end only its own session (err: %v, url: %s)", err, logoutURL)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Logout ends only its own session\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
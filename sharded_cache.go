@@ -0,0 +1,563 @@
+package ft_supabase
+
+import (
+	"hash/maphash"
+	"io"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ShardedUserCache is a SessionStore that spreads sessions over several UserCache shards
+// so concurrent requests do not contend on a single mutex.
+// Sessions are placed in a shard by a hash of their UserID, so every session of a user lives in the same shard.
+// Token and session ID lookups go through an index partitioned by a hash of the token or session ID,
+// which maps each key to its shard. Shards update the index while holding their own lock
+// (lock order: shard, then index partition), so the index never points to a session that was removed.
+// shards are the UserCache shards.
+// index is the partitioned token/session ID to shard index.
+// mask is len(shards)-1 (the shard count is a power of two).
+// seed is the hash seed shared by every partition.
+// hooks are the cache event subscribers shared by every shard.
+// misses counts Get() calls for tokens not in the index.
+// keyMu protects snapshotKey.
+// snapshotKey is the AES key used to encrypt snapshots (nil disables snapshots).
+//
+// Used in:
+// - Service struct - drop-in replacement for UserCache via service.Cache
+// - Authentication middleware - Get() on every request from many goroutines
+type ShardedUserCache struct {
+	shards      []*UserCache
+	index       []shardIndex
+	mask        uint64
+	seed        maphash.Seed
+	hooks       *eventHub
+	misses      atomic.Uint64
+	keyMu       sync.RWMutex
+	snapshotKey []byte
+}
+
+// shardIndex is one partition of the ShardedUserCache key index.
+// tokens maps access tokens to shard numbers.
+// sessions maps session IDs to shard numbers.
+type shardIndex struct {
+	mu       sync.RWMutex
+	tokens   map[string]int
+	sessions map[string]int
+}
+
+// compile-time checks that ShardedUserCache implements SessionStore and Snapshotter
+var (
+	_ SessionStore = (*ShardedUserCache)(nil)
+	_ Snapshotter  = (*ShardedUserCache)(nil)
+)
+
+// NewShardedUserCache creates a new ShardedUserCache.
+// shardCount is the number of shards, rounded up to a power of two (0 uses 4 x GOMAXPROCS).
+// Returns a ShardedUserCache with a total max size of 1000 sessions, split evenly between shards.
+func NewShardedUserCache(shardCount int) *ShardedUserCache {
+	var (
+		cache *ShardedUserCache
+		count int
+	)
+
+	if shardCount <= 0 {
+		shardCount = 4 * runtime.GOMAXPROCS(0)
+	}
+	count = 1
+	for count < shardCount {
+		count <<= 1
+	}
+
+	Logf("NewShardedUserCache", "Creating sharded user cache - Shards: %d, Max size: 1000", count)
+
+	cache = &ShardedUserCache{
+		shards: make([]*UserCache, count),
+		index:  make([]shardIndex, count),
+		mask:   uint64(count - 1),
+		seed:   maphash.MakeSeed(),
+		hooks:  &eventHub{},
+	}
+	for i := range cache.shards {
+		shard := i
+		cache.index[i].tokens = make(map[string]int)
+		cache.index[i].sessions = make(map[string]int)
+		cache.shards[i] = newUserCache(0)
+		cache.shards[i].hooks = cache.hooks
+		cache.shards[i].onStore = func(user *CachedUser) { cache.indexStore(shard, user) }
+		cache.shards[i].onRemove = func(user *CachedUser) { cache.indexRemove(shard, user) }
+	}
+	cache.SetMaxSize(1000)
+
+	return cache
+}
+
+// SetMaxSize sets the total maximum number of sessions.
+// size is split evenly between shards; each shard evicts its own least recently used session when full,
+// so eviction is approximately LRU across the whole cache.
+func (c *ShardedUserCache) SetMaxSize(size int) {
+	var (
+		perShard int
+	)
+
+	perShard = (size + len(c.shards) - 1) / len(c.shards)
+	if perShard < 1 {
+		perShard = 1
+	}
+
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		shard.MaxSize = perShard
+		shard.mu.Unlock()
+	}
+}
+
+// MaxSize returns the total maximum number of sessions across all shards.
+func (c *ShardedUserCache) MaxSize() int {
+	var (
+		total int
+	)
+
+	for _, shard := range c.shards {
+		shard.mu.RLock()
+		total += shard.MaxSize
+		shard.mu.RUnlock()
+	}
+
+	return total
+}
+
+// Set stores a user session in the shard of its UserID.
+// token is the JWT access token used as the cache key.
+// user is the CachedUser pointer to store.
+// Same behavior as UserCache.Set(); only the user's shard is locked.
+func (c *ShardedUserCache) Set(token string, user *CachedUser) {
+	var (
+		target int
+		shard  int
+		exists bool
+	)
+
+	target = c.userShard(user.UserID)
+
+	// the token may already belong to another user's shard (should not happen with Supabase tokens)
+	shard, exists = c.lookupToken(token)
+	if exists && shard != target {
+		c.shards[shard].Delete(token)
+	}
+
+	c.shards[target].Set(token, user)
+}
+
+// Get retrieves a user session by its access token.
+// token is the JWT access token used as the cache key.
+// Returns the CachedUser pointer and true if found and not expired.
+// Only the token's index partition and the session's shard are locked.
+func (c *ShardedUserCache) Get(token string) (*CachedUser, bool) {
+	var (
+		shard  int
+		exists bool
+	)
+
+	shard, exists = c.lookupToken(token)
+	if !exists {
+		c.misses.Add(1)
+		if c.hooks.enabled() {
+			c.hooks.emit([]CacheEvent{newCacheEvent(CacheEventMiss, ReasonNotFound, nil)})
+		}
+		return nil, false
+	}
+
+	return c.shards[shard].Get(token)
+}
+
+// GetByUserID retrieves the freshest valid session of a user.
+// userID is the Supabase user unique identifier (UUID).
+// Returns the non-expired CachedUser with the latest ExpiresAt and true if found.
+func (c *ShardedUserCache) GetByUserID(userID uuid.UUID) (*CachedUser, bool) {
+	return c.shards[c.userShard(userID)].GetByUserID(userID)
+}
+
+// GetByEmail retrieves the freshest valid session of the user with an email address.
+// email is the email address, matched case-insensitively.
+// Emails are not sharded, so every shard is searched (one read lock at a time).
+func (c *ShardedUserCache) GetByEmail(email string) (*CachedUser, bool) {
+	return c.freshestAcrossShards(func(shard *UserCache) (*CachedUser, bool) { return shard.GetByEmail(email) })
+}
+
+// GetByUsername retrieves the freshest valid session of the user with a username.
+// username is the username, matched case-insensitively.
+// Usernames are not sharded, so every shard is searched (one read lock at a time).
+func (c *ShardedUserCache) GetByUsername(username string) (*CachedUser, bool) {
+	return c.freshestAcrossShards(func(shard *UserCache) (*CachedUser, bool) { return shard.GetByUsername(username) })
+}
+
+// freshestAcrossShards runs lookup on every shard and returns the result with the latest ExpiresAt.
+func (c *ShardedUserCache) freshestAcrossShards(lookup func(*UserCache) (*CachedUser, bool)) (*CachedUser, bool) {
+	var (
+		freshest *CachedUser
+	)
+
+	for _, shard := range c.shards {
+		user, found := lookup(shard)
+		if found && (freshest == nil || user.ExpiresAt.After(freshest.ExpiresAt)) {
+			freshest = user
+		}
+	}
+
+	return freshest, freshest != nil
+}
+
+// GetBySessionID retrieves a session by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns the CachedUser pointer and true if found and not expired.
+func (c *ShardedUserCache) GetBySessionID(sessionID string) (*CachedUser, bool) {
+	var (
+		shard  int
+		exists bool
+	)
+
+	shard, exists = c.lookupSession(sessionID)
+	if !exists {
+		return nil, false
+	}
+
+	return c.shards[shard].GetBySessionID(sessionID)
+}
+
+// Delete removes a user session by its access token.
+// token is the JWT access token used as the cache key.
+func (c *ShardedUserCache) Delete(token string) {
+	var (
+		shard  int
+		exists bool
+	)
+
+	shard, exists = c.lookupToken(token)
+	if exists {
+		c.shards[shard].Delete(token)
+	}
+}
+
+// DeleteByUserID removes every session of a user.
+// userID is the Supabase user unique identifier (UUID).
+func (c *ShardedUserCache) DeleteByUserID(userID uuid.UUID) {
+	c.shards[c.userShard(userID)].DeleteByUserID(userID)
+}
+
+// IsValid checks if a token exists in cache and is not expired.
+// token is the JWT access token to validate.
+// Returns true if token exists and is valid, false otherwise.
+func (c *ShardedUserCache) IsValid(token string) bool {
+	var (
+		shard  int
+		exists bool
+	)
+
+	shard, exists = c.lookupToken(token)
+	if !exists {
+		return false
+	}
+
+	return c.shards[shard].IsValid(token)
+}
+
+// Update applies fn to every cached session of a user.
+// userID is the Supabase user unique identifier (UUID).
+// fn is called with each session of the user and may modify profile fields.
+func (c *ShardedUserCache) Update(userID uuid.UUID, fn func(*CachedUser)) {
+	c.shards[c.userShard(userID)].Update(userID, fn)
+}
+
+// ListSessions returns the valid sessions of a user, oldest first.
+// userID is the Supabase user unique identifier (UUID).
+func (c *ShardedUserCache) ListSessions(userID uuid.UUID) []SessionInfo {
+	return c.shards[c.userShard(userID)].ListSessions(userID)
+}
+
+// RevokeSession removes a single session by its session ID.
+// sessionID is the Supabase session identifier.
+// Returns true if the session was found and removed.
+func (c *ShardedUserCache) RevokeSession(sessionID string) bool {
+	var (
+		shard  int
+		exists bool
+	)
+
+	shard, exists = c.lookupSession(sessionID)
+	if !exists {
+		return false
+	}
+
+	return c.shards[shard].RevokeSession(sessionID)
+}
+
+// Cleanup removes all expired sessions, locking one shard at a time.
+// Returns the number of removed sessions.
+func (c *ShardedUserCache) Cleanup() int {
+	var (
+		now     time.Time
+		removed int
+		events  []CacheEvent
+	)
+
+	now = time.Now()
+	for _, shard := range c.shards {
+		shard.mu.Lock()
+		removed += shard.removeExpiredLocked(now)
+		events = shard.takeEventsLocked()
+		shard.mu.Unlock()
+
+		c.hooks.emit(events)
+	}
+
+	Logf("ShardedUserCache.Cleanup", "Removed %d expired entries - Remaining sessions: %d", removed, c.Count())
+
+	return removed
+}
+
+// NextExpiry returns the earliest ExpiresAt across all shards.
+// Returns false if the cache is empty.
+func (c *ShardedUserCache) NextExpiry() (time.Time, bool) {
+	var (
+		earliest time.Time
+		found    bool
+	)
+
+	for _, shard := range c.shards {
+		expiry, ok := shard.NextExpiry()
+		if ok && (!found || expiry.Before(earliest)) {
+			earliest, found = expiry, true
+		}
+	}
+
+	return earliest, found
+}
+
+// Count returns the number of sessions across all shards.
+func (c *ShardedUserCache) Count() int {
+	var (
+		total int
+	)
+
+	for _, shard := range c.shards {
+		total += shard.Count()
+	}
+
+	return total
+}
+
+// SetSnapshotKey sets the AES-GCM key used by SaveSnapshot and LoadSnapshot.
+// key must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256).
+// Returns ErrSnapshotKey if the key length is invalid.
+func (c *ShardedUserCache) SetSnapshotKey(key []byte) error {
+	if !validSnapshotKey(key) {
+		return ErrSnapshotKey
+	}
+
+	c.keyMu.Lock()
+	defer c.keyMu.Unlock()
+	c.snapshotKey = append([]byte(nil), key...)
+
+	return nil
+}
+
+// SaveSnapshot writes an encrypted snapshot of all non-expired sessions to w.
+// w is the destination writer.
+// Uses the same format as UserCache.SaveSnapshot(), so snapshots can be moved between both caches.
+// Returns ErrSnapshotKey if no key is set, or an error if encryption or writing fails.
+func (c *ShardedUserCache) SaveSnapshot(w io.Writer) error {
+	var (
+		payload snapshotPayload
+		key     []byte
+		now     time.Time
+	)
+
+	c.keyMu.RLock()
+	key = c.snapshotKey
+	c.keyMu.RUnlock()
+
+	if key == nil {
+		return ErrSnapshotKey
+	}
+
+	now = time.Now()
+	payload = snapshotPayload{
+		Version: SnapshotVersion,
+		SavedAt: now,
+	}
+	for _, shard := range c.shards {
+		payload.Sessions = shard.appendSessions(payload.Sessions, now)
+	}
+
+	Logf("ShardedUserCache.SaveSnapshot", "Saving snapshot - Sessions: %d", len(payload.Sessions))
+
+	return writeSnapshot(w, key, &payload)
+}
+
+// LoadSnapshot restores sessions from an encrypted snapshot read from r.
+// r is the source reader.
+// Expired sessions are skipped; existing sessions with the same session ID are replaced.
+// Returns ErrSnapshotKey if no key is set, ErrSnapshotFormat, ErrSnapshotVersion or
+// ErrSnapshotDecrypt if the snapshot cannot be read.
+func (c *ShardedUserCache) LoadSnapshot(r io.Reader) error {
+	var (
+		payload snapshotPayload
+		key     []byte
+		now     time.Time
+		loaded  int
+		err     error
+	)
+
+	c.keyMu.RLock()
+	key = c.snapshotKey
+	c.keyMu.RUnlock()
+
+	if key == nil {
+		return ErrSnapshotKey
+	}
+
+	payload, err = readSnapshot(r, key)
+	if err != nil {
+		Logf("ShardedUserCache.LoadSnapshot", "Failed to load snapshot: %v", err)
+		return err
+	}
+
+	// restore non-expired sessions
+	now = time.Now()
+	for i := range payload.Sessions {
+		user := payload.Sessions[i]
+		if now.After(user.ExpiresAt) {
+			continue
+		}
+		c.Set(user.AccessToken, &user)
+		loaded++
+	}
+
+	Logf("ShardedUserCache.LoadSnapshot", "Loaded snapshot saved at %s - Restored: %d, Skipped expired: %d", payload.SavedAt.Format(time.RFC3339), loaded, len(payload.Sessions)-loaded)
+	return nil
+}
+
+// Stats returns the cache counters summed over all shards.
+func (c *ShardedUserCache) Stats() CacheStats {
+	var (
+		stats CacheStats
+	)
+
+	for _, shard := range c.shards {
+		shardStats := shard.Stats()
+		stats.Hits += shardStats.Hits
+		stats.Misses += shardStats.Misses
+		stats.Sets += shardStats.Sets
+		stats.Evictions += shardStats.Evictions
+		stats.Expirations += shardStats.Expirations
+		stats.Deletes += shardStats.Deletes
+		stats.Size += shardStats.Size
+		stats.MaxSize += shardStats.MaxSize
+	}
+	// misses on unknown tokens never reach a shard
+	stats.Misses += c.misses.Load()
+
+	return stats
+}
+
+// Subscribe registers a hook called for every cache event of every shard.
+// fn is the hook; it runs outside every lock, in the goroutine that triggered the event.
+// Returns a function removing the hook.
+func (c *ShardedUserCache) Subscribe(fn func(CacheEvent)) func() {
+	return c.hooks.subscribe(fn)
+}
+
+// Events returns a channel receiving every cache event of every shard.
+// buffer is the channel capacity; events are dropped when the channel is full.
+// Returns the channel and a function unsubscribing and closing it.
+func (c *ShardedUserCache) Events(buffer int) (<-chan CacheEvent, func()) {
+	return c.hooks.stream(buffer)
+}
+
+// userShard returns the shard number of a user.
+func (c *ShardedUserCache) userShard(userID uuid.UUID) int {
+	return int(maphash.Bytes(c.seed, userID[:]) & c.mask)
+}
+
+// indexFor returns the index partition of a token or session ID.
+func (c *ShardedUserCache) indexFor(key string) *shardIndex {
+	return &c.index[maphash.String(c.seed, key)&c.mask]
+}
+
+// lookupToken returns the shard holding token.
+// Returns false if the token is not cached.
+func (c *ShardedUserCache) lookupToken(token string) (int, bool) {
+	var (
+		part   *shardIndex
+		shard  int
+		exists bool
+	)
+
+	part = c.indexFor(token)
+	part.mu.RLock()
+	shard, exists = part.tokens[token]
+	part.mu.RUnlock()
+
+	return shard, exists
+}
+
+// lookupSession returns the shard holding sessionID.
+// Returns false if the session is not cached.
+func (c *ShardedUserCache) lookupSession(sessionID string) (int, bool) {
+	var (
+		part   *shardIndex
+		shard  int
+		exists bool
+	)
+
+	part = c.indexFor(sessionID)
+	part.mu.RLock()
+	shard, exists = part.sessions[sessionID]
+	part.mu.RUnlock()
+
+	return shard, exists
+}
+
+// indexStore records that shard holds user's token and session ID.
+// Called by the shard with its lock held.
+func (c *ShardedUserCache) indexStore(shard int, user *CachedUser) {
+	var (
+		part *shardIndex
+	)
+
+	part = c.indexFor(user.AccessToken)
+	part.mu.Lock()
+	part.tokens[user.AccessToken] = shard
+	part.mu.Unlock()
+
+	part = c.indexFor(user.SessionID)
+	part.mu.Lock()
+	part.sessions[user.SessionID] = shard
+	part.mu.Unlock()
+}
+
+// indexRemove forgets user's token and session ID if they still point to shard.
+// Called by the shard with its lock held.
+func (c *ShardedUserCache) indexRemove(shard int, user *CachedUser) {
+	var (
+		part *shardIndex
+	)
+
+	part = c.indexFor(user.AccessToken)
+	part.mu.Lock()
+	if owner, exists := part.tokens[user.AccessToken]; exists && owner == shard {
+		delete(part.tokens, user.AccessToken)
+	}
+	part.mu.Unlock()
+
+	part = c.indexFor(user.SessionID)
+	part.mu.Lock()
+	if owner, exists := part.sessions[user.SessionID]; exists && owner == shard {
+		delete(part.sessions, user.SessionID)
+	}
+	part.mu.Unlock()
+}
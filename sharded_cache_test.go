@@ -0,0 +1,218 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestShardedUserCache tests that ShardedUserCache behaves like UserCache behind the Service.
+func TestShardedUserCache(t *testing.T) {
+	var (
+		testName     = "TestShardedUserCache"
+		service      *Service
+		server       *mockAuthServer
+		cache        *ShardedUserCache
+		ctx          context.Context
+		laptop       *LoginResponse
+		phone        *LoginResponse
+		refreshed    *RefreshTokenResponse
+		cachedUser   *CachedUser
+		sessions     []SessionInfo
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	service, _, server = newMockService()
+	cache = NewShardedUserCache(8)
+	service.Cache = cache
+	ctx = context.Background()
+
+	// execute: two devices, then refresh the laptop session
+	laptop, err = service.LoginUser(ctx, server.email, "password")
+	if err == nil {
+		phone, err = service.LoginUser(ctx, server.email, "password")
+	}
+	if err == nil {
+		cachedUser, _ = cache.Get(laptop.Token)
+		refreshed, err = service.RefreshToken(ctx, cachedUser.RefreshToken)
+	}
+	if err != nil {
+		errorMessage = fmt.Sprintf("Login/refresh failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// verify
+	sessions = cache.ListSessions(server.userID)
+	if cache.IsValid(laptop.Token) || !cache.IsValid(refreshed.AccessToken) || !cache.IsValid(phone.Token) || len(sessions) != 2 {
+		errorMessage = fmt.Sprintf("Expected refreshed and phone sessions only (sessions: %d)", len(sessions))
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Sessions stored and refreshed across shards\n")
+
+	if err = service.RevokeSession(ctx, sessions[1].SessionID); err != nil || cache.IsValid(phone.Token) || cache.Count() != 1 {
+		errorMessage = fmt.Sprintf("RevokeSession should remove the phone session (err: %v, count: %d)", err, cache.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	cache.DeleteByUserID(server.userID)
+	if _, found := cache.Get(refreshed.AccessToken); found || cache.Count() != 0 {
+		errorMessage = "DeleteByUserID should clear the token index"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Errorf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Revoke and delete keep indexes consistent\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestShardedUserCacheConcurrent tests index consistency under concurrent access (run with -race).
+func TestShardedUserCacheConcurrent(t *testing.T) {
+	var (
+		testName     = "TestShardedUserCacheConcurrent"
+		cache        *ShardedUserCache
+		wg           sync.WaitGroup
+		indexed      int
+		output       bytes.Buffer
+		errorMessage string
+	)
+
+	// setup: small max size so shards keep evicting
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+	cache = NewShardedUserCache(4)
+	cache.SetMaxSize(64)
+
+	// execute
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			userIDs := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+			for i := 0; i < 500; i++ {
+				token := fmt.Sprintf("token-%d-%d", worker, i)
+				cache.Set(token, &CachedUser{UserID: userIDs[i%3], SessionID: token, ExpiresAt: time.Now().Add(time.Hour)})
+				cache.Get(token)
+				cache.Get(fmt.Sprintf("token-%d-%d", worker, i/2))
+				switch i % 50 {
+				case 10:
+					cache.Delete(token)
+				case 20:
+					cache.RevokeSession(fmt.Sprintf("token-%d-%d", worker, i-1))
+				case 30:
+					cache.DeleteByUserID(userIDs[0])
+				case 40:
+					cache.Update(userIDs[1], func(u *CachedUser) { u.DisplayName = "updated" })
+				}
+			}
+		}(worker)
+	}
+	wg.Wait()
+
+	// verify: every indexed token resolves, and the index matches the shards
+	for i := range cache.index {
+		for token := range cache.index[i].tokens {
+			if !cache.IsValid(token) {
+				errorMessage = fmt.Sprintf("Indexed token not found in its shard: %s", token)
+				recordTestResult(testName, false, output.String(), errorMessage)
+				t.Fatalf("%s", errorMessage)
+				return
+			}
+			indexed++
+		}
+	}
+	if indexed != cache.Count() || cache.Count() > cache.MaxSize() {
+		errorMessage = fmt.Sprintf("Index size %d does not match count %d (max %d)", indexed, cache.Count(), cache.MaxSize())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Token index consistent with shards\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// BenchmarkCacheGetParallel measures Get contention; run with -cpu 1,2,4,8 to compare scaling.
+func BenchmarkCacheGetParallel(b *testing.B) {
+	var (
+		stores = map[string]SessionStore{
+			"UserCache":        NewUserCache(),
+			"ShardedUserCache": NewShardedUserCache(0),
+		}
+		tokens = make([]string, 10_000)
+	)
+
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+
+	stores["UserCache"].(*UserCache).MaxSize = len(tokens)
+	stores["ShardedUserCache"].(*ShardedUserCache).SetMaxSize(2 * len(tokens))
+	for i := range tokens {
+		tokens[i] = "token-" + strconv.Itoa(i)
+	}
+
+	for _, name := range []string{"UserCache", "ShardedUserCache"} {
+		store := stores[name]
+		for i, token := range tokens {
+			store.Set(token, &CachedUser{UserID: uuid.New(), SessionID: strconv.Itoa(i), ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					store.Get(tokens[i%len(tokens)])
+					i += 7
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkCacheMixedParallel measures a 90% Get / 10% Set workload under contention.
+func BenchmarkCacheMixedParallel(b *testing.B) {
+	SetLoggingEnabled(false)
+	defer SetLoggingEnabled(true)
+
+	for _, name := range []string{"UserCache", "ShardedUserCache"} {
+		var store SessionStore
+		if name == "UserCache" {
+			cache := NewUserCache()
+			cache.MaxSize = 10_000
+			store = cache
+		} else {
+			cache := NewShardedUserCache(0)
+			cache.SetMaxSize(10_000)
+			store = cache
+		}
+		b.Run(name, func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				userID := uuid.New()
+				prefix := uuid.NewString()
+				for pb.Next() {
+					token := prefix + strconv.Itoa(i%1000)
+					if i%10 == 0 {
+						store.Set(token, &CachedUser{UserID: userID, SessionID: token, ExpiresAt: time.Now().Add(time.Hour)})
+					} else {
+						store.Get(token)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,381 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Sentinel errors for cache snapshots.
+var (
+	ErrSnapshotKey         = errors.New("snapshot key must be 16, 24 or 32 bytes")
+	ErrSnapshotFormat      = errors.New("invalid snapshot format")
+	ErrSnapshotVersion     = errors.New("unsupported snapshot version")
+	ErrSnapshotDecrypt     = errors.New("failed to decrypt snapshot")
+	ErrSnapshotUnsupported = errors.New("session store does not support snapshots")
+)
+
+// snapshotMagic identifies ft_supabase cache snapshot files.
+var snapshotMagic = []byte("FTSC")
+
+// SnapshotVersion is the current snapshot format version.
+const SnapshotVersion byte = 1
+
+// Snapshotter is implemented by session stores that can persist their sessions.
+//
+// Used in:
+// - EnableSnapshots() - loads sessions on startup
+// - Close() - saves sessions on shutdown
+type Snapshotter interface {
+	// SetSnapshotKey sets the AES key used to encrypt and decrypt snapshots.
+	SetSnapshotKey(key []byte) error
+
+	// SaveSnapshot writes an encrypted snapshot of all sessions to w.
+	SaveSnapshot(w io.Writer) error
+
+	// LoadSnapshot restores sessions from an encrypted snapshot read from r.
+	LoadSnapshot(r io.Reader) error
+}
+
+// compile-time check that UserCache implements Snapshotter
+var _ Snapshotter = (*UserCache)(nil)
+
+// snapshotPayload is the plaintext content of a snapshot.
+// Version is the snapshot format version.
+// SavedAt is the timestamp when the snapshot was written.
+// Sessions are the cached sessions.
+type snapshotPayload struct {
+	Version  byte         `json:"version"`
+	SavedAt  time.Time    `json:"saved_at"`
+	Sessions []CachedUser `json:"sessions"`
+}
+
+// SetSnapshotKey sets the AES-GCM key used by SaveSnapshot and LoadSnapshot.
+// key must be 16, 24 or 32 bytes (AES-128, AES-192 or AES-256).
+// Returns ErrSnapshotKey if the key length is invalid.
+func (c *UserCache) SetSnapshotKey(key []byte) error {
+	if !validSnapshotKey(key) {
+		return ErrSnapshotKey
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshotKey = append([]byte(nil), key...)
+
+	return nil
+}
+
+// SaveSnapshot writes an encrypted snapshot of all non-expired sessions to w.
+// w is the destination writer.
+// Snapshot layout: magic "FTSC" | version (1 byte) | nonce (12 bytes) | AES-GCM ciphertext.
+// Returns ErrSnapshotKey if no key is set, or an error if encryption or writing fails.
+func (c *UserCache) SaveSnapshot(w io.Writer) error {
+	var (
+		payload snapshotPayload
+		key     []byte
+		now     time.Time
+		err     error
+	)
+
+	c.mu.RLock()
+	key = c.snapshotKey
+	c.mu.RUnlock()
+
+	// no token is copied when the snapshot cannot be written
+	if key == nil {
+		return ErrSnapshotKey
+	}
+
+	now = time.Now()
+	payload = snapshotPayload{
+		Version:  SnapshotVersion,
+		SavedAt:  now,
+		Sessions: c.appendSessions(nil, now),
+	}
+
+	Logf("UserCache.SaveSnapshot", "Saving snapshot - Sessions: %d", len(payload.Sessions))
+
+	// encrypt outside the lock
+	err = writeSnapshot(w, key, &payload)
+	if err != nil {
+		Logf("UserCache.SaveSnapshot", "Failed to save snapshot: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// LoadSnapshot restores sessions from an encrypted snapshot read from r.
+// r is the source reader.
+// Expired sessions are skipped; existing sessions with the same session ID are replaced.
+// Returns ErrSnapshotKey if no key is set, ErrSnapshotFormat, ErrSnapshotVersion or
+// ErrSnapshotDecrypt if the snapshot cannot be read.
+func (c *UserCache) LoadSnapshot(r io.Reader) error {
+	var (
+		payload snapshotPayload
+		key     []byte
+		now     time.Time
+		loaded  int
+		err     error
+	)
+
+	c.mu.RLock()
+	key = c.snapshotKey
+	c.mu.RUnlock()
+
+	if key == nil {
+		return ErrSnapshotKey
+	}
+
+	payload, err = readSnapshot(r, key)
+	if err != nil {
+		Logf("UserCache.LoadSnapshot", "Failed to load snapshot: %v", err)
+		return err
+	}
+
+	// restore non-expired sessions
+	now = time.Now()
+	for i := range payload.Sessions {
+		user := payload.Sessions[i]
+		if now.After(user.ExpiresAt) {
+			continue
+		}
+		c.Set(user.AccessToken, &user)
+		loaded++
+	}
+
+	Logf("UserCache.LoadSnapshot", "Loaded snapshot saved at %s - Restored: %d, Skipped expired: %d", payload.SavedAt.Format(time.RFC3339), loaded, len(payload.Sessions)-loaded)
+	return nil
+}
+
+// EnableSnapshots turns on file-backed snapshots of the session store.
+// path is the snapshot file path.
+// key is the AES key (16, 24 or 32 bytes) used to encrypt the file.
+// Sessions are loaded from path immediately (a missing file is not an error) and saved back by Close.
+// Returns ErrSnapshotUnsupported if the session store cannot be snapshotted.
+func (s *Service) EnableSnapshots(path string, key []byte) error {
+	var (
+		snapshotter Snapshotter
+		file        *os.File
+		ok          bool
+		err         error
+	)
+
+	Logf("EnableSnapshots", "Enabling cache snapshots - Path: %s", path)
+
+	snapshotter, ok = s.Cache.(Snapshotter)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	if err = snapshotter.SetSnapshotKey(key); err != nil {
+		return err
+	}
+	s.snapshotPath = path
+
+	// load previous snapshot on startup
+	file, err = os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		Log("EnableSnapshots", "No snapshot found, starting with an empty cache")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return snapshotter.LoadSnapshot(file)
+}
+
+// SaveSnapshotFile writes an encrypted snapshot of the session store to the configured snapshot file.
+// The file is written atomically (temporary file, fsync, rename) with 0600 permissions.
+// Returns nil if snapshots are not enabled.
+func (s *Service) SaveSnapshotFile() error {
+	var (
+		snapshotter Snapshotter
+		tmp         *os.File
+		ok          bool
+		err         error
+	)
+
+	if s.snapshotPath == "" {
+		return nil
+	}
+
+	snapshotter, ok = s.Cache.(Snapshotter)
+	if !ok {
+		return ErrSnapshotUnsupported
+	}
+
+	Logf("SaveSnapshotFile", "Saving cache snapshot - Path: %s", s.snapshotPath)
+
+	// write to a temporary file in the same directory so rename is atomic
+	tmp, err = os.CreateTemp(filepath.Dir(s.snapshotPath), ".ft_supabase-snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err = tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = snapshotter.SaveSnapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.snapshotPath)
+}
+
+// Close shuts the service down: stops the cache cleanup and saves a snapshot if enabled.
+// Returns an error if the snapshot cannot be saved.
+func (s *Service) Close() error {
+	Log("Close", "Shutting down Supabase service")
+
+	s.StopCacheCleanup()
+	s.SetInvalidationBus(nil)
+
+	return s.SaveSnapshotFile()
+}
+
+// appendSessions appends a copy of every session not expired at now to dst.
+// Returns the extended slice.
+// Thread-safe operation using read lock.
+func (c *UserCache) appendSessions(dst []CachedUser, now time.Time) []CachedUser {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for _, entry := range c.users {
+		if now.After(entry.user.ExpiresAt) {
+			continue
+		}
+		dst = append(dst, *entry.snapshot())
+	}
+
+	return dst
+}
+
+// validSnapshotKey reports whether key is a valid AES key length.
+func validSnapshotKey(key []byte) bool {
+	return len(key) == 16 || len(key) == 24 || len(key) == 32
+}
+
+// writeSnapshot encrypts payload with AES-GCM and writes the snapshot to w.
+func writeSnapshot(w io.Writer, key []byte, payload *snapshotPayload) error {
+	var (
+		plaintext []byte
+		gcm       cipher.AEAD
+		nonce     []byte
+		header    []byte
+		out       bytes.Buffer
+		err       error
+	)
+
+	plaintext, err = json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+	}
+
+	gcm, err = newSnapshotGCM(key)
+	if err != nil {
+		return err
+	}
+
+	nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return err
+	}
+
+	// header is authenticated as additional data
+	header = append(append([]byte(nil), snapshotMagic...), SnapshotVersion)
+
+	out.Write(header)
+	out.Write(nonce)
+	out.Write(gcm.Seal(nil, nonce, plaintext, header))
+
+	_, err = w.Write(out.Bytes())
+	return err
+}
+
+// readSnapshot reads, authenticates and decrypts a snapshot from r.
+func readSnapshot(r io.Reader, key []byte) (snapshotPayload, error) {
+	var (
+		payload   snapshotPayload
+		data      []byte
+		gcm       cipher.AEAD
+		header    []byte
+		nonce     []byte
+		plaintext []byte
+		err       error
+	)
+
+	data, err = io.ReadAll(r)
+	if err != nil {
+		return payload, err
+	}
+
+	gcm, err = newSnapshotGCM(key)
+	if err != nil {
+		return payload, err
+	}
+
+	// validate header
+	if len(data) < len(snapshotMagic)+1+gcm.NonceSize() || !bytes.Equal(data[:len(snapshotMagic)], snapshotMagic) {
+		return payload, ErrSnapshotFormat
+	}
+	header = data[:len(snapshotMagic)+1]
+	if header[len(snapshotMagic)] != SnapshotVersion {
+		return payload, fmt.Errorf("%w: %d", ErrSnapshotVersion, header[len(snapshotMagic)])
+	}
+
+	// decrypt and authenticate
+	nonce = data[len(header) : len(header)+gcm.NonceSize()]
+	plaintext, err = gcm.Open(nil, nonce, data[len(header)+gcm.NonceSize():], header)
+	if err != nil {
+		return payload, ErrSnapshotDecrypt
+	}
+
+	if err = json.Unmarshal(plaintext, &payload); err != nil {
+		return payload, fmt.Errorf("%w: %w", ErrSnapshotFormat, err)
+	}
+	if payload.Version != SnapshotVersion {
+		return payload, fmt.Errorf("%w: %d", ErrSnapshotVersion, payload.Version)
+	}
+
+	return payload, nil
+}
+
+// newSnapshotGCM creates an AES-GCM cipher for key.
+func newSnapshotGCM(key []byte) (cipher.AEAD, error) {
+	var (
+		block cipher.Block
+		err   error
+	)
+
+	if !validSnapshotKey(key) {
+		return nil, ErrSnapshotKey
+	}
+
+	block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,159 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestCacheSnapshot tests encrypted snapshot save/load round trips.
+func TestCacheSnapshot(t *testing.T) {
+	var (
+		testName     = "TestCacheSnapshot"
+		source       *UserCache
+		restored     *UserCache
+		wrongKey     *UserCache
+		key          []byte
+		snapshot     bytes.Buffer
+		user         *CachedUser
+		found        bool
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	key = bytes.Repeat([]byte{7}, 32)
+	source = NewUserCache()
+	if err = source.SetSnapshotKey(key); err != nil {
+		errorMessage = fmt.Sprintf("SetSnapshotKey failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	source.Set("valid-token", &CachedUser{UserID: uuid.New(), Email: "snap@example.com", SessionID: "s1", UserAgent: "laptop", ExpiresAt: time.Now().Add(time.Hour)})
+	source.Set("expiring-token", &CachedUser{UserID: uuid.New(), SessionID: "s2", ExpiresAt: time.Now().Add(30 * time.Millisecond)})
+
+	// execute
+	if err = source.SaveSnapshot(&snapshot); err != nil {
+		errorMessage = fmt.Sprintf("SaveSnapshot failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if bytes.Contains(snapshot.Bytes(), []byte("snap@example.com")) {
+		errorMessage = "Snapshot should not contain plaintext session data"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Snapshot is encrypted\n")
+
+	// wait for the second session to expire before loading
+	time.Sleep(50 * time.Millisecond)
+
+	wrongKey = NewUserCache()
+	wrongKey.SetSnapshotKey(bytes.Repeat([]byte{8}, 32))
+	if err = wrongKey.LoadSnapshot(bytes.NewReader(snapshot.Bytes())); !errors.Is(err, ErrSnapshotDecrypt) {
+		errorMessage = fmt.Sprintf("Expected ErrSnapshotDecrypt with wrong key, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Wrong key rejected\n")
+
+	restored = NewUserCache()
+	restored.SetSnapshotKey(key)
+	if err = restored.LoadSnapshot(bytes.NewReader(snapshot.Bytes())); err != nil {
+		errorMessage = fmt.Sprintf("LoadSnapshot failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// verify
+	user, found = restored.Get("valid-token")
+	if !found || user.Email != "snap@example.com" || user.UserAgent != "laptop" || restored.Count() != 1 {
+		errorMessage = fmt.Sprintf("Expected only the valid session to be restored (count: %d)", restored.Count())
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Valid session restored, expired session skipped\n")
+
+	// version and format checks
+	corrupted := append([]byte(nil), snapshot.Bytes()...)
+	corrupted[len(snapshotMagic)] = 99
+	if err = restored.LoadSnapshot(bytes.NewReader(corrupted)); !errors.Is(err, ErrSnapshotVersion) {
+		errorMessage = fmt.Sprintf("Expected ErrSnapshotVersion, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if err = restored.LoadSnapshot(bytes.NewReader([]byte("garbage"))); !errors.Is(err, ErrSnapshotFormat) {
+		errorMessage = fmt.Sprintf("Expected ErrSnapshotFormat, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Version and format validated\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
+
+// TestServiceSnapshotFile tests file-backed snapshots across service restarts.
+func TestServiceSnapshotFile(t *testing.T) {
+	var (
+		testName     = "TestServiceSnapshotFile"
+		path         string
+		key          []byte
+		before       *Service
+		after        *Service
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	path = filepath.Join(t.TempDir(), "sessions.snapshot")
+	key = bytes.Repeat([]byte{1}, 16)
+
+	// first process: nothing to load, one login, then shutdown
+	before = NewService("mock", "http://mock.local", "anon", "service")
+	if err = before.EnableSnapshots(path, key); err != nil {
+		errorMessage = fmt.Sprintf("EnableSnapshots failed on missing file: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	before.Cache.Set("token", &CachedUser{UserID: uuid.New(), SessionID: "s1", ExpiresAt: time.Now().Add(time.Hour)})
+	if err = before.Close(); err != nil {
+		errorMessage = fmt.Sprintf("Close failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+
+	// second process: sessions restored on startup
+	after = NewService("mock", "http://mock.local", "anon", "service")
+	if err = after.EnableSnapshots(path, key); err != nil {
+		errorMessage = fmt.Sprintf("EnableSnapshots failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if !after.Cache.IsValid("token") {
+		errorMessage = "Session should survive restart"
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatal(errorMessage)
+		return
+	}
+	output.WriteString("✓ Session restored after restart\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
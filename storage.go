@@ -0,0 +1,766 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultStorageListLimit is the default number of objects returned by BucketClient.List().
+const DefaultStorageListLimit = 100
+
+// StorageError is a Storage API error response.
+// StatusCode is the HTTP status code.
+// Code is the storage error code (e.g., "not_found", "Duplicate").
+// Message describes the error.
+// Wraps ErrInvalidStatus, so errors.Is(err, ErrInvalidStatus) keeps working.
+//
+// Used in:
+// - StorageClient and BucketClient methods - returned for non-2xx responses
+type StorageError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"error"`
+	Message    string `json:"message"`
+}
+
+// Error returns the error message with the status code and storage code.
+func (e *StorageError) Error() string {
+	return fmt.Sprintf("storage (status %d, %s): %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Unwrap returns ErrInvalidStatus.
+func (e *StorageError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
+// StorageOptions selects the credentials of a storage client.
+// Token is the user access token to act as, so storage RLS policies apply (empty acts as anon).
+// ServiceRole acts as the service role, bypassing storage RLS policies (takes precedence over Token).
+//
+// Used in:
+// - Service.Storage() - creates a storage client
+type StorageOptions struct {
+	Token       string
+	ServiceRole bool
+}
+
+// Bucket is a storage bucket.
+// ID is the bucket identifier used in object paths.
+// Name is the bucket name (same as ID for buckets created through the API).
+// Owner is the user ID of the bucket owner (empty for buckets created with the service role).
+// Public allows downloads through public URLs without a token.
+// FileSizeLimit is the maximum object size in bytes (nil for no limit).
+// AllowedMimeTypes restricts uploaded content types (empty allows all; wildcards like "image/*" are allowed).
+// CreatedAt and UpdatedAt are the bucket timestamps.
+//
+// Used in:
+// - StorageClient.ListBuckets(), StorageClient.GetBucket() - returned buckets
+type Bucket struct {
+	ID               string    `json:"id"`
+	Name             string    `json:"name"`
+	Owner            string    `json:"owner"`
+	Public           bool      `json:"public"`
+	FileSizeLimit    *int64    `json:"file_size_limit"`
+	AllowedMimeTypes []string  `json:"allowed_mime_types"`
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// BucketOptions configures a bucket on creation or update.
+// Public allows downloads through public URLs without a token.
+// FileSizeLimit is the maximum object size in bytes (0 for no limit).
+// AllowedMimeTypes restricts uploaded content types (empty allows all).
+//
+// Used in:
+// - StorageClient.CreateBucket(), StorageClient.UpdateBucket() - bucket settings
+type BucketOptions struct {
+	Public           bool
+	FileSizeLimit    int64
+	AllowedMimeTypes []string
+}
+
+// FileObject is an entry returned by BucketClient.List() or BucketClient.Remove().
+// Name is the object name relative to the listed prefix (folders have no ID).
+// ID is the object identifier (empty for folders).
+// BucketID is the bucket of the object (set by Remove()).
+// CreatedAt, UpdatedAt and LastAccessedAt are the object timestamps (zero for folders).
+// Metadata holds the object metadata (size, mimetype, cacheControl, eTag, ...).
+//
+// Used in:
+// - BucketClient.List(), BucketClient.Remove() - returned objects
+type FileObject struct {
+	Name           string         `json:"name"`
+	ID             string         `json:"id"`
+	BucketID       string         `json:"bucket_id"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	LastAccessedAt time.Time      `json:"last_accessed_at"`
+	Metadata       map[string]any `json:"metadata"`
+}
+
+// IsFolder reports whether the entry is a folder (a common prefix of other objects).
+func (f FileObject) IsFolder() bool {
+	return f.ID == ""
+}
+
+// UploadOptions configures an object upload.
+// ContentType is the object content type (default "application/octet-stream").
+// CacheControl is the max-age served with the object (0 keeps the storage default of 1 hour).
+// Upsert overwrites an existing object instead of failing with a conflict.
+// ContentLength is the body size in bytes, sent as Content-Length when known (0 streams with chunked encoding).
+// Fingerprint identifies the content of a resumable upload (e.g., a hash of the file); it must change whenever
+// the content does. When empty the whole content is hashed. Only used by ResumableUploader.
+//
+// Used in:
+// - BucketClient.Upload(), BucketClient.UploadToSignedURL() - upload settings
+// - ResumableUploader.Upload() - upload settings and content identity
+type UploadOptions struct {
+	ContentType   string
+	CacheControl  time.Duration
+	Upsert        bool
+	ContentLength int64
+	Fingerprint   string
+}
+
+// UploadResult describes an uploaded object.
+// Key is the object key including the bucket ("avatars/user/1.png").
+// ID is the object identifier.
+//
+// Used in:
+// - BucketClient.Upload(), BucketClient.UploadToSignedURL() - returned result
+type UploadResult struct {
+	Key string `json:"Key"`
+	ID  string `json:"Id"`
+}
+
+// TransformOptions are image transformation parameters applied on download.
+// Width and Height are the target size in pixels (0 keeps the ratio).
+// Resize is the resize mode: "cover" (default), "contain" or "fill".
+// Quality is the output quality from 20 to 100 (0 uses the default of 80).
+// Format is the output format; "origin" keeps the original format (empty lets storage pick WebP when supported).
+//
+// Used in:
+// - BucketClient.Download(), BucketClient.PublicURL(), BucketClient.CreateSignedURL() - transformed images
+type TransformOptions struct {
+	Width   int
+	Height  int
+	Resize  string
+	Quality int
+	Format  string
+}
+
+// URLOptions configures public and signed URLs.
+// Download makes browsers download the object instead of displaying it.
+// DownloadName is the file name suggested to browsers (implies Download).
+// Transform applies image transformations (nil serves the original object).
+//
+// Used in:
+// - BucketClient.PublicURL(), BucketClient.CreateSignedURL() - URL settings
+type URLOptions struct {
+	Download     bool
+	DownloadName string
+	Transform    *TransformOptions
+}
+
+// ListOptions configures an object listing.
+// Limit is the maximum number of entries (default 100).
+// Offset is the number of entries to skip, for pagination.
+// SortBy is the sort column ("name" by default, or "created_at", "updated_at", "last_accessed_at").
+// Descending sorts in descending order.
+// Search filters entries whose name contains this string.
+//
+// Used in:
+// - BucketClient.List() - listing settings
+type ListOptions struct {
+	Limit      int
+	Offset     int
+	SortBy     string
+	Descending bool
+	Search     string
+}
+
+// SignedUpload is a signed URL allowing a single upload without credentials.
+// URL is the absolute upload URL.
+// Path is the object path in the bucket.
+// Token is the upload token, passed to BucketClient.UploadToSignedURL().
+//
+// Used in:
+// - BucketClient.CreateSignedUploadURL() - returned upload URL
+type SignedUpload struct {
+	URL   string
+	Path  string
+	Token string
+}
+
+// Download is a downloaded object; the caller must close Body.
+// Body streams the object content.
+// ContentType is the object content type.
+// ContentLength is the object size in bytes (-1 if unknown).
+//
+// Used in:
+// - BucketClient.Download() - returned object
+type Download struct {
+	Body          io.ReadCloser
+	ContentType   string
+	ContentLength int64
+}
+
+// StorageClient runs Storage API requests with a fixed API key and token.
+// service is the service providing the project URL and HTTP client.
+// apiKey is sent in the apikey header.
+// token is sent as Bearer token; storage RLS policies apply to its role.
+//
+// Used in:
+// - Service.Storage() - creates clients
+type StorageClient struct {
+	service *Service
+	apiKey  string
+	token   string
+}
+
+// BucketClient runs object operations in one bucket.
+// storage is the client running the requests.
+// bucket is the bucket ID.
+//
+// Used in:
+// - StorageClient.From() - selects a bucket
+type BucketClient struct {
+	storage *StorageClient
+	bucket  string
+}
+
+// Storage returns a Storage API client.
+// opts select the credentials (user token, service role or anon).
+func (s *Service) Storage(opts StorageOptions) *StorageClient {
+	switch {
+	case opts.ServiceRole:
+		return &StorageClient{service: s, apiKey: s.ServiceKey, token: s.ServiceKey}
+	case opts.Token != "":
+		return &StorageClient{service: s, apiKey: s.AnonKey, token: opts.Token}
+	default:
+		return &StorageClient{service: s, apiKey: s.AnonKey, token: s.AnonKey}
+	}
+}
+
+// From returns a client for the objects of a bucket.
+// bucket is the bucket ID.
+func (c *StorageClient) From(bucket string) *BucketClient {
+	return &BucketClient{storage: c, bucket: bucket}
+}
+
+// ListBuckets returns all buckets visible to the client.
+// ctx is the context for request cancellation and timeout.
+// Returns the buckets or an error.
+func (c *StorageClient) ListBuckets(ctx context.Context) ([]Bucket, error) {
+	var (
+		buckets []Bucket
+		err     error
+	)
+
+	err = c.doJSON(ctx, http.MethodGet, StorageBucketPath, StorageBucketPath, nil, &buckets)
+	return buckets, err
+}
+
+// GetBucket returns a bucket.
+// ctx is the context for request cancellation and timeout.
+// id is the bucket ID.
+// Returns the bucket or an error (*StorageError with StatusCode 404 if it does not exist).
+func (c *StorageClient) GetBucket(ctx context.Context, id string) (*Bucket, error) {
+	var (
+		bucket Bucket
+		err    error
+	)
+
+	err = c.doJSON(ctx, http.MethodGet, StorageBucketPath+"/"+url.PathEscape(id), StorageBucketPath, nil, &bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	return &bucket, nil
+}
+
+// CreateBucket creates a bucket.
+// ctx is the context for request cancellation and timeout.
+// id is the bucket ID.
+// opts are the bucket settings.
+// Returns an error if the request fails (e.g., the bucket exists).
+func (c *StorageClient) CreateBucket(ctx context.Context, id string, opts BucketOptions) error {
+	var (
+		body = bucketBody(opts)
+	)
+
+	Logf("Storage", "Creating bucket - ID: %s, Public: %t", id, opts.Public)
+	body["id"] = id
+	body["name"] = id
+
+	return c.doJSON(ctx, http.MethodPost, StorageBucketPath, StorageBucketPath, body, nil)
+}
+
+// UpdateBucket updates the settings of a bucket.
+// ctx is the context for request cancellation and timeout.
+// id is the bucket ID.
+// opts are the new bucket settings.
+// Returns an error if the request fails.
+func (c *StorageClient) UpdateBucket(ctx context.Context, id string, opts BucketOptions) error {
+	var (
+		body = bucketBody(opts)
+	)
+
+	Logf("Storage", "Updating bucket - ID: %s, Public: %t", id, opts.Public)
+	body["id"] = id
+
+	return c.doJSON(ctx, http.MethodPut, StorageBucketPath+"/"+url.PathEscape(id), StorageBucketPath, body, nil)
+}
+
+// EmptyBucket removes all objects of a bucket.
+// ctx is the context for request cancellation and timeout.
+// id is the bucket ID.
+// Returns an error if the request fails.
+func (c *StorageClient) EmptyBucket(ctx context.Context, id string) error {
+	Logf("Storage", "Emptying bucket - ID: %s", id)
+	return c.doJSON(ctx, http.MethodPost, StorageBucketPath+"/"+url.PathEscape(id)+"/empty", StorageBucketPath+"/empty", struct{}{}, nil)
+}
+
+// DeleteBucket deletes an empty bucket.
+// ctx is the context for request cancellation and timeout.
+// id is the bucket ID.
+// Returns an error if the request fails (e.g., the bucket still contains objects).
+func (c *StorageClient) DeleteBucket(ctx context.Context, id string) error {
+	Logf("Storage", "Deleting bucket - ID: %s", id)
+	return c.doJSON(ctx, http.MethodDelete, StorageBucketPath+"/"+url.PathEscape(id), StorageBucketPath, struct{}{}, nil)
+}
+
+// Upload uploads an object, streaming its content from body.
+// ctx is the context for request cancellation and timeout.
+// path is the object path in the bucket (e.g., "user-id/avatar.png").
+// body is the object content.
+// opts are the content type, cache control, upsert and size settings.
+// Returns the uploaded object key and ID, or an error (*StorageError with StatusCode 409 if it exists and Upsert is false).
+func (b *BucketClient) Upload(ctx context.Context, path string, body io.Reader, opts UploadOptions) (*UploadResult, error) {
+	Logf("Storage", "Uploading object - Bucket: %s, Path: %s, Upsert: %t", b.bucket, path, opts.Upsert)
+	return b.upload(ctx, http.MethodPost, StorageObjectPath+"/"+b.objectPath(path), StorageObjectPath, body, opts)
+}
+
+// Download downloads an object, optionally transformed as an image.
+// ctx is the context for request cancellation and timeout.
+// path is the object path in the bucket.
+// transform are image transformation parameters (nil downloads the original object).
+// Returns the object whose Body the caller must close, or an error.
+func (b *BucketClient) Download(ctx context.Context, path string, transform *TransformOptions) (*Download, error) {
+	var (
+		endpoint = StorageObjectPath + "/authenticated/" + b.objectPath(path)
+		label    = StorageObjectPath
+		req      *http.Request
+		resp     *http.Response
+		err      error
+	)
+
+	if transform != nil {
+		endpoint = StorageRenderPath + "/authenticated/" + b.objectPath(path) + "?" + transform.values().Encode()
+		label = StorageRenderPath
+	}
+
+	req, err = b.storage.newRequest(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = b.storage.service.doHTTPStream(req, label)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		defer resp.Body.Close()
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, parseStorageError(resp.StatusCode, bodyBytes)
+	}
+
+	return &Download{Body: resp.Body, ContentType: resp.Header.Get(HeaderContentType), ContentLength: resp.ContentLength}, nil
+}
+
+// List lists the objects and folders directly under a prefix.
+// ctx is the context for request cancellation and timeout.
+// prefix is the folder to list ("" for the bucket root, "user-id" for a folder).
+// opts are the pagination, sort and search settings.
+// Returns the entries (folders have no ID) or an error.
+func (b *BucketClient) List(ctx context.Context, prefix string, opts ListOptions) ([]FileObject, error) {
+	var (
+		objects []FileObject
+		body    map[string]any
+		err     error
+	)
+
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultStorageListLimit
+	}
+	if opts.SortBy == "" {
+		opts.SortBy = "name"
+	}
+	body = map[string]any{
+		"prefix": prefix,
+		"limit":  opts.Limit,
+		"offset": opts.Offset,
+		"sortBy": map[string]string{"column": opts.SortBy, "order": map[bool]string{false: "asc", true: "desc"}[opts.Descending]},
+		"search": opts.Search,
+	}
+
+	err = b.storage.doJSON(ctx, http.MethodPost, StorageObjectPath+"/list/"+url.PathEscape(b.bucket), StorageObjectPath+"/list", body, &objects)
+	return objects, err
+}
+
+// Move moves (renames) an object within the bucket.
+// ctx is the context for request cancellation and timeout.
+// from is the current object path.
+// to is the new object path.
+// Returns an error if the request fails.
+func (b *BucketClient) Move(ctx context.Context, from, to string) error {
+	Logf("Storage", "Moving object - Bucket: %s, From: %s, To: %s", b.bucket, from, to)
+	return b.storage.doJSON(ctx, http.MethodPost, StorageObjectPath+"/move", StorageObjectPath+"/move",
+		map[string]string{"bucketId": b.bucket, "sourceKey": from, "destinationKey": to}, nil)
+}
+
+// Copy copies an object within the bucket.
+// ctx is the context for request cancellation and timeout.
+// from is the source object path.
+// to is the destination object path.
+// Returns the key of the copy ("bucket/path") or an error.
+func (b *BucketClient) Copy(ctx context.Context, from, to string) (string, error) {
+	var (
+		result UploadResult
+		err    error
+	)
+
+	Logf("Storage", "Copying object - Bucket: %s, From: %s, To: %s", b.bucket, from, to)
+	err = b.storage.doJSON(ctx, http.MethodPost, StorageObjectPath+"/copy", StorageObjectPath+"/copy",
+		map[string]string{"bucketId": b.bucket, "sourceKey": from, "destinationKey": to}, &result)
+
+	return result.Key, err
+}
+
+// Remove removes objects from the bucket.
+// ctx is the context for request cancellation and timeout.
+// paths are the object paths to remove (missing objects are ignored).
+// Returns the removed objects or an error.
+func (b *BucketClient) Remove(ctx context.Context, paths ...string) ([]FileObject, error) {
+	var (
+		objects []FileObject
+		err     error
+	)
+
+	Logf("Storage", "Removing objects - Bucket: %s, Count: %d", b.bucket, len(paths))
+	err = b.storage.doJSON(ctx, http.MethodDelete, StorageObjectPath+"/"+url.PathEscape(b.bucket), StorageObjectPath,
+		map[string][]string{"prefixes": paths}, &objects)
+
+	return objects, err
+}
+
+// PublicURL returns the public URL of an object; the bucket must be public.
+// No request is made and the object is not checked.
+// path is the object path in the bucket.
+// opts are the download and image transformation settings.
+func (b *BucketClient) PublicURL(path string, opts URLOptions) string {
+	var (
+		base   = b.storage.service.ProjectURL + StorageObjectPath + "/public/"
+		values = url.Values{}
+	)
+
+	if opts.Transform != nil {
+		base = b.storage.service.ProjectURL + StorageRenderPath + "/public/"
+		values = opts.Transform.values()
+	}
+	opts.addDownload(values)
+
+	if len(values) == 0 {
+		return base + b.objectPath(path)
+	}
+	return base + b.objectPath(path) + "?" + values.Encode()
+}
+
+// CreateSignedURL returns a URL granting temporary download access to an object.
+// ctx is the context for request cancellation and timeout.
+// path is the object path in the bucket.
+// expiresIn is how long the URL stays valid.
+// opts are the download and image transformation settings.
+// Returns the absolute signed URL or an error.
+func (b *BucketClient) CreateSignedURL(ctx context.Context, path string, expiresIn time.Duration, opts URLOptions) (string, error) {
+	var (
+		body     = map[string]any{"expiresIn": int(expiresIn.Seconds())}
+		response struct {
+			SignedURL string `json:"signedURL"`
+		}
+		values = url.Values{}
+		err    error
+	)
+
+	if opts.Transform != nil {
+		body["transform"] = opts.Transform.body()
+	}
+
+	err = b.storage.doJSON(ctx, http.MethodPost, StorageObjectPath+"/sign/"+b.objectPath(path), StorageObjectPath+"/sign", body, &response)
+	if err != nil {
+		return "", err
+	}
+	if response.SignedURL == "" {
+		return "", fmt.Errorf("%w: missing signedURL", ErrUnmarshalResponse)
+	}
+
+	opts.addDownload(values)
+	signed := b.storage.service.ProjectURL + "/storage/v1" + response.SignedURL
+	if len(values) > 0 {
+		signed += "&" + values.Encode()
+	}
+
+	return signed, nil
+}
+
+// CreateSignedUploadURL returns a URL allowing one upload to path without credentials (valid for 2 hours).
+// Hand it to browsers or other services, which upload with a PUT request or BucketClient.UploadToSignedURL().
+// ctx is the context for request cancellation and timeout.
+// path is the object path in the bucket.
+// upsert allows the upload to overwrite an existing object.
+// Returns the signed upload URL and token, or an error.
+func (b *BucketClient) CreateSignedUploadURL(ctx context.Context, path string, upsert bool) (*SignedUpload, error) {
+	var (
+		response struct {
+			URL string `json:"url"`
+		}
+		parsed *url.URL
+		req    *http.Request
+		err    error
+	)
+
+	req, err = b.storage.newRequest(ctx, http.MethodPost, StorageObjectPath+"/upload/sign/"+b.objectPath(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	if upsert {
+		req.Header.Set("x-upsert", "true")
+	}
+	if err = b.storage.do(req, StorageObjectPath+"/upload/sign", &response); err != nil {
+		return nil, err
+	}
+
+	parsed, err = url.Parse(response.URL)
+	if err != nil || parsed.Query().Get("token") == "" {
+		return nil, fmt.Errorf("%w: invalid signed upload url %q", ErrUnmarshalResponse, response.URL)
+	}
+
+	return &SignedUpload{
+		URL:   b.storage.service.ProjectURL + "/storage/v1" + response.URL,
+		Path:  path,
+		Token: parsed.Query().Get("token"),
+	}, nil
+}
+
+// UploadToSignedURL uploads an object with a token from CreateSignedUploadURL().
+// ctx is the context for request cancellation and timeout.
+// path is the object path the URL was signed for.
+// token is the upload token.
+// body is the object content.
+// opts are the content type, cache control and size settings (Upsert is decided when signing).
+// Returns the uploaded object key, or an error.
+func (b *BucketClient) UploadToSignedURL(ctx context.Context, path, token string, body io.Reader, opts UploadOptions) (*UploadResult, error) {
+	Logf("Storage", "Uploading object to signed URL - Bucket: %s, Path: %s", b.bucket, path)
+	return b.upload(ctx, http.MethodPut, StorageObjectPath+"/upload/sign/"+b.objectPath(path)+"?token="+url.QueryEscape(token), StorageObjectPath+"/upload/sign", body, opts)
+}
+
+// upload sends an object upload request.
+// method is POST for uploads and PUT for signed uploads.
+// endpoint is the path below the project URL, with query string.
+// label is the metrics label.
+func (b *BucketClient) upload(ctx context.Context, method, endpoint, label string, body io.Reader, opts UploadOptions) (*UploadResult, error) {
+	var (
+		result UploadResult
+		req    *http.Request
+		err    error
+	)
+
+	req, err = b.storage.newRequest(ctx, method, endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.ContentType == "" {
+		opts.ContentType = "application/octet-stream"
+	}
+	req.Header.Set(HeaderContentType, opts.ContentType)
+	if opts.CacheControl > 0 {
+		req.Header.Set("Cache-Control", "max-age="+strconv.Itoa(int(opts.CacheControl.Seconds())))
+	}
+	if opts.Upsert {
+		req.Header.Set("x-upsert", "true")
+	}
+	if opts.ContentLength > 0 {
+		req.ContentLength = opts.ContentLength
+	}
+
+	if err = b.storage.do(req, label, &result); err != nil {
+		Logf("Storage", "Upload failed - Bucket: %s, Error: %v", b.bucket, err)
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// objectPath returns the escaped "bucket/path" URL path of an object.
+func (b *BucketClient) objectPath(path string) string {
+	var (
+		segments = strings.Split(strings.Trim(path, "/"), "/")
+	)
+
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return url.PathEscape(b.bucket) + "/" + strings.Join(segments, "/")
+}
+
+// doJSON sends a JSON request and decodes the JSON response.
+// endpoint is the path below the project URL.
+// label is the metrics label.
+// body is encoded as JSON (nil sends no body).
+// dest receives the decoded response (nil discards it).
+func (c *StorageClient) doJSON(ctx context.Context, method, endpoint, label string, body, dest any) error {
+	var (
+		payload io.Reader
+		encoded []byte
+		req     *http.Request
+		err     error
+	)
+
+	if body != nil {
+		encoded, err = json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrMarshalRequest, err)
+		}
+		payload = bytes.NewReader(encoded)
+	}
+
+	req, err = c.newRequest(ctx, method, endpoint, payload)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set(HeaderContentType, ContentTypeJSON)
+	}
+
+	return c.do(req, label, dest)
+}
+
+// newRequest builds a request with the API key and token headers.
+func (c *StorageClient) newRequest(ctx context.Context, method, endpoint string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.service.ProjectURL+endpoint, body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCreateRequest, err)
+	}
+
+	req.Header.Set(HeaderAPIKey, c.apiKey)
+	req.Header.Set(HeaderAuthorization, "Bearer "+c.token)
+
+	return req, nil
+}
+
+// do sends a request, parses storage errors and decodes the JSON response into dest (nil discards it).
+func (c *StorageClient) do(req *http.Request, label string, dest any) error {
+	resp, bodyBytes, err := c.service.doHTTP(req, label)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return parseStorageError(resp.StatusCode, bodyBytes)
+	}
+
+	if dest != nil && len(bytes.TrimSpace(bodyBytes)) > 0 {
+		if err = json.Unmarshal(bodyBytes, dest); err != nil {
+			return fmt.Errorf("%w: %w", ErrUnmarshalResponse, err)
+		}
+	}
+
+	return nil
+}
+
+// parseStorageError decodes a Storage API error body.
+// Returns a *StorageError, or an *APIError if the body is not a storage error.
+func parseStorageError(statusCode int, body []byte) error {
+	var (
+		storageErr StorageError
+	)
+
+	if err := json.Unmarshal(body, &storageErr); err != nil || storageErr.Message == "" {
+		return &APIError{StatusCode: statusCode, Body: body}
+	}
+	storageErr.StatusCode = statusCode
+
+	return &storageErr
+}
+
+// bucketBody returns the JSON body of bucket creation and update requests.
+func bucketBody(opts BucketOptions) map[string]any {
+	var (
+		body = map[string]any{"public": opts.Public}
+	)
+
+	if opts.FileSizeLimit > 0 {
+		body["file_size_limit"] = opts.FileSizeLimit
+	}
+	if len(opts.AllowedMimeTypes) > 0 {
+		body["allowed_mime_types"] = opts.AllowedMimeTypes
+	}
+
+	return body
+}
+
+// values returns the transformation as query parameters.
+func (t *TransformOptions) values() url.Values {
+	var (
+		values = url.Values{}
+	)
+
+	for key, value := range t.body() {
+		values.Set(key, fmt.Sprint(value))
+	}
+
+	return values
+}
+
+// body returns the transformation as JSON fields of signed URL requests.
+func (t *TransformOptions) body() map[string]any {
+	var (
+		body = map[string]any{}
+	)
+
+	if t.Width > 0 {
+		body["width"] = t.Width
+	}
+	if t.Height > 0 {
+		body["height"] = t.Height
+	}
+	if t.Resize != "" {
+		body["resize"] = t.Resize
+	}
+	if t.Quality > 0 {
+		body["quality"] = t.Quality
+	}
+	if t.Format != "" {
+		body["format"] = t.Format
+	}
+
+	return body
+}
+
+// addDownload adds the download parameter to URL query values.
+func (o URLOptions) addDownload(values url.Values) {
+	if o.DownloadName != "" {
+		values.Set("download", o.DownloadName)
+	} else if o.Download {
+		values.Set("download", "")
+	}
+}
@@ -0,0 +1,176 @@
+package ft_supabase
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newMockStorageServer starts a fake Storage API keeping objects in memory.
+// Uploads require a Bearer token; the authorization header of each upload is recorded by object key.
+func newMockStorageServer() (*httptest.Server, map[string][]byte, map[string]http.Header) {
+	var (
+		mu      sync.Mutex
+		objects = make(map[string][]byte)
+		headers = make(map[string]http.Header)
+	)
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		path := strings.TrimPrefix(r.URL.Path, "/storage/v1")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodPost && path == "/bucket":
+			io.WriteString(w, `{"name":"docs"}`)
+		case r.Method == http.MethodPost && path == "/object/move":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			from, to := body["bucketId"]+"/"+body["sourceKey"], body["bucketId"]+"/"+body["destinationKey"]
+			objects[to] = objects[from]
+			delete(objects, from)
+			io.WriteString(w, `{"message":"Successfully moved"}`)
+		case r.Method == http.MethodPost && strings.HasPrefix(path, "/object/list/"):
+			var body struct {
+				Prefix string `json:"prefix"`
+				Limit  int    `json:"limit"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			var entries []map[string]any
+			for key := range objects {
+				name, found := strings.CutPrefix(key, strings.TrimPrefix(path, "/object/list/")+"/"+body.Prefix+"/")
+				if found && len(entries) < body.Limit {
+					entries = append(entries, map[string]any{"name": name, "id": "id-" + name, "metadata": map[string]any{"size": len(objects[key])}})
+				}
+			}
+			json.NewEncoder(w).Encode(entries)
+		case r.Method == http.MethodPost && strings.HasPrefix(path, "/object/sign/"):
+			fmt.Fprintf(w, `{"signedURL":"%s?token=signed"}`, path)
+		case r.Method == http.MethodPost && strings.HasPrefix(path, "/object/"):
+			key := strings.TrimPrefix(path, "/object/")
+			if _, exists := objects[key]; exists && r.Header.Get("x-upsert") != "true" {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"statusCode":"409","error":"Duplicate","message":"The resource already exists"}`)
+				return
+			}
+			objects[key], _ = io.ReadAll(r.Body)
+			headers[key] = r.Header.Clone()
+			fmt.Fprintf(w, `{"Key":"%s","Id":"object-id"}`, key)
+		case r.Method == http.MethodGet && strings.HasPrefix(path, "/object/authenticated/"):
+			content, exists := objects[strings.TrimPrefix(path, "/object/authenticated/")]
+			if !exists {
+				w.WriteHeader(http.StatusBadRequest)
+				io.WriteString(w, `{"statusCode":"404","error":"not_found","message":"Object not found"}`)
+				return
+			}
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write(content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, `{"error":"not_found","message":"route not found"}`)
+		}
+	})), objects, headers
+}
+
+// TestStorage tests uploads, downloads, listing, moves, public and signed URLs against a fake Storage API.
+func TestStorage(t *testing.T) {
+	var (
+		testName     = "TestStorage"
+		service      *Service
+		server       *httptest.Server
+		objects      map[string][]byte
+		headers      map[string]http.Header
+		bucket       *BucketClient
+		result       *UploadResult
+		download     *Download
+		entries      []FileObject
+		content      []byte
+		signed       string
+		storageErr   *StorageError
+		ctx          = context.Background()
+		output       bytes.Buffer
+		errorMessage string
+		err          error
+	)
+
+	// setup
+	server, objects, headers = newMockStorageServer()
+	defer server.Close()
+	service = NewService("mock", server.URL, "anon", "service")
+	bucket = service.Storage(StorageOptions{Token: "user-token"}).From("docs")
+
+	// execute: streamed upload as a user, then a conflicting upload without upsert
+	err = service.Storage(StorageOptions{ServiceRole: true}).CreateBucket(ctx, "docs", BucketOptions{AllowedMimeTypes: []string{"text/*"}})
+	if err == nil {
+		result, err = bucket.Upload(ctx, "user 1/notes.txt", io.LimitReader(strings.NewReader("hello storage"), 5), UploadOptions{ContentType: "text/plain", CacheControl: time.Minute})
+	}
+	if err != nil || result.Key != "docs/user 1/notes.txt" || string(objects["docs/user 1/notes.txt"]) != "hello" ||
+		headers[result.Key].Get("Authorization") != "Bearer user-token" || headers[result.Key].Get("Cache-Control") != "max-age=60" {
+		errorMessage = fmt.Sprintf("Unexpected upload (err: %v, result: %+v)", err, result)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	_, err = bucket.Upload(ctx, "user 1/notes.txt", strings.NewReader("again"), UploadOptions{})
+	if !errors.As(err, &storageErr) || storageErr.Code != "Duplicate" {
+		errorMessage = fmt.Sprintf("Expected a Duplicate storage error, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, err = bucket.Upload(ctx, "user 1/notes.txt", strings.NewReader("hello world"), UploadOptions{Upsert: true}); err != nil {
+		errorMessage = fmt.Sprintf("Upsert failed: %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Uploads stream content with the user token, upsert and cache control\n")
+
+	// execute: download, list, move
+	download, err = bucket.Download(ctx, "user 1/notes.txt", nil)
+	if err == nil {
+		content, _ = io.ReadAll(download.Body)
+		download.Body.Close()
+		entries, err = bucket.List(ctx, "user 1", ListOptions{})
+	}
+	if err == nil {
+		err = bucket.Move(ctx, "user 1/notes.txt", "user 1/archive.txt")
+	}
+	if err != nil || string(content) != "hello world" || download.ContentType != "text/plain" || len(entries) != 1 || entries[0].Name != "notes.txt" || entries[0].IsFolder() {
+		errorMessage = fmt.Sprintf("Unexpected download/list/move (err: %v, content: %q, entries: %+v)", err, content, entries)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	if _, err = bucket.Download(ctx, "user 1/notes.txt", nil); !errors.As(err, &storageErr) || storageErr.Code != "not_found" {
+		errorMessage = fmt.Sprintf("Expected not_found after move, got %v", err)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Download, list and move work on escaped paths\n")
+
+	// execute: public and signed URLs
+	public := bucket.PublicURL("user 1/avatar.png", URLOptions{Transform: &TransformOptions{Width: 64, Height: 64, Resize: "cover"}})
+	signed, err = bucket.CreateSignedURL(ctx, "user 1/archive.txt", time.Hour, URLOptions{DownloadName: "notes.txt"})
+	if err != nil || public != server.URL+"/storage/v1/render/image/public/docs/user%201/avatar.png?height=64&resize=cover&width=64" ||
+		signed != server.URL+"/storage/v1/object/sign/docs/user 1/archive.txt?token=signed&download=notes.txt" {
+		errorMessage = fmt.Sprintf("Unexpected URLs (err: %v, public: %s, signed: %s)", err, public, signed)
+		recordTestResult(testName, false, output.String(), errorMessage)
+		t.Fatalf("%s", errorMessage)
+		return
+	}
+	output.WriteString("✓ Public and signed URLs carry transforms and download names\n")
+
+	recordTestResult(testName, true, output.String(), "")
+}
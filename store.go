@@ -0,0 +1,61 @@
+package ft_supabase
+
+import (
+	"github.com/google/uuid"
+)
+
+// SessionStore defines the interface for storing authenticated user sessions.
+// UserCache is the default in-process implementation; RedisStore shares sessions across replicas.
+// Implementations must be safe for concurrent use.
+//
+// Used in:
+// - Service struct - holds the session store
+// - RegisterUser(), LoginUser(), RefreshToken() - store sessions
+// - GetUserByID(), GetCurrentUser(), UpdateUser() - read sessions
+// - DeleteUser(), Logout(), RevokeSession() - remove sessions
+type SessionStore interface {
+	// Set stores a copy of a session using its access token as the key.
+	Set(token string, user *CachedUser)
+
+	// Get retrieves a copy of a non-expired session by its access token.
+	Get(token string) (*CachedUser, bool)
+
+	// GetByUserID retrieves the freshest non-expired session of a user.
+	GetByUserID(userID uuid.UUID) (*CachedUser, bool)
+
+	// GetByEmail retrieves the freshest non-expired session of the user with an email (case-insensitive).
+	GetByEmail(email string) (*CachedUser, bool)
+
+	// GetByUsername retrieves the freshest non-expired session of the user with a username (case-insensitive).
+	GetByUsername(username string) (*CachedUser, bool)
+
+	// GetBySessionID retrieves a non-expired session by its session ID.
+	GetBySessionID(sessionID string) (*CachedUser, bool)
+
+	// Delete removes a session by its access token.
+	Delete(token string)
+
+	// DeleteByUserID removes every session of a user.
+	DeleteByUserID(userID uuid.UUID)
+
+	// IsValid checks if a token exists and is not expired.
+	IsValid(token string) bool
+
+	// Update applies fn to a copy of every session of a user and stores the result with its Version incremented.
+	Update(userID uuid.UUID, fn func(*CachedUser))
+
+	// ListSessions returns the non-expired sessions of a user, oldest first.
+	ListSessions(userID uuid.UUID) []SessionInfo
+
+	// RevokeSession removes a single session by its session ID.
+	RevokeSession(sessionID string) bool
+
+	// Cleanup removes expired sessions and returns how many were removed.
+	Cleanup() int
+
+	// Count returns the number of stored sessions.
+	Count() int
+}
+
+// compile-time check that UserCache implements SessionStore
+var _ SessionStore = (*UserCache)(nil)
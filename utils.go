@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // Sentinel errors for HTTP operations.
@@ -19,6 +21,29 @@ var (
 	ErrInvalidStatus  = errors.New("invalid response status")
 )
 
+// APIError is returned when Supabase answers with a non-success HTTP status.
+// StatusCode is the HTTP status code.
+// Body is the raw response body.
+// Wraps ErrInvalidStatus, so errors.Is(err, ErrInvalidStatus) keeps working.
+//
+// Used in:
+// - Ft_SupabaseSendRequest() - returned for non-2xx responses
+// - Service metrics - status label of request latency
+type APIError struct {
+	StatusCode int
+	Body       []byte
+}
+
+// Error returns the error message with the status code and response body.
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (status %d): %s", ErrInvalidStatus, e.StatusCode, string(e.Body))
+}
+
+// Unwrap returns ErrInvalidStatus.
+func (e *APIError) Unwrap() error {
+	return ErrInvalidStatus
+}
+
 // HTTPClient defines the interface for making HTTP requests.
 type HTTPClient interface {
 	// Ft_SupabaseSendRequest sends an HTTP request and returns the response body.
@@ -129,9 +154,69 @@ func (c *DefaultHTTPClient) Ft_SupabaseSendRequest(ctx context.Context, method,
 
 	// check response status (200 OK, 201 Created, 204 No Content)
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
-		return nil, fmt.Errorf("%w (status %d): %s", ErrInvalidStatus, resp.StatusCode, string(bodyBytes))
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: bodyBytes}
 	}
 
 	// return response body
 	return bodyBytes, nil
 }
+
+// doHTTP sends a data API request (PostgREST, Storage, Functions) with DataHTTPClient and records its latency.
+// req is the prepared request.
+// endpoint is the API path constant used as metrics label.
+// Returns the response with its body read and closed, or an error if no response was received.
+// Non-2xx statuses are not errors here; callers parse their API-specific error bodies.
+func (s *Service) doHTTP(req *http.Request, endpoint string) (*http.Response, []byte, error) {
+	var (
+		resp      *http.Response
+		bodyBytes []byte
+		err       error
+	)
+
+	resp, err = s.doHTTPStream(req, endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrReadResponse, err)
+	}
+
+	return resp, bodyBytes, nil
+}
+
+// doHTTPStream sends a data API request with DataHTTPClient and records its latency until headers arrive.
+// req is the prepared request.
+// endpoint is the API path constant used as metrics label.
+// Returns the response with an open body the caller must close, or an error if no response was received.
+func (s *Service) doHTTPStream(req *http.Request, endpoint string) (*http.Response, error) {
+	var (
+		client *http.Client
+		start  time.Time
+		resp   *http.Response
+		status string
+		err    error
+	)
+
+	client = s.DataHTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start = time.Now()
+	resp, err = client.Do(req)
+	if err != nil {
+		s.metrics.observeStatus(endpoint, req.Method, time.Since(start), "error")
+		return nil, fmt.Errorf("%w: %w", ErrSendRequest, err)
+	}
+
+	status = "2xx"
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	s.metrics.observeStatus(endpoint, req.Method, time.Since(start), status)
+
+	return resp, nil
+}
@@ -0,0 +1,325 @@
+package ft_supabase
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// WebSocket opcodes (RFC 6455).
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// wsAcceptGUID is the GUID appended to Sec-WebSocket-Key to compute Sec-WebSocket-Accept.
+const wsAcceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// wsMaxMessageSize bounds the size of a received message.
+const wsMaxMessageSize = 32 << 20
+
+// Sentinel errors for WebSocket connections.
+var (
+	ErrWebSocketHandshake = errors.New("websocket handshake failed")
+	ErrWebSocketClosed    = errors.New("websocket connection closed")
+	ErrWebSocketProtocol  = errors.New("websocket protocol error")
+)
+
+// wsConn is a minimal RFC 6455 WebSocket connection (no extensions, no subprotocols).
+// conn is the underlying network connection.
+// reader buffers reads from conn.
+// client masks written frames, as required for clients.
+// writeMu serializes frame writes.
+// closeOnce guards sending the close frame.
+//
+// Used in:
+// - RealtimeClient - Phoenix channel transport
+type wsConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	client    bool
+	writeMu   sync.Mutex
+	closeOnce sync.Once
+}
+
+// dialWebSocket opens a client WebSocket connection.
+// ctx bounds the dial and the handshake.
+// rawURL is the ws:// or wss:// URL (http:// and https:// are accepted too).
+// header are extra handshake headers.
+// Returns the connection, or an error wrapping ErrWebSocketHandshake if the server refuses the upgrade.
+func dialWebSocket(ctx context.Context, rawURL string, header http.Header) (*wsConn, error) {
+	var (
+		target   *url.URL
+		useTLS   bool
+		address  string
+		dialer   net.Dialer
+		conn     net.Conn
+		keyBytes = make([]byte, 16)
+		key      string
+		req      *http.Request
+		resp     *http.Response
+		reader   *bufio.Reader
+		err      error
+	)
+
+	target, err = url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebSocketHandshake, err)
+	}
+	switch target.Scheme {
+	case "ws", "http":
+		target.Scheme = "http"
+	case "wss", "https":
+		target.Scheme, useTLS = "https", true
+	default:
+		return nil, fmt.Errorf("%w: unsupported scheme %q", ErrWebSocketHandshake, target.Scheme)
+	}
+
+	address = target.Host
+	if target.Port() == "" {
+		address = net.JoinHostPort(target.Hostname(), map[bool]string{false: "80", true: "443"}[useTLS])
+	}
+
+	conn, err = dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrWebSocketHandshake, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if useTLS {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: target.Hostname()})
+		if err = tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%w: %w", ErrWebSocketHandshake, err)
+		}
+		conn = tlsConn
+	}
+
+	rand.Read(keyBytes)
+	key = base64.StdEncoding.EncodeToString(keyBytes)
+
+	req = &http.Request{Method: http.MethodGet, URL: target, Host: target.Host, Header: header.Clone()}
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Version", "13")
+
+	if err = req.Write(conn); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrWebSocketHandshake, err)
+	}
+
+	reader = bufio.NewReader(conn)
+	resp, err = http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("%w: %w", ErrWebSocketHandshake, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != wsAcceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("%w: status %d", ErrWebSocketHandshake, resp.StatusCode)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return &wsConn{conn: conn, reader: reader, client: true}, nil
+}
+
+// wsAcceptKey returns the Sec-WebSocket-Accept value for a Sec-WebSocket-Key.
+func wsAcceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + wsAcceptGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// WriteText sends a text message.
+func (c *wsConn) WriteText(payload []byte) error {
+	return c.writeFrame(wsOpText, payload)
+}
+
+// ReadMessage returns the next text or binary message.
+// Pings are answered and pongs are ignored while waiting.
+// Returns an error wrapping ErrWebSocketClosed when the peer closes the connection.
+func (c *wsConn) ReadMessage() (int, []byte, error) {
+	var (
+		opcode  int
+		message []byte
+	)
+
+	for {
+		fin, frameOpcode, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch frameOpcode {
+		case wsOpPing:
+			if err = c.writeFrame(wsOpPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case wsOpPong:
+			continue
+		case wsOpClose:
+			code := 1005
+			if len(payload) >= 2 {
+				code = int(binary.BigEndian.Uint16(payload))
+			}
+			c.sendClose(code)
+			return 0, nil, fmt.Errorf("%w: close code %d", ErrWebSocketClosed, code)
+		case wsOpText, wsOpBinary:
+			if message != nil {
+				return 0, nil, fmt.Errorf("%w: new message inside a fragmented message", ErrWebSocketProtocol)
+			}
+			opcode, message = frameOpcode, payload
+		case wsOpContinuation:
+			if message == nil {
+				return 0, nil, fmt.Errorf("%w: unexpected continuation frame", ErrWebSocketProtocol)
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, fmt.Errorf("%w: unknown opcode %d", ErrWebSocketProtocol, frameOpcode)
+		}
+
+		if len(message) > wsMaxMessageSize {
+			return 0, nil, fmt.Errorf("%w: message larger than %d bytes", ErrWebSocketProtocol, wsMaxMessageSize)
+		}
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// Close sends a normal close frame and closes the connection.
+func (c *wsConn) Close() error {
+	c.sendClose(1000)
+	return c.conn.Close()
+}
+
+// sendClose sends a close frame once.
+func (c *wsConn) sendClose(code int) {
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		c.writeFrame(wsOpClose, payload)
+	})
+}
+
+// writeFrame writes a single final frame, masked for clients.
+func (c *wsConn) writeFrame(opcode int, payload []byte) error {
+	var (
+		frame = make([]byte, 0, len(payload)+14)
+		mask  [4]byte
+	)
+
+	frame = append(frame, 0x80|byte(opcode))
+
+	maskBit := byte(0)
+	if c.client {
+		maskBit = 0x80
+	}
+	switch {
+	case len(payload) < 126:
+		frame = append(frame, maskBit|byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(len(payload)))
+	}
+
+	if c.client {
+		rand.Read(mask[:])
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range payload {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err := c.conn.Write(frame)
+
+	return err
+}
+
+// readFrame reads a single frame and unmasks its payload.
+func (c *wsConn) readFrame() (bool, int, []byte, error) {
+	var (
+		header  [2]byte
+		length  uint64
+		mask    [4]byte
+		payload []byte
+		err     error
+	)
+
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, fmt.Errorf("%w: %w", ErrWebSocketClosed, err)
+	}
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrWebSocketProtocol)
+	}
+
+	length = uint64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("%w: %w", ErrWebSocketClosed, err)
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("%w: %w", ErrWebSocketClosed, err)
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if length > wsMaxMessageSize {
+		return false, 0, nil, fmt.Errorf("%w: frame larger than %d bytes", ErrWebSocketProtocol, wsMaxMessageSize)
+	}
+
+	masked := header[1]&0x80 != 0
+	if masked {
+		if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+			return false, 0, nil, fmt.Errorf("%w: %w", ErrWebSocketClosed, err)
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, fmt.Errorf("%w: %w", ErrWebSocketClosed, err)
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+
+	return header[0]&0x80 != 0, int(header[0] & 0x0F), payload, nil
+}